@@ -16,6 +16,6 @@ func main() {
 	_ = pflag.CommandLine.Set("logtostderr", "true")
 	root := cmd.NewRootCmd(loadVersion().String())
 	if err := root.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/Azure/kubelogin/pkg/internal/cache"
+	"github.com/spf13/cobra"
+)
+
+// newCacheCmd provides a cobra command for cache sub commands
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "cache",
+		Short:        "list and remove the authentication records, accounts, tokens and PoP key kubelogin caches",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return c.Help()
+		},
+	}
+
+	cmd.AddCommand(newCacheListCmd())
+	cmd.AddCommand(newCacheShowCmd())
+	cmd.AddCommand(newCachePurgeCmd())
+	cmd.AddCommand(newCacheLogoutCmd())
+
+	return cmd
+}
+
+func newCacheListCmd() *cobra.Command {
+	o := cache.New()
+
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "list the cached authentication records, accounts, tokens and PoP key",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Validate(); err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			return cache.List(ctx, o, c.OutOrStdout())
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+	}
+
+	o.AddCacheDirFlag(cmd.Flags())
+	o.AddFilterFlags(cmd.Flags(), true)
+	o.AddOutputFlag(cmd.Flags())
+	_ = cmd.MarkFlagDirname("cache-dir")
+
+	return cmd
+}
+
+func newCacheShowCmd() *cobra.Command {
+	o := cache.New()
+
+	cmd := &cobra.Command{
+		Use:          "show ID",
+		Short:        "show the details of a cache entry, without its secrets",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			return cache.Show(ctx, o, args[0], c.OutOrStdout())
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+	}
+
+	o.AddCacheDirFlag(cmd.Flags())
+	_ = cmd.MarkFlagDirname("cache-dir")
+
+	return cmd
+}
+
+func newCachePurgeCmd() *cobra.Command {
+	o := cache.New()
+
+	cmd := &cobra.Command{
+		Use:          "purge KIND",
+		Short:        "remove the cache entries of a kind: record, account, token, assertion, pop-key or all",
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			return cache.Purge(ctx, o, args[0], c.OutOrStdout())
+		},
+		ValidArgs: []string{cache.KindRecord, cache.KindAccount, cache.KindToken, cache.KindAssertion, cache.KindPoPKey, "all"},
+	}
+
+	o.AddCacheDirFlag(cmd.Flags())
+	o.AddFilterFlags(cmd.Flags(), true)
+	_ = cmd.MarkFlagDirname("cache-dir")
+
+	return cmd
+}
+
+func newCacheLogoutCmd() *cobra.Command {
+	o := cache.New()
+
+	cmd := &cobra.Command{
+		Use:          "logout",
+		Short:        "remove accounts from the token caches with their authentication records and tokens",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			return cache.Logout(ctx, o, c.OutOrStdout())
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+	}
+
+	o.AddCacheDirFlag(cmd.Flags())
+	o.AddFilterFlags(cmd.Flags(), false)
+	o.AddAllFlag(cmd.Flags())
+	_ = cmd.MarkFlagDirname("cache-dir")
+
+	return cmd
+}
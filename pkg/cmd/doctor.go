@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/Azure/kubelogin/pkg/internal/doctor"
+	"github.com/spf13/cobra"
+)
+
+// newDoctorCmd provides a cobra command for doctor sub command
+func newDoctorCmd() *cobra.Command {
+	o := doctor.New()
+
+	cmd := &cobra.Command{
+		Use:          "doctor",
+		Short:        "check the environment and kubeconfig for common kubelogin problems",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			return doctor.Run(ctx, o, c.OutOrStdout())
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+	}
+
+	o.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagDirname("cache-dir")
+
+	return cmd
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Azure/kubelogin/pkg/internal/converter"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newMigrateSecretsCmd provides a cobra command for migrate-secrets sub command
+func newMigrateSecretsCmd() *cobra.Command {
+	o := converter.New()
+
+	cmd := &cobra.Command{
+		Use:          "migrate-secrets",
+		Short:        "move plaintext secrets in kubeconfig exec args and env into the keyring",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			o.Flags = c.Flags()
+
+			pathOptions := clientcmd.NewDefaultPathOptions()
+			pathOptions.LoadingRules.ExplicitPath, _ = o.Flags.GetString("kubeconfig")
+
+			migrated, err := converter.MigrateSecrets(o, pathOptions)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(c.OutOrStdout(), "migrated %d secret(s) to the keyring\n", migrated)
+			return err
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+	}
+
+	o.AddMigrateSecretsFlags(cmd.Flags())
+
+	return cmd
+}
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"errors"
+
+	"github.com/Azure/kubelogin/pkg/internal/token"
 	"github.com/spf13/cobra"
 )
 
@@ -18,9 +21,22 @@ func NewRootCmd(version string) *cobra.Command {
 	}
 
 	cmd.AddCommand(newConvertCmd())
+	cmd.AddCommand(newMigrateSecretsCmd())
 	cmd.AddCommand(newTokenCmd())
 	cmd.AddCommand(newRemoveAuthRecordCacheCmdDeprecated())
 	cmd.AddCommand(newRemoveAuthRecordCacheCmd())
+	cmd.AddCommand(newWhoamiCmd())
+	cmd.AddCommand(newDoctorCmd())
+	cmd.AddCommand(newCacheCmd())
 
 	return cmd
 }
+
+// ExitCode returns the exit status of kubelogin for the error of the root command
+func ExitCode(err error) int {
+	var expiryErr *token.CertificateExpiryError
+	if errors.As(err, &expiryErr) {
+		return expiryErr.ExitCode()
+	}
+	return 1
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+func TestExitCode(t *testing.T) {
+	if got := ExitCode(errors.New("failed")); got != 1 {
+		t.Fatalf("expected exit status 1, got %d", got)
+	}
+
+	expiryErr := &token.CertificateExpiryError{Subject: "CN=test", NotAfter: time.Now()}
+	if got := ExitCode(fmt.Errorf("failed to get token: %w", expiryErr)); got != token.ExitCodeCertificateExpiry {
+		t.Fatalf("expected exit status %d for an expiring certificate, got %d", token.ExitCodeCertificateExpiry, got)
+	}
+}
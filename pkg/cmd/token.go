@@ -12,13 +12,28 @@ import (
 // newTokenCmd provides a cobra command for convert sub command
 func newTokenCmd() *cobra.Command {
 	o := token.NewOptions(true)
+	var printConfig bool
 
 	cmd := &cobra.Command{
 		Use:          "get-token",
 		Short:        "get AAD token",
 		SilenceUsage: true,
 		RunE: func(c *cobra.Command, args []string) error {
+			o.SetChangedFlags(c.Flags())
+			if printConfig {
+				return token.PrintConfig(c.OutOrStdout(), &o)
+			}
+
+			if err := o.UpdateFromProfile(); err != nil {
+				return err
+			}
 			o.UpdateFromEnv()
+			if err := o.UpdateFromExecInfo(); err != nil {
+				return err
+			}
+			if err := o.ResolveSecrets(); err != nil {
+				return err
+			}
 
 			ctx := context.Background()
 			ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
@@ -41,6 +56,7 @@ func newTokenCmd() *cobra.Command {
 	}
 
 	o.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&printConfig, "print-config", false, "print every resolved option with its source and the credential that would be used, then exit without getting a token. Secrets are redacted")
 	o.AddCompletions(cmd)
 
 	return cmd
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/Azure/kubelogin/pkg/internal/whoami"
+	"github.com/spf13/cobra"
+)
+
+// newWhoamiCmd provides a cobra command for whoami sub command
+func newWhoamiCmd() *cobra.Command {
+	o := whoami.New()
+
+	cmd := &cobra.Command{
+		Use:          "whoami",
+		Short:        "show the identity of the token kubelogin gets for a kubeconfig context",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Validate(); err != nil {
+				return err
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			return whoami.Run(ctx, o, c.OutOrStdout())
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+	}
+
+	o.AddFlags(cmd.Flags())
+
+	return cmd
+}
@@ -0,0 +1,283 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+// Kinds of cache entries
+const (
+	KindRecord    = "record"
+	KindAccount   = "account"
+	KindToken     = "token"
+	KindAssertion = "assertion"
+	KindPoPKey    = "pop-key"
+
+	kindAll = "all"
+
+	flagCacheDir = "cache-dir"
+	flagOutput   = "output"
+	flagTenantID = "tenant-id"
+	flagClientID = "client-id"
+	flagServerID = "server-id"
+	flagAccount  = "account"
+	flagAll      = "all"
+
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// kinds are the kinds of cache entries in the order they are listed
+var kinds = []string{KindRecord, KindAccount, KindToken, KindAssertion, KindPoPKey}
+
+// Entry is an item cached by kubelogin, described without its secrets
+type Entry struct {
+	ID        string            `json:"id"`
+	Kind      string            `json:"kind"`
+	Location  string            `json:"location"`
+	Account   string            `json:"account,omitempty"`
+	ObjectID  string            `json:"objectId,omitempty"`
+	TenantID  string            `json:"tenantId,omitempty"`
+	ClientID  string            `json:"clientId,omitempty"`
+	ServerID  string            `json:"serverId,omitempty"`
+	ExpiresOn *time.Time        `json:"expiresOn,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	// Error is why the entry could not be read. It can still be removed.
+	Error string `json:"error,omitempty"`
+
+	// remove deletes the entry from its storage
+	remove func(ctx context.Context) error
+}
+
+// Filter selects the entries of a tenant, client, server or account. An entry without the
+// value of a filter is not selected by it.
+type Filter struct {
+	TenantID string
+	ClientID string
+	ServerID string
+	// Account is the username or the object ID of the account
+	Account string
+}
+
+func (f Filter) isEmpty() bool {
+	return f == Filter{}
+}
+
+func (f Filter) matches(e Entry) bool {
+	for _, c := range [][2]string{{f.TenantID, e.TenantID}, {f.ClientID, e.ClientID}, {f.ServerID, e.ServerID}} {
+		if c[0] != "" && !strings.EqualFold(c[0], c[1]) {
+			return false
+		}
+	}
+	return f.Account == "" || strings.EqualFold(f.Account, e.Account) || strings.EqualFold(f.Account, e.ObjectID)
+}
+
+type Options struct {
+	cacheDir string
+	output   string
+	filter   Filter
+	// all selects every entry of logout
+	all bool
+
+	storage storage
+}
+
+func New() Options {
+	return Options{
+		cacheDir: token.GetDefaultCacheDir(),
+		output:   outputTable,
+		storage:  defaultStorage(),
+	}
+}
+
+func (o *Options) AddCacheDirFlag(fs *pflag.FlagSet) {
+	fs.StringVar(&o.cacheDir, flagCacheDir, o.cacheDir, "directory to cache authentication record")
+}
+
+func (o *Options) AddOutputFlag(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.output, flagOutput, "o", o.output, fmt.Sprintf("Output format. One of: %s, %s", outputTable, outputJSON))
+}
+
+// AddFilterFlags adds the flags of the filter. The server ID filter is added with withServerID.
+func (o *Options) AddFilterFlags(fs *pflag.FlagSet, withServerID bool) {
+	fs.StringVar(&o.filter.TenantID, flagTenantID, "", "Select the entries of the tenant ID")
+	fs.StringVar(&o.filter.ClientID, flagClientID, "", "Select the entries of the client ID")
+	if withServerID {
+		fs.StringVar(&o.filter.ServerID, flagServerID, "", "Select the tokens of the server ID")
+	}
+	fs.StringVar(&o.filter.Account, flagAccount, "", "Select the entries of the account, by username or object ID")
+}
+
+func (o *Options) AddAllFlag(fs *pflag.FlagSet) {
+	fs.BoolVar(&o.all, flagAll, false, "Log out of every account and remove everything kubelogin caches")
+}
+
+func (o *Options) Validate() error {
+	if o.output != outputTable && o.output != outputJSON {
+		return fmt.Errorf("unsupported output format: %q. Supported formats: %s, %s", o.output, outputTable, outputJSON)
+	}
+	return nil
+}
+
+// List writes the entries selected by the filter
+func List(ctx context.Context, o Options, w io.Writer) error {
+	var selected []Entry
+	for _, e := range o.entries(ctx) {
+		if o.filter.matches(e) {
+			selected = append(selected, e)
+		}
+	}
+	if o.output == outputJSON {
+		if selected == nil {
+			selected = []Entry{}
+		}
+		return writeJSON(w, selected)
+	}
+	return writeTable(w, selected)
+}
+
+// Show writes the details of the entry of the ID, or of the ID prefix
+func Show(ctx context.Context, o Options, id string, w io.Writer) error {
+	var found []Entry
+	for _, e := range o.entries(ctx) {
+		if strings.HasPrefix(e.ID, strings.ToLower(id)) {
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return fmt.Errorf("no cache entry with the ID %q", id)
+	case 1:
+		return writeJSON(w, found[0])
+	}
+	return fmt.Errorf("cache entry ID %q is ambiguous, it matches %d entries", id, len(found))
+}
+
+// Purge removes the entries of the kind selected by the filter
+func Purge(ctx context.Context, o Options, kind string, w io.Writer) error {
+	if kind != kindAll && !slices.Contains(kinds, kind) {
+		return fmt.Errorf("%q is not a kind of cache entry. Supported kinds are %s and %s", kind, strings.Join(kinds, ", "), kindAll)
+	}
+	if kind == KindPoPKey && !o.filter.isEmpty() {
+		return fmt.Errorf("the %s cannot be selected by a filter", KindPoPKey)
+	}
+	return o.remove(ctx, w, func(e Entry) bool {
+		return (kind == kindAll || e.Kind == kind) && o.filter.matches(e)
+	})
+}
+
+// Logout removes the accounts selected by the filter from the MSAL token caches with their
+// authentication records and cached tokens. With all, everything kubelogin caches is
+// removed, including the PoP key.
+func Logout(ctx context.Context, o Options, w io.Writer) error {
+	if o.all == !o.filter.isEmpty() {
+		return fmt.Errorf("either --%s, --%s, --%s or --%s is required", flagAccount, flagTenantID, flagClientID, flagAll)
+	}
+	if o.all {
+		err := o.remove(ctx, w, func(Entry) bool { return true })
+		return errors.Join(err, o.clearCaches(ctx, w))
+	}
+	return o.remove(ctx, w, func(e Entry) bool {
+		return (e.Kind == KindRecord || e.Kind == KindAccount || e.Kind == KindToken) && o.filter.matches(e)
+	})
+}
+
+// remove removes the entries selected by selected and writes what it removed
+func (o *Options) remove(ctx context.Context, w io.Writer, selected func(Entry) bool) error {
+	var errs []error
+	for _, e := range o.entries(ctx) {
+		if !selected(e) {
+			continue
+		}
+		if err := e.remove(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("unable to remove %s %s: %w", e.Kind, e.ID, err))
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "removed %s %s (%s)\n", e.Kind, e.ID, e.Location); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// entries returns every entry cached in the cache directory
+func (o *Options) entries(ctx context.Context) []Entry {
+	var entries []Entry
+	entries = append(entries, o.records()...)
+	entries = append(entries, o.msalEntries(ctx)...)
+	entries = append(entries, o.tokens(ctx)...)
+	entries = append(entries, o.assertions(ctx)...)
+	entries = append(entries, o.popKey(ctx)...)
+
+	for i := range entries {
+		if entries[i].Details == nil {
+			entries[i].Details = map[string]string{}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if ki, kj := slices.Index(kinds, entries[i].Kind), slices.Index(kinds, entries[j].Kind); ki != kj {
+			return ki < kj
+		}
+		if entries[i].Location != entries[j].Location {
+			return entries[i].Location < entries[j].Location
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// newEntryID identifies an entry by its kind, its location and its key in the location
+func newEntryID(kind, location, key string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(kind+"\x00"+location+"\x00"+key)))[:12]
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeTable(w io.Writer, entries []Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "ID\tKIND\tACCOUNT\tTENANT\tCLIENT\tSERVER\tEXPIRES"); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		expiresOn := ""
+		if e.ExpiresOn != nil {
+			expiresOn = e.ExpiresOn.Local().Format(time.RFC3339)
+		}
+		account := e.Account
+		if account == "" {
+			account = e.ObjectID
+		}
+		if e.Error != "" {
+			account = "(unreadable)"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Kind,
+			orNone(account), orNone(e.TenantID), orNone(e.ClientID), orNone(e.ServerID), orNone(expiresOn)); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
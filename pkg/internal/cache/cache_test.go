@@ -0,0 +1,406 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor/file"
+	msalcache "github.com/AzureAD/microsoft-authentication-library-for-go/apps/cache"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+const (
+	tenantID = "00000000-0000-0000-0000-000000000001"
+	clientID = "80faf920-1908-4b52-b5ef-a8e7bedfc67a"
+	serverID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+)
+
+// fileMSALCache is an MSAL token cache in a plain file
+type fileMSALCache struct {
+	accessor.Accessor
+}
+
+func (c fileMSALCache) Replace(ctx context.Context, u msalcache.Unmarshaler, _ msalcache.ReplaceHints) error {
+	b, err := c.Read(ctx)
+	if err != nil {
+		return err
+	}
+	return u.Unmarshal(b)
+}
+
+func (c fileMSALCache) Export(ctx context.Context, m msalcache.Marshaler, _ msalcache.ExportHints) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	return c.Write(ctx, b)
+}
+
+func (c fileMSALCache) Clear(ctx context.Context) error {
+	return c.Delete(ctx)
+}
+
+func openFileMSALCache(path string) (msalCache, error) {
+	acc, err := file.New(path)
+	if err != nil {
+		return nil, err
+	}
+	return fileMSALCache{acc}, nil
+}
+
+// newTestOptions returns options of a cache directory whose caches are kept in plain files
+func newTestOptions(t *testing.T) Options {
+	t.Helper()
+	o := New()
+	o.cacheDir = t.TempDir()
+	o.output = outputJSON
+	o.storage = storage{
+		secureStorageError: func() error { return nil },
+		fileAccessor:       func(path string) (accessor.Accessor, error) { return file.New(path) },
+		secureAccessor:     func(path string) (accessor.Accessor, error) { return file.New(path) },
+		openMSALCache:      openFileMSALCache,
+	}
+	return o
+}
+
+func TestNewCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("KUBECACHEDIR", dir)
+	assert.Equal(t, dir, New().cacheDir)
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, data, 0600))
+}
+
+func writeJSONFile(t *testing.T, path string, v any) {
+	t.Helper()
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	writeFile(t, path, b)
+}
+
+func newJWT(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("key"))
+	require.NoError(t, err)
+	return s
+}
+
+// msalCacheData returns the data of an MSAL token cache holding an account signed in with
+// the client and an access token of the account for the server
+func msalCacheData(username, objectID string, expiresOn time.Time) map[string]any {
+	homeAccountID := objectID + "." + tenantID
+	return map[string]any{
+		sectionAccount: map[string]any{
+			homeAccountID + "-login.microsoftonline.com-" + tenantID: map[string]any{
+				"home_account_id": homeAccountID,
+				"environment":     "login.microsoftonline.com",
+				"realm":           tenantID,
+				"username":        username,
+				"authority_type":  "MSSTS",
+			},
+		},
+		sectionRefreshToken: map[string]any{
+			homeAccountID + "-login.microsoftonline.com-refreshtoken-" + clientID + "--": map[string]any{
+				"home_account_id": homeAccountID,
+				"environment":     "login.microsoftonline.com",
+				"credential_type": "RefreshToken",
+				"client_id":       clientID,
+				"secret":          "refresh-token",
+			},
+		},
+		sectionAccessToken: map[string]any{
+			homeAccountID + "-login.microsoftonline.com-accesstoken-" + clientID + "-" + tenantID + "-" + serverID + "/.default": map[string]any{
+				"home_account_id": homeAccountID,
+				"environment":     "login.microsoftonline.com",
+				"realm":           tenantID,
+				"credential_type": "AccessToken",
+				"client_id":       clientID,
+				"secret":          "access-token",
+				"target":          serverID + "/.default",
+				"expires_on":      strconv.FormatInt(expiresOn.Unix(), 10),
+				"token_type":      "pop",
+			},
+		},
+	}
+}
+
+// writeTestCache writes an entry of every kind
+func writeTestCache(t *testing.T, o Options) {
+	t.Helper()
+	expiresOn := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	writeJSONFile(t, filepath.Join(o.cacheDir, token.AuthRecordDirName, "alice.json"), map[string]string{
+		"authority":     "https://login.microsoftonline.com",
+		"clientId":      clientID,
+		"homeAccountId": "alice-oid." + tenantID,
+		"tenantId":      tenantID,
+		"username":      "alice@contoso.com",
+		"version":       "1.0",
+	})
+	writeJSONFile(t, filepath.Join(o.cacheDir, token.LegacyAuthRecordFileName), map[string]string{
+		"authority":     "https://login.microsoftonline.com",
+		"clientId":      clientID,
+		"homeAccountId": "bob-oid." + tenantID,
+		"tenantId":      tenantID,
+		"username":      "bob@contoso.com",
+		"version":       "1.0",
+	})
+	writeJSONFile(t, filepath.Join(o.cacheDir, token.ExecCredentialCacheDirName, "alice.cache"), token.CachedAccessToken{
+		Token: newJWT(t, jwt.MapClaims{
+			"aud": serverID, "tid": tenantID, "appid": clientID, "oid": "alice-oid", "upn": "alice@contoso.com", "exp": expiresOn.Unix(),
+		}),
+		ExpiresOn: expiresOn,
+	})
+	writeJSONFile(t, filepath.Join(o.cacheDir, token.ManagedIdentityCacheDirName, "msi.cache"), token.CachedAccessToken{
+		Token: newJWT(t, jwt.MapClaims{
+			"aud": "https://management.azure.com", "tid": tenantID, "appid": "msi-client-id", "oid": "msi-oid", "exp": expiresOn.Unix(),
+		}),
+		ExpiresOn: expiresOn,
+	})
+	writeFile(t, filepath.Join(o.cacheDir, token.ClientAssertionCacheDirName, "assertion.cache"), []byte(newJWT(t, jwt.MapClaims{
+		"iss": "https://token.actions.githubusercontent.com", "sub": "repo:contoso/app:ref:refs/heads/main", "aud": "api://AzureADTokenExchange", "exp": expiresOn.Unix(),
+	})))
+	writeJSONFile(t, filepath.Join(o.cacheDir, token.PoPTokenCacheFileName), msalCacheData("alice@contoso.com", "alice-oid", expiresOn))
+	writeJSONFile(t, filepath.Join(o.cacheDir, token.MSALCacheFileNames[3]), msalCacheData("carol@contoso.com", "carol-oid", expiresOn))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writeFile(t, filepath.Join(o.cacheDir, token.PoPKeyFileName), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func listEntries(t *testing.T, o Options) []Entry {
+	t.Helper()
+	var out bytes.Buffer
+	require.NoError(t, List(context.Background(), o, &out))
+	var entries []Entry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entries))
+	return entries
+}
+
+// describe returns the kind and the account, or the location, of the entries
+func describe(entries []Entry) []string {
+	var s []string
+	for _, e := range entries {
+		switch {
+		case e.Account != "":
+			s = append(s, e.Kind+" "+e.Account)
+		case e.ObjectID != "":
+			s = append(s, e.Kind+" "+e.ObjectID)
+		default:
+			s = append(s, e.Kind+" "+filepath.Base(e.Location))
+		}
+	}
+	return s
+}
+
+func TestList(t *testing.T) {
+	o := newTestOptions(t)
+	writeTestCache(t, o)
+
+	entries := listEntries(t, o)
+	assert.ElementsMatch(t, []string{
+		"record alice@contoso.com",
+		"record bob@contoso.com",
+		"account alice@contoso.com",
+		"account carol@contoso.com",
+		"token alice@contoso.com",
+		"token alice@contoso.com",
+		"token carol@contoso.com",
+		"token msi-oid",
+		"assertion repo:contoso/app:ref:refs/heads/main",
+		"pop-key " + token.PoPKeyFileName,
+	}, describe(entries))
+	for _, e := range entries {
+		assert.Len(t, e.ID, 12)
+		assert.Empty(t, e.Error, e.Location)
+		switch e.Kind {
+		case KindAccount:
+			assert.Equal(t, tenantID, e.TenantID)
+			assert.Equal(t, clientID, e.ClientID)
+		case KindToken:
+			assert.NotNil(t, e.ExpiresOn)
+			if e.ObjectID != "msi-oid" {
+				assert.Equal(t, serverID, e.ServerID)
+			}
+		case KindPoPKey:
+			assert.Regexp(t, `^SHA256:[A-Za-z0-9_-]{43}$`, e.Details["fingerprint"])
+		}
+	}
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "access-token", "secrets are not listed")
+		assert.NotContains(t, string(b), "refresh-token", "secrets are not listed")
+	}
+
+	o.filter = Filter{Account: "ALICE-OID"}
+	assert.ElementsMatch(t, []string{
+		"record alice@contoso.com",
+		"account alice@contoso.com",
+		"token alice@contoso.com",
+		"token alice@contoso.com",
+	}, describe(listEntries(t, o)))
+
+	o.filter = Filter{ServerID: "https://management.azure.com"}
+	assert.Equal(t, []string{"token msi-oid"}, describe(listEntries(t, o)))
+
+	o.output = outputTable
+	o.filter = Filter{}
+	var out bytes.Buffer
+	require.NoError(t, List(context.Background(), o, &out))
+	assert.Contains(t, out.String(), "ID  ")
+	assert.Contains(t, out.String(), "alice@contoso.com")
+}
+
+func TestShow(t *testing.T) {
+	o := newTestOptions(t)
+	writeTestCache(t, o)
+	o.filter = Filter{Account: "bob@contoso.com"}
+	record := listEntries(t, o)[0]
+
+	var out bytes.Buffer
+	require.NoError(t, Show(context.Background(), o, record.ID[:6], &out))
+	var shown Entry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &shown))
+	assert.Equal(t, record, shown)
+	assert.Equal(t, "bob-oid."+tenantID, shown.Details["homeAccountId"])
+
+	assert.EqualError(t, Show(context.Background(), o, "missing", &out), `no cache entry with the ID "missing"`)
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("tokens of a server", func(t *testing.T) {
+		o := newTestOptions(t)
+		writeTestCache(t, o)
+		o.filter = Filter{ServerID: serverID}
+		var out bytes.Buffer
+		require.NoError(t, Purge(ctx, o, KindToken, &out))
+		assert.Contains(t, out.String(), "removed token ")
+
+		o.filter = Filter{}
+		assert.ElementsMatch(t, []string{
+			"record alice@contoso.com",
+			"record bob@contoso.com",
+			"account alice@contoso.com",
+			"account carol@contoso.com",
+			"token msi-oid",
+			"assertion repo:contoso/app:ref:refs/heads/main",
+			"pop-key " + token.PoPKeyFileName,
+		}, describe(listEntries(t, o)))
+		assert.NoFileExists(t, filepath.Join(o.cacheDir, token.ExecCredentialCacheDirName, "alice.cache"))
+	})
+
+	t.Run("PoP key", func(t *testing.T) {
+		o := newTestOptions(t)
+		writeTestCache(t, o)
+		require.NoError(t, Purge(ctx, o, KindPoPKey, &bytes.Buffer{}))
+		assert.NoFileExists(t, filepath.Join(o.cacheDir, token.PoPKeyFileName))
+
+		o.filter = Filter{TenantID: tenantID}
+		assert.EqualError(t, Purge(ctx, o, KindPoPKey, &bytes.Buffer{}), "the pop-key cannot be selected by a filter")
+	})
+
+	t.Run("unsupported kind", func(t *testing.T) {
+		o := newTestOptions(t)
+		assert.ErrorContains(t, Purge(ctx, o, "tokens", &bytes.Buffer{}), `"tokens" is not a kind of cache entry`)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("an account", func(t *testing.T) {
+		o := newTestOptions(t)
+		writeTestCache(t, o)
+		aliceRecord := filepath.Join(o.cacheDir, token.AuthRecordDirName, "alice.json")
+		writeFile(t, aliceRecord+token.LegacyPersistentCacheSuffix, nil)
+		o.filter = Filter{Account: "alice@contoso.com"}
+		require.NoError(t, Logout(ctx, o, &bytes.Buffer{}))
+		assert.NoFileExists(t, aliceRecord+token.LegacyPersistentCacheSuffix, "the migration marker goes with the record")
+
+		o.filter = Filter{}
+		assert.ElementsMatch(t, []string{
+			"record bob@contoso.com",
+			"account carol@contoso.com",
+			"token carol@contoso.com",
+			"token msi-oid",
+			"assertion repo:contoso/app:ref:refs/heads/main",
+			"pop-key " + token.PoPKeyFileName,
+		}, describe(listEntries(t, o)))
+
+		// the other items of the MSAL token cache are kept
+		var data contract
+		b, err := os.ReadFile(filepath.Join(o.cacheDir, token.PoPTokenCacheFileName))
+		require.NoError(t, err)
+		require.NoError(t, data.Unmarshal(b))
+		assert.Empty(t, data[sectionAccount])
+		assert.Empty(t, data[sectionRefreshToken])
+	})
+
+	t.Run("everything", func(t *testing.T) {
+		o := newTestOptions(t)
+		writeTestCache(t, o)
+		o.all = true
+		require.NoError(t, Logout(ctx, o, &bytes.Buffer{}))
+
+		assert.Empty(t, listEntries(t, o))
+		assert.NoFileExists(t, filepath.Join(o.cacheDir, token.PoPTokenCacheFileName))
+		assert.NoFileExists(t, filepath.Join(o.cacheDir, token.PoPKeyFileName))
+		assert.NoFileExists(t, filepath.Join(o.cacheDir, token.MSALCacheFileNames[3]))
+	})
+
+	t.Run("everything without secure storage", func(t *testing.T) {
+		o := newTestOptions(t)
+		o.storage.secureStorageError = func() error { return errors.New("no keyring") }
+		writeFile(t, filepath.Join(o.cacheDir, token.PoPKeyFileName), []byte("encrypted key"))
+		writeFile(t, filepath.Join(o.cacheDir, token.PoPTokenCacheFileName), []byte("encrypted tokens"))
+
+		entries := listEntries(t, o)
+		require.Len(t, entries, 1)
+		assert.Equal(t, KindPoPKey, entries[0].Kind)
+		assert.Equal(t, "encrypted file", entries[0].Details["storage"])
+
+		o.all = true
+		require.NoError(t, Logout(ctx, o, &bytes.Buffer{}))
+		assert.Empty(t, listEntries(t, o))
+		assert.NoFileExists(t, filepath.Join(o.cacheDir, token.PoPKeyFileName))
+		assert.NoFileExists(t, filepath.Join(o.cacheDir, token.PoPTokenCacheFileName))
+	})
+
+	t.Run("account or all is required", func(t *testing.T) {
+		o := newTestOptions(t)
+		assert.EqualError(t, Logout(ctx, o, &bytes.Buffer{}), "either --account, --tenant-id, --client-id or --all is required")
+		o.all = true
+		o.filter = Filter{Account: "alice@contoso.com"}
+		assert.Error(t, Logout(ctx, o, &bytes.Buffer{}))
+	})
+}
+
+func TestValidate(t *testing.T) {
+	o := New()
+	assert.NoError(t, o.Validate())
+	o.output = "yaml"
+	assert.EqualError(t, o.Validate(), `unsupported output format: "yaml". Supported formats: table, json`)
+}
@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/golang-jwt/jwt/v4"
+	klog "k8s.io/klog/v2"
+
+	"github.com/Azure/kubelogin/pkg/internal/pop"
+	"github.com/Azure/kubelogin/pkg/internal/token"
+	"github.com/Azure/kubelogin/pkg/internal/whoami"
+)
+
+// records returns the authentication records of the accounts signed in with
+func (o *Options) records() []Entry {
+	files, _ := filepath.Glob(filepath.Join(o.cacheDir, token.AuthRecordDirName, "*.json"))
+	if _, err := os.Stat(filepath.Join(o.cacheDir, token.LegacyAuthRecordFileName)); err == nil {
+		files = append(files, filepath.Join(o.cacheDir, token.LegacyAuthRecordFileName))
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		e := Entry{
+			ID:       newEntryID(KindRecord, file, ""),
+			Kind:     KindRecord,
+			Location: file,
+			remove: func(context.Context) error {
+				// the marker of a record migrated from auth.json goes with the record
+				if err := os.Remove(file + token.LegacyPersistentCacheSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+				return os.Remove(file)
+			},
+		}
+		var record azidentity.AuthenticationRecord
+		b, err := os.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(b, &record)
+		}
+		if err != nil {
+			e.Error = err.Error()
+		} else {
+			e.Account = record.Username
+			e.ObjectID = objectIDOf(record.HomeAccountID)
+			e.TenantID = record.TenantID
+			e.ClientID = record.ClientID
+			e.Details = map[string]string{
+				"authority":     record.Authority,
+				"homeAccountId": record.HomeAccountID,
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// tokens returns the access tokens cached across get-token invocations, described by
+// their claims
+func (o *Options) tokens(ctx context.Context) []Entry {
+	var entries []Entry
+	for _, dir := range []string{token.ExecCredentialCacheDirName, token.ManagedIdentityCacheDirName} {
+		files, _ := filepath.Glob(filepath.Join(o.cacheDir, dir, "*.cache"))
+		for _, file := range files {
+			e := o.fileEntry(ctx, KindToken, file, func(e *Entry, b []byte) error {
+				var cached token.CachedAccessToken
+				if err := json.Unmarshal(b, &cached); err != nil {
+					return err
+				}
+				identity, err := whoami.ParseIdentity(cached.Token)
+				if err != nil {
+					return err
+				}
+				e.Account = identity.UserPrincipalName
+				e.ObjectID = identity.ObjectID
+				e.TenantID = identity.TenantID
+				e.ClientID = identity.AppID
+				if len(identity.Audience) > 0 {
+					e.ServerID = identity.Audience[0]
+				}
+				e.ExpiresOn = &cached.ExpiresOn
+				e.Details = map[string]string{"tokenType": identity.TokenType}
+				if dir == token.ManagedIdentityCacheDirName {
+					e.Details["source"] = "managed identity"
+				}
+				return nil
+			})
+			if e != nil {
+				entries = append(entries, *e)
+			}
+		}
+	}
+	return entries
+}
+
+// assertions returns the client assertions cached across get-token invocations
+func (o *Options) assertions(ctx context.Context) []Entry {
+	var entries []Entry
+	files, _ := filepath.Glob(filepath.Join(o.cacheDir, token.ClientAssertionCacheDirName, "*.cache"))
+	for _, file := range files {
+		e := o.fileEntry(ctx, KindAssertion, file, func(e *Entry, b []byte) error {
+			claims := &jwt.RegisteredClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(string(b), claims); err != nil {
+				return err
+			}
+			e.Account = claims.Subject
+			if claims.ExpiresAt != nil {
+				e.ExpiresOn = &claims.ExpiresAt.Time
+			}
+			e.Details = map[string]string{
+				"issuer":   claims.Issuer,
+				"audience": strings.Join(claims.Audience, " "),
+			}
+			return nil
+		})
+		if e != nil {
+			entries = append(entries, *e)
+		}
+	}
+	return entries
+}
+
+// fileEntry reads the cache file with the file accessor and describes it with describe. It
+// returns nil when the file holds no data.
+func (o *Options) fileEntry(ctx context.Context, kind, file string, describe func(e *Entry, b []byte) error) *Entry {
+	e := &Entry{ID: newEntryID(kind, file, ""), Kind: kind, Location: file}
+	acc, err := o.storage.fileAccessor(file)
+	if err != nil {
+		e.Error = err.Error()
+		e.remove = func(context.Context) error { return os.Remove(file) }
+		return e
+	}
+	e.remove = acc.Delete
+
+	b, err := acc.Read(ctx)
+	switch {
+	case err != nil:
+		e.Error = err.Error()
+	case len(b) == 0:
+		// the data of the file can't be decrypted anymore, e.g. after a reboot on Linux
+		e.Error = "no data"
+	default:
+		if err := describe(e, b); err != nil {
+			e.Error = err.Error()
+		}
+	}
+	return e
+}
+
+// popKey returns the persistent PoP key, described by its fingerprint. Without secure
+// storage, the key kept in a file encrypted with the PoP cache key can't be described.
+func (o *Options) popKey(ctx context.Context) []Entry {
+	path := filepath.Join(o.cacheDir, token.PoPKeyFileName)
+	if err := o.storage.secureStorageError(); err != nil {
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+		return []Entry{{
+			ID:       newEntryID(KindPoPKey, path, ""),
+			Kind:     KindPoPKey,
+			Location: path,
+			Details:  map[string]string{"storage": "encrypted file"},
+			remove: func(context.Context) error {
+				return os.Remove(path)
+			},
+		}}
+	}
+	acc, err := o.storage.secureAccessor(path)
+	if err != nil {
+		klog.V(5).Infof("unable to open the PoP key: %s", err)
+		return nil
+	}
+	b, err := acc.Read(ctx)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	e := Entry{
+		ID:       newEntryID(KindPoPKey, path, ""),
+		Kind:     KindPoPKey,
+		Location: path,
+		remove:   acc.Delete,
+	}
+	if key, err := pop.ParsePersistedPoPKey(b); err != nil {
+		e.Error = err.Error()
+	} else {
+		e.Details = map[string]string{
+			"algorithm":   key.Alg(),
+			"fingerprint": fmt.Sprintf("SHA256:%s", key.JWKThumbprint()),
+		}
+	}
+	return []Entry{e}
+}
+
+// objectIDOf returns the object ID of a home account ID, <object ID>.<tenant ID>
+func objectIDOf(homeAccountID string) string {
+	objectID, _, _ := strings.Cut(homeAccountID, ".")
+	return objectID
+}
@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	msalcache "github.com/AzureAD/microsoft-authentication-library-for-go/apps/cache"
+	klog "k8s.io/klog/v2"
+)
+
+// Sections of the MSAL token cache
+const (
+	sectionAccount      = "Account"
+	sectionAccessToken  = "AccessToken"
+	sectionRefreshToken = "RefreshToken"
+	sectionIDToken      = "IdToken"
+)
+
+// contract is the data of an MSAL token cache. Its items are kept as JSON, so that the
+// fields kubelogin does not know are written back as they were.
+type contract map[string]map[string]json.RawMessage
+
+// msalItem holds the fields of the items of an MSAL token cache kubelogin describes them with
+type msalItem struct {
+	HomeAccountID string `json:"home_account_id"`
+	Environment   string `json:"environment"`
+	Realm         string `json:"realm"`
+	ClientID      string `json:"client_id"`
+	Target        string `json:"target"`
+	ExpiresOn     string `json:"expires_on"`
+	TokenType     string `json:"token_type"`
+	Username      string `json:"username"`
+	AuthorityType string `json:"authority_type"`
+}
+
+func (c *contract) Unmarshal(b []byte) error {
+	*c = contract{}
+	if len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, c)
+}
+
+func (c *contract) Marshal() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// items returns the items of the section by their keys
+func (c contract) items(section string) map[string]msalItem {
+	items := map[string]msalItem{}
+	for key, raw := range c[section] {
+		var item msalItem
+		if err := json.Unmarshal(raw, &item); err == nil {
+			items[key] = item
+		}
+	}
+	return items
+}
+
+// removeAccount removes the account and its tokens like MSAL does on RemoveAccount
+func (c contract) removeAccount(homeAccountID, environment string) {
+	for _, section := range []string{sectionAccount, sectionAccessToken, sectionRefreshToken, sectionIDToken} {
+		for key, item := range c.items(section) {
+			if item.HomeAccountID == homeAccountID && item.Environment == environment {
+				delete(c[section], key)
+			}
+		}
+	}
+}
+
+// updateMSALCache applies update to the data of the cache and writes it back
+func updateMSALCache(ctx context.Context, c msalCache, update func(contract)) error {
+	var data contract
+	if err := c.Replace(ctx, &data, msalcache.ReplaceHints{}); err != nil {
+		return err
+	}
+	update(data)
+	return c.Export(ctx, &data, msalcache.ExportHints{})
+}
+
+// msalEntries returns the accounts and the access tokens of the MSAL token caches of kubelogin
+func (o *Options) msalEntries(ctx context.Context) []Entry {
+	var entries []Entry
+	for _, path := range o.msalCacheFiles() {
+		entries = append(entries, o.msalCacheEntries(ctx, path)...)
+	}
+	return entries
+}
+
+func (o *Options) msalCacheEntries(ctx context.Context, path string) []Entry {
+	c, err := o.storage.openMSALCache(path)
+	if err != nil {
+		klog.V(5).Infof("unable to open the token cache %s: %s", path, err)
+		return nil
+	}
+	var data contract
+	if err := c.Replace(ctx, &data, msalcache.ReplaceHints{}); err != nil {
+		klog.V(5).Infof("unable to read the token cache %s: %s", path, err)
+		return nil
+	}
+
+	var entries []Entry
+	accounts := data.items(sectionAccount)
+	refreshTokens := data.items(sectionRefreshToken)
+	for key, account := range accounts {
+		e := Entry{
+			ID:       newEntryID(KindAccount, path, key),
+			Kind:     KindAccount,
+			Location: path,
+			Account:  account.Username,
+			ObjectID: objectIDOf(account.HomeAccountID),
+			TenantID: account.Realm,
+			Details: map[string]string{
+				"homeAccountId": account.HomeAccountID,
+				"environment":   account.Environment,
+				"authorityType": account.AuthorityType,
+			},
+			remove: func(ctx context.Context) error {
+				return updateMSALCache(ctx, c, func(data contract) {
+					data.removeAccount(account.HomeAccountID, account.Environment)
+				})
+			},
+		}
+		for _, rt := range refreshTokens {
+			if rt.HomeAccountID == account.HomeAccountID && rt.Environment == account.Environment {
+				e.ClientID = rt.ClientID
+				break
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	for key, at := range data.items(sectionAccessToken) {
+		e := Entry{
+			ID:       newEntryID(KindToken, path, key),
+			Kind:     KindToken,
+			Location: path,
+			ObjectID: objectIDOf(at.HomeAccountID),
+			TenantID: at.Realm,
+			ClientID: at.ClientID,
+			ServerID: serverIDOf(at.Target),
+			Details: map[string]string{
+				"tokenType": at.TokenType,
+				"scopes":    at.Target,
+			},
+			remove: func(ctx context.Context) error {
+				return updateMSALCache(ctx, c, func(data contract) {
+					delete(data[sectionAccessToken], key)
+				})
+			},
+		}
+		for _, account := range accounts {
+			if account.HomeAccountID == at.HomeAccountID && account.Environment == at.Environment {
+				e.Account = account.Username
+			}
+		}
+		if sec, err := strconv.ParseInt(at.ExpiresOn, 10, 64); err == nil {
+			expiresOn := time.Unix(sec, 0)
+			e.ExpiresOn = &expiresOn
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// serverIDOf returns the server ID of the scopes of an access token, <server ID>/.default
+func serverIDOf(target string) string {
+	for _, scope := range strings.Fields(target) {
+		switch strings.ToLower(scope) {
+		case "openid", "profile", "offline_access":
+			continue
+		}
+		return strings.TrimSuffix(scope, "/.default")
+	}
+	return ""
+}
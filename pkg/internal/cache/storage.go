@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor/file"
+	msalcache "github.com/AzureAD/microsoft-authentication-library-for-go/apps/cache"
+
+	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+// msalCache is an MSAL token cache that can be deleted, such as popcache.Cache
+type msalCache interface {
+	msalcache.ExportReplace
+	Clear(ctx context.Context) error
+}
+
+// storage opens the storages kubelogin caches in. Tests replace it with plain files.
+type storage struct {
+	// secureStorageError reports why platform-specific secure storage is unavailable, in
+	// which case kubelogin keeps no MSAL token cache or PoP key in the cache directory
+	secureStorageError func() error
+	// fileAccessor opens a token or client assertion cache file of get-token, encrypted
+	// with platform-specific secure storage when it is available
+	fileAccessor func(path string) (accessor.Accessor, error)
+	// secureAccessor opens data only kept in platform-specific secure storage
+	secureAccessor func(path string) (accessor.Accessor, error)
+	// openMSALCache opens an MSAL token cache of kubelogin in the cache directory
+	openMSALCache func(path string) (msalCache, error)
+}
+
+func defaultStorage() storage {
+	return storage{
+		fileAccessor: func(path string) (accessor.Accessor, error) {
+			if popcache.StorageError() == nil {
+				return popcache.NewSecureAccessor(path)
+			}
+			return file.New(path)
+		},
+		secureStorageError: popcache.StorageError,
+		secureAccessor:     popcache.NewSecureAccessor,
+		openMSALCache: func(path string) (msalCache, error) {
+			return popcache.NewNamedCache(filepath.Dir(path), filepath.Base(path))
+		},
+	}
+}
+
+// msalCacheFiles returns the paths of the MSAL token caches of kubelogin in the cache directory
+func (o *Options) msalCacheFiles() []string {
+	if err := o.storage.secureStorageError(); err != nil {
+		return nil
+	}
+	var paths []string
+	for _, name := range token.MSALCacheFileNames {
+		paths = append(paths, filepath.Join(o.cacheDir, name))
+	}
+	return paths
+}
+
+// clearCaches deletes the MSAL token caches of kubelogin, including the ones no account
+// or token was found in
+func (o *Options) clearCaches(ctx context.Context, w io.Writer) error {
+	var errs []error
+	if o.storage.secureStorageError() != nil {
+		// without secure storage, PoP tokens may be cached in a file encrypted with the PoP cache key
+		path := filepath.Join(o.cacheDir, token.PoPTokenCacheFileName)
+		if err := os.Remove(path); err == nil {
+			if _, err := fmt.Fprintf(w, "removed the token cache %s\n", path); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("unable to clear the token cache %s: %w", path, err))
+		}
+	}
+	for _, path := range o.msalCacheFiles() {
+		c, err := o.storage.openMSALCache(path)
+		if err == nil {
+			err = c.Clear(ctx)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to clear the token cache %s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,9 +1,14 @@
 package converter
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 	klog "k8s.io/klog/v2"
@@ -24,14 +29,21 @@ const (
 	argTenantID                          = "--tenant-id"
 	argSubscriptionID                    = "--subscription"
 	argEnvironment                       = "--environment"
+	argEnvironmentFile                   = "--environment-file"
+	argEnvironmentMetadataURL            = "--environment-metadata-url"
 	argClientSecret                      = "--client-secret"
 	argClientCert                        = "--client-certificate"
 	argClientCertPassword                = "--client-certificate-password"
+	argClientCertExpiryDays              = "--client-certificate-expiry-days"
+	argClientCertExpiryStrict            = "--client-certificate-expiry-strict"
 	argIsLegacy                          = "--legacy"
 	argUsername                          = "--username"
 	argPassword                          = "--password"
 	argLoginMethod                       = "--login"
+	argIdentityClientID                  = "--identity-client-id"
+	argIdentityObjectID                  = "--identity-object-id"
 	argIdentityResourceID                = "--identity-resource-id"
+	argIdentityEndpoint                  = "--identity-endpoint"
 	argAuthorityHost                     = "--authority-host"
 	argFederatedTokenFile                = "--federated-token-file"
 	argTokenCacheDir                     = "--token-cache-dir"
@@ -39,9 +51,19 @@ const (
 	argIsPoPTokenEnabled                 = "--pop-enabled"
 	argPoPTokenClaims                    = "--pop-claims"
 	argDisableEnvironmentOverride        = "--disable-environment-override"
+	argFlagsOverrideEnvironment          = "--flags-override-environment"
+	argProfile                           = "--profile"
+	argLoginChain                        = "--login-chain"
+	argEnableCAE                         = "--enable-cae"
 	argRedirectURL                       = "--redirect-url"
 	argLoginHint                         = "--login-hint"
+	argBrowserCommand                    = "--browser-command"
+	argInteractiveFallback               = "--interactive-fallback"
+	argDeviceCodeQR                      = "--device-code-qr"
 	argAzurePipelinesServiceConnectionID = "--azure-pipelines-service-connection-id"
+	argClientAssertionCommand            = "--client-assertion-command"
+	argClientAssertionFile               = "--client-assertion-file"
+	argClientAssertionAudience           = "--client-assertion-audience"
 
 	flagAzureConfigDir                    = "azure-config-dir"
 	flagClientID                          = "client-id"
@@ -50,14 +72,21 @@ const (
 	flagTenantID                          = "tenant-id"
 	flagSubscriptionID                    = "subscription"
 	flagEnvironment                       = "environment"
+	flagEnvironmentFile                   = "environment-file"
+	flagEnvironmentMetadataURL            = "environment-metadata-url"
 	flagClientSecret                      = "client-secret"
 	flagClientCert                        = "client-certificate"
 	flagClientCertPassword                = "client-certificate-password"
+	flagClientCertExpiryDays              = "client-certificate-expiry-days"
+	flagClientCertExpiryStrict            = "client-certificate-expiry-strict"
 	flagIsLegacy                          = "legacy"
 	flagUsername                          = "username"
 	flagPassword                          = "password"
 	flagLoginMethod                       = "login"
+	flagIdentityClientID                  = "identity-client-id"
+	flagIdentityObjectID                  = "identity-object-id"
 	flagIdentityResourceID                = "identity-resource-id"
+	flagIdentityEndpoint                  = "identity-endpoint"
 	flagAuthorityHost                     = "authority-host"
 	flagFederatedTokenFile                = "federated-token-file"
 	flagTokenCacheDir                     = "token-cache-dir"
@@ -65,9 +94,22 @@ const (
 	flagIsPoPTokenEnabled                 = "pop-enabled"
 	flagPoPTokenClaims                    = "pop-claims"
 	flagDisableEnvironmentOverride        = "disable-environment-override"
+	flagFlagsOverrideEnvironment          = "flags-override-environment"
+	flagProfile                           = "profile"
+	flagLoginChain                        = "login-chain"
+	flagEnableCAE                         = "enable-cae"
 	flagRedirectURL                       = "redirect-url"
 	flagLoginHint                         = "login-hint"
+	flagBrowserCommand                    = "browser-command"
+	flagInteractiveFallback               = "interactive-fallback"
+	flagDeviceCodeQR                      = "device-code-qr"
 	flagAzurePipelinesServiceConnectionID = "azure-pipelines-service-connection-id"
+	flagClientAssertionCommand            = "client-assertion-command"
+	flagClientAssertionFile               = "client-assertion-file"
+	flagClientAssertionAudience           = "client-assertion-audience"
+	flagProvideClusterInfo                = "provide-cluster-info"
+	flagPlaintextSecrets                  = "plaintext-secrets"
+	flagVolatileKeyring                   = "volatile-keyring"
 
 	execName        = "kubelogin"
 	getTokenCommand = "get-token"
@@ -81,7 +123,7 @@ To learn more, please go to https://azure.github.io/kubelogin/
 	azureConfigDir = "AZURE_CONFIG_DIR"
 )
 
-func getArgValues(o Options, authInfo *api.AuthInfo) (
+func getArgValues(o Options, authInfo *api.AuthInfo, clusterConfig *token.ExecClusterConfig) (
 	argServerIDVal,
 	argClientIDVal,
 	argEnvironmentVal,
@@ -111,6 +153,8 @@ func getArgValues(o Options, authInfo *api.AuthInfo) (
 
 	if o.isSet(flagTenantID) {
 		argTenantIDVal = o.TokenOptions.TenantID
+	} else if clusterConfig != nil && clusterConfig.TenantID != "" {
+		argTenantIDVal = clusterConfig.TenantID
 	} else if isLegacyAuthProvider {
 		if x, ok := authInfo.AuthProvider.Config[cfgTenantID]; ok {
 			argTenantIDVal = x
@@ -131,6 +175,8 @@ func getArgValues(o Options, authInfo *api.AuthInfo) (
 
 	if o.isSet(flagServerID) {
 		argServerIDVal = o.TokenOptions.ServerID
+	} else if clusterConfig != nil && clusterConfig.ServerID != "" {
+		argServerIDVal = clusterConfig.ServerID
 	} else if isLegacyAuthProvider {
 		if x, ok := authInfo.AuthProvider.Config[cfgApiserverID]; ok {
 			argServerIDVal = x
@@ -163,6 +209,8 @@ func getArgValues(o Options, authInfo *api.AuthInfo) (
 
 	if o.isSet(flagIsPoPTokenEnabled) {
 		argIsPoPTokenEnabledVal = o.TokenOptions.IsPoPTokenEnabled
+	} else if clusterConfig != nil && clusterConfig.PoPTokenClaims != "" {
+		argIsPoPTokenEnabledVal = true
 	} else {
 		if found := getExecBoolArg(authInfo, argIsPoPTokenEnabled); found {
 			argIsPoPTokenEnabledVal = true
@@ -171,6 +219,8 @@ func getArgValues(o Options, authInfo *api.AuthInfo) (
 
 	if o.isSet(flagPoPTokenClaims) {
 		argPoPTokenClaimsVal = o.TokenOptions.PoPTokenClaims
+	} else if clusterConfig != nil && clusterConfig.PoPTokenClaims != "" {
+		argPoPTokenClaimsVal = clusterConfig.PoPTokenClaims
 	} else {
 		argPoPTokenClaimsVal = getExecArg(authInfo, argPoPTokenClaims)
 	}
@@ -256,246 +306,658 @@ func Convert(o Options, pathOptions *clientcmd.PathOptions) error {
 
 		klog.V(5).Info("converting...")
 
-		argServerIDVal,
-			argClientIDVal,
-			argEnvironmentVal,
-			argTenantIDVal,
-			argAuthRecordCacheDirVal,
-			argPoPTokenClaimsVal,
-			argRedirectURLVal,
-			argLoginHintVal,
-			isLegacyConfigMode,
-			isPoPTokenEnabled := getArgValues(o, authInfo)
-		exec := &api.ExecConfig{
-			Command: execName,
-			Args: []string{
-				getTokenCommand,
-			},
-			APIVersion:  execAPIVersion,
-			InstallHint: execInstallHint,
-		}
-
-		// Preserve any existing install hint
-		if authInfo.Exec != nil && authInfo.Exec.InstallHint != "" {
-			exec.InstallHint = authInfo.Exec.InstallHint
-		}
+		clusterNames := getClusterNames(config, name, o.context)
 
-		exec.Args = append(exec.Args, argLoginMethod, o.TokenOptions.LoginMethod)
+		// the args hold the settings of a single cluster, so a user shared by several clusters
+		// keeps reading their settings from the cluster extensions
+		keepClusterInfo := authInfo.Exec != nil && authInfo.Exec.ProvideClusterInfo && len(getClusterNames(config, name, "")) > 1
 
-		// all login methods require --server-id specified
-		if argServerIDVal == "" {
-			return fmt.Errorf("%s is required", argServerID)
+		if (!o.provideClusterInfo && !keepClusterInfo) || len(clusterNames) == 0 {
+			var clusterConfig *token.ExecClusterConfig
+			if len(clusterNames) > 0 && authInfo.Exec != nil && authInfo.Exec.ProvideClusterInfo {
+				// the existing exec plugin reads per-cluster settings from the cluster extension
+				if clusterConfig, err = token.GetExecClusterConfig(config.Clusters[clusterNames[0]]); err != nil {
+					return err
+				}
+			}
+			exec, err := newExecConfig(o, authInfo, clusterConfig)
+			if err != nil {
+				return err
+			}
+			authInfo.Exec = exec
+			authInfo.AuthProvider = nil
+			continue
 		}
-		exec.Args = append(exec.Args, argServerID, argServerIDVal)
 
-		if argAuthRecordCacheDirVal != "" {
-			exec.Args = append(exec.Args, argAuthRecordCacheDir, argAuthRecordCacheDirVal)
+		// the settings removed from the exec args of a user shared with other contexts would be
+		// lost for their clusters, unless they were already moved into their extensions
+		if o.context != "" && (authInfo.Exec == nil || !authInfo.Exec.ProvideClusterInfo) {
+			if shared := getClusterNames(config, name, ""); len(shared) > len(clusterNames) {
+				return fmt.Errorf("user %q of context %q is shared with the clusters %s of other contexts. Convert it without --%s to move the settings of every cluster into its extension",
+					name, o.context, strings.Join(slices.DeleteFunc(shared, func(c string) bool { return slices.Contains(clusterNames, c) }), ", "), flagContext)
+			}
 		}
 
-		switch o.TokenOptions.LoginMethod {
-		case token.AzureDeveloperCLILogin:
-			if o.isSet(flagTenantID) {
-				exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
+		// move the per-cluster settings into the extension of every cluster using this user
+		var exec *api.ExecConfig
+		for _, clusterName := range clusterNames {
+			cluster := config.Clusters[clusterName]
+			var clusterConfig *token.ExecClusterConfig
+			if authInfo.Exec != nil && authInfo.Exec.ProvideClusterInfo {
+				if clusterConfig, err = token.GetExecClusterConfig(cluster); err != nil {
+					return err
+				}
+			}
+			clusterExec, err := newExecConfig(o, authInfo, clusterConfig)
+			if err != nil {
+				return err
+			}
+			if err := setExecClusterConfig(cluster, moveClusterArgs(clusterExec)); err != nil {
+				return err
 			}
+			exec = clusterExec
+		}
+		exec.ProvideClusterInfo = true
+		authInfo.Exec = exec
+		authInfo.AuthProvider = nil
+	}
+	err = clientcmd.ModifyConfig(pathOptions, config, true)
+	return err
+}
 
-		case token.AzureCLILogin:
+// newExecConfig builds the kubelogin exec plugin config for the auth info.
+// clusterConfig holds the settings of an existing cluster extension, if any.
+func newExecConfig(o Options, authInfo *api.AuthInfo, clusterConfig *token.ExecClusterConfig) (*api.ExecConfig, error) {
+	var err error
+	argServerIDVal,
+		argClientIDVal,
+		argEnvironmentVal,
+		argTenantIDVal,
+		argAuthRecordCacheDirVal,
+		argPoPTokenClaimsVal,
+		argRedirectURLVal,
+		argLoginHintVal,
+		isLegacyConfigMode,
+		isPoPTokenEnabled := getArgValues(o, authInfo, clusterConfig)
+	if o.isSet(flagProfile) {
+		return newProfileExecConfig(o, authInfo, argServerIDVal)
+	}
 
-			if o.azureConfigDir != "" {
-				exec.Env = append(exec.Env, api.ExecEnvVar{Name: azureConfigDir, Value: o.azureConfigDir})
-			}
+	loginChain := getLoginChain(o, authInfo)
+	exec := &api.ExecConfig{
+		Command: execName,
+		Args: []string{
+			getTokenCommand,
+		},
+		APIVersion:      execAPIVersion,
+		InstallHint:     execInstallHint,
+		InteractiveMode: getInteractiveMode(o.TokenOptions.LoginMethod, loginChain),
+	}
 
-			// when convert to azurecli login, tenantID from the input kubeconfig will be disregarded and
-			// will have to come from explicit flag `--tenant-id`.
-			// this is because azure cli logged in using MSI does not allow specifying tenant ID
-			// see https://github.com/Azure/kubelogin/issues/123#issuecomment-1209652342
-			if o.isSet(flagTenantID) {
-				exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
-			}
-			if o.isSet(flagSubscriptionID) {
-				exec.Args = append(exec.Args, argSubscriptionID, o.TokenOptions.SubscriptionID)
-			}
+	// Preserve any existing install hint
+	if authInfo.Exec != nil && authInfo.Exec.InstallHint != "" {
+		exec.InstallHint = authInfo.Exec.InstallHint
+	}
 
-		case token.DeviceCodeLogin:
+	exec.Args = append(exec.Args, argLoginMethod, o.TokenOptions.LoginMethod)
 
-			if argClientIDVal == "" {
-				return fmt.Errorf("%s is required", argClientID)
-			}
+	// all login methods require --server-id specified
+	if argServerIDVal == "" {
+		return nil, fmt.Errorf("%s is required", argServerID)
+	}
+	exec.Args = append(exec.Args, argServerID, argServerIDVal)
 
-			exec.Args = append(exec.Args, argClientID, argClientIDVal)
+	if argAuthRecordCacheDirVal != "" {
+		exec.Args = append(exec.Args, argAuthRecordCacheDir, argAuthRecordCacheDirVal)
+	}
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+	switch o.TokenOptions.LoginMethod {
+	case token.AutoLogin:
+		// the client id usually differs between the login methods of the chain,
+		// so it is only kept when set explicitly
+		if o.isSet(flagClientID) {
+			exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
+		}
 
+		if argTenantIDVal != "" {
 			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+		}
 
-			if argEnvironmentVal != "" {
-				// environment is optional
-				exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
-			}
+		exec.Args = appendEnvironmentArgs(o, authInfo, exec.Args, argEnvironmentVal)
 
-			if isLegacyConfigMode {
-				exec.Args = append(exec.Args, argIsLegacy)
-			}
+		if len(loginChain) > 0 {
+			exec.Args = append(exec.Args, argLoginChain, strings.Join(loginChain, ","))
+		}
 
-		case token.InteractiveLogin:
+	case token.AzureDeveloperCLILogin:
+		if o.isSet(flagTenantID) {
+			exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
+		}
 
-			if argClientIDVal == "" {
-				return fmt.Errorf("%s is required", argClientID)
-			}
+	case token.AzureCLILogin:
 
-			exec.Args = append(exec.Args, argClientID, argClientIDVal)
+		if o.azureConfigDir != "" {
+			exec.Env = append(exec.Env, api.ExecEnvVar{Name: azureConfigDir, Value: o.azureConfigDir})
+		}
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+		// when convert to azurecli login, tenantID from the input kubeconfig will be disregarded and
+		// will have to come from explicit flag `--tenant-id`.
+		// this is because azure cli logged in using MSI does not allow specifying tenant ID
+		// see https://github.com/Azure/kubelogin/issues/123#issuecomment-1209652342
+		if o.isSet(flagTenantID) {
+			exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
+		}
+		if o.isSet(flagSubscriptionID) {
+			exec.Args = append(exec.Args, argSubscriptionID, o.TokenOptions.SubscriptionID)
+		}
 
-			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+	case token.DeviceCodeLogin:
 
-			if argEnvironmentVal != "" {
-				// environment is optional
-				exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
-			}
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
 
-			// PoP token flags are optional but must be provided together
-			exec.Args, err = validatePoPClaims(exec.Args, isPoPTokenEnabled, argPoPTokenClaims, argPoPTokenClaimsVal)
-			if err != nil {
-				return err
-			}
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
 
-			if argRedirectURLVal != "" {
-				exec.Args = append(exec.Args, argRedirectURL, argRedirectURLVal)
-			}
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
 
-			if argLoginHintVal != "" {
-				exec.Args = append(exec.Args, argLoginHint, argLoginHintVal)
-			}
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
 
-		case token.ServicePrincipalLogin:
+		exec.Args = appendEnvironmentArgs(o, authInfo, exec.Args, argEnvironmentVal)
 
-			if argClientIDVal == "" {
-				return fmt.Errorf("%s is required", argClientID)
-			}
+		if isLegacyConfigMode {
+			exec.Args = append(exec.Args, argIsLegacy)
+		}
 
-			exec.Args = append(exec.Args, argClientID, argClientIDVal)
+		exec.Args = appendDeviceCodeQRArg(o, authInfo, exec.Args)
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+	case token.InteractiveLogin, token.AuthCodeLogin:
 
-			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
 
-			if argEnvironmentVal != "" {
-				// environment is optional
-				exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
-			}
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
 
-			if o.isSet(flagClientSecret) {
-				exec.Args = append(exec.Args, argClientSecret, o.TokenOptions.ClientSecret)
-			}
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
 
-			if o.isSet(flagClientCert) {
-				exec.Args = append(exec.Args, argClientCert, o.TokenOptions.ClientCert)
-			}
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
 
-			if o.isSet(flagClientCertPassword) {
-				exec.Args = append(exec.Args, argClientCertPassword, o.TokenOptions.ClientCertPassword)
-			}
+		exec.Args = appendEnvironmentArgs(o, authInfo, exec.Args, argEnvironmentVal)
 
-			if isLegacyConfigMode {
-				exec.Args = append(exec.Args, argIsLegacy)
-			}
+		// PoP token flags are optional but must be provided together
+		exec.Args, err = validatePoPClaims(exec.Args, isPoPTokenEnabled, argPoPTokenClaims, argPoPTokenClaimsVal)
+		if err != nil {
+			return nil, err
+		}
 
-			// PoP token flags are optional but must be provided together
-			exec.Args, err = validatePoPClaims(exec.Args, isPoPTokenEnabled, argPoPTokenClaims, argPoPTokenClaimsVal)
-			if err != nil {
-				return err
-			}
+		if argRedirectURLVal != "" {
+			exec.Args = append(exec.Args, argRedirectURL, argRedirectURLVal)
+		}
 
-			if o.isSet(flagDisableEnvironmentOverride) {
-				exec.Args = append(exec.Args, argDisableEnvironmentOverride)
-			}
+		if argLoginHintVal != "" {
+			exec.Args = append(exec.Args, argLoginHint, argLoginHintVal)
+		}
 
-		case token.MSILogin:
+		if o.TokenOptions.LoginMethod == token.InteractiveLogin {
+			exec.Args = appendBrowserArgs(o, authInfo, exec.Args)
+			exec.Args = appendDeviceCodeQRArg(o, authInfo, exec.Args)
+		}
 
-			if o.isSet(flagClientID) {
-				exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
-			} else if o.isSet(flagIdentityResourceID) {
-				exec.Args = append(exec.Args, argIdentityResourceID, o.TokenOptions.IdentityResourceID)
-			}
+	case token.ServicePrincipalLogin:
 
-		case token.ROPCLogin:
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
 
-			if argClientIDVal == "" {
-				return fmt.Errorf("%s is required", argClientID)
-			}
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
 
-			exec.Args = append(exec.Args, argClientID, argClientIDVal)
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
 
-			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+		exec.Args = appendEnvironmentArgs(o, authInfo, exec.Args, argEnvironmentVal)
 
-			if argEnvironmentVal != "" {
-				// environment is optional
-				exec.Args = append(exec.Args, argEnvironment, argEnvironmentVal)
-			}
+		if o.isSet(flagClientSecret) {
+			exec.Args = append(exec.Args, argClientSecret, getSecretArgValue(o, o.TokenOptions.ClientSecret, argAuthRecordCacheDirVal, argTenantIDVal, argClientIDVal, flagClientSecret))
+		}
 
-			if o.isSet(flagUsername) {
-				exec.Args = append(exec.Args, argUsername, o.TokenOptions.Username)
-			}
+		if o.isSet(flagClientCert) {
+			exec.Args = append(exec.Args, argClientCert, o.TokenOptions.ClientCert)
+		}
 
-			if o.isSet(flagPassword) {
-				exec.Args = append(exec.Args, argPassword, o.TokenOptions.Password)
-			}
+		if o.isSet(flagClientCertPassword) {
+			exec.Args = append(exec.Args, argClientCertPassword, getSecretArgValue(o, o.TokenOptions.ClientCertPassword, argAuthRecordCacheDirVal, argTenantIDVal, argClientIDVal, flagClientCertPassword))
+		}
 
-			if isLegacyConfigMode {
-				exec.Args = append(exec.Args, argIsLegacy)
-			}
+		if o.isSet(flagClientCertExpiryDays) {
+			exec.Args = append(exec.Args, argClientCertExpiryDays, strconv.Itoa(o.TokenOptions.ClientCertExpiryDays))
+		}
 
-			exec.Args, err = validatePoPClaims(exec.Args, isPoPTokenEnabled, argPoPTokenClaims, argPoPTokenClaimsVal)
-			if err != nil {
-				return err
-			}
+		if o.isSet(flagClientCertExpiryStrict) {
+			exec.Args = append(exec.Args, argClientCertExpiryStrict)
+		}
 
-		case token.WorkloadIdentityLogin:
+		if isLegacyConfigMode {
+			exec.Args = append(exec.Args, argIsLegacy)
+		}
 
-			if o.isSet(flagClientID) {
-				exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
-			}
+		// PoP token flags are optional but must be provided together
+		exec.Args, err = validatePoPClaims(exec.Args, isPoPTokenEnabled, argPoPTokenClaims, argPoPTokenClaimsVal)
+		if err != nil {
+			return nil, err
+		}
 
-			if o.isSet(flagTenantID) {
-				exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
-			}
+		if o.isSet(flagDisableEnvironmentOverride) {
+			exec.Args = append(exec.Args, argDisableEnvironmentOverride)
+		}
 
-			if o.isSet(flagAuthorityHost) {
-				exec.Args = append(exec.Args, argAuthorityHost, o.TokenOptions.AuthorityHost)
-			}
+	case token.MSILogin:
 
-			if o.isSet(flagFederatedTokenFile) {
-				exec.Args = append(exec.Args, argFederatedTokenFile, o.TokenOptions.FederatedTokenFile)
-			}
+		if o.isSet(flagClientID) {
+			exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
+		} else if o.isSet(flagIdentityObjectID) {
+			exec.Args = append(exec.Args, argIdentityObjectID, o.TokenOptions.IdentityObjectID)
+		} else if o.isSet(flagIdentityResourceID) {
+			exec.Args = append(exec.Args, argIdentityResourceID, o.TokenOptions.IdentityResourceID)
+		}
 
-		case token.AzurePipelinesLogin:
+		if o.isSet(flagIdentityEndpoint) {
+			exec.Args = append(exec.Args, argIdentityEndpoint, o.TokenOptions.IdentityEndpoint)
+		}
 
-			if argTenantIDVal == "" {
-				return fmt.Errorf("%s is required", argTenantID)
-			}
+	case token.ROPCLogin:
 
-			exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
 
-			if o.isSet(flagAzurePipelinesServiceConnectionID) {
-				exec.Args = append(exec.Args, argAzurePipelinesServiceConnectionID, o.TokenOptions.AzurePipelinesServiceConnectionID)
-			}
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
+
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
 		}
 
-		authInfo.Exec = exec
-		authInfo.AuthProvider = nil
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+
+		exec.Args = appendEnvironmentArgs(o, authInfo, exec.Args, argEnvironmentVal)
+
+		if o.isSet(flagUsername) {
+			exec.Args = append(exec.Args, argUsername, o.TokenOptions.Username)
+		}
+
+		if o.isSet(flagPassword) {
+			exec.Args = append(exec.Args, argPassword, getSecretArgValue(o, o.TokenOptions.Password, argAuthRecordCacheDirVal, argTenantIDVal, argClientIDVal, o.TokenOptions.Username, flagPassword))
+		}
+
+		if isLegacyConfigMode {
+			exec.Args = append(exec.Args, argIsLegacy)
+		}
+
+		exec.Args, err = validatePoPClaims(exec.Args, isPoPTokenEnabled, argPoPTokenClaims, argPoPTokenClaimsVal)
+		if err != nil {
+			return nil, err
+		}
+
+	case token.WorkloadIdentityLogin:
+
+		if o.isSet(flagClientID) {
+			exec.Args = append(exec.Args, argClientID, o.TokenOptions.ClientID)
+		}
+
+		if o.isSet(flagTenantID) {
+			exec.Args = append(exec.Args, argTenantID, o.TokenOptions.TenantID)
+		}
+
+		if o.isSet(flagAuthorityHost) {
+			exec.Args = append(exec.Args, argAuthorityHost, o.TokenOptions.AuthorityHost)
+		}
+
+		if o.isSet(flagFederatedTokenFile) {
+			exec.Args = append(exec.Args, argFederatedTokenFile, o.TokenOptions.FederatedTokenFile)
+		}
+
+		if o.isSet(flagClientAssertionAudience) {
+			exec.Args = append(exec.Args, argClientAssertionAudience, o.TokenOptions.ClientAssertionAudience)
+		}
+
+	case token.AzurePipelinesLogin:
+
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
+
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+
+		if o.isSet(flagAzurePipelinesServiceConnectionID) {
+			exec.Args = append(exec.Args, argAzurePipelinesServiceConnectionID, o.TokenOptions.AzurePipelinesServiceConnectionID)
+		}
+
+	case token.ClientAssertionLogin:
+
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
+
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
+
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
+
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+
+		exec.Args = appendEnvironmentArgs(o, authInfo, exec.Args, argEnvironmentVal)
+
+		if o.isSet(flagClientAssertionCommand) {
+			exec.Args = append(exec.Args, argClientAssertionCommand, o.TokenOptions.ClientAssertionCommand)
+		}
+
+		if o.isSet(flagClientAssertionFile) {
+			exec.Args = append(exec.Args, argClientAssertionFile, o.TokenOptions.ClientAssertionFile)
+		}
+
+		if o.isSet(flagClientAssertionAudience) {
+			exec.Args = append(exec.Args, argClientAssertionAudience, o.TokenOptions.ClientAssertionAudience)
+		}
+
+	case token.MSIFederatedLogin:
+
+		if argClientIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argClientID)
+		}
+
+		exec.Args = append(exec.Args, argClientID, argClientIDVal)
+
+		if argTenantIDVal == "" {
+			return nil, fmt.Errorf("%s is required", argTenantID)
+		}
+
+		exec.Args = append(exec.Args, argTenantID, argTenantIDVal)
+
+		exec.Args = appendEnvironmentArgs(o, authInfo, exec.Args, argEnvironmentVal)
+
+		if o.isSet(flagIdentityClientID) {
+			exec.Args = append(exec.Args, argIdentityClientID, o.TokenOptions.IdentityClientID)
+		} else if o.isSet(flagIdentityObjectID) {
+			exec.Args = append(exec.Args, argIdentityObjectID, o.TokenOptions.IdentityObjectID)
+		} else if o.isSet(flagIdentityResourceID) {
+			exec.Args = append(exec.Args, argIdentityResourceID, o.TokenOptions.IdentityResourceID)
+		}
+
+		if o.isSet(flagIdentityEndpoint) {
+			exec.Args = append(exec.Args, argIdentityEndpoint, o.TokenOptions.IdentityEndpoint)
+		}
+
+		if o.isSet(flagClientAssertionAudience) {
+			exec.Args = append(exec.Args, argClientAssertionAudience, o.TokenOptions.ClientAssertionAudience)
+		}
 	}
-	err = clientcmd.ModifyConfig(pathOptions, config, true)
-	return err
+
+	if o.isSet(flagFlagsOverrideEnvironment) && o.TokenOptions.FlagsOverrideEnvironment {
+		exec.Args = append(exec.Args, argFlagsOverrideEnvironment)
+	}
+
+	enableCAE := getExecBoolArg(authInfo, argEnableCAE)
+	if o.isSet(flagEnableCAE) {
+		enableCAE = o.TokenOptions.EnableCAE
+	}
+	if enableCAE {
+		exec.Args = append(exec.Args, argEnableCAE)
+	}
+
+	return exec, nil
+}
+
+// setKeyringSecret stores a secret in the keyring.
+// It is a variable to allow overriding in tests.
+var setKeyringSecret = token.SetKeyringSecret
+
+// keyringSecretsPersist reports whether secrets stored in the keyring survive a reboot.
+// It is a variable to allow overriding in tests.
+var keyringSecretsPersist = token.KeyringSecretsPersist
+
+// getSecretArgValue returns the value written to the exec args for a secret. Secret references
+// are kept as is and literal secrets are moved to the keyring unless --plaintext-secrets is set.
+// When the keyring is unavailable, or doesn't survive a reboot without --volatile-keyring, the
+// secret is kept as plain text with a warning. The keyring secret is named after nameParts.
+func getSecretArgValue(o Options, secret, cacheDir string, nameParts ...string) string {
+	if o.plaintextSecrets || secret == "" || token.IsSecretRef(secret) {
+		return secret
+	}
+	if !keyringSecretsPersist() && !o.volatileKeyring {
+		klog.Warning("the keyring doesn't survive a reboot on this platform, writing the secret to the kubeconfig as plain text. Use an env: or file: secret reference instead, or --volatile-keyring to store it in the keyring anyway")
+		return secret
+	}
+	if cacheDir == "" {
+		cacheDir = o.TokenOptions.AuthRecordCacheDir
+	}
+	ref, err := setKeyringSecret(cacheDir, token.KeyringSecretName(nameParts...), secret)
+	if err != nil {
+		klog.Warningf("unable to store secret in keyring, writing it to the kubeconfig as plain text. Use an env: or file: secret reference instead: %s", err)
+		return secret
+	}
+	return ref
+}
+
+// appendEnvironmentArgs appends the optional environment and the custom cloud definition,
+// taken from the flags or the existing exec args
+func appendEnvironmentArgs(o Options, authInfo *api.AuthInfo, args []string, environment string) []string {
+	if environment != "" {
+		args = append(args, argEnvironment, environment)
+	}
+	for _, a := range []struct {
+		flag, arg, value string
+	}{
+		{flag: flagEnvironmentFile, arg: argEnvironmentFile, value: o.TokenOptions.EnvironmentFile},
+		{flag: flagEnvironmentMetadataURL, arg: argEnvironmentMetadataURL, value: o.TokenOptions.EnvironmentMetadataURL},
+	} {
+		value := a.value
+		if !o.isSet(a.flag) {
+			value = getExecArg(authInfo, a.arg)
+		}
+		if value != "" {
+			args = append(args, a.arg, value)
+		}
+	}
+	return args
+}
+
+// newProfileExecConfig builds the kubelogin exec plugin config referring to a profile of the
+// kubelogin config file instead of passing every setting as an arg
+func newProfileExecConfig(o Options, authInfo *api.AuthInfo, serverID string) (*api.ExecConfig, error) {
+	profile, err := token.LoadProfile(o.TokenOptions.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	loginMethod := profile.LoginMethod
+	if o.isSet(flagLoginMethod) || loginMethod == "" {
+		loginMethod = o.TokenOptions.LoginMethod
+	}
+	exec := &api.ExecConfig{
+		Command: execName,
+		Args: []string{
+			getTokenCommand,
+			argProfile, o.TokenOptions.Profile,
+		},
+		APIVersion:      execAPIVersion,
+		InstallHint:     execInstallHint,
+		InteractiveMode: getInteractiveMode(loginMethod, profile.LoginChain),
+	}
+	if authInfo.Exec != nil && authInfo.Exec.InstallHint != "" {
+		exec.InstallHint = authInfo.Exec.InstallHint
+	}
+
+	if o.isSet(flagLoginMethod) {
+		exec.Args = append(exec.Args, argLoginMethod, o.TokenOptions.LoginMethod)
+	}
+
+	// the server id is usually per cluster, so the profile may leave it out
+	if o.isSet(flagServerID) || profile.ServerID == "" {
+		if serverID == "" {
+			return nil, fmt.Errorf("%s is required", argServerID)
+		}
+		exec.Args = append(exec.Args, argServerID, serverID)
+	}
+
+	return exec, nil
+}
+
+// getInteractiveMode returns the exec interactive mode of the login method. Only
+// devicecode, interactive and authcode logins ever prompt the user, and auto login when its
+// chain is detected at runtime or includes one of them.
+func getInteractiveMode(loginMethod string, loginChain []string) api.ExecInteractiveMode {
+	switch loginMethod {
+	case token.DeviceCodeLogin, token.InteractiveLogin, token.AuthCodeLogin:
+		return api.IfAvailableExecInteractiveMode
+	case token.AutoLogin:
+		if len(loginChain) == 0 || slices.ContainsFunc(loginChain, func(login string) bool {
+			return login == token.DeviceCodeLogin || login == token.InteractiveLogin || login == token.AuthCodeLogin
+		}) {
+			return api.IfAvailableExecInteractiveMode
+		}
+		return api.NeverExecInteractiveMode
+	default:
+		return api.NeverExecInteractiveMode
+	}
+}
+
+// getLoginChain returns the login chain of auto login from the flag or the existing exec args
+func getLoginChain(o Options, authInfo *api.AuthInfo) []string {
+	if o.isSet(flagLoginChain) {
+		return o.TokenOptions.LoginChain
+	}
+	if v := getExecArg(authInfo, argLoginChain); v != "" {
+		return strings.Split(v, ",")
+	}
+	return nil
+}
+
+// appendBrowserArgs appends the browser command and the interactive fallback of
+// interactive login, taken from the flags or else the existing exec args
+func appendBrowserArgs(o Options, authInfo *api.AuthInfo, args []string) []string {
+	browserCommand := getExecArg(authInfo, argBrowserCommand)
+	if o.isSet(flagBrowserCommand) {
+		browserCommand = o.TokenOptions.BrowserCommand
+	}
+	if browserCommand != "" {
+		args = append(args, argBrowserCommand, browserCommand)
+	}
+
+	interactiveFallback := getExecArg(authInfo, argInteractiveFallback)
+	if o.isSet(flagInteractiveFallback) {
+		interactiveFallback = o.TokenOptions.InteractiveFallback
+	}
+	if interactiveFallback != "" {
+		args = append(args, argInteractiveFallback, interactiveFallback)
+	}
+	return args
+}
+
+// appendDeviceCodeQRArg appends the device code QR flag of device code login, taken from
+// the flag or else the existing exec args
+func appendDeviceCodeQRArg(o Options, authInfo *api.AuthInfo, args []string) []string {
+	deviceCodeQR := getExecBoolArg(authInfo, argDeviceCodeQR)
+	if o.isSet(flagDeviceCodeQR) {
+		deviceCodeQR = o.TokenOptions.DeviceCodeQR
+	}
+	if deviceCodeQR {
+		args = append(args, argDeviceCodeQR)
+	}
+	return args
+}
+
+// getClusterNames returns the sorted names of the clusters used by the auth info.
+// When context is set, only the cluster of that context is returned.
+func getClusterNames(config api.Config, authInfoName, context string) []string {
+	var names []string
+	for contextName, c := range config.Contexts {
+		if context != "" && contextName != context {
+			continue
+		}
+		if c.AuthInfo != authInfoName || config.Clusters[c.Cluster] == nil || slices.Contains(names, c.Cluster) {
+			continue
+		}
+		names = append(names, c.Cluster)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setExecClusterConfig writes the kubelogin settings to the cluster's exec extension,
+// keeping any other settings already present in the extension
+func setExecClusterConfig(cluster *api.Cluster, clusterConfig token.ExecClusterConfig) error {
+	settings := map[string]interface{}{}
+	if ext, ok := cluster.Extensions[token.ExecClusterExtensionName]; ok && ext != nil {
+		b, err := json.Marshal(ext)
+		if err != nil {
+			return fmt.Errorf("unable to read %s cluster extension: %w", token.ExecClusterExtensionName, err)
+		}
+		if err := json.Unmarshal(b, &settings); err != nil {
+			return fmt.Errorf("unable to read %s cluster extension: %w", token.ExecClusterExtensionName, err)
+		}
+	}
+
+	b, err := json.Marshal(clusterConfig)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	for _, key := range []string{flagServerID, flagTenantID, flagPoPTokenClaims} {
+		delete(settings, key)
+	}
+	for k, v := range values {
+		settings[k] = v
+	}
+
+	b, err = json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if cluster.Extensions == nil {
+		cluster.Extensions = map[string]runtime.Object{}
+	}
+	cluster.Extensions[token.ExecClusterExtensionName] = &runtime.Unknown{Raw: b, ContentType: runtime.ContentTypeJSON}
+	return nil
+}
+
+// moveClusterArgs removes the per-cluster settings from the exec args and returns them
+func moveClusterArgs(exec *api.ExecConfig) token.ExecClusterConfig {
+	var (
+		clusterConfig token.ExecClusterConfig
+		args          []string
+	)
+	for i := 0; i < len(exec.Args); i++ {
+		arg := exec.Args[i]
+		switch {
+		case arg == argIsPoPTokenEnabled:
+			// pop-claims in the cluster extension enable PoP tokens
+		case (arg == argServerID || arg == argTenantID || arg == argPoPTokenClaims) && i+1 < len(exec.Args):
+			i++
+			switch arg {
+			case argServerID:
+				clusterConfig.ServerID = exec.Args[i]
+			case argTenantID:
+				clusterConfig.TenantID = exec.Args[i]
+			case argPoPTokenClaims:
+				clusterConfig.PoPTokenClaims = exec.Args[i]
+			}
+		default:
+			args = append(args, arg)
+		}
+	}
+	exec.Args = args
+	return clusterConfig
 }
 
 // get the item in Exec.Args[] right after someArg
@@ -1,18 +1,26 @@
 package converter
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/Azure/kubelogin/pkg/internal/env"
 	"github.com/Azure/kubelogin/pkg/internal/token"
 	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 func TestConvert(t *testing.T) {
+	original := keyringSecretsPersist
+	defer func() { keyringSecretsPersist = original }()
+	keyringSecretsPersist = func() bool { return true }
+
 	const (
 		clusterName1       = "aks1"
 		clusterName2       = "aks2"
@@ -28,7 +36,10 @@ func TestConvert(t *testing.T) {
 		username           = "foo123"
 		password           = "foobar"
 		loginMethod        = "devicecode"
+		identityClientID   = "identityClientID"
 		identityResourceID = "/msi/resource/id"
+		identityObjectID   = "identityObjectID"
+		identityEndpoint   = "http://localhost:40342/metadata/identity/oauth2/token"
 		authorityHost      = "https://login.microsoftonline.com/"
 		federatedTokenFile = "/tmp/file"
 		authRecordCacheDir = "/tmp/token_dir"
@@ -150,11 +161,12 @@ func TestConvert(t *testing.T) {
 				cfgConfigMode:  "0",
 			},
 			overrideFlags: map[string]string{
-				flagLoginMethod:        token.WorkloadIdentityLogin,
-				flagClientID:           spClientID,
-				flagTenantID:           tenantID,
-				flagAuthorityHost:      authorityHost,
-				flagFederatedTokenFile: federatedTokenFile,
+				flagLoginMethod:             token.WorkloadIdentityLogin,
+				flagClientID:                spClientID,
+				flagTenantID:                tenantID,
+				flagAuthorityHost:           authorityHost,
+				flagFederatedTokenFile:      federatedTokenFile,
+				flagClientAssertionAudience: "api://kubelogin",
 			},
 			expectedArgs: []string{
 				getTokenCommand,
@@ -163,9 +175,60 @@ func TestConvert(t *testing.T) {
 				argTenantID, tenantID,
 				argAuthorityHost, authorityHost,
 				argFederatedTokenFile, federatedTokenFile,
+				argClientAssertionAudience, "api://kubelogin",
 				argLoginMethod, token.WorkloadIdentityLogin,
 			},
 		},
+		{
+			name: "using legacy azure auth to convert to clientassertion",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:             token.ClientAssertionLogin,
+				flagClientID:                spClientID,
+				flagClientAssertionCommand:  "vault-jwt --role kubelogin",
+				flagClientAssertionAudience: "api://kubelogin",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, spClientID,
+				argTenantID, tenantID,
+				argEnvironment, envName,
+				argClientAssertionCommand, "vault-jwt --role kubelogin",
+				argClientAssertionAudience, "api://kubelogin",
+				argLoginMethod, token.ClientAssertionLogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to msifederated",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:      token.MSIFederatedLogin,
+				flagClientID:         spClientID,
+				flagIdentityClientID: identityClientID,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, spClientID,
+				argTenantID, tenantID,
+				argEnvironment, envName,
+				argIdentityClientID, identityClientID,
+				argLoginMethod, token.MSIFederatedLogin,
+			},
+		},
 		{
 			name: "using legacy azure auth to convert to spn without setting environment",
 			authProviderConfig: map[string]string{
@@ -204,7 +267,7 @@ func TestConvert(t *testing.T) {
 				getTokenCommand,
 				argServerID, serverID,
 				argClientID, spClientID,
-				argClientSecret, clientSecret,
+				argClientSecret, token.SecretRefKeyringPrefix + token.KeyringSecretName(tenantID, spClientID, flagClientSecret),
 				argTenantID, tenantID,
 				argEnvironment, envName,
 				argLoginMethod, token.ServicePrincipalLogin,
@@ -254,7 +317,35 @@ func TestConvert(t *testing.T) {
 				argServerID, serverID,
 				argClientID, spClientID,
 				argClientCert, clientCert,
-				argClientCertPassword, clientCertPassword,
+				argClientCertPassword, token.SecretRefKeyringPrefix + token.KeyringSecretName(tenantID, spClientID, flagClientCertPassword),
+				argTenantID, tenantID,
+				argEnvironment, envName,
+				argLoginMethod, token.ServicePrincipalLogin,
+			},
+		},
+		{
+			name: "using legacy azure auth to convert to spn with clientCert expiry checks",
+			authProviderConfig: map[string]string{
+				cfgEnvironment: envName,
+				cfgApiserverID: serverID,
+				cfgClientID:    clientID,
+				cfgTenantID:    tenantID,
+				cfgConfigMode:  "1",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:            token.ServicePrincipalLogin,
+				flagClientID:               spClientID,
+				flagClientCert:             clientCert,
+				flagClientCertExpiryDays:   "14",
+				flagClientCertExpiryStrict: "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, spClientID,
+				argClientCert, clientCert,
+				argClientCertExpiryDays, "14",
+				argClientCertExpiryStrict,
 				argTenantID, tenantID,
 				argEnvironment, envName,
 				argLoginMethod, token.ServicePrincipalLogin,
@@ -300,7 +391,7 @@ func TestConvert(t *testing.T) {
 				argServerID, serverID,
 				argClientID, clientID,
 				argUsername, username,
-				argPassword, password,
+				argPassword, token.SecretRefKeyringPrefix + token.KeyringSecretName(tenantID, clientID, username, flagPassword),
 				argTenantID, tenantID,
 				argEnvironment, envName,
 				argLoginMethod, token.ROPCLogin,
@@ -1039,6 +1130,30 @@ func TestConvert(t *testing.T) {
 			},
 			command: execName,
 		},
+		{
+			name: "with exec format kubeconfig, convert from devicecode to msi with identity-object-id and identity-endpoint override",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argEnvironment, envName,
+				argLoginMethod, token.DeviceCodeLogin,
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:      token.MSILogin,
+				flagIdentityObjectID: identityObjectID,
+				flagIdentityEndpoint: identityEndpoint,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argIdentityObjectID, identityObjectID,
+				argIdentityEndpoint, identityEndpoint,
+				argLoginMethod, token.MSILogin,
+			},
+			command: execName,
+		},
 		{
 			name: "with exec format kubeconfig, convert from devicecode to ropc",
 			execArgItems: []string{
@@ -1107,7 +1222,7 @@ func TestConvert(t *testing.T) {
 				argServerID, serverID,
 				argClientID, clientID,
 				argUsername, username,
-				argPassword, password,
+				argPassword, token.SecretRefKeyringPrefix + token.KeyringSecretName(tenantID, clientID, username, flagPassword),
 				argTenantID, tenantID,
 				argEnvironment, envName,
 				argLoginMethod, token.ROPCLogin,
@@ -1548,6 +1663,192 @@ func TestConvert(t *testing.T) {
 			},
 			command: execName,
 		},
+		{
+			name: "test with exec format kubeconfig, convert from devicecode to azurecli with flags overriding environment",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argEnvironment, envName,
+				argLoginMethod, token.DeviceCodeLogin,
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:              token.AzureCLILogin,
+				flagFlagsOverrideEnvironment: "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argLoginMethod, token.AzureCLILogin,
+				argFlagsOverrideEnvironment,
+			},
+			command: execName,
+		},
+		{
+			name: "test with exec format kubeconfig, convert from devicecode to azurecli with CAE enabled",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.DeviceCodeLogin,
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AzureCLILogin,
+				flagEnableCAE:   "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argLoginMethod, token.AzureCLILogin,
+				argEnableCAE,
+			},
+			command: execName,
+		},
+		{
+			name: "test with exec format kubeconfig, convert from devicecode to interactive keeps CAE enabled",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.DeviceCodeLogin,
+				argEnableCAE,
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.InteractiveLogin,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.InteractiveLogin,
+				argEnableCAE,
+			},
+			command: execName,
+		},
+		{
+			name: "test with exec format kubeconfig, convert from devicecode to interactive with browser command and fallback",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.DeviceCodeLogin,
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:         token.InteractiveLogin,
+				flagBrowserCommand:      "wslview",
+				flagInteractiveFallback: token.DeviceCodeLogin,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.InteractiveLogin,
+				argBrowserCommand, "wslview",
+				argInteractiveFallback, token.DeviceCodeLogin,
+			},
+			command: execName,
+		},
+		{
+			name: "test with exec format kubeconfig, interactive keeps browser command",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.InteractiveLogin,
+				argBrowserCommand, "wslview",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:         token.InteractiveLogin,
+				flagInteractiveFallback: token.DeviceCodeLogin,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.InteractiveLogin,
+				argBrowserCommand, "wslview",
+				argInteractiveFallback, token.DeviceCodeLogin,
+			},
+			command: execName,
+		},
+		{
+			name: "test with exec format kubeconfig, devicecode with QR code",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.DeviceCodeLogin,
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:  token.DeviceCodeLogin,
+				flagDeviceCodeQR: "true",
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.DeviceCodeLogin,
+				argDeviceCodeQR,
+			},
+			command: execName,
+		},
+		{
+			name: "test with exec format kubeconfig, convert from devicecode to interactive keeps QR code",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.DeviceCodeLogin,
+				argDeviceCodeQR,
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod:         token.InteractiveLogin,
+				flagInteractiveFallback: token.DeviceCodeLogin,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.InteractiveLogin,
+				argInteractiveFallback, token.DeviceCodeLogin,
+				argDeviceCodeQR,
+			},
+			command: execName,
+		},
+		{
+			name: "test with exec format kubeconfig, convert from interactive to authcode drops browser command",
+			execArgItems: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.InteractiveLogin,
+				argBrowserCommand, "wslview",
+			},
+			overrideFlags: map[string]string{
+				flagLoginMethod: token.AuthCodeLogin,
+			},
+			expectedArgs: []string{
+				getTokenCommand,
+				argServerID, serverID,
+				argClientID, clientID,
+				argTenantID, tenantID,
+				argLoginMethod, token.AuthCodeLogin,
+			},
+			command: execName,
+		},
 	}
 	rootTmpDir, err := os.MkdirTemp("", "kubelogin-test")
 	if err != nil {
@@ -1582,6 +1883,8 @@ func TestConvert(t *testing.T) {
 					WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, clusterName1, &clientcmd.ConfigOverrides{}, nil)),
 			}
 			o.AddFlags(fs)
+			// keep secrets moved to the keyring out of the user's cache dir
+			o.TokenOptions.AuthRecordCacheDir = tmpDir
 
 			for k, v := range data.overrideFlags {
 				if err := o.setFlag(k, v); err != nil {
@@ -1620,6 +1923,435 @@ func TestConvert(t *testing.T) {
 	}
 }
 
+func TestConvertInteractiveMode(t *testing.T) {
+	testData := []struct {
+		loginMethod  string
+		expectedMode clientcmdapi.ExecInteractiveMode
+	}{
+		{loginMethod: token.DeviceCodeLogin, expectedMode: clientcmdapi.IfAvailableExecInteractiveMode},
+		{loginMethod: token.InteractiveLogin, expectedMode: clientcmdapi.IfAvailableExecInteractiveMode},
+		{loginMethod: token.AuthCodeLogin, expectedMode: clientcmdapi.IfAvailableExecInteractiveMode},
+		{loginMethod: token.ServicePrincipalLogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.ROPCLogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.MSILogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.AzureCLILogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.AzureDeveloperCLILogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.WorkloadIdentityLogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.AzurePipelinesLogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.ClientAssertionLogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.MSIFederatedLogin, expectedMode: clientcmdapi.NeverExecInteractiveMode},
+		{loginMethod: token.AutoLogin, expectedMode: clientcmdapi.IfAvailableExecInteractiveMode},
+	}
+
+	for _, data := range testData {
+		t.Run(data.loginMethod, func(t *testing.T) {
+			config := createValidTestConfigs("aks1", "aks2", "", azureAuthProvider, map[string]string{
+				cfgApiserverID: "serverID",
+				cfgClientID:    "clientID",
+				cfgTenantID:    "tenantID",
+			}, nil, "")
+
+			converted := convertTestConfig(t, config, map[string]string{flagLoginMethod: data.loginMethod})
+
+			for _, name := range []string{"aks1", "aks2"} {
+				exec := converted.AuthInfos[name].Exec
+				require.NotNil(t, exec)
+				assert.Equal(t, data.expectedMode, exec.InteractiveMode)
+				assert.False(t, exec.ProvideClusterInfo)
+			}
+		})
+	}
+}
+
+func TestConvertProvideClusterInfo(t *testing.T) {
+	t.Run("moves cluster settings into the extension", func(t *testing.T) {
+		config := createValidTestConfigs("aks1", "aks2", "", azureAuthProvider, map[string]string{
+			cfgApiserverID: "serverID",
+			cfgClientID:    "clientID",
+			cfgTenantID:    "tenantID",
+		}, nil, "")
+
+		converted := convertTestConfig(t, config, map[string]string{
+			flagLoginMethod:        token.InteractiveLogin,
+			flagIsPoPTokenEnabled:  "true",
+			flagPoPTokenClaims:     "u=/arm/id",
+			flagProvideClusterInfo: "true",
+		})
+
+		for _, name := range []string{"aks1", "aks2"} {
+			exec := converted.AuthInfos[name].Exec
+			require.NotNil(t, exec)
+			assert.True(t, exec.ProvideClusterInfo)
+			assert.ElementsMatch(t, []string{
+				getTokenCommand,
+				argLoginMethod, token.InteractiveLogin,
+				argClientID, "clientID",
+			}, exec.Args)
+
+			clusterConfig, err := token.GetExecClusterConfig(converted.Clusters[name])
+			require.NoError(t, err)
+			assert.Equal(t, &token.ExecClusterConfig{
+				ServerID:       "serverID",
+				TenantID:       "tenantID",
+				PoPTokenClaims: "u=/arm/id",
+			}, clusterConfig)
+		}
+	})
+
+	t.Run("shared user keeps each cluster's settings", func(t *testing.T) {
+		config := createValidTestConfigs("aks1", "aks2", execName, "", nil, []string{
+			getTokenCommand,
+			argLoginMethod, token.ServicePrincipalLogin,
+			argClientID, "clientID",
+		}, "")
+		// both contexts use the aks1 user, each cluster has its own server ID
+		config.Contexts["aks2"].AuthInfo = "aks1"
+		delete(config.AuthInfos, "aks2")
+		config.AuthInfos["aks1"].Exec.ProvideClusterInfo = true
+		require.NoError(t, setExecClusterConfig(config.Clusters["aks1"], token.ExecClusterConfig{ServerID: "server1", TenantID: "tenantID"}))
+		require.NoError(t, setExecClusterConfig(config.Clusters["aks2"], token.ExecClusterConfig{ServerID: "server2", TenantID: "tenantID"}))
+
+		converted := convertTestConfig(t, config, map[string]string{
+			flagLoginMethod:        token.ServicePrincipalLogin,
+			flagProvideClusterInfo: "true",
+		})
+
+		exec := converted.AuthInfos["aks1"].Exec
+		require.NotNil(t, exec)
+		assert.True(t, exec.ProvideClusterInfo)
+		assert.Equal(t, clientcmdapi.NeverExecInteractiveMode, exec.InteractiveMode)
+		assert.ElementsMatch(t, []string{
+			getTokenCommand,
+			argLoginMethod, token.ServicePrincipalLogin,
+			argClientID, "clientID",
+		}, exec.Args)
+
+		for name, serverID := range map[string]string{"aks1": "server1", "aks2": "server2"} {
+			clusterConfig, err := token.GetExecClusterConfig(converted.Clusters[name])
+			require.NoError(t, err)
+			assert.Equal(t, &token.ExecClusterConfig{ServerID: serverID, TenantID: "tenantID"}, clusterConfig)
+		}
+	})
+
+	t.Run("shared user keeps provideClusterInfo without the flag", func(t *testing.T) {
+		config := createValidTestConfigs("aks1", "aks2", execName, "", nil, []string{
+			getTokenCommand,
+			argLoginMethod, token.ServicePrincipalLogin,
+			argClientID, "clientID",
+		}, "")
+		config.Contexts["aks2"].AuthInfo = "aks1"
+		delete(config.AuthInfos, "aks2")
+		config.AuthInfos["aks1"].Exec.ProvideClusterInfo = true
+		require.NoError(t, setExecClusterConfig(config.Clusters["aks1"], token.ExecClusterConfig{ServerID: "server1", TenantID: "tenant1"}))
+		require.NoError(t, setExecClusterConfig(config.Clusters["aks2"], token.ExecClusterConfig{ServerID: "server2", TenantID: "tenant2"}))
+
+		converted := convertTestConfig(t, config, map[string]string{flagLoginMethod: token.ServicePrincipalLogin})
+
+		exec := converted.AuthInfos["aks1"].Exec
+		require.NotNil(t, exec)
+		assert.True(t, exec.ProvideClusterInfo)
+		assert.ElementsMatch(t, []string{
+			getTokenCommand,
+			argLoginMethod, token.ServicePrincipalLogin,
+			argClientID, "clientID",
+		}, exec.Args)
+
+		for name, want := range map[string]token.ExecClusterConfig{
+			"aks1": {ServerID: "server1", TenantID: "tenant1"},
+			"aks2": {ServerID: "server2", TenantID: "tenant2"},
+		} {
+			clusterConfig, err := token.GetExecClusterConfig(converted.Clusters[name])
+			require.NoError(t, err)
+			assert.Equal(t, &want, clusterConfig)
+		}
+	})
+
+	t.Run("user shared with another context is not converted with context", func(t *testing.T) {
+		config := createValidTestConfigs("aks1", "aks2", execName, "", nil, []string{
+			getTokenCommand,
+			argLoginMethod, token.ServicePrincipalLogin,
+			argServerID, "serverID",
+			argClientID, "clientID",
+		}, "")
+		config.Contexts["aks2"].AuthInfo = "aks1"
+		delete(config.AuthInfos, "aks2")
+
+		fs := &pflag.FlagSet{}
+		o := Options{
+			Flags: fs,
+			configFlags: genericclioptions.NewTestConfigFlags().
+				WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, "aks1", &clientcmd.ConfigOverrides{}, nil)),
+		}
+		o.AddFlags(fs)
+		require.NoError(t, o.setFlag(flagLoginMethod, token.ServicePrincipalLogin))
+		require.NoError(t, o.setFlag(flagProvideClusterInfo, "true"))
+		require.NoError(t, o.setFlag(flagContext, "aks1"))
+
+		err := Convert(o, &clientcmd.PathOptions{
+			LoadingRules: &clientcmd.ClientConfigLoadingRules{ExplicitPath: filepath.Join(t.TempDir(), "config")},
+		})
+		assert.EqualError(t, err, `user "aks1" of context "aks1" is shared with the clusters aks2 of other contexts. Convert it without --context to move the settings of every cluster into its extension`)
+	})
+
+	t.Run("converting back to args reads the extension", func(t *testing.T) {
+		config := createValidTestConfigs("aks1", "aks2", execName, "", nil, []string{
+			getTokenCommand,
+			argLoginMethod, token.DeviceCodeLogin,
+			argClientID, "clientID",
+		}, "")
+		for _, name := range []string{"aks1", "aks2"} {
+			config.AuthInfos[name].Exec.ProvideClusterInfo = true
+			require.NoError(t, setExecClusterConfig(config.Clusters[name], token.ExecClusterConfig{ServerID: "serverID", TenantID: "tenantID"}))
+		}
+
+		converted := convertTestConfig(t, config, map[string]string{flagLoginMethod: token.DeviceCodeLogin})
+
+		for _, name := range []string{"aks1", "aks2"} {
+			exec := converted.AuthInfos[name].Exec
+			require.NotNil(t, exec)
+			assert.False(t, exec.ProvideClusterInfo)
+			assert.ElementsMatch(t, []string{
+				getTokenCommand,
+				argLoginMethod, token.DeviceCodeLogin,
+				argServerID, "serverID",
+				argClientID, "clientID",
+				argTenantID, "tenantID",
+			}, exec.Args)
+		}
+	})
+
+	t.Run("server id is required", func(t *testing.T) {
+		config := createValidTestConfigs("aks1", "aks2", execName, "", nil, []string{
+			getTokenCommand,
+			argLoginMethod, token.MSILogin,
+		}, "")
+		fs := &pflag.FlagSet{}
+		o := Options{
+			Flags: fs,
+			configFlags: genericclioptions.NewTestConfigFlags().
+				WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, "aks1", &clientcmd.ConfigOverrides{}, nil)),
+		}
+		o.AddFlags(fs)
+		require.NoError(t, o.setFlag(flagLoginMethod, token.MSILogin))
+		require.NoError(t, o.setFlag(flagProvideClusterInfo, "true"))
+
+		err := Convert(o, &clientcmd.PathOptions{
+			LoadingRules: &clientcmd.ClientConfigLoadingRules{ExplicitPath: filepath.Join(t.TempDir(), "config")},
+		})
+		assert.EqualError(t, err, "--server-id is required")
+	})
+}
+
+func TestConvertSecrets(t *testing.T) {
+	newConfig := func() *clientcmdapi.Config {
+		return createValidTestConfigs("aks1", "aks2", "", azureAuthProvider, map[string]string{
+			cfgApiserverID: "serverID",
+			cfgClientID:    "clientID",
+			cfgTenantID:    "tenantID",
+		}, nil, "")
+	}
+
+	t.Run("literal secret is stored in the keyring", func(t *testing.T) {
+		original := keyringSecretsPersist
+		defer func() { keyringSecretsPersist = original }()
+		keyringSecretsPersist = func() bool { return true }
+
+		cacheDir := t.TempDir()
+		converted := convertTestConfig(t, newConfig(), map[string]string{
+			flagLoginMethod:        token.ServicePrincipalLogin,
+			flagClientSecret:       "secret",
+			flagAuthRecordCacheDir: cacheDir,
+		})
+		name := token.KeyringSecretName("tenantID", "clientID", flagClientSecret)
+		assert.Equal(t, token.SecretRefKeyringPrefix+name, getExecArg(converted.AuthInfos["aks1"], argClientSecret))
+
+		secret, err := token.GetKeyringSecret(cacheDir, name)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", secret)
+	})
+
+	t.Run("secret reference is written as is", func(t *testing.T) {
+		converted := convertTestConfig(t, newConfig(), map[string]string{
+			flagLoginMethod: token.ROPCLogin,
+			flagUsername:    "user",
+			flagPassword:    "env:MY_PASSWORD",
+		})
+		assert.Equal(t, "env:MY_PASSWORD", getExecArg(converted.AuthInfos["aks1"], argPassword))
+	})
+
+	t.Run("literal secret is written as is when the keyring doesn't survive a reboot", func(t *testing.T) {
+		original := keyringSecretsPersist
+		defer func() { keyringSecretsPersist = original }()
+		keyringSecretsPersist = func() bool { return false }
+
+		converted := convertTestConfig(t, newConfig(), map[string]string{
+			flagLoginMethod:  token.ServicePrincipalLogin,
+			flagClientSecret: "secret",
+		})
+		assert.Equal(t, "secret", getExecArg(converted.AuthInfos["aks1"], argClientSecret))
+
+		cacheDir := t.TempDir()
+		converted = convertTestConfig(t, newConfig(), map[string]string{
+			flagLoginMethod:        token.ServicePrincipalLogin,
+			flagClientSecret:       "secret",
+			flagAuthRecordCacheDir: cacheDir,
+			flagVolatileKeyring:    "true",
+		})
+		name := token.KeyringSecretName("tenantID", "clientID", flagClientSecret)
+		assert.Equal(t, token.SecretRefKeyringPrefix+name, getExecArg(converted.AuthInfos["aks1"], argClientSecret))
+	})
+
+	t.Run("literal secret is written as is without a keyring", func(t *testing.T) {
+		original := setKeyringSecret
+		defer func() { setKeyringSecret = original }()
+		setKeyringSecret = func(string, string, string) (string, error) {
+			return "", errors.New("keyring is not available")
+		}
+
+		converted := convertTestConfig(t, newConfig(), map[string]string{
+			flagLoginMethod:  token.ServicePrincipalLogin,
+			flagClientSecret: "secret",
+		})
+		assert.Equal(t, "secret", getExecArg(converted.AuthInfos["aks1"], argClientSecret))
+	})
+
+	t.Run("plaintext secret", func(t *testing.T) {
+		converted := convertTestConfig(t, newConfig(), map[string]string{
+			flagLoginMethod:        token.ServicePrincipalLogin,
+			flagClientSecret:       "secret",
+			flagPlaintextSecrets:   "true",
+			flagClientCertPassword: "password",
+		})
+		assert.Equal(t, "secret", getExecArg(converted.AuthInfos["aks1"], argClientSecret))
+		assert.Equal(t, "password", getExecArg(converted.AuthInfos["aks1"], argClientCertPassword))
+	})
+}
+
+// convertTestConfig converts the config with the given flags and returns the kubeconfig
+// read back from disk
+func TestConvertProfile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`profiles:
+  prod:
+    login: spn
+    tenant-id: tenantID
+    client-id: clientID
+  shared:
+    login: azurecli
+    server-id: profileServerID
+`), 0600))
+	t.Setenv(env.KubeloginConfig, configFile)
+
+	newConfig := func() *clientcmdapi.Config {
+		return createValidTestConfigs("aks1", "aks2", "", azureAuthProvider, map[string]string{
+			cfgApiserverID: "serverID",
+			cfgClientID:    "clientID",
+			cfgTenantID:    "tenantID",
+		}, nil, "")
+	}
+
+	t.Run("profile with server id from kubeconfig", func(t *testing.T) {
+		converted := convertTestConfig(t, newConfig(), map[string]string{flagProfile: "prod"})
+		exec := converted.AuthInfos["aks1"].Exec
+		assert.Equal(t, []string{getTokenCommand, argProfile, "prod", argServerID, "serverID"}, exec.Args)
+		assert.Equal(t, clientcmdapi.NeverExecInteractiveMode, exec.InteractiveMode)
+	})
+
+	t.Run("profile with server id", func(t *testing.T) {
+		converted := convertTestConfig(t, newConfig(), map[string]string{flagProfile: "shared"})
+		assert.Equal(t, []string{getTokenCommand, argProfile, "shared"}, converted.AuthInfos["aks1"].Exec.Args)
+	})
+
+	t.Run("flags are kept", func(t *testing.T) {
+		converted := convertTestConfig(t, newConfig(), map[string]string{
+			flagProfile:     "shared",
+			flagLoginMethod: token.DeviceCodeLogin,
+			flagServerID:    "flagServerID",
+		})
+		exec := converted.AuthInfos["aks1"].Exec
+		assert.Equal(t, []string{getTokenCommand, argProfile, "shared", argLoginMethod, token.DeviceCodeLogin, argServerID, "flagServerID"}, exec.Args)
+		assert.Equal(t, clientcmdapi.IfAvailableExecInteractiveMode, exec.InteractiveMode)
+	})
+
+	t.Run("profile not found", func(t *testing.T) {
+		config := newConfig()
+		fs := &pflag.FlagSet{}
+		o := Options{
+			Flags: fs,
+			configFlags: genericclioptions.NewTestConfigFlags().
+				WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, "aks1", &clientcmd.ConfigOverrides{}, nil)),
+		}
+		o.AddFlags(fs)
+		require.NoError(t, o.setFlag(flagProfile, "missing"))
+		pathOptions := clientcmd.PathOptions{LoadingRules: &clientcmd.ClientConfigLoadingRules{ExplicitPath: filepath.Join(t.TempDir(), "config")}}
+		assert.ErrorContains(t, Convert(o, &pathOptions), `profile "missing" not found`)
+	})
+}
+
+func TestConvertCustomCloud(t *testing.T) {
+	newConfig := func(execArgs []string) *clientcmdapi.Config {
+		return createValidTestConfigs("aks1", "aks2", execName, "", nil, execArgs, "")
+	}
+	execArgs := []string{
+		getTokenCommand,
+		argServerID, "serverID",
+		argClientID, "clientID",
+		argTenantID, "tenantID",
+		argEnvironment, "AzureStackCloud",
+		argEnvironmentFile, "/etc/kubelogin/cloud.json",
+		argLoginMethod, token.DeviceCodeLogin,
+	}
+
+	t.Run("existing custom cloud is kept", func(t *testing.T) {
+		converted := convertTestConfig(t, newConfig(execArgs), map[string]string{
+			flagLoginMethod: token.ServicePrincipalLogin,
+		})
+		authInfo := converted.AuthInfos["aks1"]
+		assert.Equal(t, "AzureStackCloud", getExecArg(authInfo, argEnvironment))
+		assert.Equal(t, "/etc/kubelogin/cloud.json", getExecArg(authInfo, argEnvironmentFile))
+	})
+
+	t.Run("custom cloud from flags", func(t *testing.T) {
+		converted := convertTestConfig(t, newConfig(execArgs), map[string]string{
+			flagEnvironment:            "AirGapped",
+			flagEnvironmentFile:        "",
+			flagEnvironmentMetadataURL: "https://management.airgapped.example/metadata/endpoints?api-version=2022-09-01",
+		})
+		authInfo := converted.AuthInfos["aks1"]
+		assert.Equal(t, "AirGapped", getExecArg(authInfo, argEnvironment))
+		assert.Empty(t, getExecArg(authInfo, argEnvironmentFile))
+		assert.Equal(t, "https://management.airgapped.example/metadata/endpoints?api-version=2022-09-01", getExecArg(authInfo, argEnvironmentMetadataURL))
+	})
+}
+
+func convertTestConfig(t *testing.T, config *clientcmdapi.Config, flags map[string]string) *clientcmdapi.Config {
+	t.Helper()
+	fs := &pflag.FlagSet{}
+	o := Options{
+		Flags: fs,
+		configFlags: genericclioptions.NewTestConfigFlags().
+			WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, "aks1", &clientcmd.ConfigOverrides{}, nil)),
+	}
+	o.AddFlags(fs)
+	o.TokenOptions.AuthRecordCacheDir = t.TempDir()
+	for k, v := range flags {
+		require.NoError(t, o.setFlag(k, v))
+	}
+
+	kubeconfigFile := filepath.Join(t.TempDir(), "config")
+	pathOptions := clientcmd.PathOptions{
+		ExplicitFileFlag: "kubeconfig",
+		LoadingRules: &clientcmd.ClientConfigLoadingRules{
+			ExplicitPath: kubeconfigFile,
+		},
+	}
+	require.NoError(t, Convert(o, &pathOptions))
+
+	converted, err := clientcmd.LoadFromFile(kubeconfigFile)
+	require.NoError(t, err)
+	return converted
+}
+
 func createValidTestConfigs(
 	name1, name2, commandName, authProviderName string,
 	authProviderConfig map[string]string,
@@ -1768,3 +2500,56 @@ func contains(a []string, x string) bool {
 	}
 	return false
 }
+
+func TestConvertAutoLogin(t *testing.T) {
+	execArgs := []string{
+		getTokenCommand,
+		argServerID, "serverID",
+		argClientID, "clientID",
+		argTenantID, "tenantID",
+		argLoginMethod, token.DeviceCodeLogin,
+	}
+
+	t.Run("detected chain", func(t *testing.T) {
+		config := createValidTestConfigs("aks1", "aks2", execName, "", nil, execArgs, "")
+		converted := convertTestConfig(t, config, map[string]string{
+			flagLoginMethod: token.AutoLogin,
+		})
+		authInfo := converted.AuthInfos["aks1"]
+		assert.Equal(t, token.AutoLogin, getExecArg(authInfo, argLoginMethod))
+		assert.Equal(t, "serverID", getExecArg(authInfo, argServerID))
+		assert.Equal(t, "tenantID", getExecArg(authInfo, argTenantID))
+		assert.Empty(t, getExecArg(authInfo, argClientID))
+		assert.Empty(t, getExecArg(authInfo, argLoginChain))
+		assert.Equal(t, clientcmdapi.IfAvailableExecInteractiveMode, authInfo.Exec.InteractiveMode)
+	})
+
+	t.Run("explicit non-interactive chain", func(t *testing.T) {
+		config := createValidTestConfigs("aks1", "aks2", execName, "", nil, execArgs, "")
+		converted := convertTestConfig(t, config, map[string]string{
+			flagLoginMethod: token.AutoLogin,
+			flagLoginChain:  "workloadidentity,msi,azurecli",
+			flagClientID:    "chainClientID",
+		})
+		authInfo := converted.AuthInfos["aks1"]
+		assert.Equal(t, "workloadidentity,msi,azurecli", getExecArg(authInfo, argLoginChain))
+		assert.Equal(t, "chainClientID", getExecArg(authInfo, argClientID))
+		assert.Equal(t, clientcmdapi.NeverExecInteractiveMode, authInfo.Exec.InteractiveMode)
+	})
+
+	t.Run("existing chain is kept", func(t *testing.T) {
+		args := []string{
+			getTokenCommand,
+			argServerID, "serverID",
+			argLoginMethod, token.AutoLogin,
+			argLoginChain, "msi,devicecode",
+		}
+		config := createValidTestConfigs("aks1", "aks2", execName, "", nil, args, "")
+		converted := convertTestConfig(t, config, map[string]string{
+			flagLoginMethod: token.AutoLogin,
+		})
+		authInfo := converted.AuthInfos["aks1"]
+		assert.Equal(t, "msi,devicecode", getExecArg(authInfo, argLoginChain))
+		assert.Equal(t, clientcmdapi.IfAvailableExecInteractiveMode, authInfo.Exec.InteractiveMode)
+	})
+}
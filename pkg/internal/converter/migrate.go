@@ -0,0 +1,142 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+	klog "k8s.io/klog/v2"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+// secretArgs are the exec args holding secrets, keyed by arg with the flag name used in the keyring secret name
+var secretArgs = map[string]string{
+	argClientSecret:       flagClientSecret,
+	argClientCertPassword: flagClientCertPassword,
+	argPassword:           flagPassword,
+}
+
+// secretEnvVars are the exec env variables holding secrets, keyed by name with the flag name used in the
+// keyring secret name
+var secretEnvVars = map[string]string{
+	env.KubeloginClientSecret:              flagClientSecret,
+	env.AzureClientSecret:                  flagClientSecret,
+	env.TerraformClientSecret:              flagClientSecret,
+	env.KubeloginClientCertificatePassword: flagClientCertPassword,
+	env.AzureClientCertificatePassword:     flagClientCertPassword,
+	env.TerraformClientCertificatePassword: flagClientCertPassword,
+	env.KubeloginROPCPassword:              flagPassword,
+	env.AzurePassword:                      flagPassword,
+}
+
+// MigrateSecrets moves literal secrets in kubelogin exec args and env into the keyring and replaces
+// them with keyring references. It returns the number of secrets migrated.
+func MigrateSecrets(o Options, pathOptions *clientcmd.PathOptions) (int, error) {
+	clientConfig := o.configFlags.ToRawKubeConfigLoader()
+	config, err := clientConfig.RawConfig()
+	if err != nil {
+		return 0, fmt.Errorf("unable to load kubeconfig: %s", err)
+	}
+
+	targetAuthInfo := ""
+	if o.context != "" {
+		if config.Contexts[o.context] == nil {
+			return 0, fmt.Errorf("no context exists with the name: %q", o.context)
+		}
+		targetAuthInfo = config.Contexts[o.context].AuthInfo
+	}
+	if !keyringSecretsPersist() && !o.volatileKeyring {
+		return 0, fmt.Errorf("the keyring doesn't survive a reboot on this platform, so migrated secrets would be lost. Use env: or file: secret references instead, or set --%s to migrate them anyway", flagVolatileKeyring)
+	}
+
+	migrated := 0
+	for name, authInfo := range config.AuthInfos {
+		if targetAuthInfo != "" && name != targetAuthInfo {
+			continue
+		}
+		if !isExecUsingkubelogin(authInfo) {
+			continue
+		}
+
+		n, err := migrateExecSecrets(o, authInfo)
+		if err != nil {
+			return 0, fmt.Errorf("unable to migrate secrets of user %q: %w", name, err)
+		}
+		klog.V(5).Infof("migrated %d secrets of user %q", n, name)
+		migrated += n
+	}
+
+	if migrated == 0 {
+		return 0, nil
+	}
+	return migrated, clientcmd.ModifyConfig(pathOptions, config, true)
+}
+
+func migrateExecSecrets(o Options, authInfo *api.AuthInfo) (int, error) {
+	cacheDir := getExecArg(authInfo, argAuthRecordCacheDir)
+	if cacheDir == "" {
+		cacheDir = getExecArg(authInfo, argTokenCacheDir)
+	}
+	if cacheDir == "" {
+		cacheDir = o.TokenOptions.AuthRecordCacheDir
+	}
+	tenantID := getExecArg(authInfo, argTenantID)
+	clientID := getExecArg(authInfo, argClientID)
+	username := getExecArg(authInfo, argUsername)
+
+	store := func(secret, flag string) (string, error) {
+		nameParts := []string{tenantID, clientID, flag}
+		if flag == flagPassword {
+			nameParts = []string{tenantID, clientID, username, flag}
+		}
+		return setKeyringSecret(cacheDir, token.KeyringSecretName(nameParts...), secret)
+	}
+
+	migrated := 0
+	args := authInfo.Exec.Args
+	for i := 0; i < len(args); i++ {
+		arg, value, hasValue := strings.Cut(args[i], "=")
+		flag, ok := secretArgs[arg]
+		if !ok {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				continue
+			}
+			i++
+			value = args[i]
+		}
+		if value == "" || token.IsSecretRef(value) {
+			continue
+		}
+		ref, err := store(value, flag)
+		if err != nil {
+			return 0, err
+		}
+		if hasValue {
+			args[i] = arg + "=" + ref
+		} else {
+			args[i] = ref
+		}
+		migrated++
+	}
+
+	for i, e := range authInfo.Exec.Env {
+		flag, ok := secretEnvVars[e.Name]
+		if !ok || e.Value == "" || token.IsSecretRef(e.Value) {
+			continue
+		}
+		ref, err := store(e.Value, flag)
+		if err != nil {
+			return 0, err
+		}
+		authInfo.Exec.Env[i].Value = ref
+		migrated++
+	}
+
+	return migrated, nil
+}
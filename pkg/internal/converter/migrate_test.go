@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+	"github.com/Azure/kubelogin/pkg/internal/token"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestMigrateSecrets(t *testing.T) {
+	original := keyringSecretsPersist
+	defer func() { keyringSecretsPersist = original }()
+	keyringSecretsPersist = func() bool { return true }
+
+	cacheDir := t.TempDir()
+	config := createValidTestConfigs("aks1", "aks2", execName, "", nil, nil, "")
+	config.AuthInfos["aks1"] = &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			Command: execName,
+			Args: []string{
+				getTokenCommand,
+				argLoginMethod, token.ServicePrincipalLogin,
+				argServerID, "serverID",
+				argClientID, "clientID",
+				argTenantID, "tenantID",
+				argClientSecret, "client-secret",
+				argAuthRecordCacheDir, cacheDir,
+			},
+		},
+	}
+	config.AuthInfos["aks2"] = &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			Command: execName,
+			Args: []string{
+				getTokenCommand,
+				argLoginMethod, token.ROPCLogin,
+				argServerID, "serverID",
+				argClientID, "clientID",
+				argTenantID, "tenantID",
+				argUsername, "user",
+				argPassword + "=env:MY_PASSWORD",
+				argAuthRecordCacheDir, cacheDir,
+			},
+			Env: []clientcmdapi.ExecEnvVar{
+				{Name: env.AzureClientCertificatePassword, Value: "cert-password"},
+				{Name: "OTHER", Value: "value"},
+			},
+		},
+	}
+
+	kubeconfigFile := filepath.Join(t.TempDir(), "config")
+	fs := &pflag.FlagSet{}
+	o := Options{
+		Flags: fs,
+		configFlags: genericclioptions.NewTestConfigFlags().
+			WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, "aks1", &clientcmd.ConfigOverrides{}, nil)),
+	}
+	o.AddMigrateSecretsFlags(fs)
+
+	migrated, err := MigrateSecrets(o, &clientcmd.PathOptions{
+		LoadingRules: &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigFile},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, migrated)
+
+	converted, err := clientcmd.LoadFromFile(kubeconfigFile)
+	require.NoError(t, err)
+
+	secretName := token.KeyringSecretName("tenantID", "clientID", flagClientSecret)
+	assert.Equal(t, token.SecretRefKeyringPrefix+secretName, getExecArg(converted.AuthInfos["aks1"], argClientSecret))
+	secret, err := token.GetKeyringSecret(cacheDir, secretName)
+	require.NoError(t, err)
+	assert.Equal(t, "client-secret", secret)
+
+	// references are left untouched
+	assert.Contains(t, converted.AuthInfos["aks2"].Exec.Args, argPassword+"=env:MY_PASSWORD")
+
+	certPasswordName := token.KeyringSecretName("tenantID", "clientID", flagClientCertPassword)
+	assert.Equal(t, []clientcmdapi.ExecEnvVar{
+		{Name: env.AzureClientCertificatePassword, Value: token.SecretRefKeyringPrefix + certPasswordName},
+		{Name: "OTHER", Value: "value"},
+	}, converted.AuthInfos["aks2"].Exec.Env)
+	secret, err = token.GetKeyringSecret(cacheDir, certPasswordName)
+	require.NoError(t, err)
+	assert.Equal(t, "cert-password", secret)
+}
+
+func TestMigrateSecretsUnknownContext(t *testing.T) {
+	config := createValidTestConfigs("aks1", "aks2", execName, "", nil, []string{getTokenCommand}, "")
+	fs := &pflag.FlagSet{}
+	o := Options{
+		Flags: fs,
+		configFlags: genericclioptions.NewTestConfigFlags().
+			WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, "aks1", &clientcmd.ConfigOverrides{}, nil)),
+	}
+	o.AddMigrateSecretsFlags(fs)
+	require.NoError(t, fs.Set(flagContext, "missing"))
+
+	_, err := MigrateSecrets(o, &clientcmd.PathOptions{})
+	assert.EqualError(t, err, `no context exists with the name: "missing"`)
+}
+
+func TestMigrateSecretsVolatileKeyring(t *testing.T) {
+	original := keyringSecretsPersist
+	defer func() { keyringSecretsPersist = original }()
+	keyringSecretsPersist = func() bool { return false }
+
+	config := createValidTestConfigs("aks1", "aks2", execName, "", nil, []string{getTokenCommand}, "")
+	fs := &pflag.FlagSet{}
+	o := Options{
+		Flags: fs,
+		configFlags: genericclioptions.NewTestConfigFlags().
+			WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, "aks1", &clientcmd.ConfigOverrides{}, nil)),
+	}
+	o.AddMigrateSecretsFlags(fs)
+
+	_, err := MigrateSecrets(o, &clientcmd.PathOptions{})
+	assert.ErrorContains(t, err, "the keyring doesn't survive a reboot on this platform")
+
+	require.NoError(t, fs.Set(flagVolatileKeyring, "true"))
+	migrated, err := MigrateSecrets(o, &clientcmd.PathOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, migrated)
+}
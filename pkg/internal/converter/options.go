@@ -16,6 +16,12 @@ type Options struct {
 	// context is the kubeconfig context name
 	context        string
 	azureConfigDir string
+	// provideClusterInfo moves per-cluster settings into the cluster's exec extension
+	provideClusterInfo bool
+	// plaintextSecrets writes literal secrets to the exec args instead of keyring references
+	plaintextSecrets bool
+	// volatileKeyring stores literal secrets in the keyring even when it doesn't survive a reboot
+	volatileKeyring bool
 }
 
 func stringptr(str string) *string { return &str }
@@ -34,9 +40,31 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	}
 	fs.StringVar(&o.context, flagContext, "", "The name of the kubeconfig context to use")
 	fs.StringVar(&o.azureConfigDir, flagAzureConfigDir, "", "Azure CLI config path")
+	fs.BoolVar(&o.provideClusterInfo, flagProvideClusterInfo, false,
+		fmt.Sprintf("set provideClusterInfo in the exec plugin and store server-id, tenant-id and pop-claims in the cluster's %s extension instead of args", token.ExecClusterExtensionName))
+	fs.BoolVar(&o.plaintextSecrets, flagPlaintextSecrets, false,
+		"write client secret and passwords to the kubeconfig as plain text instead of storing them in the keyring. Secret references such as env:NAME and file:/path are always written as is")
+	o.addVolatileKeyringFlag(fs)
 	o.TokenOptions.AddFlags(fs)
 }
 
+// AddMigrateSecretsFlags adds the flags used by the migrate-secrets command
+func (o *Options) AddMigrateSecretsFlags(fs *pflag.FlagSet) {
+	o.TokenOptions = token.NewOptions(true)
+	if cf, ok := o.configFlags.(*genericclioptions.ConfigFlags); ok {
+		cf.AddFlags(fs)
+	}
+	fs.StringVar(&o.context, flagContext, "", "The name of the kubeconfig context to use")
+	fs.StringVar(&o.TokenOptions.AuthRecordCacheDir, flagAuthRecordCacheDir, o.TokenOptions.AuthRecordCacheDir,
+		"directory to cache authentication record. Used when the exec plugin does not specify --cache-dir")
+	o.addVolatileKeyringFlag(fs)
+}
+
+func (o *Options) addVolatileKeyringFlag(fs *pflag.FlagSet) {
+	fs.BoolVar(&o.volatileKeyring, flagVolatileKeyring, false,
+		"store secrets in the keyring even when it doesn't survive a reboot, such as the kernel keyring on Linux. get-token fails to resolve the secrets after a reboot")
+}
+
 func (o *Options) Validate() error {
 	return o.TokenOptions.Validate()
 }
@@ -46,7 +74,7 @@ func (o *Options) UpdateFromEnv() {
 }
 
 func (o *Options) ToString() string {
-	return fmt.Sprintf("Context: %s, %s", o.context, o.TokenOptions.ToString())
+	return fmt.Sprintf("Context: %s, ProvideClusterInfo: %t, %s", o.context, o.provideClusterInfo, o.TokenOptions.ToString())
 }
 
 func (o *Options) isSet(name string) bool {
@@ -0,0 +1,253 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+const (
+	argTokenCacheDir = "--token-cache-dir"
+	// authRecordFile is the authentication record of kubelogin versions keeping a single one,
+	// and authRecordDir holds the records per account
+	authRecordFile = "auth.json"
+	authRecordDir  = "records"
+)
+
+// checkStorage checks platform-specific secure storage used by the PoP token cache,
+// the token cache and keyring secrets
+func checkStorage() Result {
+	r := Result{Check: "storage"}
+	if err := popcache.StorageError(); err != nil {
+		r.Status = StatusWarn
+		r.Message = fmt.Sprintf("secure storage is unavailable, PoP tokens are not cached unless --pop-cache-key or --pop-cache-passphrase is set and keyring secrets cannot be used: %s", err)
+		r.Remediation = storageRemediation(runtime.GOOS)
+		return r
+	}
+	r.Status = StatusPass
+	r.Message = "secure storage is available"
+	return r
+}
+
+// storageRemediation tells how to make the secure storage of the OS available, or to do without it
+func storageRemediation(goos string) string {
+	const fallback = "or set --pop-cache-key or --pop-cache-passphrase to encrypt the caches in files instead"
+	switch goos {
+	case "linux":
+		return "secure storage uses the kernel keyring: make sure the kernel supports keyrings and the keyctl syscalls are allowed, which container runtimes often block with seccomp, and that the user or session keyring is reachable, " + fallback
+	case "darwin":
+		return "unlock the login Keychain, " + fallback
+	default:
+		return "make sure DPAPI can be used by the user, " + fallback
+	}
+}
+
+// checkConfig checks the kubelogin config file holding profiles
+func checkConfig() Result {
+	path := token.ConfigFile()
+	r := Result{Check: "config " + path}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		r.Status = StatusPass
+		r.Message = "config file does not exist"
+		return r
+	}
+	c, err := token.LoadConfig(path)
+	if err != nil {
+		r.Status = StatusFail
+		r.Message = err.Error()
+		r.Remediation = "fix or remove " + path
+		return r
+	}
+	r.Status = StatusPass
+	r.Message = fmt.Sprintf("%d profile(s)", len(c.Profiles))
+	return r
+}
+
+// checkCacheDir checks the cache directory and the authentication records it holds
+func checkCacheDir(dir string) []Result {
+	check := "cache " + dir
+	fi, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Result{{Check: check, Status: StatusPass, Message: "cache directory does not exist yet"}}
+	}
+	if err != nil {
+		return []Result{{Check: check, Status: StatusFail, Message: err.Error(), Remediation: "make the cache directory accessible or use --cache-dir"}}
+	}
+	if !fi.IsDir() {
+		return []Result{{Check: check, Status: StatusFail, Message: "cache path is not a directory", Remediation: "remove the file or use --cache-dir"}}
+	}
+
+	results := []Result{checkPermissions(check, dir, fi.Mode(), 0700)}
+	results = append(results, checkAuthRecord(filepath.Join(dir, authRecordFile))...)
+	records, _ := filepath.Glob(filepath.Join(dir, authRecordDir, "*.json"))
+	for _, record := range records {
+		results = append(results, checkAuthRecord(record)...)
+	}
+	return results
+}
+
+// checkAuthRecord checks the permissions and the content of an authentication record
+func checkAuthRecord(authRecord string) []Result {
+	fi, err := os.Stat(authRecord)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return []Result{{Check: authRecord, Status: StatusFail, Message: err.Error(), Remediation: "remove " + authRecord}}
+	}
+	results := []Result{checkPermissions(authRecord, authRecord, fi.Mode(), 0600)}
+
+	b, err := os.ReadFile(authRecord)
+	if err == nil && len(b) > 0 && !json.Valid(b) {
+		err = errors.New("invalid JSON")
+	}
+	if err != nil {
+		results = append(results, Result{
+			Check:       authRecord,
+			Status:      StatusFail,
+			Message:     fmt.Sprintf("unable to read authentication record: %s", err),
+			Remediation: "remove " + authRecord + " and log in again",
+		})
+	}
+	return results
+}
+
+// checkPermissions warns when group or others have access to path
+func checkPermissions(check, path string, mode fs.FileMode, want fs.FileMode) Result {
+	if runtime.GOOS == "windows" {
+		return Result{Check: check, Status: StatusPass, Message: "permissions are not checked on Windows"}
+	}
+	perm := mode.Perm()
+	if perm&0077 != 0 {
+		return Result{
+			Check:       check,
+			Status:      StatusWarn,
+			Message:     fmt.Sprintf("permissions %#o allow access by other users", perm),
+			Remediation: fmt.Sprintf("chmod %#o %s", want, path),
+		}
+	}
+	return Result{Check: check, Status: StatusPass, Message: fmt.Sprintf("permissions %#o", perm)}
+}
+
+// checkExec checks the exec plugin of a kubeconfig user and returns the cache directory it uses
+func (o *Options) checkExec(user string, exec *api.ExecConfig) ([]Result, string) {
+	check := "user " + user
+	opts, err := token.NewOptionsFromExecArgs(exec.Args)
+	if err != nil {
+		return []Result{{
+			Check:       check,
+			Status:      StatusFail,
+			Message:     fmt.Sprintf("unable to parse exec args: %s", err),
+			Remediation: "run kubelogin convert-kubeconfig",
+		}}, ""
+	}
+	if err := opts.UpdateFromProfile(); err != nil {
+		return []Result{{
+			Check:       check,
+			Status:      StatusFail,
+			Message:     err.Error(),
+			Remediation: "add the profile to " + token.ConfigFile() + " or remove --profile from the exec args",
+		}}, ""
+	}
+
+	var results []Result
+	add := func(status Status, message, remediation string) {
+		results = append(results, Result{Check: check, Status: status, Message: message, Remediation: remediation})
+	}
+
+	for _, arg := range exec.Args {
+		if arg == argTokenCacheDir || strings.HasPrefix(arg, argTokenCacheDir+"=") {
+			add(StatusWarn, "--token-cache-dir is deprecated", "replace --token-cache-dir with --cache-dir")
+			break
+		}
+	}
+
+	if opts.ServerID == "" && !exec.ProvideClusterInfo {
+		add(StatusFail, "--server-id is not set", "run kubelogin convert-kubeconfig with --server-id")
+	}
+
+	literal := 0
+	for _, s := range []string{opts.ClientSecret, opts.ClientCertPassword, opts.Password} {
+		if s != "" && !token.IsSecretRef(s) {
+			literal++
+		}
+	}
+	if literal > 0 {
+		add(StatusWarn, fmt.Sprintf("%d secret(s) are stored in plain text in kubeconfig", literal), "run kubelogin migrate-secrets")
+	}
+
+	tools := map[string]string{
+		token.AzureCLILogin:          "az",
+		token.AzureDeveloperCLILogin: "azd",
+	}
+	if tool, ok := tools[opts.LoginMethod]; ok {
+		if _, err := o.lookPath(tool); err != nil {
+			add(StatusFail, fmt.Sprintf("%s login requires %s, which is not found in PATH", opts.LoginMethod, tool), fmt.Sprintf("install %s or add it to PATH", tool))
+		}
+	}
+
+	if overrides := opts.EnvOverrides(execLookupEnv(exec.Env, o.lookupEnv)); len(overrides) > 0 {
+		add(StatusWarn,
+			fmt.Sprintf("environment variables override exec args: %s", strings.Join(overrides, ", ")),
+			"unset the environment variables or add --flags-override-environment to the exec args")
+	}
+
+	if len(results) == 0 {
+		add(StatusPass, fmt.Sprintf("%s login is configured", opts.LoginMethod), "")
+	}
+	return results, opts.AuthRecordCacheDir
+}
+
+// checkClock compares the local clock with the Date header returned by the authority
+func (o *Options) checkClock(ctx context.Context) Result {
+	r := Result{Check: "clock"}
+	skew, err := o.clockSkew(ctx)
+	switch {
+	case err != nil:
+		r.Status = StatusWarn
+		r.Message = fmt.Sprintf("unable to check the local clock against %s: %s", o.clockCheckURL, err)
+		r.Remediation = "check network connectivity to Microsoft Entra ID"
+	case skew > maxClockSkew:
+		r.Status = StatusFail
+		r.Message = fmt.Sprintf("local clock is off by %s", skew.Round(time.Second))
+		r.Remediation = "synchronize the local clock, e.g. enable NTP"
+	default:
+		r.Status = StatusPass
+		r.Message = fmt.Sprintf("local clock is off by %s", skew.Round(time.Second))
+	}
+	return r
+}
+
+func (o *Options) clockSkew(ctx context.Context) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, o.clockCheckURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header: %w", err)
+	}
+	skew := o.now().Sub(date)
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew, nil
+}
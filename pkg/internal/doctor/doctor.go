@@ -0,0 +1,214 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusPass Status = "PASS"
+	StatusWarn Status = "WARN"
+	StatusFail Status = "FAIL"
+
+	flagContext  = "context"
+	flagCacheDir = "cache-dir"
+
+	defaultClockCheckURL = "https://login.microsoftonline.com/"
+	// maxClockSkew is the clock skew tolerated by Microsoft Entra ID and the API server
+	maxClockSkew = 5 * time.Minute
+)
+
+// Result is the outcome of a check with the remediation to apply when it did not pass
+type Result struct {
+	Check       string `json:"check"`
+	Status      Status `json:"status"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+type Options struct {
+	configFlags genericclioptions.RESTClientGetter
+	// context is the kubeconfig context name
+	context  string
+	cacheDir string
+
+	clockCheckURL string
+	httpClient    *http.Client
+	lookPath      func(file string) (string, error)
+	lookupEnv     func(key string) (string, bool)
+	now           func() time.Time
+}
+
+func stringptr(str string) *string { return &str }
+
+func New() Options {
+	configFlags := &genericclioptions.ConfigFlags{
+		KubeConfig: stringptr(""),
+	}
+	return Options{
+		configFlags:   configFlags,
+		cacheDir:      token.GetDefaultCacheDir(),
+		clockCheckURL: defaultClockCheckURL,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+		lookPath:      exec.LookPath,
+		lookupEnv:     os.LookupEnv,
+		now:           time.Now,
+	}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	if cf, ok := o.configFlags.(*genericclioptions.ConfigFlags); ok {
+		cf.AddFlags(fs)
+	}
+	fs.StringVar(&o.context, flagContext, "", "The name of the kubeconfig context to check. Defaults to every user using kubelogin")
+	fs.StringVar(&o.cacheDir, flagCacheDir, o.cacheDir, "directory to cache authentication record")
+}
+
+// Run runs every check and writes the results. It returns an error when a check failed.
+func Run(ctx context.Context, o Options, w io.Writer) error {
+	results := []Result{checkStorage(), checkConfig()}
+
+	cacheDirs := []string{o.cacheDir}
+	userResults, userCacheDirs, err := o.checkKubeconfig()
+	if err != nil {
+		results = append(results, Result{
+			Check:       "kubeconfig",
+			Status:      StatusFail,
+			Message:     err.Error(),
+			Remediation: "check --kubeconfig, KUBECONFIG and --context",
+		})
+	}
+	for _, dir := range userCacheDirs {
+		if !contains(cacheDirs, dir) {
+			cacheDirs = append(cacheDirs, dir)
+		}
+	}
+	for _, dir := range cacheDirs {
+		results = append(results, checkCacheDir(dir)...)
+	}
+	results = append(results, userResults...)
+	results = append(results, o.checkClock(ctx))
+
+	if err := writeResults(w, results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == StatusFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// checkKubeconfig checks the exec plugin of every kubeconfig user using kubelogin and
+// returns the cache directories they use
+func (o *Options) checkKubeconfig() ([]Result, []string, error) {
+	config, err := o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to load kubeconfig: %s", err)
+	}
+
+	targetAuthInfo := ""
+	if o.context != "" {
+		if config.Contexts[o.context] == nil {
+			return nil, nil, fmt.Errorf("no context exists with the name: %q", o.context)
+		}
+		targetAuthInfo = config.Contexts[o.context].AuthInfo
+	}
+
+	names := make([]string, 0, len(config.AuthInfos))
+	for name := range config.AuthInfos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		results   []Result
+		cacheDirs []string
+	)
+	for _, name := range names {
+		authInfo := config.AuthInfos[name]
+		if targetAuthInfo != "" && name != targetAuthInfo {
+			continue
+		}
+		if authInfo.Exec == nil || !strings.Contains(strings.ToLower(authInfo.Exec.Command), "kubelogin") {
+			continue
+		}
+		userResults, cacheDir := o.checkExec(name, authInfo.Exec)
+		results = append(results, userResults...)
+		if cacheDir != "" && !contains(cacheDirs, cacheDir) {
+			cacheDirs = append(cacheDirs, cacheDir)
+		}
+	}
+
+	if len(results) == 0 {
+		results = append(results, Result{
+			Check:       "kubeconfig",
+			Status:      StatusWarn,
+			Message:     "no kubeconfig user uses the kubelogin exec plugin",
+			Remediation: "run kubelogin convert-kubeconfig",
+		})
+	}
+	return results, cacheDirs, nil
+}
+
+func writeResults(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "STATUS\tCHECK\tMESSAGE"); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Status, r.Check, r.Message); err != nil {
+			return err
+		}
+		if r.Status != StatusPass && r.Remediation != "" {
+			if _, err := fmt.Fprintf(tw, "\t\t-> %s\n", r.Remediation); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func contains(a []string, x string) bool {
+	for _, n := range a {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
+
+// execLookupEnv looks up the env of the exec plugin first, like the process kubectl starts
+func execLookupEnv(execEnv []api.ExecEnvVar, lookupEnv func(string) (string, bool)) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		for _, e := range execEnv {
+			if e.Name == name {
+				return e.Value, true
+			}
+		}
+		return lookupEnv(name)
+	}
+}
@@ -0,0 +1,305 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+func newTestOptions(t *testing.T, config *clientcmdapi.Config) Options {
+	return Options{
+		configFlags: genericclioptions.NewTestConfigFlags().
+			WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, config.CurrentContext, &clientcmd.ConfigOverrides{}, nil)),
+		cacheDir:   t.TempDir(),
+		httpClient: http.DefaultClient,
+		lookPath: func(file string) (string, error) {
+			return "", errors.New("not found")
+		},
+		lookupEnv: func(key string) (string, bool) { return "", false },
+		now:       time.Now,
+	}
+}
+
+func newExecAuthInfo(args ...string) *clientcmdapi.AuthInfo {
+	return &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			Command: "kubelogin",
+			Args:    append([]string{"get-token"}, args...),
+		},
+	}
+}
+
+func statusOf(results []Result) []Status {
+	var statuses []Status
+	for _, r := range results {
+		statuses = append(statuses, r.Status)
+	}
+	return statuses
+}
+
+func TestCheckExec(t *testing.T) {
+	testCases := []struct {
+		name        string
+		args        []string
+		env         []clientcmdapi.ExecEnvVar
+		clusterInfo bool
+		osEnv       map[string]string
+		expected    []Status
+		contains    string
+	}{
+		{
+			name:     "configured",
+			args:     []string{"--login", "spn", "--server-id", "server-id", "--client-secret", "env:SECRET"},
+			expected: []Status{StatusPass},
+			contains: "spn login is configured",
+		},
+		{
+			name:     "deprecated token cache dir",
+			args:     []string{"--server-id", "server-id", "--token-cache-dir=/tmp/cache"},
+			expected: []Status{StatusWarn},
+			contains: "--token-cache-dir is deprecated",
+		},
+		{
+			name:     "missing server id",
+			args:     []string{"--login", "devicecode"},
+			expected: []Status{StatusFail},
+			contains: "--server-id is not set",
+		},
+		{
+			name:        "server id from cluster info",
+			args:        []string{"--login", "devicecode"},
+			clusterInfo: true,
+			expected:    []Status{StatusPass},
+		},
+		{
+			name:     "server id from profile",
+			args:     []string{"--profile", "shared"},
+			expected: []Status{StatusPass},
+		},
+		{
+			name:     "profile not found",
+			args:     []string{"--profile", "missing"},
+			expected: []Status{StatusFail},
+			contains: `profile "missing" not found`,
+		},
+		{
+			name:     "literal secrets",
+			args:     []string{"--login", "ropc", "--server-id", "server-id", "--username", "user", "--password", "password"},
+			expected: []Status{StatusWarn},
+			contains: "1 secret(s) are stored in plain text",
+		},
+		{
+			name:     "az not in PATH",
+			args:     []string{"--login", "azurecli", "--server-id", "server-id"},
+			expected: []Status{StatusFail},
+			contains: "which is not found in PATH",
+		},
+		{
+			name:     "exec env overrides",
+			args:     []string{"--login", "spn", "--server-id", "server-id", "--client-id", "client-id"},
+			env:      []clientcmdapi.ExecEnvVar{{Name: "AZURE_CLIENT_ID", Value: "other"}},
+			expected: []Status{StatusWarn},
+			contains: "AZURE_CLIENT_ID",
+		},
+		{
+			name:     "process env overrides",
+			args:     []string{"--login", "spn", "--server-id", "server-id", "--tenant-id", "tenant-id"},
+			osEnv:    map[string]string{"AZURE_TENANT_ID": "other"},
+			expected: []Status{StatusWarn},
+			contains: "AZURE_TENANT_ID",
+		},
+		{
+			name:     "env override disabled",
+			args:     []string{"--login", "spn", "--server-id", "server-id", "--disable-environment-override"},
+			osEnv:    map[string]string{"AZURE_TENANT_ID": "other"},
+			expected: []Status{StatusPass},
+		},
+	}
+
+	writeTestConfig(t, "profiles:\n  shared:\n    login: spn\n    server-id: server-id\n")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newTestOptions(t, clientcmdapi.NewConfig())
+			o.lookupEnv = func(key string) (string, bool) {
+				v, ok := tc.osEnv[key]
+				return v, ok
+			}
+			exec := newExecAuthInfo(tc.args...).Exec
+			exec.Env = tc.env
+			exec.ProvideClusterInfo = tc.clusterInfo
+
+			results, _ := o.checkExec("user", exec)
+			assert.Equal(t, tc.expected, statusOf(results))
+			if tc.contains != "" {
+				assert.Contains(t, results[0].Message, tc.contains)
+			}
+		})
+	}
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	t.Setenv(env.KubeloginConfig, path)
+	return path
+}
+
+func TestCheckConfig(t *testing.T) {
+	t.Run("not exist", func(t *testing.T) {
+		t.Setenv(env.KubeloginConfig, filepath.Join(t.TempDir(), "config.yaml"))
+		assert.Equal(t, StatusPass, checkConfig().Status)
+	})
+
+	t.Run("profiles", func(t *testing.T) {
+		writeTestConfig(t, "profiles:\n  shared:\n    login: spn\n")
+		r := checkConfig()
+		assert.Equal(t, StatusPass, r.Status)
+		assert.Equal(t, "1 profile(s)", r.Message)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		writeTestConfig(t, "profiles: [")
+		assert.Equal(t, StatusFail, checkConfig().Status)
+	})
+}
+
+func TestCheckCacheDir(t *testing.T) {
+	t.Run("not exist", func(t *testing.T) {
+		results := checkCacheDir(filepath.Join(t.TempDir(), "missing"))
+		assert.Equal(t, []Status{StatusPass}, statusOf(results))
+	})
+
+	t.Run("invalid auth record", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, authRecordFile), []byte("{"), 0600))
+		results := checkCacheDir(dir)
+		assert.Equal(t, []Status{StatusPass, StatusPass, StatusFail}, statusOf(results))
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("permissions are not checked on Windows")
+		}
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, authRecordFile), []byte("{}"), 0644))
+		results := checkCacheDir(dir)
+		assert.Equal(t, []Status{StatusWarn, StatusWarn}, statusOf(results))
+		assert.Equal(t, "chmod 0600 "+filepath.Join(dir, authRecordFile), results[1].Remediation)
+	})
+
+	t.Run("auth records per account", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0700))
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, authRecordDir), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, authRecordDir, "a.json"), []byte("{}"), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, authRecordDir, "b.json"), []byte("{"), 0600))
+		results := checkCacheDir(dir)
+		assert.Equal(t, []Status{StatusPass, StatusPass, StatusPass, StatusFail}, statusOf(results))
+		assert.Equal(t, filepath.Join(dir, authRecordDir, "b.json"), results[3].Check)
+	})
+}
+
+func TestStorageRemediation(t *testing.T) {
+	assert.Contains(t, storageRemediation("linux"), "kernel keyring")
+	assert.Contains(t, storageRemediation("darwin"), "Keychain")
+	assert.Contains(t, storageRemediation("windows"), "DPAPI")
+	for _, goos := range []string{"linux", "darwin", "windows"} {
+		assert.Contains(t, storageRemediation(goos), "--pop-cache-key or --pop-cache-passphrase")
+	}
+}
+
+func TestNewCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("KUBECACHEDIR", dir)
+	assert.Equal(t, dir, New().cacheDir)
+}
+
+func TestCheckClock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		date     string
+		expected Status
+	}{
+		{name: "in sync", date: now.Add(time.Minute).Format(http.TimeFormat), expected: StatusPass},
+		{name: "skewed", date: now.Add(-10 * time.Minute).Format(http.TimeFormat), expected: StatusFail},
+		{name: "no date", date: "", expected: StatusWarn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Date"] = []string{tc.date}
+			}))
+			defer srv.Close()
+
+			o := newTestOptions(t, clientcmdapi.NewConfig())
+			o.clockCheckURL = srv.URL
+			o.now = func() time.Time { return now }
+			assert.Equal(t, tc.expected, o.checkClock(context.Background()).Status)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Setenv(env.KubeloginConfig, filepath.Join(t.TempDir(), "config.yaml"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	config := clientcmdapi.NewConfig()
+	config.AuthInfos["devicecode"] = newExecAuthInfo("--login", "devicecode")
+	config.AuthInfos["spn"] = newExecAuthInfo("--login", "spn", "--server-id", "server-id")
+	config.AuthInfos["token"] = &clientcmdapi.AuthInfo{Token: "token"}
+	config.Contexts["devicecode"] = &clientcmdapi.Context{AuthInfo: "devicecode"}
+	config.Contexts["spn"] = &clientcmdapi.Context{AuthInfo: "spn"}
+
+	t.Run("all users", func(t *testing.T) {
+		o := newTestOptions(t, config)
+		o.clockCheckURL = srv.URL
+		var buf bytes.Buffer
+		err := Run(context.Background(), o, &buf)
+		assert.EqualError(t, err, "1 check(s) failed")
+		assert.Contains(t, buf.String(), "user devicecode")
+		assert.Contains(t, buf.String(), "user spn")
+		assert.Contains(t, buf.String(), "-> run kubelogin convert-kubeconfig with --server-id")
+		assert.NotContains(t, buf.String(), "user token")
+	})
+
+	t.Run("context", func(t *testing.T) {
+		o := newTestOptions(t, config)
+		o.clockCheckURL = srv.URL
+		o.context = "spn"
+		var buf bytes.Buffer
+		require.NoError(t, Run(context.Background(), o, &buf))
+		assert.NotContains(t, buf.String(), "user devicecode")
+		assert.Contains(t, buf.String(), "user spn")
+	})
+
+	t.Run("unknown context", func(t *testing.T) {
+		o := newTestOptions(t, config)
+		o.clockCheckURL = srv.URL
+		o.context = "missing"
+		var buf bytes.Buffer
+		assert.Error(t, Run(context.Background(), o, &buf))
+		assert.Contains(t, buf.String(), `no context exists with the name: "missing"`)
+	})
+}
@@ -9,6 +9,15 @@ const (
 	KubeloginClientSecret              = "AAD_SERVICE_PRINCIPAL_CLIENT_SECRET"
 	KubeloginClientCertificatePath     = "AAD_SERVICE_PRINCIPAL_CLIENT_CERTIFICATE"
 	KubeloginClientCertificatePassword = "AAD_SERVICE_PRINCIPAL_CLIENT_CERTIFICATE_PASSWORD"
+	KubeloginConfig                    = "KUBELOGIN_CONFIG"
+	KubeloginClaims                    = "KUBELOGIN_CLAIMS"
+	KubeloginEventsFile                = "KUBELOGIN_EVENTS_FILE"
+	KubeloginClientAssertionCommand    = "KUBELOGIN_CLIENT_ASSERTION_COMMAND"
+	KubeloginClientAssertionFile       = "KUBELOGIN_CLIENT_ASSERTION_FILE"
+	KubeloginClientAssertionAudience   = "KUBELOGIN_CLIENT_ASSERTION_AUDIENCE"
+	KubeloginIdentityEndpoint          = "KUBELOGIN_IDENTITY_ENDPOINT"
+	KubeloginPoPCacheKey               = "KUBELOGIN_POP_CACHE_KEY"
+	KubeloginPoPCachePassphrase        = "KUBELOGIN_POP_CACHE_PASSPHRASE"
 
 	// env vars used by Terraform
 	TerraformClientID                  = "ARM_CLIENT_ID"
@@ -19,10 +28,12 @@ const (
 
 	// env vars following azure sdk naming convention
 	AzureAuthorityHost             = "AZURE_AUTHORITY_HOST"
+	AzureClientCertificate         = "AZURE_CLIENT_CERTIFICATE"
 	AzureClientCertificatePassword = "AZURE_CLIENT_CERTIFICATE_PASSWORD"
 	AzureClientCertificatePath     = "AZURE_CLIENT_CERTIFICATE_PATH"
 	AzureClientID                  = "AZURE_CLIENT_ID"
 	AzureClientSecret              = "AZURE_CLIENT_SECRET"
+	AzureEnvironmentFilepath       = "AZURE_ENVIRONMENT_FILEPATH"
 	AzureFederatedTokenFile        = "AZURE_FEDERATED_TOKEN_FILE"
 	AzurePassword                  = "AZURE_PASSWORD"
 	AzureTenantID                  = "AZURE_TENANT_ID"
@@ -32,6 +43,22 @@ const (
 	SystemAccessToken    = "SYSTEM_ACCESSTOKEN"
 	SystemOIDCRequestURI = "SYSTEM_OIDCREQUESTURI"
 
+	// env vars of the OIDC tokens of CI systems
+	GitLabCI                  = "GITLAB_CI"
+	GitLabOIDCToken           = "GITLAB_OIDC_TOKEN"
+	CircleCIOIDCToken         = "CIRCLE_OIDC_TOKEN_V2"
+	BitbucketStepOIDCToken    = "BITBUCKET_STEP_OIDC_TOKEN"
+	BuildkiteAgentAccessToken = "BUILDKITE_AGENT_ACCESS_TOKEN"
+
+	// env vars of the managed identity endpoints of App Service, Cloud Shell and Arc
+	IdentityEndpoint = "IDENTITY_ENDPOINT"
+	IdentityHeader   = "IDENTITY_HEADER"
+	IMDSEndpoint     = "IMDS_ENDPOINT"
+	MSIEndpoint      = "MSI_ENDPOINT"
+
+	// env var of the SPIFFE Workload API endpoint
+	SpiffeEndpointSocket = "SPIFFE_ENDPOINT_SOCKET"
+
 	// env vars used by Azure Pipelines service connections
 	AzureSubscriptionTenantID            = "AZURESUBSCRIPTION_TENANT_ID"
 	AzureSubscriptionServiceConnectionID = "AZURESUBSCRIPTION_SERVICE_CONNECTION_ID"
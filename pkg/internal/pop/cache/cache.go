@@ -14,7 +14,8 @@ import (
 	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/cache"
 )
 
-const popTokenCacheFileName = "pop_tokens.cache"
+// PoPTokenCacheFileName is the file of the cache directory holding the PoP token cache
+const PoPTokenCacheFileName = "pop_tokens.cache"
 
 var (
 	// once ensures storage capability is tested only once per process
@@ -77,7 +78,7 @@ var (
 // getPoPCacheFilePath returns the file path for the PoP token cache.
 // This is separate from the authentication record cache file.
 func getPoPCacheFilePath(cacheDir string) string {
-	return filepath.Join(cacheDir, popTokenCacheFileName)
+	return filepath.Join(cacheDir, PoPTokenCacheFileName)
 }
 
 // Cache implements the MSAL cache.ExportReplace interface using our platform-specific PoP cache.
@@ -91,12 +92,18 @@ type Cache struct {
 // This implementation provides secure storage on all platforms without external dependencies like libsecret on Linux.
 // Following the azidentity pattern, this proactively tests storage capability before creating the cache.
 func NewCache(cacheDir string) (*Cache, error) {
-	cachePath := getPoPCacheFilePath(cacheDir)
+	return newCache(getPoPCacheFilePath(cacheDir))
+}
 
-	// Test storage capability once per process
-	once.Do(testStorage)
-	if storageError != nil {
-		return nil, storageError
+// NewNamedCache creates a cache like NewCache that is stored in the named file under cacheDir,
+// so that MSAL tokens of other flows are kept apart from the PoP tokens.
+func NewNamedCache(cacheDir, fileName string) (*Cache, error) {
+	return newCache(filepath.Join(cacheDir, fileName))
+}
+
+func newCache(cachePath string) (*Cache, error) {
+	if err := StorageError(); err != nil {
+		return nil, err
 	}
 
 	acc, err := storage(cachePath)
@@ -109,6 +116,13 @@ func NewCache(cacheDir string) (*Cache, error) {
 	}, nil
 }
 
+// StorageError reports why platform-specific secure storage can't be used, or nil when it is
+// available. The storage capability is tested only once per process.
+func StorageError() error {
+	once.Do(testStorage)
+	return storageError
+}
+
 // Export saves the current PoP token cache state to platform-specific secure storage.
 // This method is called by MSAL to persist PoP tokens across application restarts.
 func (c *Cache) Export(ctx context.Context, marshaler cache.Marshaler, hints cache.ExportHints) error {
@@ -143,6 +157,12 @@ func (c *Cache) Clear(ctx context.Context) error {
 	return c.accessor.Delete(ctx)
 }
 
+// PersistentStorage reports whether data kept in platform-specific secure storage survives a
+// reboot. It doesn't on Linux, where the encryption key is kept in the kernel keyring.
+func PersistentStorage() bool {
+	return persistentStorage
+}
+
 // NewSecureAccessor creates a new platform-specific secure storage accessor.
 // This can be used for storing other sensitive data like RSA private keys
 // using the same encrypted storage infrastructure as the PoP token cache.
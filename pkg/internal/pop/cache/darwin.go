@@ -8,6 +8,9 @@ import (
 	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
 )
 
+// persistentStorage is true as Keychain items survive a reboot
+const persistentStorage = true
+
 // storage creates a platform-specific accessor for macOS for MSAL cache
 func storage(cachePath string) (accessor.Accessor, error) {
 	// Use the filename from cachePath as the account identifier
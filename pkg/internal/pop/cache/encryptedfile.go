@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	aescbc "github.com/Azure/kubelogin/pkg/internal/pop/cache/internal/aescbc"
+	"github.com/Azure/kubelogin/pkg/internal/pop/cache/internal/jwe"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
+)
+
+const (
+	// EncryptionKeySize is the size of the keys encrypting files with NewEncryptedFileAccessor
+	EncryptionKeySize = 32
+
+	// encryptedFileKeyID identifies the data encrypted with a user-provided key
+	encryptedFileKeyID = "kubelogin-file"
+
+	// passphraseSaltFileName is the file in the cache directory holding the salt of the keys
+	// derived from a passphrase
+	passphraseSaltFileName = "pop_cache.salt"
+	passphraseSaltSize     = 16
+	// passphraseIterations is the PBKDF2-HMAC-SHA256 iteration count recommended by OWASP
+	passphraseIterations = 600000
+)
+
+var (
+	// derivedKeys memoizes the keys derived from a passphrase and salt, so that PBKDF2 runs
+	// once per process however many caches are opened with the same passphrase
+	derivedKeys   = map[string][]byte{}
+	derivedKeysMu sync.Mutex
+	// deriveKey derives a key with PBKDF2-HMAC-SHA256.
+	// It is a variable to allow overriding in tests.
+	deriveKey = func(passphrase string, salt []byte) ([]byte, error) {
+		return pbkdf2.Key(sha256.New, passphrase, salt, passphraseIterations, EncryptionKeySize)
+	}
+)
+
+// encryptedFile encrypts cache data with a user-provided key and writes the encrypted data to
+// a file, for environments without platform-specific secure storage such as containers without
+// a kernel keyring. The data is encrypted like the Linux keyring implementation does, but it
+// survives as long as the key is provided again. Data encrypted with another key can't be read
+// and is overwritten by the next Write.
+type encryptedFile struct {
+	file string
+	key  []byte
+}
+
+// NewEncryptedFileAccessor creates an accessor of the file at path encrypted with key, for
+// when platform-specific secure storage is unavailable
+func NewEncryptedFileAccessor(path string, key []byte) (accessor.Accessor, error) {
+	return newEncryptedFile(path, key)
+}
+
+// NewEncryptedFileCache creates a cache like NewCache whose PoP tokens are encrypted with key
+// in a file of cacheDir, for when platform-specific secure storage is unavailable
+func NewEncryptedFileCache(cacheDir string, key []byte) (*Cache, error) {
+	acc, err := newEncryptedFile(getPoPCacheFilePath(cacheDir), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PoP cache storage: %w", err)
+	}
+	return &Cache{accessor: acc}, nil
+}
+
+func newEncryptedFile(path string, key []byte) (*encryptedFile, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	return &encryptedFile{file: path, key: append([]byte(nil), key...)}, nil
+}
+
+// ParseEncryptionKey decodes a base64-encoded key, such as the output of `openssl rand -base64 32`
+func ParseEncryptionKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		key, err = base64.RawURLEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, errors.New("encryption key must be base64-encoded")
+	}
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	return key, nil
+}
+
+// DeriveEncryptionKey derives a key from the passphrase with PBKDF2. Its random salt is kept
+// in cacheDir, so that the same passphrase derives the same key on later invocations.
+// PBKDF2 is deliberately slow, so the key is derived once per process for each passphrase
+// and salt, but every invocation of kubelogin derives it again.
+func DeriveEncryptionKey(cacheDir, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	salt, err := loadOrCreateSalt(filepath.Join(cacheDir, passphraseSaltFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKeysMu.Lock()
+	defer derivedKeysMu.Unlock()
+	id := string(salt) + "\x00" + passphrase
+	if key, ok := derivedKeys[id]; ok {
+		return append([]byte(nil), key...), nil
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	derivedKeys[id] = key
+	return append([]byte(nil), key...), nil
+}
+
+// loadOrCreateSalt reads the salt at path, creating it if it doesn't exist. The salt is
+// written to a temporary file first and linked to path, so that concurrent invocations
+// never read a partially written salt and all of them use the first one created.
+func loadOrCreateSalt(path string) ([]byte, error) {
+	salt, err := readSalt(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return salt, err
+	}
+
+	salt = make([]byte, passphraseSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), passphraseSaltFileName+".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write salt: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(salt)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write salt: %w", err)
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			// another invocation created the salt first
+			return readSalt(path)
+		}
+		return nil, fmt.Errorf("failed to write salt: %w", err)
+	}
+	return salt, nil
+}
+
+func readSalt(path string) ([]byte, error) {
+	salt, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read salt: %w", err)
+	}
+	if len(salt) != passphraseSaltSize {
+		return nil, fmt.Errorf("salt %s is corrupted, remove it to derive a new key", path)
+	}
+	return salt, nil
+}
+
+func (f *encryptedFile) Delete(context.Context) error {
+	err := os.Remove(f.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (f *encryptedFile) Read(context.Context) ([]byte, error) {
+	b, err := os.ReadFile(f.file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache data due to error %q", err)
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+	j, err := jwe.ParseCompactFormat(b)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse cache data due to error %q", err)
+	}
+	plaintext, err := j.Decrypt(f.key)
+	if err != nil {
+		// data is unreadable, e.g. encrypted with another key; the next Write will overwrite the file
+		return nil, nil
+	}
+	return plaintext, nil
+}
+
+func (f *encryptedFile) Write(_ context.Context, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	alg, err := aescbc.NewAES128CBCHMACSHA256(f.key)
+	if err != nil {
+		return err
+	}
+	j, err := jwe.Encrypt(data, encryptedFileKeyID, alg)
+	if err != nil {
+		return fmt.Errorf("couldn't encrypt cache data due to error %q", err)
+	}
+	content, err := j.Serialize()
+	if err != nil {
+		return fmt.Errorf("couldn't serialize cache data due to error %q", err)
+	}
+	err = os.WriteFile(f.file, []byte(content), 0600)
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.MkdirAll(filepath.Dir(f.file), 0700)
+		if err == nil {
+			err = os.WriteFile(f.file, []byte(content), 0600)
+		}
+	}
+	return err
+}
+
+var _ accessor.Accessor = (*encryptedFile)(nil)
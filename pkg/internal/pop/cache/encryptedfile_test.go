@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/cache"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEncryptionKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, EncryptionKeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func TestEncryptedFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "data.cache")
+	key := newTestEncryptionKey(t)
+	acc, err := NewEncryptedFileAccessor(path, key)
+	require.NoError(t, err)
+
+	data := []byte("secret data")
+	require.NoError(t, acc.Write(ctx, data))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(b, data), "data must be encrypted at rest")
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	if filepath.Separator == '/' {
+		require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	// another accessor with the same key, e.g. in a later invocation, reads the data
+	acc2, err := NewEncryptedFileAccessor(path, key)
+	require.NoError(t, err)
+	got, err := acc2.Read(ctx)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// data encrypted with another key is unreadable and treated as no data
+	other, err := NewEncryptedFileAccessor(path, newTestEncryptionKey(t))
+	require.NoError(t, err)
+	got, err = other.Read(ctx)
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	require.NoError(t, acc.Delete(ctx))
+	require.NoFileExists(t, path)
+	require.NoError(t, acc.Delete(ctx))
+	got, err = acc.Read(ctx)
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func TestEncryptedFileInvalidKey(t *testing.T) {
+	_, err := NewEncryptedFileAccessor(filepath.Join(t.TempDir(), "data.cache"), []byte("short"))
+	require.ErrorContains(t, err, "must be 32 bytes")
+}
+
+func TestNewEncryptedFileCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewEncryptedFileCache(dir, newTestEncryptionKey(t))
+	require.NoError(t, err)
+
+	data := []byte(`{"AccessToken":{}}`)
+	require.NoError(t, c.Export(ctx, &mockMarshaler{data: data}, cache.ExportHints{}))
+	require.FileExists(t, getPoPCacheFilePath(dir))
+
+	unmarshaler := &mockUnmarshaler{}
+	require.NoError(t, c.Replace(ctx, unmarshaler, cache.ReplaceHints{}))
+	require.Equal(t, data, unmarshaler.data)
+
+	require.NoError(t, c.Clear(ctx))
+	require.NoFileExists(t, getPoPCacheFilePath(dir))
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	key := newTestEncryptionKey(t)
+	for _, s := range []string{
+		base64.StdEncoding.EncodeToString(key),
+		base64.StdEncoding.EncodeToString(key) + "\n",
+		base64.RawURLEncoding.EncodeToString(key),
+	} {
+		got, err := ParseEncryptionKey(s)
+		require.NoError(t, err)
+		require.Equal(t, key, got)
+	}
+
+	_, err := ParseEncryptionKey("not base64!")
+	require.ErrorContains(t, err, "base64")
+	_, err = ParseEncryptionKey(base64.StdEncoding.EncodeToString([]byte("too short")))
+	require.ErrorContains(t, err, "must be 32 bytes")
+}
+
+func TestDeriveEncryptionKey(t *testing.T) {
+	original := deriveKey
+	defer func() { deriveKey = original }()
+	derivations := 0
+	deriveKey = func(passphrase string, salt []byte) ([]byte, error) {
+		derivations++
+		return original(passphrase, salt)
+	}
+
+	dir := t.TempDir()
+	key1, err := DeriveEncryptionKey(dir, "passphrase")
+	require.NoError(t, err)
+	require.Len(t, key1, EncryptionKeySize)
+	salt, err := os.ReadFile(filepath.Join(dir, passphraseSaltFileName))
+	require.NoError(t, err)
+	require.Len(t, salt, passphraseSaltSize)
+
+	key2, err := DeriveEncryptionKey(dir, "passphrase")
+	require.NoError(t, err)
+	require.Equal(t, key1, key2, "the salt must be reused")
+
+	key3, err := DeriveEncryptionKey(dir, "another passphrase")
+	require.NoError(t, err)
+	require.NotEqual(t, key1, key3)
+
+	key4, err := DeriveEncryptionKey(t.TempDir(), "passphrase")
+	require.NoError(t, err)
+	require.NotEqual(t, key1, key4, "each cache directory has its own salt")
+
+	_, err = DeriveEncryptionKey(dir, "passphrase")
+	require.NoError(t, err)
+	require.Equal(t, 3, derivations, "the key of a passphrase and salt must be derived once per process")
+
+	_, err = DeriveEncryptionKey(dir, "")
+	require.ErrorContains(t, err, "must not be empty")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, passphraseSaltFileName), []byte("bad"), 0600))
+	_, err = DeriveEncryptionKey(dir, "passphrase")
+	require.ErrorContains(t, err, "corrupted")
+}
@@ -40,6 +40,9 @@ type keyring struct {
 	keyID, ringID     int
 }
 
+// persistentStorage is false as the keyring key, and thus the data, is lost when the system shuts down
+const persistentStorage = false
+
 // storage creates a platform-specific accessor for Linux
 func storage(cachePath string) (accessor.Accessor, error) {
 	return newKeyring(cachePath)
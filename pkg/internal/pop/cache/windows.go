@@ -6,6 +6,9 @@ import (
 	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
 )
 
+// persistentStorage is true as files encrypted with DPAPI survive a reboot
+const persistentStorage = true
+
 // storage creates a platform-specific accessor for Windows
 func storage(cachePath string) (accessor.Accessor, error) {
 	return accessor.New(cachePath)
@@ -74,10 +74,49 @@ func NewPublicClient(
 	return client, nil
 }
 
+// AcquirePoPTokenSilent acquires a PoP token from the cache of the given public client
+// without user interaction. It returns an error when no cached account can be used.
+func AcquirePoPTokenSilent(
+	ctx context.Context,
+	popClaims map[string]string,
+	scopes []string,
+	client public.Client,
+	msalOptions *MsalClientOptions,
+	popKey PoPKey,
+) (string, int64, error) {
+	authnScheme := &PoPAuthenticationScheme{
+		Host:   popClaims["u"],
+		PoPKey: popKey,
+	}
+
+	accounts, err := client.Accounts(ctx)
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to list cached accounts: %w", err)
+	}
+	if len(accounts) == 0 {
+		return "", -1, fmt.Errorf("no cached account found")
+	}
+
+	// Use the first account for silent acquisition (single-user cache)
+	result, err := client.AcquireTokenSilent(
+		ctx,
+		scopes,
+		public.WithSilentAccount(accounts[0]),
+		public.WithAuthenticationScheme(authnScheme),
+		public.WithTenantID(msalOptions.TenantID),
+	)
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to create PoP token silently: %w", err)
+	}
+
+	return result.AccessToken, result.ExpiresOn.Unix(), nil
+}
+
 // AcquirePoPTokenInteractive acquires a PoP token using MSAL's interactive login flow with caching.
 // First attempts silent token acquisition if a single account is cached.
 // Uses the provided PoP key for proper token caching.
-// Falls back to interactive authentication if silent acquisition fails or no accounts are cached.
+// Falls back to interactive authentication if silent acquisition fails or no accounts are cached,
+// with interactiveOptions such as public.WithOpenURL to launch a custom browser.
 func AcquirePoPTokenInteractive(
 	ctx context.Context,
 	popClaims map[string]string,
@@ -85,6 +124,7 @@ func AcquirePoPTokenInteractive(
 	client public.Client,
 	msalOptions *MsalClientOptions,
 	popKey PoPKey,
+	interactiveOptions ...public.AcquireInteractiveOption,
 ) (string, int64, error) {
 
 	authnScheme := &PoPAuthenticationScheme{
@@ -95,17 +135,9 @@ func AcquirePoPTokenInteractive(
 	// Try silent token acquisition first if accounts exist
 	accounts, err := client.Accounts(ctx)
 	if err == nil && len(accounts) > 0 {
-		// Use the first account for silent acquisition (single-user cache)
-		account := accounts[0]
-		result, err := client.AcquireTokenSilent(
-			ctx,
-			scopes,
-			public.WithSilentAccount(account),
-			public.WithAuthenticationScheme(authnScheme),
-			public.WithTenantID(msalOptions.TenantID),
-		)
+		token, expiresOn, err := AcquirePoPTokenSilent(ctx, popClaims, scopes, client, msalOptions, popKey)
 		if err == nil {
-			return result.AccessToken, result.ExpiresOn.Unix(), nil
+			return token, expiresOn, nil
 		}
 
 		// Silent acquisition failed - clear cache to ensure single-user behavior
@@ -120,11 +152,64 @@ func AcquirePoPTokenInteractive(
 	result, err := client.AcquireTokenInteractive(
 		ctx,
 		scopes,
+		append([]public.AcquireInteractiveOption{
+			public.WithAuthenticationScheme(authnScheme),
+			public.WithTenantID(msalOptions.TenantID),
+		}, interactiveOptions...)...,
+	)
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to create PoP token with interactive flow: %w", err)
+	}
+
+	return result.AccessToken, result.ExpiresOn.Unix(), nil
+}
+
+// AcquirePoPTokenBySignIn acquires a PoP token for the user signed in by signIn, e.g. by redeeming
+// an authorization code or with the device code flow.
+// First attempts silent token acquisition if accounts are cached, like AcquirePoPTokenInteractive.
+// MSAL cannot acquire a PoP token with these flows, so the refresh token of the signed in user
+// is exchanged for a PoP token silently.
+func AcquirePoPTokenBySignIn(
+	ctx context.Context,
+	popClaims map[string]string,
+	scopes []string,
+	client public.Client,
+	msalOptions *MsalClientOptions,
+	popKey PoPKey,
+	signIn func(ctx context.Context) (public.AuthResult, error),
+) (string, int64, error) {
+	accounts, err := client.Accounts(ctx)
+	if err == nil && len(accounts) > 0 {
+		token, expiresOn, err := AcquirePoPTokenSilent(ctx, popClaims, scopes, client, msalOptions, popKey)
+		if err == nil {
+			return token, expiresOn, nil
+		}
+
+		// Silent acquisition failed - clear cache to ensure single-user behavior
+		clearErr := clearAllAccounts(ctx, client)
+		if clearErr != nil {
+			return "", -1, fmt.Errorf("failed to clear cache after silent acquisition failure: %w", clearErr)
+		}
+	}
+
+	signedIn, err := signIn(ctx)
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to create PoP token after sign-in: %w", err)
+	}
+
+	authnScheme := &PoPAuthenticationScheme{
+		Host:   popClaims["u"],
+		PoPKey: popKey,
+	}
+	result, err := client.AcquireTokenSilent(
+		ctx,
+		scopes,
+		public.WithSilentAccount(signedIn.Account),
 		public.WithAuthenticationScheme(authnScheme),
 		public.WithTenantID(msalOptions.TenantID),
 	)
 	if err != nil {
-		return "", -1, fmt.Errorf("failed to create PoP token with interactive flow: %w", err)
+		return "", -1, fmt.Errorf("failed to create PoP token after sign-in: %w", err)
 	}
 
 	return result.AccessToken, result.ExpiresOn.Unix(), nil
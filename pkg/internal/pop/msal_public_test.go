@@ -223,6 +223,38 @@ func TestClearAllAccounts(t *testing.T) {
 	}
 }
 
+func TestAcquirePoPTokenSilentWithoutAccounts(t *testing.T) {
+	msalClientOptions := &MsalClientOptions{
+		Authority: "https://login.microsoftonline.com/" + testutils.TestTenantID,
+		ClientID:  testutils.TestClientID,
+		Options: azcore.ClientOptions{
+			Cloud: cloud.AzurePublic,
+		},
+		TenantID: testutils.TestTenantID,
+	}
+
+	client, err := NewPublicClient(msalClientOptions)
+	if err != nil {
+		t.Fatalf("failed to create public client: %s", err)
+	}
+	popKey, err := GetSwPoPKey()
+	if err != nil {
+		t.Fatalf("failed to create PoP key: %s", err)
+	}
+
+	_, _, err = AcquirePoPTokenSilent(
+		context.Background(),
+		map[string]string{"u": "testhost"},
+		[]string{testutils.TestServerID + "/.default"},
+		client,
+		msalClientOptions,
+		popKey,
+	)
+	if err == nil || err.Error() != "no cached account found" {
+		t.Errorf("expected no cached account error, got: %v", err)
+	}
+}
+
 func TestGetPublicClient(t *testing.T) {
 	httpClient := &http.Client{}
 	authority := "https://login.microsoftonline.com/" + testutils.TenantID
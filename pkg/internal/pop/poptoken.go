@@ -14,10 +14,13 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
+
 	"github.com/Azure/kubelogin/pkg/internal/pop/cache"
 )
 
-const popKeyFileName = "pop_rsa_key.cache"
+// PoPKeyFileName is the file of the cache directory holding the persistent PoP key
+const PoPKeyFileName = "pop_rsa_key.cache"
 
 // PoPKey is a generic interface for PoP key properties and methods
 type PoPKey interface {
@@ -115,13 +118,33 @@ func GetSwPoPKey() (*SwKey, error) {
 // - macOS: macOS Keychain
 // - Windows: Windows Credential Manager
 func GetSwPoPKeyPersistent(cacheDir string) (*SwKey, error) {
-	key, err := loadOrGenerateRSAKey(cacheDir)
+	// Create a secure storage accessor using our cache infrastructure
+	acc, err := cache.NewSecureAccessor(getPoPKeyFilePath(cacheDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secure storage accessor: %w", err)
+	}
+	key, err := loadOrGenerateRSAKey(acc)
 	if err != nil {
 		return nil, fmt.Errorf("error loading or generating persistent RSA private key from secure storage: %w", err)
 	}
 	return GetSwPoPKeyWithRSAKey(key)
 }
 
+// GetSwPoPKeyEncryptedFile loads or generates a persistent PoP key like GetSwPoPKeyPersistent,
+// kept in a file of cacheDir encrypted with encryptionKey for environments without
+// platform-specific secure storage, such as containers.
+func GetSwPoPKeyEncryptedFile(cacheDir string, encryptionKey []byte) (*SwKey, error) {
+	acc, err := cache.NewEncryptedFileAccessor(getPoPKeyFilePath(cacheDir), encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encrypted file accessor: %w", err)
+	}
+	key, err := loadOrGenerateRSAKey(acc)
+	if err != nil {
+		return nil, fmt.Errorf("error loading or generating persistent RSA private key from encrypted file: %w", err)
+	}
+	return GetSwPoPKeyWithRSAKey(key)
+}
+
 func GetSwPoPKeyWithRSAKey(rsaKey *rsa.PrivateKey) (*SwKey, error) {
 	key, err := generateSwKey(rsaKey)
 	if err != nil {
@@ -170,25 +193,19 @@ func getJWK(eB64 string, nB64 string, keyID string) string {
 
 // getPoPKeyFilePath returns the file path for the persistent PoP RSA key.
 func getPoPKeyFilePath(cacheDir string) string {
-	return filepath.Join(cacheDir, popKeyFileName)
+	return filepath.Join(cacheDir, PoPKeyFileName)
 }
 
-// loadOrGenerateRSAKey loads an existing RSA key from secure storage or generates a new one if it doesn't exist.
-// This uses the same encrypted storage infrastructure as our PoP token cache, providing platform-specific secure storage:
+// loadOrGenerateRSAKey loads an existing RSA key from storage or generates a new one if it doesn't exist.
+// The storage is the same encrypted storage infrastructure as our PoP token cache, either platform-specific secure storage:
 // - Linux: Kernel keyrings with encrypted files
 // - macOS: macOS Keychain
 // - Windows: Windows Credential Manager
-func loadOrGenerateRSAKey(cacheDir string) (*rsa.PrivateKey, error) {
-	// Create a secure storage accessor using our cache infrastructure
-	popKeyPath := getPoPKeyFilePath(cacheDir)
-	accessor, err := cache.NewSecureAccessor(popKeyPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create secure storage accessor: %w", err)
-	}
-
+// or a file encrypted with a user-provided key when platform-specific secure storage is unavailable.
+func loadOrGenerateRSAKey(accessor accessor.Accessor) (*rsa.PrivateKey, error) {
 	ctx := context.Background()
 
-	// Try to load existing key from secure storage
+	// Try to load existing key from storage
 	if keyData, err := accessor.Read(ctx); err == nil && len(keyData) > 0 {
 		if key, err := parseRSAKeyFromPEM(keyData); err == nil {
 			return key, nil
@@ -202,16 +219,26 @@ func loadOrGenerateRSAKey(cacheDir string) (*rsa.PrivateKey, error) {
 		return nil, fmt.Errorf("error generating RSA private key: %w", err)
 	}
 
-	// Save the key to secure storage
+	// Save the key to storage
 	keyPEM := marshalRSAKeyToPEM(key)
 	if err := accessor.Write(ctx, keyPEM); err != nil {
 		// Log warning but don't fail - key generation succeeded
-		fmt.Fprintf(os.Stderr, "Warning: failed to persist PoP key to secure storage: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Warning: failed to persist PoP key to storage: %v\n", err)
 	}
 
 	return key, nil
 }
 
+// ParsePersistedPoPKey returns the PoP key of the PEM data GetSwPoPKeyPersistent stores, so
+// that a persisted key can be described without generating one
+func ParsePersistedPoPKey(pemData []byte) (*SwKey, error) {
+	key, err := parseRSAKeyFromPEM(pemData)
+	if err != nil {
+		return nil, err
+	}
+	return GetSwPoPKeyWithRSAKey(key)
+}
+
 // parseRSAKeyFromPEM parses an RSA private key from PEM data
 func parseRSAKeyFromPEM(pemData []byte) (*rsa.PrivateKey, error) {
 	block, _ := pem.Decode(pemData)
@@ -238,11 +265,19 @@ func marshalRSAKeyToPEM(key *rsa.PrivateKey) []byte {
 
 // GetPoPKeyByPolicy returns a PoP key based on cache directory availability.
 // Uses persistent key storage when cacheDir is provided, ephemeral keys otherwise.
+// The persistent key is kept in platform-specific secure storage, or in a file encrypted with
+// encryptionKey when it is set because secure storage is unavailable.
 // This centralizes the key selection logic used across all PoP credential implementations.
-func GetPoPKeyByPolicy(cacheDir string) (*SwKey, error) {
+func GetPoPKeyByPolicy(cacheDir string, encryptionKey []byte) (*SwKey, error) {
 	if cacheDir != "" {
 		// Use persistent key storage when cache directory is available
-		popKey, err := GetSwPoPKeyPersistent(cacheDir)
+		getPersistentKey := GetSwPoPKeyPersistent
+		if encryptionKey != nil {
+			getPersistentKey = func(cacheDir string) (*SwKey, error) {
+				return GetSwPoPKeyEncryptedFile(cacheDir, encryptionKey)
+			}
+		}
+		popKey, err := getPersistentKey(cacheDir)
 		if err != nil {
 			return nil, fmt.Errorf("unable to get persistent PoP key: %w", err)
 		}
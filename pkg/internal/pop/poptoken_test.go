@@ -121,6 +121,47 @@ func TestSecureKeyStorage(t *testing.T) {
 		// Clean up
 		os.RemoveAll(nonExistentDir)
 	})
+
+	t.Run("GetPoPKeyByPolicy should persist keys in a file encrypted with the encryption key", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		encryptionKey := make([]byte, 32)
+		if _, err := rand.Read(encryptionKey); err != nil {
+			t.Fatalf("Failed to generate encryption key: %v", err)
+		}
+
+		key1, err := GetPoPKeyByPolicy(cacheDir, encryptionKey)
+		if err != nil {
+			t.Fatalf("Failed to generate first key: %v", err)
+		}
+		key2, err := GetPoPKeyByPolicy(cacheDir, encryptionKey)
+		if err != nil {
+			t.Fatalf("Failed to load second key: %v", err)
+		}
+		if key1.KeyID() != key2.KeyID() {
+			t.Errorf("Keys don't match! First KeyID: %s, Second KeyID: %s", key1.KeyID(), key2.KeyID())
+		}
+
+		data, err := os.ReadFile(getPoPKeyFilePath(cacheDir))
+		if err != nil {
+			t.Fatalf("Failed to read the encrypted key file: %v", err)
+		}
+		if strings.Contains(string(data), "PRIVATE KEY") {
+			t.Error("The key file must be encrypted")
+		}
+
+		// a key encrypted with another encryption key can't be read and is replaced
+		otherKey := make([]byte, 32)
+		if _, err := rand.Read(otherKey); err != nil {
+			t.Fatalf("Failed to generate encryption key: %v", err)
+		}
+		key3, err := GetPoPKeyByPolicy(cacheDir, otherKey)
+		if err != nil {
+			t.Fatalf("Failed to generate third key: %v", err)
+		}
+		if key1.KeyID() == key3.KeyID() {
+			t.Error("A key encrypted with another encryption key must not be read")
+		}
+	})
 }
 
 func TestRSAKeyConversion(t *testing.T) {
@@ -173,4 +214,23 @@ func TestRSAKeyConversion(t *testing.T) {
 			t.Errorf("Expected 'invalid PEM block type' error, got: %v", err)
 		}
 	})
+
+	t.Run("ParsePersistedPoPKey should return the PoP key of the persisted key", func(t *testing.T) {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Failed to generate test RSA key: %v", err)
+		}
+		want, err := GetSwPoPKeyWithRSAKey(rsaKey)
+		if err != nil {
+			t.Fatalf("Failed to create PoP key: %v", err)
+		}
+
+		got, err := ParsePersistedPoPKey(marshalRSAKeyToPEM(rsaKey))
+		if err != nil {
+			t.Fatalf("Failed to parse persisted PoP key: %v", err)
+		}
+		if got.JWKThumbprint() != want.JWKThumbprint() {
+			t.Errorf("Expected JWK thumbprint %s, got %s", want.JWKThumbprint(), got.JWKThumbprint())
+		}
+	})
 }
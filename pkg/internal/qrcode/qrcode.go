@@ -0,0 +1,69 @@
+// Package qrcode renders text as a QR code in a terminal. The symbol is encoded by
+// github.com/skip2/go-qrcode at error correction level M.
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+
+	qr "github.com/skip2/go-qrcode"
+)
+
+// quietZone is the width in modules of the light border around the symbol
+const quietZone = 4
+
+// Code is a QR code symbol
+type Code struct {
+	size int
+	// modules are the dark modules indexed by row then column
+	modules [][]bool
+}
+
+// Encode returns the QR code of the smallest version that holds text
+func Encode(text string) (*Code, error) {
+	q, err := qr.New(text, qr.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %d bytes as a QR code: %w", len(text), err)
+	}
+	q.DisableBorder = true
+	modules := q.Bitmap()
+	return &Code{size: len(modules), modules: modules}, nil
+}
+
+// Size is the number of modules on each side of the symbol
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Dark reports whether the module at column x and row y is dark.
+// Modules outside the symbol are light.
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && x < c.size && y >= 0 && y < c.size && c.modules[y][x]
+}
+
+// Terminal renders the symbol with its quiet zone for a terminal, two rows of modules
+// per line. Colors are set explicitly so that the symbol reads the same on light and dark
+// terminal themes.
+func (c *Code) Terminal() string {
+	const (
+		dark  = 0
+		light = 7
+	)
+	color := func(x, y int) int {
+		if c.Dark(x, y) {
+			return dark
+		}
+		return light
+	}
+
+	var sb strings.Builder
+	for y := -quietZone; y < c.size+quietZone; y += 2 {
+		for x := -quietZone; x < c.size+quietZone; x++ {
+			// the upper half block is drawn in the foreground color of the upper module
+			// on the background color of the lower one
+			fmt.Fprintf(&sb, "\x1b[3%d;4%dm▀", color(x, y), color(x, y+1))
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+	return sb.String()
+}
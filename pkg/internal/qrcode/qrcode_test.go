@@ -0,0 +1,44 @@
+package qrcode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	c, err := Encode("https://microsoft.com/devicelogin")
+	require.NoError(t, err)
+	assert.Equal(t, 29, c.Size(), "version 3")
+
+	// finder patterns in three corners
+	for _, corner := range [][2]int{{0, 0}, {c.Size() - 7, 0}, {0, c.Size() - 7}} {
+		for i := range 7 {
+			assert.True(t, c.Dark(corner[0]+i, corner[1]))
+			assert.True(t, c.Dark(corner[0], corner[1]+i))
+		}
+		assert.False(t, c.Dark(corner[0]+1, corner[1]+1))
+		assert.True(t, c.Dark(corner[0]+3, corner[1]+3))
+	}
+	assert.True(t, c.Dark(8, c.Size()-8), "dark module")
+	assert.False(t, c.Dark(-1, 0))
+	assert.False(t, c.Dark(0, c.Size()))
+
+	_, err = Encode(strings.Repeat("a", 2332))
+	assert.ErrorContains(t, err, "failed to encode 2332 bytes as a QR code")
+}
+
+func TestTerminal(t *testing.T) {
+	c, err := Encode("https://microsoft.com/devicelogin")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(c.Terminal(), "\n"), "\n")
+	assert.Len(t, lines, (c.Size()+2*quietZone+1)/2)
+	for _, line := range lines {
+		assert.Equal(t, c.Size()+2*quietZone, strings.Count(line, "▀"))
+		assert.True(t, strings.HasSuffix(line, "\x1b[0m"))
+	}
+	// the first line is the light quiet zone
+	assert.NotContains(t, lines[0], "\x1b[30")
+}
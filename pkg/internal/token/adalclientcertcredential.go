@@ -2,6 +2,8 @@ package token
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"fmt"
 	"strings"
 
@@ -12,10 +14,9 @@ import (
 )
 
 type ADALClientCertCredential struct {
-	oAuthConfig        adal.OAuthConfig
-	clientID           string
-	clientCert         string
-	clientCertPassword string
+	oAuthConfig adal.OAuthConfig
+	clientID    string
+	clientCert  clientCertificate
 }
 
 var _ CredentialProvider = (*ADALClientCertCredential)(nil)
@@ -39,10 +40,9 @@ func newADALClientCertCredential(opts *Options) (CredentialProvider, error) {
 		return nil, fmt.Errorf("failed to create OAuth config: %w", err)
 	}
 	return &ADALClientCertCredential{
-		oAuthConfig:        *oAuthConfig,
-		clientID:           opts.ClientID,
-		clientCert:         opts.ClientCert,
-		clientCertPassword: opts.ClientCertPassword,
+		oAuthConfig: *oAuthConfig,
+		clientID:    opts.ClientID,
+		clientCert:  newClientCertificate(opts),
 	}, nil
 }
 
@@ -56,7 +56,7 @@ func (c *ADALClientCertCredential) Authenticate(ctx context.Context, opts *polic
 
 func (c *ADALClientCertCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
 	// Get the certificate and private key from cert file
-	cert, rsaPrivateKey, err := readCertificate(c.clientCert, c.clientCertPassword)
+	cert, privateKey, err := c.clientCert.read()
 	if err != nil {
 		return azcore.AccessToken{}, fmt.Errorf("failed to read certificate: %w", err)
 	}
@@ -65,14 +65,30 @@ func (c *ADALClientCertCredential) GetToken(ctx context.Context, opts policy.Tok
 	// 1. we only support one resource
 	// 2. we remove the "/.default" suffix from the resource
 	resource := strings.Replace(opts.Scopes[0], "/.default", "", 1)
-	spt, err := adal.NewServicePrincipalTokenFromCertificate(
-		c.oAuthConfig,
-		c.clientID,
-		cert,
-		rsaPrivateKey,
-		resource)
+	var spt *adal.ServicePrincipalToken
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		spt, err = adal.NewServicePrincipalTokenFromCertificate(
+			c.oAuthConfig,
+			c.clientID,
+			cert,
+			key,
+			resource)
+	case *ecdsa.PrivateKey:
+		var assertion *certificateAssertion
+		assertion, err = newCertificateAssertion(cert, key, c.clientID)
+		if err != nil {
+			return azcore.AccessToken{}, err
+		}
+		tokenEndpoint := c.oAuthConfig.TokenEndpoint.String()
+		spt, err = adal.NewServicePrincipalTokenFromFederatedTokenCallback(
+			c.oAuthConfig,
+			c.clientID,
+			func() (string, error) { return assertion.sign(tokenEndpoint) },
+			resource)
+	}
 	if err != nil {
-		return azcore.AccessToken{}, fmt.Errorf("failed to create service principal token using secret: %w", err)
+		return azcore.AccessToken{}, fmt.Errorf("failed to create service principal token using certificate: %w", err)
 	}
 
 	if err := spt.EnsureFreshWithContext(ctx); err != nil {
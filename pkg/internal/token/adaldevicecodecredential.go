@@ -3,8 +3,8 @@ package token
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
@@ -14,8 +14,10 @@ import (
 )
 
 type ADALDeviceCodeCredential struct {
-	oAuthConfig adal.OAuthConfig
-	clientID    string
+	oAuthConfig    adal.OAuthConfig
+	clientID       string
+	prompt         *deviceCodePrompt
+	nonInteractive bool
 }
 
 var _ CredentialProvider = (*ADALDeviceCodeCredential)(nil)
@@ -36,8 +38,10 @@ func newADALDeviceCodeCredential(opts *Options) (CredentialProvider, error) {
 		return nil, fmt.Errorf("failed to create OAuth config: %w", err)
 	}
 	return &ADALDeviceCodeCredential{
-		oAuthConfig: *oAuthConfig,
-		clientID:    opts.ClientID,
+		oAuthConfig:    *oAuthConfig,
+		clientID:       opts.ClientID,
+		prompt:         newDeviceCodePrompt(opts),
+		nonInteractive: opts.isNonInteractive,
 	}, nil
 }
 
@@ -50,6 +54,9 @@ func (c *ADALDeviceCodeCredential) Authenticate(ctx context.Context, opts *polic
 }
 
 func (c *ADALDeviceCodeCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if c.nonInteractive {
+		return azcore.AccessToken{}, errNonInteractiveSession
+	}
 	client := &autorest.Client{}
 	// to keep backward compatibility,
 	// 1. we only support one resource
@@ -60,8 +67,8 @@ func (c *ADALDeviceCodeCredential) GetToken(ctx context.Context, opts policy.Tok
 		return azcore.AccessToken{}, fmt.Errorf("initialing the device code authentication: %w", err)
 	}
 
-	if _, err := fmt.Fprintln(os.Stderr, *deviceCode.Message); err != nil {
-		return azcore.AccessToken{}, fmt.Errorf("prompting the device code message: %w", err)
+	if err := c.prompt.show(newADALDeviceCodeEvent(deviceCode)); err != nil {
+		return azcore.AccessToken{}, err
 	}
 
 	token, err := adal.WaitForUserCompletionWithContext(ctx, client, deviceCode)
@@ -75,3 +82,23 @@ func (c *ADALDeviceCodeCredential) GetToken(ctx context.Context, opts policy.Tok
 func (c *ADALDeviceCodeCredential) NeedAuthenticate() bool {
 	return false
 }
+
+func newADALDeviceCodeEvent(deviceCode *adal.DeviceCode) deviceCodeEvent {
+	e := deviceCodeEvent{
+		VerificationURI: stringValue(deviceCode.VerificationURL),
+		UserCode:        stringValue(deviceCode.UserCode),
+		Message:         stringValue(deviceCode.Message),
+	}
+	if deviceCode.ExpiresIn != nil {
+		expiresOn := time.Now().Add(time.Duration(*deviceCode.ExpiresIn) * time.Second)
+		e.ExpiresOn = &expiresOn
+	}
+	return e
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,184 @@
+package token
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
+)
+
+// defaultAuthCodeRedirectURL is registered for the public clients used with kubelogin.
+// Nothing needs to listen on it: the user copies the redirect URL from the browser.
+const defaultAuthCodeRedirectURL = "http://localhost"
+
+// authCodeDefaultScopes are requested in the authorize URL so that the redeemed code
+// returns an ID token and a refresh token for silent token acquisition
+var authCodeDefaultScopes = []string{"openid", "offline_access", "profile"}
+
+// authCodePrompt runs the authorization code flow with PKCE for sessions without a
+// local browser. The user opens the authorize URL on any machine and pastes the URL
+// it redirects to, or only its code, back into the terminal.
+type authCodePrompt struct {
+	clientID    string
+	redirectURL string
+	loginHint   string
+	in          io.Reader
+	out         io.Writer
+}
+
+func newAuthCodePrompt(opts *Options, in io.Reader, out io.Writer) *authCodePrompt {
+	redirectURL := opts.RedirectURL
+	if redirectURL == "" {
+		redirectURL = defaultAuthCodeRedirectURL
+	}
+	return &authCodePrompt{
+		clientID:    opts.ClientID,
+		redirectURL: redirectURL,
+		loginHint:   opts.LoginHint,
+		in:          in,
+		out:         out,
+	}
+}
+
+// acquireToken prompts the user to sign in and redeems the pasted authorization code
+func (p *authCodePrompt) acquireToken(ctx context.Context, client public.Client, scopes []string, tenantID, claims string) (public.AuthResult, error) {
+	verifier, challenge, err := newPKCE()
+	if err != nil {
+		return public.AuthResult{}, err
+	}
+	state, err := randomURLString(16)
+	if err != nil {
+		return public.AuthResult{}, err
+	}
+
+	urlOpts := []public.AuthCodeURLOption{public.WithTenantID(tenantID), public.WithClaims(claims)}
+	if p.loginHint != "" {
+		urlOpts = append(urlOpts, public.WithLoginHint(p.loginHint))
+	}
+	authURL, err := client.AuthCodeURL(ctx, p.clientID, p.redirectURL, append(slices.Clone(scopes), authCodeDefaultScopes...), urlOpts...)
+	if err != nil {
+		return public.AuthResult{}, fmt.Errorf("failed to create authorize URL: %w", err)
+	}
+	authURL, err = withAuthCodeParams(authURL, challenge, state)
+	if err != nil {
+		return public.AuthResult{}, err
+	}
+
+	fmt.Fprintf(p.out, "To sign in, open the following URL in a browser on any machine:\n\n%s\n\n", authURL)
+	fmt.Fprintf(p.out, "After signing in, the browser is redirected to %s, which may fail to load.\n", p.redirectURL)
+	fmt.Fprint(p.out, "Paste the URL from the address bar, or only its code parameter: ")
+
+	input, err := readLine(ctx, p.in)
+	if err != nil {
+		return public.AuthResult{}, fmt.Errorf("failed to read the authorization code: %w", err)
+	}
+	code, err := parseAuthCodeResponse(input, state)
+	if err != nil {
+		return public.AuthResult{}, err
+	}
+
+	result, err := client.AcquireTokenByAuthCode(ctx, code, p.redirectURL, scopes,
+		public.WithChallenge(verifier), public.WithTenantID(tenantID), public.WithClaims(claims))
+	if err != nil {
+		return public.AuthResult{}, fmt.Errorf("failed to redeem the authorization code: %w", err)
+	}
+	return result, nil
+}
+
+// withAuthCodeParams adds the PKCE challenge and the state to the authorize URL,
+// which MSAL's public client does not expose
+func withAuthCodeParams(authURL, challenge, state string) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse authorize URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+	q.Set("state", state)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// parseAuthCodeResponse returns the authorization code from the pasted redirect URL,
+// checking its state, or the pasted input itself when it is only the code
+func parseAuthCodeResponse(input, state string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", errors.New("no authorization code was entered")
+	}
+	if !strings.Contains(input, "code=") && !strings.Contains(input, "error=") {
+		return input, nil
+	}
+
+	query := input
+	if i := strings.Index(input, "?"); i >= 0 {
+		query = input[i+1:]
+	}
+	// the response mode may also put the parameters in the fragment
+	query = strings.Replace(query, "#", "&", 1)
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the redirect URL: %w", err)
+	}
+	if e := values.Get("error"); e != "" {
+		return "", fmt.Errorf("sign-in failed: %s: %s", e, values.Get("error_description"))
+	}
+	if s := values.Get("state"); s != "" && s != state {
+		return "", errors.New("the redirect URL does not belong to this sign-in: state mismatch")
+	}
+	code := values.Get("code")
+	if code == "" {
+		return "", errors.New("the redirect URL has no code parameter")
+	}
+	return code, nil
+}
+
+// newPKCE returns a PKCE code verifier and its S256 challenge
+func newPKCE() (verifier string, challenge string, err error) {
+	verifier, err = randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// readLine reads a line from r, returning early when the context is done
+func readLine(ctx context.Context, r io.Reader) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		line, err := bufio.NewReader(r).ReadString('\n')
+		if errors.Is(err, io.EOF) && line != "" {
+			err = nil
+		}
+		ch <- result{line: line, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		return res.line, res.err
+	}
+}
@@ -0,0 +1,55 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
+)
+
+const (
+	authCodeTokenCacheFileName    = "authcode_tokens.cache"
+	authCodeCAETokenCacheFileName = "authcode_tokens_cae.cache"
+)
+
+// AuthCodeCredential authenticates with the authorization code flow, letting the user
+// sign in with a browser on another machine and paste the redirect URL back
+type AuthCodeCredential struct {
+	publicClientCredential
+	prompt *authCodePrompt
+}
+
+var _ CredentialProvider = (*AuthCodeCredential)(nil)
+
+func newAuthCodeCredential(opts *Options, record azidentity.AuthenticationRecord) (CredentialProvider, error) {
+	if opts.ClientID == "" {
+		return nil, fmt.Errorf("client ID cannot be empty")
+	}
+	if opts.TenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+
+	client, err := newUserPublicClient(opts, authCodeTokenCacheFileName, authCodeCAETokenCacheFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authorization code credential: %w", err)
+	}
+	prompt := newAuthCodePrompt(opts, os.Stdin, os.Stderr)
+	return &AuthCodeCredential{
+		publicClientCredential: publicClientCredential{
+			client:         client,
+			record:         record,
+			tenantID:       opts.TenantID,
+			nonInteractive: opts.isNonInteractive,
+			signIn: func(ctx context.Context, scopes []string, tenantID, claims string) (public.AuthResult, error) {
+				return prompt.acquireToken(ctx, client, scopes, tenantID, claims)
+			},
+		},
+		prompt: prompt,
+	}, nil
+}
+
+func (c *AuthCodeCredential) Name() string {
+	return "AuthCodeCredential"
+}
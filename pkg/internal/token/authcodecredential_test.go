@@ -0,0 +1,302 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSTS serves the OpenID configuration, the device code and the token endpoint of a tenant
+type fakeSTS struct {
+	server        *httptest.Server
+	tokenRequests []url.Values
+}
+
+func newFakeSTS(t *testing.T) *fakeSTS {
+	t.Helper()
+	sts := &fakeSTS{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant/v2.0/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		base := sts.server.URL + "/tenant"
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": base + "/oauth2/v2.0/authorize",
+			"token_endpoint":         base + "/oauth2/v2.0/token",
+			"issuer":                 base + "/v2.0",
+		})
+	})
+	mux.HandleFunc("/tenant/oauth2/v2.0/devicecode", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"user_code":        "USERCODE",
+			"device_code":      "device-code",
+			"verification_uri": "https://microsoft.com/devicelogin",
+			"expires_in":       300,
+			"interval":         1,
+			"message":          "To sign in, enter the code USERCODE",
+		})
+	})
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		sts.tokenRequests = append(sts.tokenRequests, r.PostForm)
+		if r.PostForm.Get("grant_type") == "authorization_code" && r.PostForm.Get("code") != "the-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"AADSTS70000: invalid code"}`))
+			return
+		}
+		encode := func(v any) string {
+			b, _ := json.Marshal(v)
+			return base64.RawURLEncoding.EncodeToString(b)
+		}
+		idToken := encode(map[string]string{"alg": "none"}) + "." + encode(map[string]any{
+			"iss":                sts.server.URL + "/tenant/v2.0",
+			"aud":                "client-id",
+			"tid":                "tenant",
+			"oid":                "uid",
+			"sub":                "sub",
+			"preferred_username": "user@example.com",
+			"iat":                time.Now().Unix(),
+			"nbf":                time.Now().Unix(),
+			"exp":                time.Now().Add(time.Hour).Unix(),
+		}) + "."
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  fmt.Sprintf("access-token-%d", len(sts.tokenRequests)),
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh-token",
+			"id_token":      idToken,
+			"client_info":   encode(map[string]string{"uid": "uid", "utid": "tenant"}),
+		})
+	})
+	sts.server = httptest.NewTLSServer(mux)
+	t.Cleanup(sts.server.Close)
+	return sts
+}
+
+// redirectPaster plays the user of the prompt: it reads the authorize URL the prompt
+// writes and pastes back the redirect URL with the code
+type redirectPaster struct {
+	output  bytes.Buffer
+	code    string
+	authURL *url.URL
+	input   io.Reader
+}
+
+func (p *redirectPaster) Write(b []byte) (int, error) {
+	return p.output.Write(b)
+}
+
+func (p *redirectPaster) Read(b []byte) (int, error) {
+	if p.input == nil {
+		u, err := url.Parse(regexp.MustCompile(`https://\S+`).FindString(p.output.String()))
+		if err != nil {
+			return 0, err
+		}
+		p.authURL = u
+		p.input = strings.NewReader(fmt.Sprintf("http://localhost/?code=%s&state=%s&session_state=abc\n", p.code, u.Query().Get("state")))
+	}
+	return p.input.Read(b)
+}
+
+func newTestAuthCodeCredential(t *testing.T, sts *fakeSTS, record azidentity.AuthenticationRecord, nonInteractive bool) (*AuthCodeCredential, *redirectPaster) {
+	t.Helper()
+	cred, err := newAuthCodeCredential(&Options{
+		ClientID:                 "client-id",
+		TenantID:                 "tenant",
+		AuthorityHost:            sts.server.URL + "/",
+		DisableInstanceDiscovery: true,
+		LoginHint:                "user@example.com",
+		httpClient:               sts.server.Client(),
+		isNonInteractive:         nonInteractive,
+	}, record)
+	require.NoError(t, err)
+	paster := &redirectPaster{code: "the-code"}
+	c := cred.(*AuthCodeCredential)
+	c.prompt.in = paster
+	c.prompt.out = paster
+	return c, paster
+}
+
+func TestAuthCodeCredential(t *testing.T) {
+	scopes := []string{"server-id/.default"}
+
+	t.Run("authenticate redeems the pasted code with PKCE", func(t *testing.T) {
+		sts := newFakeSTS(t)
+		cred, paster := newTestAuthCodeCredential(t, sts, azidentity.AuthenticationRecord{}, false)
+
+		record, err := cred.Authenticate(context.Background(), &policy.TokenRequestOptions{Scopes: scopes})
+		require.NoError(t, err)
+		assert.Equal(t, "user@example.com", record.Username)
+		assert.Equal(t, "tenant", record.TenantID)
+		assert.Equal(t, "client-id", record.ClientID)
+		assert.Equal(t, "uid.tenant", record.HomeAccountID)
+
+		query := paster.authURL.Query()
+		assert.Equal(t, "http://localhost", query.Get("redirect_uri"))
+		assert.Equal(t, "user@example.com", query.Get("login_hint"))
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+		assert.Contains(t, query.Get("scope"), "offline_access")
+		require.Len(t, sts.tokenRequests, 1)
+		verifier := sts.tokenRequests[0].Get("code_verifier")
+		sum := sha256.Sum256([]byte(verifier))
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), query.Get("code_challenge"))
+
+		// the token of the redeemed code is returned silently
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: scopes})
+		require.NoError(t, err)
+		assert.Equal(t, "access-token-1", token.Token)
+		assert.Len(t, sts.tokenRequests, 1)
+	})
+
+	t.Run("get token prompts when no account is cached", func(t *testing.T) {
+		sts := newFakeSTS(t)
+		cred, paster := newTestAuthCodeCredential(t, sts, azidentity.AuthenticationRecord{HomeAccountID: "uid.tenant", Username: "user@example.com"}, false)
+
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: scopes})
+		require.NoError(t, err)
+		assert.Equal(t, "access-token-1", token.Token)
+		assert.NotNil(t, paster.authURL)
+	})
+
+	t.Run("get token does not prompt in a non-interactive session", func(t *testing.T) {
+		sts := newFakeSTS(t)
+		cred, paster := newTestAuthCodeCredential(t, sts, azidentity.AuthenticationRecord{HomeAccountID: "uid.tenant", Username: "user@example.com"}, true)
+
+		_, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: scopes})
+		assert.ErrorIs(t, err, errNonInteractiveSession)
+		assert.Nil(t, paster.authURL)
+		assert.Empty(t, sts.tokenRequests)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		sts := newFakeSTS(t)
+		cred, paster := newTestAuthCodeCredential(t, sts, azidentity.AuthenticationRecord{}, false)
+		paster.code = "wrong-code"
+
+		_, err := cred.Authenticate(context.Background(), &policy.TokenRequestOptions{Scopes: scopes})
+		assert.ErrorContains(t, err, "failed to redeem the authorization code")
+	})
+}
+
+func TestNewAuthCodeCredential(t *testing.T) {
+	testCases := []struct {
+		name           string
+		opts           *Options
+		expectErrorMsg string
+	}{
+		{
+			name: "valid options",
+			opts: &Options{ClientID: "client-id", TenantID: "tenant-id"},
+		},
+		{
+			name:           "missing client ID",
+			opts:           &Options{TenantID: "tenant-id"},
+			expectErrorMsg: "client ID cannot be empty",
+		},
+		{
+			name:           "missing tenant ID",
+			opts:           &Options{ClientID: "client-id"},
+			expectErrorMsg: "tenant ID cannot be empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cred, err := newAuthCodeCredential(tc.opts, azidentity.AuthenticationRecord{})
+			if tc.expectErrorMsg != "" {
+				assert.EqualError(t, err, tc.expectErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "AuthCodeCredential", cred.Name())
+		})
+	}
+}
+
+func TestNewAuthCodeCredentialWithPoP(t *testing.T) {
+	testCases := []struct {
+		name           string
+		opts           *Options
+		expectErrorMsg string
+	}{
+		{
+			name: "valid options",
+			opts: &Options{ClientID: "client-id", TenantID: "tenant-id", IsPoPTokenEnabled: true, PoPTokenClaims: "u=test-cluster"},
+		},
+		{
+			name:           "missing client ID",
+			opts:           &Options{TenantID: "tenant-id", IsPoPTokenEnabled: true, PoPTokenClaims: "u=test-cluster"},
+			expectErrorMsg: "client ID cannot be empty",
+		},
+		{
+			name:           "missing PoP claims",
+			opts:           &Options{ClientID: "client-id", TenantID: "tenant-id", IsPoPTokenEnabled: true},
+			expectErrorMsg: "unable to parse PoP claims: failed to parse PoP token claims: no claims provided",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cred, err := newAuthCodeCredentialWithPoP(tc.opts)
+			if tc.expectErrorMsg != "" {
+				assert.EqualError(t, err, tc.expectErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "AuthCodeCredentialWithPoP", cred.Name())
+			assert.False(t, cred.NeedAuthenticate())
+		})
+	}
+}
+
+func TestParseAuthCodeResponse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{name: "redirect URL", input: "http://localhost/?code=abc&state=xyz&session_state=1\n", want: "abc"},
+		{name: "redirect URL with fragment", input: "http://localhost/#code=abc&state=xyz", want: "abc"},
+		{name: "code only", input: "  abc\n", want: "abc"},
+		{name: "empty", input: "\n", wantErr: "no authorization code was entered"},
+		{name: "state mismatch", input: "http://localhost/?code=abc&state=other", wantErr: "state mismatch"},
+		{name: "error", input: "http://localhost/?error=access_denied&error_description=denied&state=xyz", wantErr: "sign-in failed: access_denied: denied"},
+		{name: "no code", input: "http://localhost/?code=&state=xyz", wantErr: "the redirect URL has no code parameter"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseAuthCodeResponse(tc.input, "xyz")
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestReadLineCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, w := io.Pipe()
+	defer w.Close()
+	_, err := readLine(ctx, r)
+	assert.ErrorIs(t, err, context.Canceled)
+}
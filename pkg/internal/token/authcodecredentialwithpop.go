@@ -0,0 +1,111 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/kubelogin/pkg/internal/pop"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
+)
+
+type AuthCodeCredentialWithPoP struct {
+	popClaims      map[string]string
+	client         public.Client
+	options        *pop.MsalClientOptions
+	keyProvider    PoPKeyProvider
+	prompt         *authCodePrompt
+	nonInteractive bool
+}
+
+var _ CredentialProvider = (*AuthCodeCredentialWithPoP)(nil)
+
+func newAuthCodeCredentialWithPoP(opts *Options) (CredentialProvider, error) {
+	if opts.ClientID == "" {
+		return nil, fmt.Errorf("client ID cannot be empty")
+	}
+	if opts.TenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	popClaimsMap, err := parsePoPClaims(opts.PoPTokenClaims)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse PoP claims: %w", err)
+	}
+
+	authorityURL, err := url.JoinPath(opts.GetCloudConfiguration().ActiveDirectoryAuthorityHost, opts.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct authority URL: %w", err)
+	}
+
+	msalOpts := &pop.MsalClientOptions{
+		Authority:                authorityURL,
+		ClientID:                 opts.ClientID,
+		TenantID:                 opts.TenantID,
+		DisableInstanceDiscovery: opts.DisableInstanceDiscovery,
+	}
+	if opts.httpClient != nil {
+		msalOpts.Options.Transport = opts.httpClient
+	}
+
+	client, err := pop.NewPublicClient(
+		msalOpts,
+		pop.WithCustomCachePublic(opts.GetPoPTokenCache()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create public client: %w", err)
+	}
+
+	return &AuthCodeCredentialWithPoP{
+		options:        msalOpts,
+		client:         client,
+		popClaims:      popClaimsMap,
+		keyProvider:    opts.GetPoPKeyProvider(),
+		prompt:         newAuthCodePrompt(opts, os.Stdin, os.Stderr),
+		nonInteractive: opts.isNonInteractive,
+	}, nil
+}
+
+func (c *AuthCodeCredentialWithPoP) Name() string {
+	return "AuthCodeCredentialWithPoP"
+}
+
+func (c *AuthCodeCredentialWithPoP) Authenticate(ctx context.Context, opts *policy.TokenRequestOptions) (azidentity.AuthenticationRecord, error) {
+	return azidentity.AuthenticationRecord{}, errAuthenticateNotSupported
+}
+
+func (c *AuthCodeCredentialWithPoP) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	popKey, err := c.keyProvider.GetPoPKey()
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	var (
+		token              string
+		expirationTimeUnix int64
+	)
+	if c.nonInteractive {
+		// only cached accounts can be used when kubectl cannot prompt the user
+		token, expirationTimeUnix, err = pop.AcquirePoPTokenSilent(ctx, c.popClaims, opts.Scopes, c.client, c.options, popKey)
+		if err != nil {
+			return azcore.AccessToken{}, fmt.Errorf("%w: %s", errNonInteractiveSession, err)
+		}
+	} else {
+		redeem := func(ctx context.Context) (public.AuthResult, error) {
+			return c.prompt.acquireToken(ctx, c.client, opts.Scopes, c.options.TenantID, "")
+		}
+		token, expirationTimeUnix, err = pop.AcquirePoPTokenBySignIn(ctx, c.popClaims, opts.Scopes, c.client, c.options, popKey, redeem)
+		if err != nil {
+			return azcore.AccessToken{}, fmt.Errorf("failed to create PoP token using authorization code login: %w", err)
+		}
+	}
+	return azcore.AccessToken{Token: token, ExpiresOn: time.Unix(expirationTimeUnix, 0)}, nil
+}
+
+func (c *AuthCodeCredentialWithPoP) NeedAuthenticate() bool {
+	return false
+}
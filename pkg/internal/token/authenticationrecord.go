@@ -1,11 +1,30 @@
 package token
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/google/uuid"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// LegacyAuthRecordFileName is the authentication record shared by all contexts before
+	// the records were kept per account
+	LegacyAuthRecordFileName = "auth.json"
+	// AuthRecordDirName is the directory of the cache directory holding the authentication records
+	AuthRecordDirName = "records"
+	// LegacyPersistentCacheSuffix is appended to the file of a record migrated from auth.json to
+	// mark that the tokens of its account are in the persistent token cache of earlier versions
+	LegacyPersistentCacheSuffix = ".legacy"
 )
 
 type CachedRecordProvider interface {
@@ -17,13 +36,62 @@ type CachedRecordProvider interface {
 
 type defaultCachedRecordProvider struct {
 	file string
+	// legacyFile is migrated to file when it holds a record of the same account
+	legacyFile string
+	// scan looks for a record of the same account in the directory of file, so that a
+	// login hint picks the account of a record stored without it
+	scan bool
+	// matches reports whether a record found in legacyFile or in the directory of file is of
+	// the account of file
+	matches func(record azidentity.AuthenticationRecord) bool
+}
+
+// newCachedRecordProvider returns the provider of the authentication record of the
+// authority, tenant, client and login hint of the options
+func newCachedRecordProvider(o *Options) *defaultCachedRecordProvider {
+	return &defaultCachedRecordProvider{
+		file:       getAuthenticationRecordFileName(o),
+		legacyFile: filepath.Join(o.AuthRecordCacheDir, LegacyAuthRecordFileName),
+		scan:       o.LoginHint != "",
+		matches: func(record azidentity.AuthenticationRecord) bool {
+			return authenticationRecordMatches(o, record)
+		},
+	}
 }
 
 func (c *defaultCachedRecordProvider) Retrieve() (azidentity.AuthenticationRecord, error) {
-	record := azidentity.AuthenticationRecord{}
-	b, err := os.ReadFile(c.file)
-	if err == nil {
-		err = json.Unmarshal(b, &record)
+	record, err := readAuthenticationRecord(c.file)
+	if !errors.Is(err, fs.ErrNotExist) || c.matches == nil {
+		return record, err
+	}
+
+	if legacy, lerr := readAuthenticationRecord(c.legacyFile); lerr == nil && c.matches(legacy) {
+		if err := c.Store(legacy); err != nil {
+			return legacy, nil
+		}
+		klog.V(5).Infof("migrated authentication record %s to %s", c.legacyFile, c.file)
+		markLegacyPersistentCache(c.file)
+		if err := os.Remove(c.legacyFile); err != nil {
+			klog.V(5).Infof("failed to remove authentication record %s: %s", c.legacyFile, err)
+		}
+		return legacy, nil
+	}
+
+	if c.scan {
+		files, _ := filepath.Glob(filepath.Join(filepath.Dir(c.file), "*.json"))
+		for _, file := range files {
+			found, ferr := readAuthenticationRecord(file)
+			if ferr != nil || !c.matches(found) {
+				continue
+			}
+			klog.V(5).Infof("using authentication record %s of %s", file, found.Username)
+			if err := c.Store(found); err != nil {
+				klog.V(5).Infof("failed to store authentication record: %s", err)
+			} else if usesLegacyPersistentCache(file) {
+				markLegacyPersistentCache(c.file)
+			}
+			return found, nil
+		}
 	}
 	return record, err
 }
@@ -41,3 +109,68 @@ func (c *defaultCachedRecordProvider) Store(record azidentity.AuthenticationReco
 
 	return os.WriteFile(c.file, b, 0600)
 }
+
+// markLegacyPersistentCache marks that the tokens of the account of the record file are in the
+// persistent token cache shared by all contexts of earlier versions, so that the account keeps
+// using it instead of signing in again
+func markLegacyPersistentCache(file string) {
+	if err := os.WriteFile(file+LegacyPersistentCacheSuffix, nil, 0600); err != nil {
+		klog.V(5).Infof("failed to mark authentication record %s as migrated: %s", file, err)
+	}
+}
+
+// usesLegacyPersistentCache reports whether the tokens of the account of the record file are
+// in the persistent token cache of earlier versions
+func usesLegacyPersistentCache(file string) bool {
+	_, err := os.Stat(file + LegacyPersistentCacheSuffix)
+	return err == nil
+}
+
+func readAuthenticationRecord(file string) (azidentity.AuthenticationRecord, error) {
+	record := azidentity.AuthenticationRecord{}
+	b, err := os.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(b, &record)
+	}
+	return record, err
+}
+
+func getAuthenticationRecordFileName(o *Options) string {
+	return filepath.Join(o.AuthRecordCacheDir, AuthRecordDirName, getAuthenticationRecordKey(o, o.LoginHint)+".json")
+}
+
+// getAuthenticationRecordKey identifies the authority, tenant and client of the options, and
+// the account of the login hint when it is set
+func getAuthenticationRecordKey(o *Options, loginHint string) string {
+	key := strings.Join([]string{
+		authorityHostName(o.GetCloudConfiguration().ActiveDirectoryAuthorityHost),
+		strings.ToLower(o.TenantID),
+		strings.ToLower(o.ClientID),
+		strings.ToLower(loginHint),
+	}, "\x00")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
+
+// authenticationRecordMatches reports whether the record is of the authority, tenant and
+// client of the options, and of the account of the login hint when it is set. The tenant
+// of a record is its ID, which only a tenant ID of the options can be compared with.
+func authenticationRecordMatches(o *Options, record azidentity.AuthenticationRecord) bool {
+	if authorityHostName(record.Authority) != authorityHostName(o.GetCloudConfiguration().ActiveDirectoryAuthorityHost) {
+		return false
+	}
+	if !strings.EqualFold(record.ClientID, o.ClientID) {
+		return false
+	}
+	if _, err := uuid.Parse(o.TenantID); err == nil && !strings.EqualFold(record.TenantID, o.TenantID) {
+		return false
+	}
+	return o.LoginHint == "" || strings.EqualFold(record.Username, o.LoginHint)
+}
+
+// authorityHostName returns the lower-cased host of an authority URL
+func authorityHostName(authority string) string {
+	if u, err := url.Parse(authority); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host)
+	}
+	return strings.ToLower(strings.TrimSuffix(authority, "/"))
+}
@@ -106,3 +106,132 @@ func TestDefaultCachedRecordProvider_NonExistentDirectory(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, fileInfo.IsDir())
 }
+
+func TestGetAuthenticationRecordFileName(t *testing.T) {
+	base := Options{AuthRecordCacheDir: "/cache", TenantID: "tenant", ClientID: "client"}
+	file := getAuthenticationRecordFileName(&base)
+	assert.Equal(t, filepath.Join("/cache", AuthRecordDirName), filepath.Dir(file))
+
+	same := base
+	same.TenantID = "TENANT"
+	same.Environment = "AzurePublicCloud"
+	assert.Equal(t, file, getAuthenticationRecordFileName(&same), "the key is case-insensitive")
+
+	for name, update := range map[string]func(o *Options){
+		"tenant":     func(o *Options) { o.TenantID = "other-tenant" },
+		"client":     func(o *Options) { o.ClientID = "other-client" },
+		"authority":  func(o *Options) { o.Environment = "AzureChinaCloud" },
+		"login hint": func(o *Options) { o.LoginHint = "user@contoso.com" },
+	} {
+		o := base
+		update(&o)
+		assert.NotEqual(t, file, getAuthenticationRecordFileName(&o), "another %s has its own record", name)
+	}
+}
+
+func TestAuthenticationRecordMigration(t *testing.T) {
+	const tenantID = "00000000-0000-0000-0000-000000000001"
+	record := azidentity.AuthenticationRecord{
+		TenantID:      tenantID,
+		ClientID:      "client-id",
+		Authority:     "https://login.microsoftonline.com",
+		HomeAccountID: "home-account-id",
+		Username:      "user@contoso.com",
+		Version:       "1.0",
+	}
+	writeLegacyRecord := func(t *testing.T, dir string) string {
+		t.Helper()
+		file := filepath.Join(dir, LegacyAuthRecordFileName)
+		assert.NoError(t, (&defaultCachedRecordProvider{file: file}).Store(record))
+		return file
+	}
+
+	testCases := []struct {
+		name     string
+		opts     Options
+		migrated bool
+	}{
+		{
+			name:     "same tenant ID and client",
+			opts:     Options{TenantID: tenantID, ClientID: "client-id"},
+			migrated: true,
+		},
+		{
+			name:     "tenant domain and login hint of the account",
+			opts:     Options{TenantID: "contoso.onmicrosoft.com", ClientID: "CLIENT-ID", LoginHint: "User@Contoso.com"},
+			migrated: true,
+		},
+		{
+			name: "another tenant",
+			opts: Options{TenantID: "00000000-0000-0000-0000-000000000002", ClientID: "client-id"},
+		},
+		{
+			name: "another client",
+			opts: Options{TenantID: tenantID, ClientID: "other-client-id"},
+		},
+		{
+			name: "another cloud",
+			opts: Options{TenantID: tenantID, ClientID: "client-id", Environment: "AzureUSGovernmentCloud"},
+		},
+		{
+			name: "login hint of another account",
+			opts: Options{TenantID: tenantID, ClientID: "client-id", LoginHint: "other@contoso.com"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.AuthRecordCacheDir = t.TempDir()
+			legacyFile := writeLegacyRecord(t, tc.opts.AuthRecordCacheDir)
+
+			got, err := newCachedRecordProvider(&tc.opts).Retrieve()
+			if !tc.migrated {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				assert.FileExists(t, legacyFile)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, record, got)
+			assert.NoFileExists(t, legacyFile)
+			assert.FileExists(t, getAuthenticationRecordFileName(&tc.opts))
+			assert.True(t, usesLegacyPersistentCache(getAuthenticationRecordFileName(&tc.opts)),
+				"the migrated account keeps the persistent token cache holding its tokens")
+		})
+	}
+}
+
+func TestAuthenticationRecordLoginHint(t *testing.T) {
+	dir := t.TempDir()
+	newOptions := func(loginHint string) *Options {
+		return &Options{AuthRecordCacheDir: dir, TenantID: "tenant", ClientID: "client-id", LoginHint: loginHint}
+	}
+	newRecord := func(username string) azidentity.AuthenticationRecord {
+		return azidentity.AuthenticationRecord{
+			TenantID:  "00000000-0000-0000-0000-000000000001",
+			ClientID:  "client-id",
+			Authority: "https://login.microsoftonline.com",
+			Username:  username,
+			Version:   "1.0",
+		}
+	}
+
+	// accounts signed in to without a login hint and with one
+	assert.NoError(t, newCachedRecordProvider(newOptions("")).Store(newRecord("alice@contoso.com")))
+	assert.NoError(t, newCachedRecordProvider(newOptions("bob@contoso.com")).Store(newRecord("bob@contoso.com")))
+
+	got, err := newCachedRecordProvider(newOptions("")).Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@contoso.com", got.Username)
+
+	got, err = newCachedRecordProvider(newOptions("bob@contoso.com")).Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "bob@contoso.com", got.Username)
+
+	// the login hint picks the account among the records
+	got, err = newCachedRecordProvider(newOptions("Alice@contoso.com")).Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@contoso.com", got.Username)
+	assert.FileExists(t, getAuthenticationRecordFileName(newOptions("Alice@contoso.com")))
+
+	_, err = newCachedRecordProvider(newOptions("carol@contoso.com")).Retrieve()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,229 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
+	"github.com/pkg/browser"
+	"k8s.io/klog/v2"
+)
+
+// browserSignIn signs the user in with a browser opened by the browser command, or the
+// system browser. With device code as the interactive fallback, the user signs in with
+// device code login instead when no browser can be launched.
+type browserSignIn struct {
+	command     string
+	fallback    string
+	redirectURL string
+	loginHint   string
+	deviceCode  *deviceCodePrompt
+	// launchErr is the error of the last attempt to open a browser
+	launchErr error
+	// openBrowser opens the system browser, replaced in tests
+	openBrowser func(url string) error
+}
+
+func newBrowserSignIn(opts *Options) *browserSignIn {
+	return &browserSignIn{
+		command:     opts.BrowserCommand,
+		fallback:    opts.InteractiveFallback,
+		redirectURL: opts.RedirectURL,
+		loginHint:   opts.LoginHint,
+		deviceCode:  newDeviceCodePrompt(opts),
+		openBrowser: browser.OpenURL,
+	}
+}
+
+// openURL opens the sign-in URL, remembering whether a browser could be launched
+func (s *browserSignIn) openURL(url string) error {
+	if s.command != "" {
+		s.launchErr = runBrowserCommand(s.command, url)
+	} else {
+		s.launchErr = s.openBrowser(url)
+	}
+	return s.launchErr
+}
+
+// interactiveOptions are the options of MSAL interactive login opening the sign-in URL
+func (s *browserSignIn) interactiveOptions() []public.AcquireInteractiveOption {
+	s.launchErr = nil
+	return []public.AcquireInteractiveOption{public.WithOpenURL(s.openURL)}
+}
+
+// useDeviceCode reports whether the user signs in with device code login without
+// trying to launch a browser
+func (s *browserSignIn) useDeviceCode() bool {
+	if s.fallback != DeviceCodeLogin || canLaunchBrowser(s.command) {
+		return false
+	}
+	klog.V(2).Infof("no browser can be launched, using %s login", DeviceCodeLogin)
+	return true
+}
+
+// fallBackToDeviceCode reports whether interactive login failed to launch a browser
+// and the user signs in with device code login instead
+func (s *browserSignIn) fallBackToDeviceCode() bool {
+	if s.fallback != DeviceCodeLogin || s.launchErr == nil {
+		return false
+	}
+	klog.V(2).Infof("failed to launch a browser, falling back to %s login: %s", DeviceCodeLogin, s.launchErr)
+	return true
+}
+
+// acquireToken signs the user in with the browser, or device code login as fallback
+func (s *browserSignIn) acquireToken(ctx context.Context, client public.Client, scopes []string, tenantID, claims string) (public.AuthResult, error) {
+	if s.useDeviceCode() {
+		return s.acquireTokenByDeviceCode(ctx, client, scopes, tenantID, claims)
+	}
+
+	opts := append(s.interactiveOptions(), public.WithTenantID(tenantID), public.WithClaims(claims))
+	if s.redirectURL != "" {
+		opts = append(opts, public.WithRedirectURI(s.redirectURL))
+	}
+	if s.loginHint != "" {
+		opts = append(opts, public.WithLoginHint(s.loginHint))
+	}
+	result, err := client.AcquireTokenInteractive(ctx, scopes, opts...)
+	if err != nil {
+		if s.fallBackToDeviceCode() {
+			return s.acquireTokenByDeviceCode(ctx, client, scopes, tenantID, claims)
+		}
+		return public.AuthResult{}, fmt.Errorf("failed to sign in with a browser: %w", err)
+	}
+	return result, nil
+}
+
+// acquireTokenByDeviceCode signs the user in with the device code flow
+func (s *browserSignIn) acquireTokenByDeviceCode(ctx context.Context, client public.Client, scopes []string, tenantID, claims string) (public.AuthResult, error) {
+	dc, err := client.AcquireTokenByDeviceCode(ctx, scopes, public.WithTenantID(tenantID), public.WithClaims(claims))
+	if err != nil {
+		return public.AuthResult{}, fmt.Errorf("failed to start device code login: %w", err)
+	}
+	expiresOn := dc.Result.ExpiresOn
+	if err := s.deviceCode.show(deviceCodeEvent{
+		VerificationURI: dc.Result.VerificationURL,
+		UserCode:        dc.Result.UserCode,
+		ExpiresOn:       &expiresOn,
+		Message:         dc.Result.Message,
+	}); err != nil {
+		return public.AuthResult{}, err
+	}
+	result, err := dc.AuthenticationResult(ctx)
+	if err != nil {
+		return public.AuthResult{}, fmt.Errorf("failed to sign in with device code: %w", err)
+	}
+	return result, nil
+}
+
+// runBrowserCommand runs the browser command with the URL appended to its arguments. Its
+// output goes to stderr as stdout carries the exec credential read by kubectl.
+func runBrowserCommand(command, url string) error {
+	args, err := splitCommand(command)
+	if err != nil {
+		return fmt.Errorf("invalid browser command: %w", err)
+	}
+	if len(args) == 0 {
+		return errors.New("browser command is empty")
+	}
+	cmd := exec.Command(args[0], append(args[1:], url)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run browser command %q: %w", command, err)
+	}
+	return nil
+}
+
+// canLaunchBrowser reports whether interactive login can open a browser, with the
+// browser command when it is set
+func canLaunchBrowser(browserCommand string) bool {
+	if strings.TrimSpace(browserCommand) != "" {
+		args, err := splitCommand(browserCommand)
+		if err != nil || len(args) == 0 {
+			return false
+		}
+		_, err = lookPath(args[0])
+		return err == nil
+	}
+	return hasBrowser()
+}
+
+// splitCommand splits a command line into its arguments like a shell, without expansions:
+// arguments are separated by whitespace, which single or double quotes keep in an argument.
+// A backslash escapes a quote, a backslash or whitespace, and is otherwise kept, so that
+// Windows paths need no escaping.
+func splitCommand(command string) ([]string, error) {
+	var (
+		args    []string
+		arg     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	isSpecial := func(r rune) bool {
+		switch r {
+		case '\\', '"':
+			return true
+		case '\'', ' ', '\t', '\n':
+			return quote == 0
+		}
+		return false
+	}
+	for _, r := range command {
+		switch {
+		case escaped:
+			if !isSpecial(r) {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		arg.WriteRune('\\')
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// hasBrowser reports whether interactive login can open the system browser
+func hasBrowser() bool {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
+	default:
+		return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+	}
+}
@@ -0,0 +1,188 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCustomBrowserCredential(t *testing.T, sts *fakeSTS, browserCommand string) (*CustomBrowserCredential, *bytes.Buffer) {
+	t.Helper()
+	cred, err := newCustomBrowserCredential(&Options{
+		ClientID:                 "client-id",
+		TenantID:                 "tenant",
+		AuthorityHost:            sts.server.URL + "/",
+		DisableInstanceDiscovery: true,
+		BrowserCommand:           browserCommand,
+		InteractiveFallback:      DeviceCodeLogin,
+		httpClient:               sts.server.Client(),
+	}, azidentity.AuthenticationRecord{})
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	c := cred.(*CustomBrowserCredential)
+	c.browser.deviceCode.out = out
+	return c, out
+}
+
+func TestCustomBrowserCredential(t *testing.T) {
+	scopes := []string{"server-id/.default"}
+
+	t.Run("falls back to device code when the browser command is not found", func(t *testing.T) {
+		sts := newFakeSTS(t)
+		cred, out := newTestCustomBrowserCredential(t, sts, "kubelogin-test-no-such-browser")
+
+		record, err := cred.Authenticate(context.Background(), &policy.TokenRequestOptions{Scopes: scopes})
+		require.NoError(t, err)
+		assert.Equal(t, "user@example.com", record.Username)
+		assert.Contains(t, out.String(), "USERCODE")
+		require.Len(t, sts.tokenRequests, 1)
+		assert.Equal(t, "device_code", sts.tokenRequests[0].Get("grant_type"))
+
+		// the token of the device code login is returned silently
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: scopes})
+		require.NoError(t, err)
+		assert.Equal(t, "access-token-1", token.Token)
+		assert.Len(t, sts.tokenRequests, 1)
+	})
+
+	t.Run("falls back to device code when the browser command fails", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the browser command is a shell script")
+		}
+		sts := newFakeSTS(t)
+		cred, out := newTestCustomBrowserCredential(t, sts, writeBrowserScript(t, "exit 1"))
+
+		_, err := cred.Authenticate(context.Background(), &policy.TokenRequestOptions{Scopes: scopes})
+		require.NoError(t, err)
+		assert.ErrorContains(t, cred.browser.launchErr, "failed to run browser command")
+		assert.Contains(t, out.String(), "USERCODE")
+	})
+
+	t.Run("does not fall back without a device code fallback", func(t *testing.T) {
+		sts := newFakeSTS(t)
+		cred, out := newTestCustomBrowserCredential(t, sts, "kubelogin-test-no-such-browser")
+		cred.browser.fallback = ""
+
+		_, err := cred.Authenticate(context.Background(), &policy.TokenRequestOptions{Scopes: scopes})
+		assert.ErrorContains(t, err, "failed to sign in with a browser")
+		assert.Empty(t, out.String())
+		assert.Empty(t, sts.tokenRequests)
+	})
+}
+
+func TestBrowserSignInOpenURL(t *testing.T) {
+	t.Run("browser command", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the browser command is a shell script")
+		}
+		urlFile := filepath.Join(t.TempDir(), "url")
+		s := &browserSignIn{command: writeBrowserScript(t, `echo "$2" > "$1"`) + " " + urlFile}
+
+		require.NoError(t, s.openURL("https://login.example.com/authorize?state=abc"))
+		b, err := os.ReadFile(urlFile)
+		require.NoError(t, err)
+		assert.Equal(t, "https://login.example.com/authorize?state=abc\n", string(b))
+	})
+
+	t.Run("quoted browser command path with spaces", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the browser command is a shell script")
+		}
+		dir := filepath.Join(t.TempDir(), "my browser")
+		require.NoError(t, os.Mkdir(dir, 0o700))
+		script := filepath.Join(dir, "open url.sh")
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho \"$2\" > \"$1\"\n"), 0o700))
+		urlFile := filepath.Join(dir, "url file")
+		s := &browserSignIn{command: fmt.Sprintf(`"%s" '%s'`, script, urlFile)}
+
+		require.NoError(t, s.openURL("https://login.example.com/authorize?state=abc"))
+		b, err := os.ReadFile(urlFile)
+		require.NoError(t, err)
+		assert.Equal(t, "https://login.example.com/authorize?state=abc\n", string(b))
+	})
+
+	t.Run("system browser", func(t *testing.T) {
+		var opened string
+		s := &browserSignIn{openBrowser: func(url string) error {
+			opened = url
+			return errors.New("no browser")
+		}}
+
+		assert.EqualError(t, s.openURL("https://login.example.com"), "no browser")
+		assert.Equal(t, "https://login.example.com", opened)
+		assert.False(t, s.fallBackToDeviceCode(), "no fallback is configured")
+		s.fallback = DeviceCodeLogin
+		assert.True(t, s.fallBackToDeviceCode())
+	})
+}
+
+func TestCanLaunchBrowser(t *testing.T) {
+	origLookPath := lookPath
+	t.Cleanup(func() { lookPath = origLookPath })
+	lookPath = func(file string) (string, error) {
+		if file == "wslview" {
+			return "/usr/bin/wslview", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	assert.True(t, canLaunchBrowser("wslview"))
+	assert.True(t, canLaunchBrowser("wslview --verbose"))
+	assert.False(t, canLaunchBrowser("open-remote"))
+	assert.False(t, canLaunchBrowser(`"wslview`), "unterminated quote")
+
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	assert.Equal(t, runtime.GOOS == "windows" || runtime.GOOS == "darwin", canLaunchBrowser(""))
+	t.Setenv("DISPLAY", ":0")
+	assert.True(t, canLaunchBrowser(""))
+}
+
+// writeBrowserScript writes a shell script running body and returns its path
+func writeBrowserScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "browser.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o700))
+	return path
+}
+
+func TestSplitCommand(t *testing.T) {
+	testCases := []struct {
+		command string
+		want    []string
+		wantErr string
+	}{
+		{command: "wslview", want: []string{"wslview"}},
+		{command: "  open-remote  --host   dev ", want: []string{"open-remote", "--host", "dev"}},
+		{command: `"/opt/my browser/open" --new-tab`, want: []string{"/opt/my browser/open", "--new-tab"}},
+		{command: `'/opt/my browser/open' 'it''s'`, want: []string{"/opt/my browser/open", "its"}},
+		{command: `/opt/my\ browser/open "say \"hi\""`, want: []string{"/opt/my browser/open", `say "hi"`}},
+		{command: `'a\b' ""`, want: []string{`a\b`, ""}},
+		{command: `C:\Users\me\browser.exe`, want: []string{`C:\Users\me\browser.exe`}},
+		{command: `"C:\Program Files\browser.exe" --url`, want: []string{`C:\Program Files\browser.exe`, "--url"}},
+		{command: "", want: nil},
+		{command: `"/opt/my browser/open`, wantErr: `unterminated " quote`},
+		{command: `'open`, wantErr: `unterminated ' quote`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.command, func(t *testing.T) {
+			got, err := splitCommand(tc.command)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
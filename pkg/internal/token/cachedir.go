@@ -0,0 +1,21 @@
+package token
+
+import (
+	"github.com/Azure/kubelogin/pkg/internal/pop"
+	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
+)
+
+// The files of the PoP key and the PoP token cache in the cache directory
+const (
+	PoPKeyFileName        = pop.PoPKeyFileName
+	PoPTokenCacheFileName = popcache.PoPTokenCacheFileName
+)
+
+// MSALCacheFileNames are the MSAL token caches kubelogin keeps in the cache directory
+var MSALCacheFileNames = []string{
+	PoPTokenCacheFileName,
+	authCodeTokenCacheFileName,
+	authCodeCAETokenCacheFileName,
+	interactiveTokenCacheFileName,
+	interactiveCAETokenCacheFileName,
+}
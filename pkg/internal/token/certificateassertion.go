@@ -0,0 +1,60 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// certificateAssertion signs the client assertions of a certificate with an ECDSA key.
+// MSAL and azidentity only sign client assertions with RSA keys.
+type certificateAssertion struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	clientID string
+	method   jwt.SigningMethod
+}
+
+func newCertificateAssertion(cert *x509.Certificate, key *ecdsa.PrivateKey, clientID string) (*certificateAssertion, error) {
+	var method jwt.SigningMethod
+	switch key.Curve {
+	case elliptic.P256():
+		method = jwt.SigningMethodES256
+	case elliptic.P384():
+		method = jwt.SigningMethodES384
+	case elliptic.P521():
+		method = jwt.SigningMethodES512
+	default:
+		return nil, fmt.Errorf("unsupported elliptic curve %s, supported curves are P-256, P-384 and P-521", key.Curve.Params().Name)
+	}
+	return &certificateAssertion{cert: cert, key: key, clientID: clientID, method: method}, nil
+}
+
+// sign returns a client assertion for the token endpoint
+func (a *certificateAssertion) sign(tokenEndpoint string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(a.method, jwt.MapClaims{
+		"aud": tokenEndpoint,
+		"exp": now.Add(10 * time.Minute).Unix(),
+		"iss": a.clientID,
+		"jti": uuid.New().String(),
+		"nbf": now.Unix(),
+		"sub": a.clientID,
+	})
+	thumbprint := sha256.Sum256(a.cert.Raw)
+	token.Header["x5t#S256"] = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	token.Header["x5c"] = []string{base64.StdEncoding.EncodeToString(a.cert.Raw)}
+
+	assertion, err := token.SignedString(a.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign the client assertion: %w", err)
+	}
+	return assertion, nil
+}
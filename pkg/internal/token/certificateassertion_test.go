@@ -0,0 +1,83 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifyCertificateAssertion checks the client assertion is signed by the key of the
+// certificate for the token endpoint
+func verifyCertificateAssertion(t *testing.T, assertion string, cert *x509.Certificate, tokenEndpoint string) {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		return cert.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}))
+	require.NoError(t, err)
+
+	thumbprint := sha256.Sum256(cert.Raw)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(thumbprint[:]), token.Header["x5t#S256"])
+	assert.Equal(t, []interface{}{base64.StdEncoding.EncodeToString(cert.Raw)}, token.Header["x5c"])
+	assert.Equal(t, tokenEndpoint, claims["aud"])
+	assert.Equal(t, "client-id", claims["iss"])
+	assert.Equal(t, "client-id", claims["sub"])
+	assert.NotEmpty(t, claims["jti"])
+}
+
+func TestCertificateAssertion(t *testing.T) {
+	cert, key, err := readCertificate("fixtures/cert_ecdsa_encrypted.pem", testPKCS8Password)
+	require.NoError(t, err)
+
+	t.Run("signs with the certificate key", func(t *testing.T) {
+		a, err := newCertificateAssertion(cert, key.(*ecdsa.PrivateKey), "client-id")
+		require.NoError(t, err)
+		assertion, err := a.sign("https://login.microsoftonline.com/tenant/oauth2/v2.0/token")
+		require.NoError(t, err)
+		verifyCertificateAssertion(t, assertion, cert, "https://login.microsoftonline.com/tenant/oauth2/v2.0/token")
+	})
+
+	t.Run("unsupported curve", func(t *testing.T) {
+		p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+		require.NoError(t, err)
+		_, err = newCertificateAssertion(cert, p224Key, "client-id")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported elliptic curve P-224")
+	})
+}
+
+func TestClientCertificateCredentialWithECDSAKey(t *testing.T) {
+	sts := newFakeSTS(t)
+	cred, err := newClientCertificateCredential(&Options{
+		ClientID:                 "client-id",
+		TenantID:                 "tenant",
+		ClientCert:               "fixtures/cert_ecdsa_encrypted.pem",
+		ClientCertPassword:       testPKCS8Password,
+		AuthorityHost:            sts.server.URL + "/",
+		DisableInstanceDiscovery: true,
+		httpClient:               sts.server.Client(),
+	})
+	require.NoError(t, err)
+
+	token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"server-id/.default"}})
+	require.NoError(t, err)
+	assert.Equal(t, "access-token-1", token.Token)
+
+	require.Len(t, sts.tokenRequests, 1)
+	req := sts.tokenRequests[0]
+	assert.Equal(t, "client_credentials", req.Get("grant_type"))
+	assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", req.Get("client_assertion_type"))
+	cert, _, err := readCertificate("fixtures/cert_ecdsa_encrypted.pem", testPKCS8Password)
+	require.NoError(t, err)
+	verifyCertificateAssertion(t, req.Get("client_assertion"), cert, sts.server.URL+"/tenant/oauth2/v2.0/token")
+}
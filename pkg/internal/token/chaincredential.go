@@ -0,0 +1,158 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	klog "k8s.io/klog/v2"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+const (
+	imdsAddress      = "169.254.169.254:80"
+	imdsProbeTimeout = 500 * time.Millisecond
+)
+
+var (
+	// lookPath and imdsAvailable detect the environment for auto login, replaced in tests
+	lookPath      = exec.LookPath
+	imdsAvailable = probeIMDS
+)
+
+// errAuthenticationRequired is returned by the chain when it selects a link, such as
+// interactive or devicecode login, with which the user has to authenticate first
+var errAuthenticationRequired = errors.New("authentication required")
+
+// ChainCredential tries the credentials of a list of login methods in order and
+// keeps using the first one that returns a token. A link that needs authentication
+// without a stored record is selected without prompting, and reported as such by
+// NeedAuthenticate, so that the caller authenticates and stores the record.
+type ChainCredential struct {
+	opts   *Options
+	record azidentity.AuthenticationRecord
+	chain  []string
+	// newCredentialFunc creates the credential of a link, replaced in tests
+	newCredentialFunc func(record azidentity.AuthenticationRecord, o *Options) (CredentialProvider, error)
+	selected          CredentialProvider
+}
+
+var _ CredentialProvider = (*ChainCredential)(nil)
+
+func newChainCredential(opts *Options, record azidentity.AuthenticationRecord) (CredentialProvider, error) {
+	chain := opts.LoginChain
+	if len(chain) == 0 {
+		chain = detectLoginChain(opts)
+	}
+	return &ChainCredential{
+		opts:              opts,
+		record:            record,
+		chain:             chain,
+		newCredentialFunc: NewAzIdentityCredential,
+	}, nil
+}
+
+func (c *ChainCredential) Name() string {
+	return "ChainCredential"
+}
+
+func (c *ChainCredential) Authenticate(ctx context.Context, opts *policy.TokenRequestOptions) (azidentity.AuthenticationRecord, error) {
+	if c.selected == nil {
+		return azidentity.AuthenticationRecord{}, errAuthenticateNotSupported
+	}
+	return c.selected.Authenticate(ctx, opts)
+}
+
+func (c *ChainCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if c.selected != nil {
+		return c.selected.GetToken(ctx, opts)
+	}
+
+	var errs []error
+	for _, login := range c.chain {
+		linkOpts := *c.opts
+		linkOpts.LoginMethod = login
+		cred, err := c.newCredentialFunc(c.record, &linkOpts)
+		if err != nil {
+			klog.V(5).Infof("skipping %s login: %s", login, err)
+			errs = append(errs, fmt.Errorf("%s login: %w", login, err))
+			continue
+		}
+		if cred.NeedAuthenticate() && c.record == (azidentity.AuthenticationRecord{}) {
+			// the user authenticates with the caller, which stores the record for later invocations
+			klog.V(2).Infof("authenticating with %s login using %s", login, cred.Name())
+			c.selected = cred
+			return azcore.AccessToken{}, fmt.Errorf("%s login: %w", login, errAuthenticationRequired)
+		}
+		token, err := cred.GetToken(ctx, opts)
+		if err != nil {
+			klog.V(5).Infof("%s login failed: %s", login, err)
+			errs = append(errs, fmt.Errorf("%s login: %w", login, err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		klog.V(2).Infof("authenticated with %s login using %s", login, cred.Name())
+		c.selected = cred
+		return token, nil
+	}
+	if len(errs) == 0 {
+		return azcore.AccessToken{}, errors.New("login chain is empty")
+	}
+	return azcore.AccessToken{}, fmt.Errorf("failed to get token with login chain: %w", errors.Join(errs...))
+}
+
+func (c *ChainCredential) NeedAuthenticate() bool {
+	return c.selected != nil && c.selected.NeedAuthenticate()
+}
+
+// detectLoginChain returns the login methods auto login tries in order, based on the environment
+func detectLoginChain(o *Options) []string {
+	var chain []string
+	if detectCIProvider(o) != nil {
+		// workloadidentity login uses the OIDC token of the CI system
+		chain = append(chain, WorkloadIdentityLogin)
+	} else if o.FederatedTokenFile != "" || os.Getenv(env.AzureFederatedTokenFile) != "" {
+		chain = append(chain, WorkloadIdentityLogin)
+	}
+	if os.Getenv(env.SystemOIDCRequestURI) != "" {
+		chain = append(chain, AzurePipelinesLogin)
+	}
+	if imdsAvailable() {
+		chain = append(chain, MSILogin)
+	}
+	if _, err := lookPath("az"); err == nil {
+		chain = append(chain, AzureCLILogin)
+	}
+	if _, err := lookPath("azd"); err == nil {
+		chain = append(chain, AzureDeveloperCLILogin)
+	}
+	if canLaunchBrowser(o.BrowserCommand) {
+		chain = append(chain, InteractiveLogin)
+	} else {
+		chain = append(chain, DeviceCodeLogin)
+	}
+	return chain
+}
+
+// probeIMDS reports whether a managed identity endpoint is available
+func probeIMDS() bool {
+	if os.Getenv(env.IdentityEndpoint) != "" || os.Getenv(env.MSIEndpoint) != "" {
+		return true
+	}
+	conn, err := net.DialTimeout("tcp", imdsAddress, imdsProbeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
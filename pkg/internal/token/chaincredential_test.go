@@ -0,0 +1,261 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+type fakeChainLink struct {
+	name  string
+	token string
+	err   error
+	calls int
+}
+
+func (f *fakeChainLink) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	f.calls++
+	if f.err != nil {
+		return azcore.AccessToken{}, f.err
+	}
+	return azcore.AccessToken{Token: f.token}, nil
+}
+
+func (f *fakeChainLink) Authenticate(ctx context.Context, opts *policy.TokenRequestOptions) (azidentity.AuthenticationRecord, error) {
+	return azidentity.AuthenticationRecord{}, errAuthenticateNotSupported
+}
+
+func (f *fakeChainLink) NeedAuthenticate() bool {
+	return false
+}
+
+func (f *fakeChainLink) Name() string {
+	return f.name
+}
+
+func newTestChainCredential(chain []string, links map[string]*fakeChainLink) *ChainCredential {
+	return &ChainCredential{
+		opts:  &Options{LoginMethod: AutoLogin},
+		chain: chain,
+		newCredentialFunc: func(record azidentity.AuthenticationRecord, o *Options) (CredentialProvider, error) {
+			link, ok := links[o.LoginMethod]
+			if !ok {
+				return nil, errors.New("unsupported token provider")
+			}
+			return link, nil
+		},
+	}
+}
+
+func TestChainCredential(t *testing.T) {
+	t.Run("first successful link is used", func(t *testing.T) {
+		links := map[string]*fakeChainLink{
+			WorkloadIdentityLogin: {name: "WorkloadIdentityCredential", err: errors.New("no federated token")},
+			MSILogin:              {name: "ManagedIdentityCredential", token: "msi-token"},
+			AzureCLILogin:         {name: "AzureCLICredential", token: "cli-token"},
+		}
+		cred := newTestChainCredential([]string{WorkloadIdentityLogin, MSILogin, AzureCLILogin}, links)
+
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "msi-token", token.Token)
+		assert.Equal(t, 0, links[AzureCLILogin].calls)
+
+		// the selected link is reused without trying the failed one again
+		_, err = cred.GetToken(context.Background(), policy.TokenRequestOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, links[WorkloadIdentityLogin].calls)
+		assert.Equal(t, 2, links[MSILogin].calls)
+	})
+
+	t.Run("errors of all links are aggregated", func(t *testing.T) {
+		msiErr := errors.New("imds unreachable")
+		links := map[string]*fakeChainLink{
+			MSILogin:      {name: "ManagedIdentityCredential", err: msiErr},
+			AzureCLILogin: {name: "AzureCLICredential", err: errors.New("please run az login")},
+		}
+		cred := newTestChainCredential([]string{MSILogin, AzureCLILogin, AzureDeveloperCLILogin}, links)
+
+		_, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, msiErr)
+		assert.Contains(t, err.Error(), "failed to get token with login chain")
+		assert.Contains(t, err.Error(), "msi login: imds unreachable")
+		assert.Contains(t, err.Error(), "azurecli login: please run az login")
+		assert.Contains(t, err.Error(), "azd login: unsupported token provider")
+	})
+
+	t.Run("canceled context stops the chain", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		links := map[string]*fakeChainLink{
+			MSILogin:      {name: "ManagedIdentityCredential", err: context.Canceled},
+			AzureCLILogin: {name: "AzureCLICredential", token: "cli-token"},
+		}
+		cred := newTestChainCredential([]string{MSILogin, AzureCLILogin}, links)
+
+		_, err := cred.GetToken(ctx, policy.TokenRequestOptions{})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 0, links[AzureCLILogin].calls)
+	})
+
+	t.Run("empty chain", func(t *testing.T) {
+		cred := newTestChainCredential(nil, nil)
+		_, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{})
+		assert.EqualError(t, err, "login chain is empty")
+	})
+
+	t.Run("devicecode link authenticates and stores the record", func(t *testing.T) {
+		msi := &fakeChainLink{name: "ManagedIdentityCredential", err: errors.New("imds unreachable")}
+		deviceCode := &fakeCredential{
+			token:            azcore.AccessToken{Token: "devicecode-token", ExpiresOn: time.Now().Add(time.Hour)},
+			needAuthenticate: true,
+			record:           azidentity.AuthenticationRecord{Username: "user", Version: "1.0"},
+		}
+		newChain := func(record azidentity.AuthenticationRecord, o *Options) (CredentialProvider, error) {
+			return &ChainCredential{
+				opts:   o,
+				record: record,
+				chain:  []string{MSILogin, DeviceCodeLogin},
+				newCredentialFunc: func(_ azidentity.AuthenticationRecord, o *Options) (CredentialProvider, error) {
+					if o.LoginMethod == MSILogin {
+						return msi, nil
+					}
+					return deviceCode, nil
+				},
+			}, nil
+		}
+		p := &execCredentialPlugin{
+			o:                    &Options{LoginMethod: AutoLogin, ServerID: "server-id", Timeout: time.Minute},
+			cachedRecord:         &defaultCachedRecordProvider{file: filepath.Join(t.TempDir(), "auth.json")},
+			execCredentialWriter: &fakeExecCredentialWriter{},
+			newCredentialFunc:    newChain,
+		}
+
+		token, err := p.getToken(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "devicecode-token", token.Token)
+		assert.Equal(t, 1, deviceCode.authenticateCalled)
+		assert.Equal(t, 1, deviceCode.getTokenCalled, "the user is not prompted by GetToken without a record")
+		record, err := p.cachedRecord.Retrieve()
+		require.NoError(t, err)
+		assert.Equal(t, "user", record.Username)
+
+		// the stored record is used silently by the next invocation
+		token, err = p.getToken(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "devicecode-token", token.Token)
+		assert.Equal(t, 1, deviceCode.authenticateCalled)
+		assert.Equal(t, 2, deviceCode.getTokenCalled)
+	})
+
+	t.Run("explicit chain is used as is", func(t *testing.T) {
+		cred, err := newChainCredential(&Options{LoginChain: []string{AzureCLILogin, DeviceCodeLogin}}, azidentity.AuthenticationRecord{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{AzureCLILogin, DeviceCodeLogin}, cred.(*ChainCredential).chain)
+		assert.False(t, cred.NeedAuthenticate())
+	})
+}
+
+func TestDetectLoginChain(t *testing.T) {
+	testCases := []struct {
+		name     string
+		envs     map[string]string
+		opts     Options
+		imds     bool
+		binaries []string
+		want     []string
+	}{
+		{
+			name: "nothing detected falls back to device code",
+			want: []string{DeviceCodeLogin},
+		},
+		{
+			name: "browser available falls back to interactive",
+			envs: map[string]string{"DISPLAY": ":0"},
+			want: []string{InteractiveLogin},
+		},
+		{
+			name: "github actions",
+			envs: map[string]string{
+				actionsIDTokenRequestToken: "token",
+				actionsIDTokenRequestURL:   "https://token.actions.githubusercontent.com",
+			},
+			want: []string{WorkloadIdentityLogin, DeviceCodeLogin},
+		},
+		{
+			name: "gitlab ci",
+			envs: map[string]string{env.GitLabCI: "true", env.GitLabOIDCToken: "token"},
+			want: []string{WorkloadIdentityLogin, DeviceCodeLogin},
+		},
+		{
+			name: "federated token file from env",
+			envs: map[string]string{env.AzureFederatedTokenFile: "/var/run/secrets/token"},
+			want: []string{WorkloadIdentityLogin, DeviceCodeLogin},
+		},
+		{
+			name: "federated token file from flag",
+			opts: Options{FederatedTokenFile: "/var/run/secrets/token"},
+			want: []string{WorkloadIdentityLogin, DeviceCodeLogin},
+		},
+		{
+			name: "azure pipelines",
+			envs: map[string]string{env.SystemOIDCRequestURI: "https://dev.azure.com/org/_apis/oidc"},
+			want: []string{AzurePipelinesLogin, DeviceCodeLogin},
+		},
+		{
+			name:     "imds and cli tools",
+			imds:     true,
+			binaries: []string{"az", "azd"},
+			want:     []string{MSILogin, AzureCLILogin, AzureDeveloperCLILogin, DeviceCodeLogin},
+		},
+		{
+			name:     "azd only",
+			binaries: []string{"azd"},
+			want:     []string{AzureDeveloperCLILogin, DeviceCodeLogin},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clearCIProviderEnvs(t)
+			for _, name := range []string{
+				env.AzureFederatedTokenFile, env.SystemOIDCRequestURI, "DISPLAY", "WAYLAND_DISPLAY",
+			} {
+				t.Setenv(name, "")
+			}
+			for k, v := range tc.envs {
+				t.Setenv(k, v)
+			}
+			origLookPath, origIMDSAvailable := lookPath, imdsAvailable
+			t.Cleanup(func() { lookPath, imdsAvailable = origLookPath, origIMDSAvailable })
+			imdsAvailable = func() bool { return tc.imds }
+			lookPath = func(file string) (string, error) {
+				for _, b := range tc.binaries {
+					if b == file {
+						return "/usr/bin/" + file, nil
+					}
+				}
+				return "", exec.ErrNotFound
+			}
+
+			got := detectLoginChain(&tc.opts)
+			if hasBrowser() && len(tc.envs["DISPLAY"]) == 0 {
+				// windows and darwin always have a browser
+				tc.want[len(tc.want)-1] = InteractiveLogin
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	klog "k8s.io/klog/v2"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+// ciProvider is a CI system issuing OIDC tokens to its jobs, or a workload identity
+// platform such as SPIRE. workloadidentity login exchanges the token for a Microsoft
+// Entra ID token when kubelogin runs in the CI system.
+type ciProvider struct {
+	// name is the name of the CI system shown in messages
+	name string
+	// credentialName is the name of the credential of workloadidentity login in the CI system
+	credentialName string
+	// envs are the environment variables set in the jobs of the CI system
+	envs []string
+	// getToken returns the OIDC token of the job. The audience is only used by CI systems
+	// issuing tokens on request, others issue tokens with the audience of their configuration.
+	getToken func(ctx context.Context, audience string) (string, error)
+	// precedesTokenFile is set for GitHub Actions, which was detected even with a federated
+	// token file before the other CI systems were supported
+	precedesTokenFile bool
+}
+
+// ciProviders are the CI systems detected by workloadidentity login, in order. To support
+// another CI system, add it here.
+var ciProviders = []*ciProvider{
+	{
+		name:              "GitHub Actions",
+		credentialName:    "GithubActionsCredential",
+		envs:              []string{actionsIDTokenRequestToken, actionsIDTokenRequestURL},
+		getToken:          getGitHubToken,
+		precedesTokenFile: true,
+	},
+	{
+		name:           "GitLab CI",
+		credentialName: "GitLabCICredential",
+		envs:           []string{env.GitLabCI, env.GitLabOIDCToken},
+		getToken:       getEnvToken(env.GitLabOIDCToken),
+	},
+	{
+		name:           "CircleCI",
+		credentialName: "CircleCICredential",
+		envs:           []string{env.CircleCIOIDCToken},
+		getToken:       getEnvToken(env.CircleCIOIDCToken),
+	},
+	{
+		name:           "Bitbucket Pipelines",
+		credentialName: "BitbucketPipelinesCredential",
+		envs:           []string{env.BitbucketStepOIDCToken},
+		getToken:       getEnvToken(env.BitbucketStepOIDCToken),
+	},
+	{
+		name:           "Buildkite",
+		credentialName: "BuildkiteCredential",
+		envs:           []string{env.BuildkiteAgentAccessToken},
+		getToken:       getBuildkiteToken,
+	},
+	{
+		name:           "SPIFFE Workload API",
+		credentialName: "SPIFFECredential",
+		envs:           []string{env.SpiffeEndpointSocket},
+		getToken:       getSPIFFEToken,
+	},
+}
+
+// detectCIProvider returns the CI system kubelogin runs in, or nil. A federated token file
+// set with --federated-token-file or AZURE_FEDERATED_TOKEN_FILE takes precedence over it.
+func detectCIProvider(o *Options) *ciProvider {
+	hasTokenFile := o.FederatedTokenFile != "" || os.Getenv(env.AzureFederatedTokenFile) != ""
+	for _, p := range ciProviders {
+		if p.detected() && (p.precedesTokenFile || !hasTokenFile) {
+			return p
+		}
+	}
+	return nil
+}
+
+// detected reports whether all the environment variables of the CI system are set
+func (p *ciProvider) detected() bool {
+	for _, name := range p.envs {
+		if os.Getenv(name) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// detectedBy describes the environment variables the CI system is detected by
+func (p *ciProvider) detectedBy() string {
+	if len(p.envs) == 1 {
+		return p.envs[0] + " is set"
+	}
+	return strings.Join(p.envs[:len(p.envs)-1], ", ") + " and " + p.envs[len(p.envs)-1] + " are set"
+}
+
+// getEnvToken returns a function reading the OIDC token of the job from the environment variable
+func getEnvToken(name string) func(context.Context, string) (string, error) {
+	return func(context.Context, string) (string, error) {
+		token := os.Getenv(name)
+		if token == "" {
+			return "", fmt.Errorf("%s is not set", name)
+		}
+		return token, nil
+	}
+}
+
+type githubTokenResponse struct {
+	Value string `json:"value"`
+}
+
+//nolint:gosec // ACTIONS_ID_TOKEN_REQUEST_URL is provided by GitHub Actions runtime.
+func getGitHubToken(ctx context.Context, audience string) (string, error) {
+	reqToken := os.Getenv(actionsIDTokenRequestToken)
+	reqURL := os.Getenv(actionsIDTokenRequestURL)
+
+	if reqToken == "" || reqURL == "" {
+		return "", errors.New("ACTIONS_ID_TOKEN_REQUEST_TOKEN or ACTIONS_ID_TOKEN_REQUEST_URL is not set")
+	}
+
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("audience", audience)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	// reference:
+	// https://docs.github.com/en/actions/deployment/security-hardening-your-deployments/about-security-hardening-with-openid-connect
+	req.Header.Set("Authorization", fmt.Sprintf("bearer %s", reqToken))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json; api-version=2.0")
+
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body string
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			body = err.Error()
+		} else {
+			body = string(b)
+		}
+
+		return "", fmt.Errorf("github actions ID token request failed with status code: %d, response body: %s", resp.StatusCode, body)
+	}
+
+	var tokenResp githubTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", err
+	}
+
+	if tokenResp.Value == "" {
+		return "", errors.New("github actions ID token is empty")
+	}
+
+	return tokenResp.Value, nil
+}
+
+// getBuildkiteToken requests an OIDC token for the audience with the buildkite agent.
+// Its errors go to stderr as stdout carries the exec credential read by kubectl.
+//
+// reference: https://buildkite.com/docs/agent/v3/cli-oidc
+func getBuildkiteToken(ctx context.Context, audience string) (string, error) {
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "buildkite-agent", "oidc", "request-token", "--audience", audience)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to request buildkite OIDC token: %w", err)
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return "", errors.New("buildkite OIDC token is empty")
+	}
+	return token, nil
+}
+
+// getSPIFFEToken fetches a JWT-SVID for the audience from the SPIFFE Workload API at
+// SPIFFE_ENDPOINT_SOCKET, e.g. unix:///run/spire/agent/public/api.sock
+//
+// reference: https://github.com/spiffe/spiffe/blob/main/standards/JWT-SVID.md
+func getSPIFFEToken(ctx context.Context, audience string) (string, error) {
+	svid, err := workloadapi.FetchJWTSVID(ctx, jwtsvid.Params{Audience: audience},
+		workloadapi.WithAddr(os.Getenv(env.SpiffeEndpointSocket)))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch JWT-SVID from the SPIFFE Workload API: %w", err)
+	}
+	klog.V(5).Infof("fetched JWT-SVID of %s expiring on %s", svid.ID, svid.Expiry)
+	return svid.Marshal(), nil
+}
@@ -0,0 +1,417 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+func TestNewCIProviderCredential(t *testing.T) {
+	t.Run("valid options", func(t *testing.T) {
+		opts := &Options{
+			ClientID: "test-client-id",
+			TenantID: "test-tenant-id",
+		}
+
+		cred, err := newCIProviderCredential(opts, ciProviders[0])
+		assert.NoError(t, err)
+		assert.NotNil(t, cred)
+		assert.Equal(t, "GithubActionsCredential", cred.Name())
+	})
+
+	t.Run("missing client ID", func(t *testing.T) {
+		opts := &Options{
+			TenantID: "test-tenant-id",
+		}
+
+		cred, err := newCIProviderCredential(opts, ciProviders[0])
+		assert.Error(t, err)
+		assert.Nil(t, cred)
+		assert.Equal(t, "client ID cannot be empty", err.Error())
+	})
+
+	t.Run("missing tenant ID", func(t *testing.T) {
+		opts := &Options{
+			ClientID: "test-client-id",
+		}
+
+		cred, err := newCIProviderCredential(opts, ciProviders[0])
+		assert.Error(t, err)
+		assert.Nil(t, cred)
+		assert.Equal(t, "tenant ID cannot be empty", err.Error())
+	})
+}
+
+func TestGetGitHubToken(t *testing.T) {
+	t.Run("valid token", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"value":"TEST_ACCESS_TOKEN"}`))
+		}))
+		defer ts.Close()
+
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "test-token")
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", ts.URL)
+
+		token, err := getGitHubToken(context.Background(), azureADAudience)
+		assert.NoError(t, err)
+		assert.Equal(t, "TEST_ACCESS_TOKEN", token)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"value":""}`))
+		}))
+		defer ts.Close()
+
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "test-token")
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", ts.URL)
+
+		token, err := getGitHubToken(context.Background(), azureADAudience)
+		assert.Error(t, err)
+		assert.Equal(t, "", token)
+		assert.Equal(t, "github actions ID token is empty", err.Error())
+	})
+
+	t.Run("http request failure", func(t *testing.T) {
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "test-token")
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", "http://invalid-url")
+
+		token, err := getGitHubToken(context.Background(), azureADAudience)
+		assert.Error(t, err)
+		assert.Equal(t, "", token)
+	})
+
+	t.Run("invalid response from GitHub", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"invalid":"response"}`))
+		}))
+		defer ts.Close()
+
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "test-token")
+		t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", ts.URL)
+
+		token, err := getGitHubToken(context.Background(), azureADAudience)
+		assert.Error(t, err)
+		assert.Equal(t, "", token)
+	})
+}
+
+// clearCIProviderEnvs unsets the environment variables of every CI system for the test
+func clearCIProviderEnvs(t *testing.T) {
+	t.Helper()
+	for _, p := range ciProviders {
+		for _, name := range p.envs {
+			t.Setenv(name, "")
+		}
+	}
+}
+
+func TestDetectCIProvider(t *testing.T) {
+	testCases := []struct {
+		name           string
+		envs           map[string]string
+		tokenFile      string
+		wantCredential string
+		wantDetectedBy string
+	}{
+		{
+			name: "no CI system",
+		},
+		{
+			name: "github actions",
+			envs: map[string]string{
+				actionsIDTokenRequestToken: "token",
+				actionsIDTokenRequestURL:   "https://token.actions.githubusercontent.com",
+			},
+			wantCredential: "GithubActionsCredential",
+			wantDetectedBy: "ACTIONS_ID_TOKEN_REQUEST_TOKEN and ACTIONS_ID_TOKEN_REQUEST_URL are set",
+		},
+		{
+			name: "github actions with a federated token file",
+			envs: map[string]string{
+				actionsIDTokenRequestToken: "token",
+				actionsIDTokenRequestURL:   "https://token.actions.githubusercontent.com",
+			},
+			tokenFile:      "/var/run/secrets/azure/tokens/azure-identity-token",
+			wantCredential: "GithubActionsCredential",
+			wantDetectedBy: "ACTIONS_ID_TOKEN_REQUEST_TOKEN and ACTIONS_ID_TOKEN_REQUEST_URL are set",
+		},
+		{
+			name: "gitlab ci without an ID token",
+			envs: map[string]string{env.GitLabCI: "true"},
+		},
+		{
+			name:           "gitlab ci",
+			envs:           map[string]string{env.GitLabCI: "true", env.GitLabOIDCToken: "gitlab-token"},
+			wantCredential: "GitLabCICredential",
+			wantDetectedBy: "GITLAB_CI and GITLAB_OIDC_TOKEN are set",
+		},
+		{
+			name:      "gitlab ci with a federated token file",
+			envs:      map[string]string{env.GitLabCI: "true", env.GitLabOIDCToken: "gitlab-token"},
+			tokenFile: "/var/run/secrets/azure/tokens/azure-identity-token",
+		},
+		{
+			name: "circleci with a federated token file from env",
+			envs: map[string]string{
+				env.CircleCIOIDCToken:       "circleci-token",
+				env.AzureFederatedTokenFile: "/var/run/secrets/azure/tokens/azure-identity-token",
+			},
+		},
+		{
+			name:           "circleci",
+			envs:           map[string]string{env.CircleCIOIDCToken: "circleci-token"},
+			wantCredential: "CircleCICredential",
+			wantDetectedBy: "CIRCLE_OIDC_TOKEN_V2 is set",
+		},
+		{
+			name:           "bitbucket pipelines",
+			envs:           map[string]string{env.BitbucketStepOIDCToken: "bitbucket-token"},
+			wantCredential: "BitbucketPipelinesCredential",
+			wantDetectedBy: "BITBUCKET_STEP_OIDC_TOKEN is set",
+		},
+		{
+			name:           "buildkite",
+			envs:           map[string]string{env.BuildkiteAgentAccessToken: "agent-token"},
+			wantCredential: "BuildkiteCredential",
+			wantDetectedBy: "BUILDKITE_AGENT_ACCESS_TOKEN is set",
+		},
+		{
+			name:           "spiffe workload api",
+			envs:           map[string]string{env.SpiffeEndpointSocket: "unix:///run/spire/agent/public/api.sock"},
+			wantCredential: "SPIFFECredential",
+			wantDetectedBy: "SPIFFE_ENDPOINT_SOCKET is set",
+		},
+		{
+			name: "spiffe workload api with a federated token file",
+			envs: map[string]string{
+				env.SpiffeEndpointSocket:    "unix:///run/spire/agent/public/api.sock",
+				env.AzureFederatedTokenFile: "/var/run/secrets/azure/tokens/azure-identity-token",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clearCIProviderEnvs(t)
+			t.Setenv(env.AzureFederatedTokenFile, "")
+			for k, v := range tc.envs {
+				t.Setenv(k, v)
+			}
+
+			p := detectCIProvider(&Options{FederatedTokenFile: tc.tokenFile})
+			if tc.wantCredential == "" {
+				assert.Nil(t, p)
+				return
+			}
+			require.NotNil(t, p)
+			assert.Equal(t, tc.wantCredential, p.credentialName)
+			assert.Equal(t, tc.wantDetectedBy, p.detectedBy())
+		})
+	}
+}
+
+func TestGetEnvToken(t *testing.T) {
+	t.Setenv(env.CircleCIOIDCToken, "circleci-token")
+	token, err := getEnvToken(env.CircleCIOIDCToken)(context.Background(), azureADAudience)
+	assert.NoError(t, err)
+	assert.Equal(t, "circleci-token", token)
+
+	t.Setenv(env.CircleCIOIDCToken, "")
+	_, err = getEnvToken(env.CircleCIOIDCToken)(context.Background(), azureADAudience)
+	assert.EqualError(t, err, "CIRCLE_OIDC_TOKEN_V2 is not set")
+}
+
+func TestGetGitHubTokenAudience(t *testing.T) {
+	var audience string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		audience = r.URL.Query().Get("audience")
+		w.Write([]byte(`{"value":"TEST_ACCESS_TOKEN"}`))
+	}))
+	defer ts.Close()
+
+	t.Setenv(actionsIDTokenRequestToken, "test-token")
+	t.Setenv(actionsIDTokenRequestURL, ts.URL)
+
+	_, err := getGitHubToken(context.Background(), "api://kubelogin")
+	assert.NoError(t, err)
+	assert.Equal(t, "api://kubelogin", audience)
+}
+
+func TestGetBuildkiteToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the buildkite agent is a shell script")
+	}
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\necho buildkite-token\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "buildkite-agent"), []byte(script), 0o700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	token, err := getBuildkiteToken(context.Background(), "api://kubelogin")
+	require.NoError(t, err)
+	assert.Equal(t, "buildkite-token", token)
+	b, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "oidc request-token --audience api://kubelogin\n", string(b))
+}
+
+func TestCIProviderCredentialGetToken(t *testing.T) {
+	clearCIProviderEnvs(t)
+	t.Setenv(env.BitbucketStepOIDCToken, "bitbucket-token")
+	sts := newFakeSTS(t)
+
+	cred, err := NewAzIdentityCredential(azidentity.AuthenticationRecord{}, &Options{
+		LoginMethod:              WorkloadIdentityLogin,
+		ClientID:                 "client-id",
+		TenantID:                 "tenant",
+		AuthorityHost:            sts.server.URL + "/",
+		DisableInstanceDiscovery: true,
+		httpClient:               sts.server.Client(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "BitbucketPipelinesCredential", cred.Name())
+
+	token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"server-id/.default"}})
+	require.NoError(t, err)
+	assert.Equal(t, "access-token-1", token.Token)
+
+	require.Len(t, sts.tokenRequests, 1)
+	req := sts.tokenRequests[0]
+	assert.Equal(t, "client_credentials", req.Get("grant_type"))
+	assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", req.Get("client_assertion_type"))
+	assert.Equal(t, "bitbucket-token", req.Get("client_assertion"))
+}
+
+// fakeWorkloadAPI is a SPIFFE Workload API issuing a JWT-SVID for the requested audience
+type fakeWorkloadAPI struct {
+	workload.UnimplementedSpiffeWorkloadAPIServer
+	key       *ecdsa.PrivateKey
+	mu        sync.Mutex
+	audiences [][]string
+}
+
+func (f *fakeWorkloadAPI) FetchJWTSVID(ctx context.Context, req *workload.JWTSVIDRequest) (*workload.JWTSVIDResponse, error) {
+	// the Workload API rejects requests without the security header
+	if md, _ := metadata.FromIncomingContext(ctx); len(md.Get("workload.spiffe.io")) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "security header missing from request")
+	}
+	f.mu.Lock()
+	f.audiences = append(f.audiences, req.Audience)
+	f.mu.Unlock()
+
+	svid, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Subject:   "spiffe://example.org/build-agent",
+		Audience:  req.Audience,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+	}).SignedString(f.key)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &workload.JWTSVIDResponse{Svids: []*workload.JWTSVID{{SpiffeId: "spiffe://example.org/build-agent", Svid: svid}}}, nil
+}
+
+// newFakeWorkloadAPI serves a fake Workload API on a unix socket and returns its address
+func newFakeWorkloadAPI(t *testing.T) (*fakeWorkloadAPI, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	api := &fakeWorkloadAPI{key: key}
+
+	// unix socket paths are limited to about 100 characters, shorter than some test temp dirs
+	dir, err := os.MkdirTemp("", "spiffe")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "agent.sock")
+	lis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	workload.RegisterSpiffeWorkloadAPIServer(server, api)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+	return api, "unix://" + socket
+}
+
+func TestGetSPIFFEToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake Workload API listens on a unix socket")
+	}
+
+	t.Run("fetches a JWT-SVID for the audience", func(t *testing.T) {
+		api, addr := newFakeWorkloadAPI(t)
+		t.Setenv(env.SpiffeEndpointSocket, addr)
+
+		svid, err := getSPIFFEToken(context.Background(), azureADAudience)
+		require.NoError(t, err)
+		claims := &jwt.RegisteredClaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(svid, claims)
+		require.NoError(t, err)
+		assert.Equal(t, "spiffe://example.org/build-agent", claims.Subject)
+		assert.Equal(t, [][]string{{azureADAudience}}, api.audiences)
+	})
+
+	t.Run("workload API is unavailable", func(t *testing.T) {
+		t.Setenv(env.SpiffeEndpointSocket, "unix://"+filepath.Join(os.TempDir(), "kubelogin-no-such.sock"))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, err := getSPIFFEToken(ctx, azureADAudience)
+		assert.ErrorContains(t, err, "failed to fetch JWT-SVID from the SPIFFE Workload API")
+	})
+
+	t.Run("exchanged as the client assertion of workloadidentity login", func(t *testing.T) {
+		_, addr := newFakeWorkloadAPI(t)
+		clearCIProviderEnvs(t)
+		t.Setenv(env.SpiffeEndpointSocket, addr)
+		sts := newFakeSTS(t)
+
+		cred, err := NewAzIdentityCredential(azidentity.AuthenticationRecord{}, &Options{
+			LoginMethod:              WorkloadIdentityLogin,
+			ClientID:                 "client-id",
+			TenantID:                 "tenant",
+			AuthorityHost:            sts.server.URL + "/",
+			DisableInstanceDiscovery: true,
+			httpClient:               sts.server.Client(),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "SPIFFECredential", cred.Name())
+
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"server-id/.default"}})
+		require.NoError(t, err)
+		assert.Equal(t, "access-token-1", token.Token)
+		require.Len(t, sts.tokenRequests, 1)
+		claims := &jwt.RegisteredClaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(sts.tokenRequests[0].Get("client_assertion"), claims)
+		require.NoError(t, err)
+		assert.Equal(t, "spiffe://example.org/build-agent", claims.Subject)
+	})
+}
@@ -0,0 +1,72 @@
+package token
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
+)
+
+// CIProviderCredential authenticates workloadidentity login with the OIDC token of the
+// CI system kubelogin runs in, used as the client assertion of a federated identity credential
+type CIProviderCredential struct {
+	client   confidential.Client
+	provider *ciProvider
+}
+
+var _ CredentialProvider = (*CIProviderCredential)(nil)
+
+func newCIProviderCredential(opts *Options, provider *ciProvider) (CredentialProvider, error) {
+	if opts.ClientID == "" {
+		return nil, fmt.Errorf("client ID cannot be empty")
+	}
+	if opts.TenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	audience := opts.ClientAssertionAudience
+	if audience == "" {
+		audience = azureADAudience
+	}
+	cred := confidential.NewCredFromAssertionCallback(func(ctx context.Context, _ confidential.AssertionRequestOptions) (string, error) {
+		return provider.getToken(ctx, audience)
+	})
+
+	o := []confidential.Option{
+		confidential.WithInstanceDiscovery(!opts.DisableInstanceDiscovery),
+	}
+	if opts.httpClient != nil {
+		o = append(o, confidential.WithHTTPClient(opts.httpClient))
+	}
+	client, err := confidential.New(
+		fmt.Sprintf("%s%s/", opts.GetCloudConfiguration().ActiveDirectoryAuthorityHost, opts.TenantID),
+		opts.ClientID, cred, o...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s credential: %w", provider.name, err)
+	}
+
+	return &CIProviderCredential{client: client, provider: provider}, nil
+}
+
+func (c *CIProviderCredential) Name() string {
+	return c.provider.credentialName
+}
+
+func (c *CIProviderCredential) Authenticate(ctx context.Context, opts *policy.TokenRequestOptions) (azidentity.AuthenticationRecord, error) {
+	return azidentity.AuthenticationRecord{}, errAuthenticateNotSupported
+}
+
+func (c *CIProviderCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	result, err := c.client.AcquireTokenByCredential(ctx, opts.Scopes)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	return azcore.AccessToken{Token: result.AccessToken, ExpiresOn: result.ExpiresOn}, nil
+}
+
+func (c *CIProviderCredential) NeedAuthenticate() bool {
+	return false
+}
@@ -0,0 +1,45 @@
+package token
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// parseClaims returns the JSON of a claims challenge. The challenge may be given as
+// JSON or base64 encoded as in the claims parameter of a WWW-Authenticate header.
+func parseClaims(claims string) (string, error) {
+	claims = strings.TrimSpace(claims)
+	if strings.HasPrefix(claims, "{") {
+		if !isJSONObject([]byte(claims)) {
+			return "", fmt.Errorf("claims %q is not a valid JSON object", claims)
+		}
+		return claims, nil
+	}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		b, err := encoding.DecodeString(claims)
+		if err == nil && isJSONObject(b) {
+			return string(b), nil
+		}
+	}
+	return "", fmt.Errorf("claims %q is neither a JSON object nor a base64 encoded JSON object", claims)
+}
+
+func isJSONObject(b []byte) bool {
+	var v map[string]any
+	return json.Unmarshal(b, &v) == nil
+}
+
+// isInteractionRequired reports whether a token request failed because the user
+// has to sign in again, e.g. to satisfy a claims challenge
+func isInteractionRequired(err error) bool {
+	var authRequiredErr *azidentity.AuthenticationRequiredError
+	if errors.As(err, &authRequiredErr) || errors.Is(err, errAuthenticationRequired) {
+		return true
+	}
+	return strings.Contains(err.Error(), "interaction_required")
+}
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClaims(t *testing.T) {
+	const claims = `{"access_token":{"nbf":{"essential":true,"value":"1726077595"}}}`
+
+	testCases := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "json", input: claims, want: claims},
+		{name: "json with whitespace", input: " " + claims + "\n", want: claims},
+		{name: "base64", input: base64.StdEncoding.EncodeToString([]byte(claims)), want: claims},
+		{name: "unpadded base64url", input: base64.RawURLEncoding.EncodeToString([]byte(claims)), want: claims},
+		{name: "invalid json", input: `{"access_token":`, wantErr: true},
+		{name: "base64 of a non-object", input: base64.StdEncoding.EncodeToString([]byte(`"claims"`)), wantErr: true},
+		{name: "garbage", input: "not claims", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseClaims(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestIsInteractionRequired(t *testing.T) {
+	assert.True(t, isInteractionRequired(&azidentity.AuthenticationRequiredError{}))
+	assert.True(t, isInteractionRequired(fmt.Errorf("failed: %w", errors.New(`{"error":"interaction_required","error_description":"AADSTS50076"}`))))
+	assert.False(t, isInteractionRequired(errors.New("invalid_client")))
+}
@@ -0,0 +1,179 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
+	"github.com/golang-jwt/jwt/v4"
+	klog "k8s.io/klog/v2"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
+)
+
+const (
+	// ClientAssertionCacheDirName is the directory of the cache directory holding the client
+	// assertions of --client-assertion-command
+	ClientAssertionCacheDirName = "assertions"
+	// clientAssertionExpiryMargin is how long before its exp a cached client assertion
+	// is no longer used, so that it does not expire on its way to Microsoft Entra ID
+	clientAssertionExpiryMargin = time.Minute
+)
+
+// clientAssertionSource gets the client assertion from the output of a command, cached
+// until it expires, or from a file read each time
+type clientAssertionSource struct {
+	command  string
+	file     string
+	audience string
+	// cache persists the assertion of the command across get-token invocations, nil when disabled
+	cache accessor.Accessor
+	// assertion is the last assertion of the command and expiresOn its exp
+	assertion string
+	expiresOn time.Time
+	now       func() time.Time
+}
+
+func newClientAssertionSource(opts *Options) (*clientAssertionSource, error) {
+	if opts.ClientAssertionCommand == "" && opts.ClientAssertionFile == "" {
+		return nil, fmt.Errorf("client assertion command or file is required")
+	}
+	s := &clientAssertionSource{
+		command:  opts.ClientAssertionCommand,
+		file:     opts.ClientAssertionFile,
+		audience: opts.ClientAssertionAudience,
+		now:      time.Now,
+	}
+	if s.audience == "" {
+		s.audience = azureADAudience
+	}
+	if s.command != "" && !opts.DisableTokenCache {
+		path := filepath.Join(opts.AuthRecordCacheDir, ClientAssertionCacheDirName, getClientAssertionCacheKey(s.command, s.audience)+".cache")
+		var err error
+		if storageErr := secureStorageError(); storageErr == nil {
+			s.cache, err = popcache.NewSecureAccessor(path)
+		} else if opts.hasPoPCacheEncryption() {
+			klog.V(5).Infof("secure storage is unavailable, caching client assertions in a file encrypted with the pop cache key: %v", storageErr)
+			s.cache, err = opts.newEncryptedFileAccessor(path)
+		} else {
+			// the assertion is a credential, so it is kept in memory only rather than in a plain file
+			klog.Warningf("secure storage is unavailable, the client assertion command runs on every invocation. Use --pop-cache-key or --pop-cache-passphrase to cache its assertion in an encrypted file: %v", storageErr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client assertion cache storage: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// getAssertion returns the client assertion for the audience
+func (s *clientAssertionSource) getAssertion(ctx context.Context) (string, error) {
+	if s.file != "" {
+		b, err := os.ReadFile(s.file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the client assertion file: %w", err)
+		}
+		assertion := strings.TrimSpace(string(b))
+		if _, err := s.validate(assertion); err != nil {
+			return "", fmt.Errorf("client assertion file %s: %w", s.file, err)
+		}
+		return assertion, nil
+	}
+
+	if s.assertion == "" && s.cache != nil {
+		s.readCache(ctx)
+	}
+	if s.assertion != "" && s.now().Add(clientAssertionExpiryMargin).Before(s.expiresOn) {
+		klog.V(5).Info("using the cached client assertion")
+		return s.assertion, nil
+	}
+
+	assertion, err := s.runCommand(ctx)
+	if err != nil {
+		return "", err
+	}
+	expiresOn, err := s.validate(assertion)
+	if err != nil {
+		return "", fmt.Errorf("client assertion of command %q: %w", s.command, err)
+	}
+	s.assertion, s.expiresOn = assertion, expiresOn
+	if s.cache != nil && !expiresOn.IsZero() {
+		if err := s.cache.Write(ctx, []byte(assertion)); err != nil {
+			klog.V(5).Infof("failed to cache the client assertion: %v", err)
+		}
+	}
+	return assertion, nil
+}
+
+// readCache loads the assertion cached by a previous get-token invocation
+func (s *clientAssertionSource) readCache(ctx context.Context) {
+	b, err := s.cache.Read(ctx)
+	if err != nil || len(b) == 0 {
+		return
+	}
+	assertion := string(b)
+	expiresOn, err := s.validate(assertion)
+	if err != nil {
+		klog.V(5).Infof("ignoring the cached client assertion: %v", err)
+		return
+	}
+	s.assertion, s.expiresOn = assertion, expiresOn
+}
+
+// runCommand runs the command and returns its output. The audience is passed in the
+// KUBELOGIN_CLIENT_ASSERTION_AUDIENCE environment variable. Its errors go to stderr as
+// stdout carries the exec credential read by kubectl.
+func (s *clientAssertionSource) runCommand(ctx context.Context) (string, error) {
+	args := strings.Fields(s.command)
+	if len(args) == 0 {
+		return "", errors.New("client assertion command is empty")
+	}
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", env.KubeloginClientAssertionAudience, s.audience))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run client assertion command %q: %w", s.command, err)
+	}
+	assertion := strings.TrimSpace(stdout.String())
+	if assertion == "" {
+		return "", fmt.Errorf("client assertion command %q returned no assertion", s.command)
+	}
+	return assertion, nil
+}
+
+// validate checks the assertion is a JWT for the audience that has not expired, and
+// returns its exp. The signature is verified by Microsoft Entra ID.
+func (s *clientAssertionSource) validate(assertion string) (time.Time, error) {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse the client assertion: %w", err)
+	}
+	if !slices.Contains(claims.Audience, s.audience) {
+		return time.Time{}, fmt.Errorf("client assertion audience %v does not contain %s", []string(claims.Audience), s.audience)
+	}
+	if claims.ExpiresAt == nil {
+		return time.Time{}, nil
+	}
+	expiresOn := claims.ExpiresAt.Time
+	if !s.now().Before(expiresOn) {
+		return time.Time{}, fmt.Errorf("client assertion expired on %s", expiresOn.Format(time.RFC3339))
+	}
+	return expiresOn, nil
+}
+
+// getClientAssertionCacheKey identifies the assertions of a command for the audience
+func getClientAssertionCacheKey(command, audience string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(command+"\x00"+audience)))
+}
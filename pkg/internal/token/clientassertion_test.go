@@ -0,0 +1,237 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor/file"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClientAssertion returns a JWT for the audience expiring at exp. Its signature is
+// not verified by kubelogin.
+func newTestClientAssertion(t *testing.T, audience string, exp time.Time) string {
+	t.Helper()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(exp),
+		Issuer:    "https://issuer.example.com",
+		Subject:   "kubelogin",
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	return assertion
+}
+
+// writeClientAssertionScript writes a command printing the assertion file. Each run appends
+// the audience it is passed to the runs file.
+func writeClientAssertionScript(t *testing.T, assertionFile string) (command, runsFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	runsFile = filepath.Join(dir, "runs")
+	path := filepath.Join(dir, "assertion.sh")
+	body := `echo "$KUBELOGIN_CLIENT_ASSERTION_AUDIENCE" >> "$1"` + "\n" + `cat "$2"`
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o700))
+	return strings.Join([]string{path, runsFile, assertionFile}, " "), runsFile
+}
+
+func readClientAssertionRuns(t *testing.T, runsFile string) []string {
+	t.Helper()
+	b, err := os.ReadFile(runsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	return strings.Fields(string(b))
+}
+
+func TestNewClientAssertionCredential(t *testing.T) {
+	testCases := []struct {
+		name    string
+		opts    *Options
+		wantErr string
+	}{
+		{
+			name: "valid options",
+			opts: &Options{ClientID: "client-id", TenantID: "tenant", ClientAssertionFile: "assertion.jwt"},
+		},
+		{
+			name:    "missing client ID",
+			opts:    &Options{TenantID: "tenant", ClientAssertionFile: "assertion.jwt"},
+			wantErr: "client ID cannot be empty",
+		},
+		{
+			name:    "missing tenant ID",
+			opts:    &Options{ClientID: "client-id", ClientAssertionFile: "assertion.jwt"},
+			wantErr: "tenant ID cannot be empty",
+		},
+		{
+			name:    "missing command and file",
+			opts:    &Options{ClientID: "client-id", TenantID: "tenant"},
+			wantErr: "client assertion command or file is required",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cred, err := newClientAssertionCredential(tc.opts)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				assert.Nil(t, cred)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "ClientAssertionCredential", cred.Name())
+		})
+	}
+}
+
+func TestClientAssertionCredentialGetToken(t *testing.T) {
+	sts := newFakeSTS(t)
+	assertion := newTestClientAssertion(t, azureADAudience, time.Now().Add(time.Hour))
+	assertionFile := filepath.Join(t.TempDir(), "assertion.jwt")
+	require.NoError(t, os.WriteFile(assertionFile, []byte(assertion+"\n"), 0o600))
+
+	cred, err := newClientAssertionCredential(&Options{
+		ClientID:                 "client-id",
+		TenantID:                 "tenant",
+		ClientAssertionFile:      assertionFile,
+		AuthorityHost:            sts.server.URL + "/",
+		DisableInstanceDiscovery: true,
+		httpClient:               sts.server.Client(),
+	})
+	require.NoError(t, err)
+
+	token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"server-id/.default"}})
+	require.NoError(t, err)
+	assert.Equal(t, "access-token-1", token.Token)
+
+	require.Len(t, sts.tokenRequests, 1)
+	req := sts.tokenRequests[0]
+	assert.Equal(t, "client_credentials", req.Get("grant_type"))
+	assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", req.Get("client_assertion_type"))
+	assert.Equal(t, assertion, req.Get("client_assertion"))
+}
+
+func TestClientAssertionSource(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	t.Run("file is read each time", func(t *testing.T) {
+		assertionFile := filepath.Join(t.TempDir(), "assertion.jwt")
+		s, err := newClientAssertionSource(&Options{ClientAssertionFile: assertionFile})
+		require.NoError(t, err)
+
+		for _, exp := range []time.Time{now.Add(time.Hour), now.Add(2 * time.Hour)} {
+			want := newTestClientAssertion(t, azureADAudience, exp)
+			require.NoError(t, os.WriteFile(assertionFile, []byte(want), 0o600))
+			got, err := s.getAssertion(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		}
+	})
+
+	t.Run("audience must match", func(t *testing.T) {
+		assertionFile := filepath.Join(t.TempDir(), "assertion.jwt")
+		require.NoError(t, os.WriteFile(assertionFile, []byte(newTestClientAssertion(t, azureADAudience, now.Add(time.Hour))), 0o600))
+		s, err := newClientAssertionSource(&Options{ClientAssertionFile: assertionFile, ClientAssertionAudience: "api://kubelogin"})
+		require.NoError(t, err)
+
+		_, err = s.getAssertion(ctx)
+		assert.ErrorContains(t, err, "client assertion audience [api://AzureADTokenExchange] does not contain api://kubelogin")
+	})
+
+	t.Run("expired assertion is rejected", func(t *testing.T) {
+		assertionFile := filepath.Join(t.TempDir(), "assertion.jwt")
+		require.NoError(t, os.WriteFile(assertionFile, []byte(newTestClientAssertion(t, azureADAudience, now.Add(-time.Minute))), 0o600))
+		s, err := newClientAssertionSource(&Options{ClientAssertionFile: assertionFile})
+		require.NoError(t, err)
+
+		_, err = s.getAssertion(ctx)
+		assert.ErrorContains(t, err, "client assertion expired on")
+	})
+
+	t.Run("assertion must be a JWT", func(t *testing.T) {
+		assertionFile := filepath.Join(t.TempDir(), "assertion.jwt")
+		require.NoError(t, os.WriteFile(assertionFile, []byte("not-a-jwt"), 0o600))
+		s, err := newClientAssertionSource(&Options{ClientAssertionFile: assertionFile})
+		require.NoError(t, err)
+
+		_, err = s.getAssertion(ctx)
+		assert.ErrorContains(t, err, "failed to parse the client assertion")
+	})
+
+	t.Run("command assertion is cached until it expires", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("the client assertion command is a shell script")
+		}
+		assertionFile := filepath.Join(t.TempDir(), "assertion.jwt")
+		assertion := newTestClientAssertion(t, "api://kubelogin", now.Add(time.Hour))
+		require.NoError(t, os.WriteFile(assertionFile, []byte(assertion), 0o600))
+		command, runsFile := writeClientAssertionScript(t, assertionFile)
+		cachePath := filepath.Join(t.TempDir(), "assertion.cache")
+
+		newSource := func(now time.Time) *clientAssertionSource {
+			s, err := newClientAssertionSource(&Options{ClientAssertionCommand: command, ClientAssertionAudience: "api://kubelogin", DisableTokenCache: true})
+			require.NoError(t, err)
+			s.cache, err = file.New(cachePath)
+			require.NoError(t, err)
+			s.now = func() time.Time { return now }
+			return s
+		}
+
+		s := newSource(now)
+		for range 2 {
+			got, err := s.getAssertion(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, assertion, got)
+		}
+		assert.Equal(t, []string{"api://kubelogin"}, readClientAssertionRuns(t, runsFile), "the command runs once with the audience")
+
+		// a later get-token invocation reuses the cached assertion
+		got, err := newSource(now).getAssertion(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, assertion, got)
+		assert.Len(t, readClientAssertionRuns(t, runsFile), 1)
+
+		// the command runs again once the cached assertion expires within the margin
+		renewed := newTestClientAssertion(t, "api://kubelogin", now.Add(2*time.Hour))
+		require.NoError(t, os.WriteFile(assertionFile, []byte(renewed), 0o600))
+		got, err = newSource(now.Add(time.Hour - clientAssertionExpiryMargin)).getAssertion(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, renewed, got)
+		assert.Len(t, readClientAssertionRuns(t, runsFile), 2)
+	})
+
+	t.Run("command failure is returned", func(t *testing.T) {
+		s, err := newClientAssertionSource(&Options{ClientAssertionCommand: "kubelogin-test-no-such-command", DisableTokenCache: true})
+		require.NoError(t, err)
+
+		_, err = s.getAssertion(ctx)
+		assert.ErrorContains(t, err, `failed to run client assertion command "kubelogin-test-no-such-command"`)
+	})
+
+	t.Run("assertion is not persisted in a plain file without secure storage", func(t *testing.T) {
+		original := secureStorageError
+		defer func() { secureStorageError = original }()
+		secureStorageError = func() error { return errors.New("no keyring") }
+
+		s, err := newClientAssertionSource(&Options{ClientAssertionCommand: "vault-jwt", AuthRecordCacheDir: t.TempDir()})
+		require.NoError(t, err)
+		assert.Nil(t, s.cache)
+	})
+
+	t.Run("assertion is not persisted with the token cache disabled", func(t *testing.T) {
+		s, err := newClientAssertionSource(&Options{ClientAssertionCommand: "vault-jwt", DisableTokenCache: true})
+		require.NoError(t, err)
+		assert.Nil(t, s.cache)
+		assert.Equal(t, azureADAudience, s.audience)
+	})
+}
@@ -0,0 +1,71 @@
+package token
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
+)
+
+// ClientAssertionCredential authenticates a service principal with a federated client
+// assertion issued by a command or read from a file
+type ClientAssertionCredential struct {
+	client confidential.Client
+}
+
+var _ CredentialProvider = (*ClientAssertionCredential)(nil)
+
+func newClientAssertionCredential(opts *Options) (CredentialProvider, error) {
+	if opts.ClientID == "" {
+		return nil, fmt.Errorf("client ID cannot be empty")
+	}
+	if opts.TenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	source, err := newClientAssertionSource(opts)
+	if err != nil {
+		return nil, err
+	}
+	cred := confidential.NewCredFromAssertionCallback(func(ctx context.Context, _ confidential.AssertionRequestOptions) (string, error) {
+		return source.getAssertion(ctx)
+	})
+
+	o := []confidential.Option{
+		confidential.WithInstanceDiscovery(!opts.DisableInstanceDiscovery),
+	}
+	if opts.httpClient != nil {
+		o = append(o, confidential.WithHTTPClient(opts.httpClient))
+	}
+	client, err := confidential.New(
+		fmt.Sprintf("%s%s/", opts.GetCloudConfiguration().ActiveDirectoryAuthorityHost, opts.TenantID),
+		opts.ClientID, cred, o...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client assertion credential: %w", err)
+	}
+
+	return &ClientAssertionCredential{client: client}, nil
+}
+
+func (c *ClientAssertionCredential) Name() string {
+	return "ClientAssertionCredential"
+}
+
+func (c *ClientAssertionCredential) Authenticate(ctx context.Context, opts *policy.TokenRequestOptions) (azidentity.AuthenticationRecord, error) {
+	return azidentity.AuthenticationRecord{}, errAuthenticateNotSupported
+}
+
+func (c *ClientAssertionCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	result, err := c.client.AcquireTokenByCredential(ctx, opts.Scopes)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	return azcore.AccessToken{Token: result.AccessToken, ExpiresOn: result.ExpiresOn}, nil
+}
+
+func (c *ClientAssertionCredential) NeedAuthenticate() bool {
+	return false
+}
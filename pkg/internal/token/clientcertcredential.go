@@ -1,13 +1,21 @@
 package token
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
@@ -17,7 +25,7 @@ import (
 )
 
 type ClientCertificateCredential struct {
-	cred *azidentity.ClientCertificateCredential
+	cred azcore.TokenCredential
 }
 
 var _ CredentialProvider = (*ClientCertificateCredential)(nil)
@@ -37,33 +45,52 @@ func newClientCertificateCredential(opts *Options) (CredentialProvider, error) {
 		err error
 	)
 	if opts.UsePersistentCache {
-		c, err = newPersistentCache()
+		c, err = newPersistentCache(nil)
 		if err != nil {
 			klog.V(5).Infof("failed to create cache: %v", err)
 		}
 	}
 
 	// Get the certificate and private key from file
-	cert, rsaPrivateKey, err := readCertificate(opts.ClientCert, opts.ClientCertPassword)
+	cert, privateKey, err := newClientCertificate(opts).read()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read certificate: %w", err)
 	}
 
-	azOpts := &azidentity.ClientCertificateCredentialOptions{
-		ClientOptions:            azcore.ClientOptions{Cloud: opts.GetCloudConfiguration()},
-		Cache:                    c,
-		SendCertificateChain:     true,
-		DisableInstanceDiscovery: opts.DisableInstanceDiscovery,
-	}
-
+	clientOpts := azcore.ClientOptions{Cloud: opts.GetCloudConfiguration()}
 	if opts.httpClient != nil {
-		azOpts.Transport = opts.httpClient
+		clientOpts.Transport = opts.httpClient
 	}
 
-	cred, err := azidentity.NewClientCertificateCredential(
-		opts.TenantID, opts.ClientID,
-		[]*x509.Certificate{cert}, rsaPrivateKey,
-		azOpts)
+	var cred azcore.TokenCredential
+	if ecKey, ok := privateKey.(*ecdsa.PrivateKey); ok {
+		assertion, err := newCertificateAssertion(cert, ecKey, opts.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		tokenEndpoint, err := url.JoinPath(clientOpts.Cloud.ActiveDirectoryAuthorityHost, opts.TenantID, "oauth2/v2.0/token")
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct token endpoint: %w", err)
+		}
+		cred, err = azidentity.NewClientAssertionCredential(
+			opts.TenantID, opts.ClientID,
+			func(context.Context) (string, error) { return assertion.sign(tokenEndpoint) },
+			&azidentity.ClientAssertionCredentialOptions{
+				ClientOptions:            clientOpts,
+				Cache:                    c,
+				DisableInstanceDiscovery: opts.DisableInstanceDiscovery,
+			})
+	} else {
+		cred, err = azidentity.NewClientCertificateCredential(
+			opts.TenantID, opts.ClientID,
+			[]*x509.Certificate{cert}, privateKey,
+			&azidentity.ClientCertificateCredentialOptions{
+				ClientOptions:            clientOpts,
+				Cache:                    c,
+				SendCertificateChain:     true,
+				DisableInstanceDiscovery: opts.DisableInstanceDiscovery,
+			})
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client certificate credential: %w", err)
 	}
@@ -86,11 +113,23 @@ func (c *ClientCertificateCredential) NeedAuthenticate() bool {
 	return false
 }
 
-func isPublicKeyEqual(key1, key2 *rsa.PublicKey) bool {
-	if key1.N == nil || key2.N == nil {
+func isPublicKeyEqual(key1, key2 crypto.PublicKey) bool {
+	switch k1 := key1.(type) {
+	case *rsa.PublicKey:
+		k2, ok := key2.(*rsa.PublicKey)
+		if !ok || k1.N == nil || k2.N == nil {
+			return false
+		}
+		return k1.E == k2.E && k1.N.Cmp(k2.N) == 0
+	case *ecdsa.PublicKey:
+		k2, ok := key2.(*ecdsa.PublicKey)
+		if !ok || k1.X == nil || k2.X == nil {
+			return false
+		}
+		return k1.Equal(k2)
+	default:
 		return false
 	}
-	return key1.E == key2.E && key1.N.Cmp(key2.N) == 0
 }
 
 func splitPEMBlock(pemBlock []byte) (certPEM []byte, keyPEM []byte) {
@@ -103,7 +142,7 @@ func splitPEMBlock(pemBlock []byte) (certPEM []byte, keyPEM []byte) {
 		switch derBlock.Type {
 		case "CERTIFICATE":
 			certPEM = append(certPEM, pem.EncodeToMemory(derBlock)...)
-		case "PRIVATE KEY":
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
 			keyPEM = append(keyPEM, pem.EncodeToMemory(derBlock)...)
 		}
 	}
@@ -111,36 +150,75 @@ func splitPEMBlock(pemBlock []byte) (certPEM []byte, keyPEM []byte) {
 	return certPEM, keyPEM
 }
 
-func parseRsaPrivateKey(privateKeyPEM []byte) (*rsa.PrivateKey, error) {
+// parsePrivateKey parses an RSA or ECDSA private key. A PKCS#8 key encrypted with a
+// password is decrypted with the password of the certificate.
+func parsePrivateKey(privateKeyPEM []byte, password string) (crypto.PrivateKey, error) {
 	block, _ := pem.Decode(privateKeyPEM)
 	if block == nil {
 		return nil, fmt.Errorf("failed to decode a pem block from private key")
 	}
+	if _, ok := block.Headers["DEK-Info"]; ok {
+		return nil, fmt.Errorf("legacy PEM encryption of the private key is not supported, encrypt the private key as PKCS#8 instead")
+	}
 
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if password == "" {
+			return nil, fmt.Errorf("the private key is encrypted, a password is required")
+		}
+		der, err := decryptPKCS8PrivateKey(block.Bytes, password)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := x509.ParsePKCS8PrivateKey(der); err != nil {
+			// the padding of a key decrypted with a wrong password can still be valid
+			return nil, errPKCS8Decryption
+		}
+		return parsePKCS8PrivateKey(der)
+	}
+
+	// pkcs12.ToPEM returns "PRIVATE KEY" blocks with PKCS#1 RSA keys and SEC 1 ECDSA keys
 	privatePkcs1Key, errPkcs1 := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if errPkcs1 == nil {
 		return privatePkcs1Key, nil
 	}
-
-	privatePkcs8Key, errPkcs8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+	privateECKey, errEC := x509.ParseECPrivateKey(block.Bytes)
+	if errEC == nil {
+		return privateECKey, nil
+	}
+	privatePkcs8Key, errPkcs8 := parsePKCS8PrivateKey(block.Bytes)
 	if errPkcs8 == nil {
-		privatePkcs8RsaKey, ok := privatePkcs8Key.(*rsa.PrivateKey)
-		if !ok {
-			return nil, fmt.Errorf("pkcs8 contained non-RSA key. Expected RSA key")
-		}
-		return privatePkcs8RsaKey, nil
+		return privatePkcs8Key, nil
 	}
 
-	return nil, fmt.Errorf("failed to parse private key as Pkcs#1 or Pkcs#8. (%w), (%w)", errPkcs1, errPkcs8)
+	return nil, fmt.Errorf("failed to parse private key as Pkcs#1, SEC 1 or Pkcs#8. (%w), (%w), (%w)", errPkcs1, errEC, errPkcs8)
+}
+
+func parsePKCS8PrivateKey(der []byte) (crypto.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("pkcs8 contained an unsupported %T key. Expected RSA or ECDSA key", key)
+	}
 }
 
-func parseKeyPairFromPEMBlock(pemBlock []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+func parseKeyPairFromPEMBlock(pemBlock []byte, password string) (*x509.Certificate, crypto.PrivateKey, error) {
 	certPEM, keyPEM := splitPEMBlock(pemBlock)
 
-	privateKey, err := parseRsaPrivateKey(keyPEM)
+	privateKey, err := parsePrivateKey(keyPEM, password)
 	if err != nil {
 		return nil, nil, err
 	}
+	publicKey := privateKey.(crypto.Signer).Public()
 
 	found := false
 	var cert *x509.Certificate
@@ -157,8 +235,7 @@ func parseKeyPairFromPEMBlock(pemBlock []byte) (*x509.Certificate, *rsa.PrivateK
 			return nil, nil, fmt.Errorf("unable to parse certificate: %w", err)
 		}
 
-		certPublicKey, ok := cert.PublicKey.(*rsa.PublicKey)
-		if ok && isPublicKeyEqual(certPublicKey, &privateKey.PublicKey) {
+		if isPublicKeyEqual(cert.PublicKey, publicKey) {
 			found = true
 			break
 		}
@@ -171,7 +248,7 @@ func parseKeyPairFromPEMBlock(pemBlock []byte) (*x509.Certificate, *rsa.PrivateK
 	return cert, privateKey, nil
 }
 
-func decodePkcs12(pkcs []byte, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+func decodePkcs12(pkcs []byte, password string) (*x509.Certificate, crypto.PrivateKey, error) {
 	blocks, err := pkcs12.ToPEM(pkcs, password)
 	if err != nil {
 		return nil, nil, err
@@ -182,21 +259,150 @@ func decodePkcs12(pkcs []byte, password string) (*x509.Certificate, *rsa.Private
 		pemData = append(pemData, pem.EncodeToMemory(b)...)
 	}
 
-	return parseKeyPairFromPEMBlock(pemData)
+	return parseKeyPairFromPEMBlock(pemData, "")
 }
 
-func readCertificate(certFile, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
-	if strings.HasSuffix(certFile, ".pfx") {
-		cert, err := os.ReadFile(certFile)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read the certificate file (%s): %w", certFile, err)
+// stdinCertificate is the client certificate read from stdin, which can only be read once
+var (
+	stdinCertificateOnce sync.Once
+	stdinCertificate     []byte
+	stdinCertificateErr  error
+	// certificateStdin is replaced in tests
+	certificateStdin io.Reader = os.Stdin
+)
+
+// clientCertificate reads the client certificate of the options and checks its expiry
+type clientCertificate struct {
+	path         string
+	password     string
+	expiryDays   int
+	expiryStrict bool
+}
+
+func newClientCertificate(opts *Options) clientCertificate {
+	return clientCertificate{
+		path:         opts.ClientCert,
+		password:     opts.ClientCertPassword,
+		expiryDays:   opts.ClientCertExpiryDays,
+		expiryStrict: opts.ClientCertExpiryStrict,
+	}
+}
+
+func (c clientCertificate) read() (*x509.Certificate, crypto.PrivateKey, error) {
+	cert, privateKey, err := readCertificate(c.path, c.password)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkCertificateExpiry(cert, c.expiryDays, c.expiryStrict, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	return cert, privateKey, nil
+}
+
+// readCertificate reads the certificate and private key of the client certificate: a file,
+// - for stdin or env:NAME for content in an environment variable. Whether the certificate
+// is PEM or PKCS#12 is detected from its content.
+func readCertificate(clientCert, password string) (*x509.Certificate, crypto.PrivateKey, error) {
+	data, err := readCertificateContent(clientCert)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseCertificate(data, password)
+}
+
+func readCertificateContent(clientCert string) ([]byte, error) {
+	switch {
+	case clientCert == "-":
+		stdinCertificateOnce.Do(func() {
+			stdinCertificate, stdinCertificateErr = io.ReadAll(certificateStdin)
+		})
+		if stdinCertificateErr != nil {
+			return nil, fmt.Errorf("failed to read the certificate from stdin: %w", stdinCertificateErr)
 		}
-		return decodePkcs12(cert, password)
-	} else {
-		cert, err := os.ReadFile(certFile)
+		return decodeCertificateContent(stdinCertificate), nil
+	case strings.HasPrefix(clientCert, SecretRefEnvPrefix):
+		name := strings.TrimPrefix(clientCert, SecretRefEnvPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %q of the certificate is not set", name)
+		}
+		return decodeCertificateContent([]byte(v)), nil
+	default:
+		data, err := os.ReadFile(clientCert)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read the certificate file (%s): %w", certFile, err)
+			return nil, fmt.Errorf("failed to read the certificate file (%s): %w", clientCert, err)
 		}
-		return parseKeyPairFromPEMBlock(cert)
+		return data, nil
+	}
+}
+
+// decodeCertificateContent decodes base64 certificate content. PEM and binary PKCS#12
+// content is returned as is.
+func decodeCertificateContent(content []byte) []byte {
+	if isPEM(content) {
+		return content
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(content)), "")); err == nil {
+		return decoded
+	}
+	return content
+}
+
+func isPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+// parseCertificate parses a PEM or PKCS#12 certificate with its private key
+func parseCertificate(data []byte, password string) (*x509.Certificate, crypto.PrivateKey, error) {
+	if isPEM(data) {
+		return parseKeyPairFromPEMBlock(data, password)
+	}
+	cert, privateKey, err := decodePkcs12(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode the certificate as PKCS#12 as it is not PEM: %w", err)
+	}
+	return cert, privateKey, nil
+}
+
+// ExitCodeCertificateExpiry is the exit status of get-token when the client certificate
+// expires within --client-certificate-expiry-days with --client-certificate-expiry-strict
+const ExitCodeCertificateExpiry = 3
+
+// CertificateExpiryError is returned in strict mode when the client certificate expires
+// within the configured number of days
+type CertificateExpiryError struct {
+	Subject  string
+	NotAfter time.Time
+	Days     int
+}
+
+func (e *CertificateExpiryError) Error() string {
+	return certificateExpiryMessage(e.Subject, e.NotAfter, time.Now())
+}
+
+// ExitCode is the exit status of kubelogin
+func (e *CertificateExpiryError) ExitCode() int {
+	return ExitCodeCertificateExpiry
+}
+
+func certificateExpiryMessage(subject string, notAfter, now time.Time) string {
+	if !now.Before(notAfter) {
+		return fmt.Sprintf("client certificate %q expired on %s", subject, notAfter.UTC().Format(time.RFC3339))
+	}
+	days := int(notAfter.Sub(now).Hours() / 24)
+	return fmt.Sprintf("client certificate %q expires on %s, in %d days", subject, notAfter.UTC().Format(time.RFC3339), days)
+}
+
+// checkCertificateExpiry logs a warning when the certificate expires within the days, or
+// fails in strict mode
+func checkCertificateExpiry(cert *x509.Certificate, days int, strict bool, now time.Time) error {
+	if days <= 0 || now.AddDate(0, 0, days).Before(cert.NotAfter) {
+		return nil
+	}
+	subject := cert.Subject.String()
+	if strict {
+		return &CertificateExpiryError{Subject: subject, NotAfter: cert.NotAfter, Days: days}
 	}
+	klog.Warningf("%s. Rotate it before it expires", certificateExpiryMessage(subject, cert.NotAfter, now))
+	return nil
 }
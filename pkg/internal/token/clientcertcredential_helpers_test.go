@@ -1,7 +1,9 @@
 package token
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -55,9 +57,17 @@ func TestIsPublicKeyEqual(t *testing.T) {
 	assert.False(t, isPublicKeyEqual(&key1.PublicKey, &key2.PublicKey), "different keys should not be equal")
 	assert.False(t, isPublicKeyEqual(&rsa.PublicKey{}, &key1.PublicKey), "nil modulus (left) should not be equal")
 	assert.False(t, isPublicKeyEqual(&key1.PublicKey, &rsa.PublicKey{}), "nil modulus (right) should not be equal")
+
+	ecKey1, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecKey2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	assert.True(t, isPublicKeyEqual(&ecKey1.PublicKey, &ecKey1.PublicKey), "identical ecdsa keys should be equal")
+	assert.False(t, isPublicKeyEqual(&ecKey1.PublicKey, &ecKey2.PublicKey), "different ecdsa keys should not be equal")
+	assert.False(t, isPublicKeyEqual(&key1.PublicKey, &ecKey1.PublicKey), "keys of different types should not be equal")
 }
 
-func TestParseRsaPrivateKey(t *testing.T) {
+func TestParsePrivateKey(t *testing.T) {
 	key, _ := certTestKeyPair(t)
 
 	pkcs1PEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
@@ -71,24 +81,45 @@ func TestParseRsaPrivateKey(t *testing.T) {
 	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
 	require.NoError(t, err)
 	ecPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecDER})
+	sec1DER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	sec1PEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1DER})
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	edPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER})
+
+	legacyEncryptedPEM := pem.EncodeToMemory(&pem.Block{
+		Type:    "RSA PRIVATE KEY",
+		Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-256-CBC,00000000000000000000000000000000"},
+		Bytes:   []byte("encrypted"),
+	})
 
 	testCases := []struct {
 		name         string
 		input        []byte
-		expectErr    bool
+		password     string
+		expectKey    crypto.PublicKey
 		expectErrMsg string
 	}{
-		{name: "pkcs1 rsa key", input: pkcs1PEM},
-		{name: "pkcs8 rsa key", input: pkcs8PEM},
-		{name: "pkcs8 non-rsa key", input: ecPEM, expectErr: true, expectErrMsg: "non-RSA"},
-		{name: "not a pem block", input: []byte("not a pem block"), expectErr: true, expectErrMsg: "failed to decode"},
-		{name: "empty input", input: nil, expectErr: true, expectErrMsg: "failed to decode"},
+		{name: "pkcs1 rsa key", input: pkcs1PEM, expectKey: &key.PublicKey},
+		{name: "pkcs8 rsa key", input: pkcs8PEM, expectKey: &key.PublicKey},
+		{name: "pkcs8 ecdsa key", input: ecPEM, expectKey: &ecKey.PublicKey},
+		{name: "sec1 ecdsa key", input: sec1PEM, expectKey: &ecKey.PublicKey},
+		{name: "encrypted pkcs8 key", input: []byte(testPKCS8AES256SHA256), password: testPKCS8Password},
+		{name: "encrypted pkcs8 key without password", input: []byte(testPKCS8AES256SHA256), expectErrMsg: "a password is required"},
+		{name: "legacy encrypted key", input: legacyEncryptedPEM, expectErrMsg: "legacy PEM encryption"},
+		{name: "pkcs8 ed25519 key", input: edPEM, expectErrMsg: "unsupported ed25519.PrivateKey key"},
+		{name: "not a pem block", input: []byte("not a pem block"), expectErrMsg: "failed to decode"},
+		{name: "empty input", input: nil, expectErrMsg: "failed to decode"},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := parseRsaPrivateKey(tc.input)
-			if tc.expectErr {
+			got, err := parsePrivateKey(tc.input, tc.password)
+			if tc.expectErrMsg != "" {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tc.expectErrMsg)
 				assert.Nil(t, got)
@@ -96,7 +127,9 @@ func TestParseRsaPrivateKey(t *testing.T) {
 			}
 			require.NoError(t, err)
 			require.NotNil(t, got)
-			assert.Equal(t, 0, key.PublicKey.N.Cmp(got.PublicKey.N), "parsed key should match the original")
+			if tc.expectKey != nil {
+				assert.True(t, isPublicKeyEqual(tc.expectKey, got.(crypto.Signer).Public()), "parsed key should match the original")
+			}
 		})
 	}
 }
@@ -116,9 +149,9 @@ func TestSplitPEMBlock(t *testing.T) {
 		assert.NotContains(t, string(gotCert), "SOMETHING ELSE")
 		assert.NotContains(t, string(gotKey), "SOMETHING ELSE")
 
-		parsedKey, err := parseRsaPrivateKey(gotKey)
+		parsedKey, err := parsePrivateKey(gotKey, "")
 		require.NoError(t, err)
-		assert.Equal(t, 0, key.PublicKey.N.Cmp(parsedKey.PublicKey.N))
+		assert.Equal(t, 0, key.PublicKey.N.Cmp(parsedKey.(*rsa.PrivateKey).PublicKey.N))
 	})
 
 	t.Run("returns nil for input without pem blocks", func(t *testing.T) {
@@ -137,21 +170,21 @@ func TestParseKeyPairFromPEMBlock(t *testing.T) {
 	otherCertPEM := certTestCertPEM(otherDER)
 
 	t.Run("matching cert and key", func(t *testing.T) {
-		cert, priv, err := parseKeyPairFromPEMBlock(bytesJoin(certPEM, keyPEM))
+		cert, priv, err := parseKeyPairFromPEMBlock(bytesJoin(certPEM, keyPEM), "")
 		require.NoError(t, err)
 		require.NotNil(t, cert)
 		require.NotNil(t, priv)
-		assert.Equal(t, 0, key.PublicKey.N.Cmp(priv.PublicKey.N))
+		assert.Equal(t, 0, key.PublicKey.N.Cmp(priv.(*rsa.PrivateKey).PublicKey.N))
 	})
 
 	t.Run("cert does not match key", func(t *testing.T) {
-		_, _, err := parseKeyPairFromPEMBlock(bytesJoin(otherCertPEM, keyPEM))
+		_, _, err := parseKeyPairFromPEMBlock(bytesJoin(otherCertPEM, keyPEM), "")
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "unable to find a matching public certificate")
 	})
 
 	t.Run("missing private key", func(t *testing.T) {
-		_, _, err := parseKeyPairFromPEMBlock(certPEM)
+		_, _, err := parseKeyPairFromPEMBlock(certPEM, "")
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to decode")
 	})
@@ -178,7 +211,20 @@ func TestReadCertificate(t *testing.T) {
 		cert, priv, err := readCertificate(p, "")
 		require.NoError(t, err)
 		require.NotNil(t, cert)
-		assert.Equal(t, 0, key.PublicKey.N.Cmp(priv.PublicKey.N))
+		assert.Equal(t, 0, key.PublicKey.N.Cmp(priv.(*rsa.PrivateKey).PublicKey.N))
+	})
+
+	t.Run("ecdsa certificate with encrypted pkcs8 key", func(t *testing.T) {
+		cert, priv, err := readCertificate("fixtures/cert_ecdsa_encrypted.pem", testPKCS8Password)
+		require.NoError(t, err)
+		assert.Equal(t, "kubelogin-test", cert.Subject.CommonName)
+		assert.IsType(t, &ecdsa.PrivateKey{}, priv)
+	})
+
+	t.Run("ecdsa certificate with wrong password", func(t *testing.T) {
+		_, _, err := readCertificate("fixtures/cert_ecdsa_encrypted.pem", "not-the-password")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the password may be incorrect")
 	})
 
 	t.Run("missing pem file", func(t *testing.T) {
@@ -202,3 +248,38 @@ func bytesJoin(parts ...[]byte) []byte {
 	}
 	return out
 }
+
+func TestCheckCertificateExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "kubelogin-test"},
+		NotAfter: now.AddDate(0, 0, 10),
+	}
+
+	t.Run("outside the warning window", func(t *testing.T) {
+		assert.NoError(t, checkCertificateExpiry(cert, 7, true, now))
+	})
+
+	t.Run("warning disabled", func(t *testing.T) {
+		assert.NoError(t, checkCertificateExpiry(cert, 0, true, now))
+	})
+
+	t.Run("warning within the window", func(t *testing.T) {
+		assert.NoError(t, checkCertificateExpiry(cert, 30, false, now))
+	})
+
+	t.Run("strict mode fails within the window", func(t *testing.T) {
+		err := checkCertificateExpiry(cert, 30, true, now)
+		var expiryErr *CertificateExpiryError
+		require.ErrorAs(t, err, &expiryErr)
+		assert.Equal(t, ExitCodeCertificateExpiry, expiryErr.ExitCode())
+		assert.Equal(t, cert.NotAfter, expiryErr.NotAfter)
+	})
+
+	t.Run("expiry message", func(t *testing.T) {
+		assert.Equal(t, `client certificate "CN=kubelogin-test" expires on 2026-01-11T00:00:00Z, in 10 days`,
+			certificateExpiryMessage("CN=kubelogin-test", cert.NotAfter, now))
+		assert.Equal(t, `client certificate "CN=kubelogin-test" expired on 2026-01-11T00:00:00Z`,
+			certificateExpiryMessage("CN=kubelogin-test", cert.NotAfter, now.AddDate(0, 0, 11)))
+	})
+}
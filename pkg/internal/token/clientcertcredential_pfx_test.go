@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -46,7 +48,7 @@ func TestDecodePkcs12WithPassword(t *testing.T) {
 		require.NotNil(t, key)
 		assert.Equal(t, "kubelogin-test", cert.Subject.CommonName)
 		assert.IsType(t, &rsa.PrivateKey{}, key)
-		require.NoError(t, key.Validate())
+		require.NoError(t, key.(*rsa.PrivateKey).Validate())
 	})
 
 	t.Run("wrong password returns error", func(t *testing.T) {
@@ -76,3 +78,61 @@ func TestReadCertificatePFX(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestReadCertificateContent(t *testing.T) {
+	pfx := testPFXBytes(t)
+	dir := t.TempDir()
+
+	t.Run("pkcs12 detected from the content of a .p12 file", func(t *testing.T) {
+		p := filepath.Join(dir, "client.p12")
+		require.NoError(t, os.WriteFile(p, pfx, 0o600))
+		cert, _, err := readCertificate(p, testPFXPassword)
+		require.NoError(t, err)
+		assert.Equal(t, "kubelogin-test", cert.Subject.CommonName)
+	})
+
+	t.Run("base64 pkcs12 from an environment variable", func(t *testing.T) {
+		t.Setenv("TEST_CLIENT_CERTIFICATE", testPFXBase64)
+		cert, _, err := readCertificate("env:TEST_CLIENT_CERTIFICATE", testPFXPassword)
+		require.NoError(t, err)
+		assert.Equal(t, "kubelogin-test", cert.Subject.CommonName)
+	})
+
+	t.Run("base64 pem from an environment variable", func(t *testing.T) {
+		pemData, err := os.ReadFile("fixtures/cert_ecdsa_encrypted.pem")
+		require.NoError(t, err)
+		t.Setenv("TEST_CLIENT_CERTIFICATE", base64.StdEncoding.EncodeToString(pemData))
+		cert, _, err := readCertificate("env:TEST_CLIENT_CERTIFICATE", testPKCS8Password)
+		require.NoError(t, err)
+		assert.Equal(t, "kubelogin-test", cert.Subject.CommonName)
+	})
+
+	t.Run("unset environment variable", func(t *testing.T) {
+		_, _, err := readCertificate("env:TEST_CLIENT_CERTIFICATE_UNSET", testPFXPassword)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `environment variable "TEST_CLIENT_CERTIFICATE_UNSET" of the certificate is not set`)
+	})
+
+	t.Run("neither pem nor pkcs12", func(t *testing.T) {
+		p := filepath.Join(dir, "client.crt")
+		require.NoError(t, os.WriteFile(p, []byte("not a certificate"), 0o600))
+		_, _, err := readCertificate(p, "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to decode the certificate as PKCS#12 as it is not PEM")
+	})
+
+	t.Run("stdin is read once", func(t *testing.T) {
+		stdinCertificateOnce = sync.Once{}
+		certificateStdin = strings.NewReader(testPFXBase64 + "\n")
+		t.Cleanup(func() {
+			stdinCertificateOnce = sync.Once{}
+			certificateStdin = os.Stdin
+		})
+
+		for range 2 {
+			cert, _, err := readCertificate("-", testPFXPassword)
+			require.NoError(t, err)
+			assert.Equal(t, "kubelogin-test", cert.Subject.CommonName)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package token
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"crypto/x509"
 	"fmt"
 	"net/url"
@@ -43,14 +44,25 @@ func newClientCertificateCredentialWithPoP(opts *Options) (CredentialProvider, e
 	}
 
 	// Get the certificate and private key from cert file
-	cert, rsaPrivateKey, err := readCertificate(opts.ClientCert, opts.ClientCertPassword)
+	cert, privateKey, err := newClientCertificate(opts).read()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read certificate: %w", err)
 	}
 
-	cred, err := confidential.NewCredFromCert([]*x509.Certificate{cert}, rsaPrivateKey)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create credential from certificate: %w", err)
+	var cred confidential.Credential
+	if ecKey, ok := privateKey.(*ecdsa.PrivateKey); ok {
+		assertion, err := newCertificateAssertion(cert, ecKey, opts.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		cred = confidential.NewCredFromAssertionCallback(func(_ context.Context, o confidential.AssertionRequestOptions) (string, error) {
+			return assertion.sign(o.TokenEndpoint)
+		})
+	} else {
+		cred, err = confidential.NewCredFromCert([]*x509.Certificate{cert}, privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create credential from certificate: %w", err)
+		}
 	}
 
 	// Construct authority URL properly to avoid malformation
@@ -31,6 +31,19 @@ func TestNewClientCertificateCredentialWithPoP(t *testing.T) {
 			},
 			expectName: "ClientCertificateCredentialWithPoP",
 		},
+		{
+			name: "ecdsa certificate with encrypted key",
+			opts: &Options{
+				ClientID:           "test-client-id",
+				TenantID:           "test-tenant-id",
+				ClientCert:         "fixtures/cert_ecdsa_encrypted.pem",
+				ClientCertPassword: "kubelogin-test",
+				IsPoPTokenEnabled:  true,
+				PoPTokenClaims:     "u=test-cluster",
+				AuthorityHost:      "https://login.microsoftonline.com/",
+			},
+			expectName: "ClientCertificateCredentialWithPoP",
+		},
 		{
 			name: "missing client ID",
 			opts: &Options{
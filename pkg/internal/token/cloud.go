@@ -0,0 +1,220 @@
+package token
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	cloudMetadataTimeout = 30 * time.Second
+	// cloudMetadataCacheTTL is how long the metadata of --environment-metadata-url is reused
+	// before it is fetched again
+	cloudMetadataCacheTTL = 24 * time.Hour
+	// cloudMetadataCacheDirName is the directory of the cache directory holding the metadata
+	// fetched from --environment-metadata-url
+	cloudMetadataCacheDirName = "environments"
+)
+
+// knownClouds maps the upper-case environment names to their cloud configuration
+var knownClouds = map[string]cloud.Configuration{
+	"AZURECLOUD":             cloud.AzurePublic,
+	"AZUREPUBLIC":            cloud.AzurePublic,
+	"AZUREPUBLICCLOUD":       cloud.AzurePublic,
+	"AZUREUSGOVERNMENT":      cloud.AzureGovernment,
+	"AZUREUSGOVERNMENTCLOUD": cloud.AzureGovernment,
+	"AZURECHINACLOUD":        cloud.AzureChina,
+}
+
+// armCloudMetadata is a cloud in the ARM metadata format returned by
+// <resource manager>/metadata/endpoints. Azure Stack Hub returns a single
+// cloud (api-version 2015-01-01) while public Azure returns a list of clouds.
+type armCloudMetadata struct {
+	Name            string `json:"name"`
+	ResourceManager string `json:"resourceManager"`
+	Authentication  struct {
+		LoginEndpoint string   `json:"loginEndpoint"`
+		Audiences     []string `json:"audiences"`
+	} `json:"authentication"`
+}
+
+// loadCustomCloud loads the cloud configuration from --environment-file or
+// --environment-metadata-url, if set
+func (o *Options) loadCustomCloud() error {
+	var (
+		b               []byte
+		err             error
+		source          string
+		resourceManager string
+		cachePath       string
+		fetched         bool
+	)
+	switch {
+	case o.EnvironmentFile != "" && o.EnvironmentMetadataURL != "":
+		return fmt.Errorf("environment file and environment metadata URL cannot be used together")
+	case o.EnvironmentFile != "":
+		source = o.EnvironmentFile
+		b, err = os.ReadFile(o.EnvironmentFile)
+		if err != nil {
+			return fmt.Errorf("failed to read environment file: %w", err)
+		}
+	case o.EnvironmentMetadataURL != "":
+		source = o.EnvironmentMetadataURL
+		u, parseErr := url.ParseRequestURI(o.EnvironmentMetadataURL)
+		if parseErr != nil || u.Host == "" {
+			return fmt.Errorf("environment metadata URL %q is not valid", o.EnvironmentMetadataURL)
+		}
+		resourceManager = u.Scheme + "://" + u.Host + "/"
+		// the metadata is cached so that get-token doesn't fetch it on every invocation
+		cachePath = o.getCloudMetadataCachePath()
+		cached, fresh := readCloudMetadataCache(cachePath)
+		if fresh {
+			b = cached
+			break
+		}
+		b, err = o.getCloudMetadata(u.String())
+		if err != nil && cached != nil {
+			klog.V(5).Infof("using the cloud metadata cached in %s: %s", cachePath, err)
+			b, err = cached, nil
+		} else {
+			fetched = true
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get cloud metadata from %s: %w", o.EnvironmentMetadataURL, err)
+		}
+	default:
+		return nil
+	}
+
+	c, err := parseARMCloudMetadata(b, o.Environment, resourceManager)
+	if err != nil {
+		return fmt.Errorf("invalid cloud metadata in %s: %w", source, err)
+	}
+	if fetched {
+		writeCloudMetadataCache(cachePath, b)
+	}
+	o.customCloud = &c
+	return nil
+}
+
+// getCloudMetadataCachePath returns the file caching the metadata of --environment-metadata-url,
+// or an empty path when there is no cache directory
+func (o *Options) getCloudMetadataCachePath() string {
+	if o.AuthRecordCacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(o.EnvironmentMetadataURL))
+	return filepath.Join(o.AuthRecordCacheDir, cloudMetadataCacheDirName, hex.EncodeToString(sum[:])+".json")
+}
+
+// readCloudMetadataCache returns the cached cloud metadata, if any, and whether it is recent
+// enough to be used without fetching it again
+func readCloudMetadataCache(path string) ([]byte, bool) {
+	if path == "" {
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || len(b) == 0 {
+		return nil, false
+	}
+	return b, time.Since(info.ModTime()) < cloudMetadataCacheTTL
+}
+
+func writeCloudMetadataCache(path string, b []byte) {
+	if path == "" {
+		return
+	}
+	err := os.WriteFile(path, b, 0600)
+	if errors.Is(err, os.ErrNotExist) {
+		if err = os.MkdirAll(filepath.Dir(path), 0700); err == nil {
+			err = os.WriteFile(path, b, 0600)
+		}
+	}
+	if err != nil {
+		klog.V(5).Infof("failed to cache cloud metadata in %s: %s", path, err)
+	}
+}
+
+func (o *Options) getCloudMetadata(metadataURL string) ([]byte, error) {
+	client := o.httpClient
+	if client == nil {
+		client = &http.Client{Timeout: cloudMetadataTimeout}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cloudMetadataTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parseARMCloudMetadata parses a single cloud or a list of clouds in the ARM metadata format.
+// From a list, the cloud named environment is used. resourceManager is used when the
+// metadata does not include the resource manager endpoint.
+func parseARMCloudMetadata(b []byte, environment, resourceManager string) (cloud.Configuration, error) {
+	var m armCloudMetadata
+	if trimmed := strings.TrimSpace(string(b)); strings.HasPrefix(trimmed, "[") {
+		var clouds []armCloudMetadata
+		if err := json.Unmarshal(b, &clouds); err != nil {
+			return cloud.Configuration{}, err
+		}
+		found := false
+		for _, c := range clouds {
+			if len(clouds) == 1 || strings.EqualFold(c.Name, environment) {
+				m = c
+				found = true
+				break
+			}
+		}
+		if !found {
+			return cloud.Configuration{}, fmt.Errorf("cloud %q not found", environment)
+		}
+	} else if err := json.Unmarshal(b, &m); err != nil {
+		return cloud.Configuration{}, err
+	}
+
+	if m.Authentication.LoginEndpoint == "" {
+		return cloud.Configuration{}, fmt.Errorf("authentication.loginEndpoint is not set")
+	}
+	c := cloud.Configuration{
+		ActiveDirectoryAuthorityHost: strings.TrimSuffix(m.Authentication.LoginEndpoint, "/") + "/",
+		Services:                     map[cloud.ServiceName]cloud.ServiceConfiguration{},
+	}
+	if m.ResourceManager != "" {
+		resourceManager = m.ResourceManager
+	}
+	if resourceManager != "" {
+		rm := cloud.ServiceConfiguration{Endpoint: resourceManager}
+		if len(m.Authentication.Audiences) > 0 {
+			rm.Audience = m.Authentication.Audiences[0]
+		}
+		c.Services[cloud.ResourceManager] = rm
+	}
+	return c, nil
+}
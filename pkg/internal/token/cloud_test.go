@@ -0,0 +1,203 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	azureStackMetadata = `{
+  "galleryEndpoint": "https://providers.local.azurestack.external:30016/",
+  "graphEndpoint": "https://graph.windows.net/",
+  "portalEndpoint": "https://portal.local.azurestack.external/",
+  "authentication": {
+    "loginEndpoint": "https://adfs.local.azurestack.external/adfs",
+    "audiences": ["https://management.adfs.azurestack.local/00000000-0000-0000-0000-000000000000"]
+  }
+}`
+	cloudListMetadata = `[
+  {
+    "name": "AzureCloud",
+    "resourceManager": "https://management.azure.com/",
+    "authentication": {"loginEndpoint": "https://login.microsoftonline.com", "audiences": ["https://management.core.windows.net/"]}
+  },
+  {
+    "name": "AirGapped",
+    "resourceManager": "https://management.airgapped.example/",
+    "authentication": {"loginEndpoint": "https://login.airgapped.example/", "audiences": ["https://management.airgapped.example/"]}
+  }
+]`
+)
+
+func TestParseARMCloudMetadata(t *testing.T) {
+	testCases := []struct {
+		name            string
+		metadata        string
+		environment     string
+		resourceManager string
+		expected        cloud.Configuration
+		expectedErr     string
+	}{
+		{
+			name:            "azure stack",
+			metadata:        azureStackMetadata,
+			environment:     "AzureStackCloud",
+			resourceManager: "https://management.local.azurestack.external/",
+			expected: cloud.Configuration{
+				ActiveDirectoryAuthorityHost: "https://adfs.local.azurestack.external/adfs/",
+				Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+					cloud.ResourceManager: {
+						Endpoint: "https://management.local.azurestack.external/",
+						Audience: "https://management.adfs.azurestack.local/00000000-0000-0000-0000-000000000000",
+					},
+				},
+			},
+		},
+		{
+			name:        "cloud from list",
+			metadata:    cloudListMetadata,
+			environment: "airgapped",
+			expected: cloud.Configuration{
+				ActiveDirectoryAuthorityHost: "https://login.airgapped.example/",
+				Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+					cloud.ResourceManager: {
+						Endpoint: "https://management.airgapped.example/",
+						Audience: "https://management.airgapped.example/",
+					},
+				},
+			},
+		},
+		{
+			name:        "cloud not in list",
+			metadata:    cloudListMetadata,
+			environment: "Other",
+			expectedErr: `cloud "Other" not found`,
+		},
+		{
+			name:        "missing login endpoint",
+			metadata:    `{"name": "Custom"}`,
+			expectedErr: "authentication.loginEndpoint is not set",
+		},
+		{
+			name:        "invalid JSON",
+			metadata:    `{`,
+			expectedErr: "unexpected end of JSON input",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := parseARMCloudMetadata([]byte(tc.metadata), tc.environment, tc.resourceManager)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, c)
+		})
+	}
+}
+
+func TestValidateEnvironment(t *testing.T) {
+	t.Run("unknown environment", func(t *testing.T) {
+		o := defaultOptions()
+		o.Environment = "AzureStackCloud"
+		assert.ErrorContains(t, o.Validate(), "'AzureStackCloud' is not a supported environment")
+	})
+
+	t.Run("environment file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cloud.json")
+		require.NoError(t, os.WriteFile(path, []byte(azureStackMetadata), 0600))
+		o := defaultOptions()
+		o.Environment = "AzureStackCloud"
+		o.EnvironmentFile = path
+		require.NoError(t, o.Validate())
+		assert.Equal(t, "https://adfs.local.azurestack.external/adfs/", o.GetCloudConfiguration().ActiveDirectoryAuthorityHost)
+	})
+
+	t.Run("missing environment file", func(t *testing.T) {
+		o := defaultOptions()
+		o.EnvironmentFile = filepath.Join(t.TempDir(), "cloud.json")
+		assert.ErrorContains(t, o.Validate(), "failed to read environment file")
+	})
+
+	t.Run("environment metadata URL", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/metadata/endpoints", r.URL.Path)
+			_, _ = w.Write([]byte(azureStackMetadata))
+		}))
+		defer srv.Close()
+
+		o := defaultOptions()
+		o.AuthRecordCacheDir = t.TempDir()
+		o.EnvironmentMetadataURL = srv.URL + "/metadata/endpoints?api-version=2015-01-01"
+		require.NoError(t, o.Validate())
+		c := o.GetCloudConfiguration()
+		assert.Equal(t, "https://adfs.local.azurestack.external/adfs/", c.ActiveDirectoryAuthorityHost)
+		assert.Equal(t, srv.URL+"/", c.Services[cloud.ResourceManager].Endpoint)
+	})
+
+	t.Run("environment metadata URL error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer srv.Close()
+
+		o := defaultOptions()
+		o.AuthRecordCacheDir = t.TempDir()
+		o.EnvironmentMetadataURL = srv.URL + "/metadata/endpoints"
+		assert.ErrorContains(t, o.Validate(), "unexpected status 404 Not Found")
+	})
+
+	t.Run("environment metadata URL is cached", func(t *testing.T) {
+		requests := 0
+		status := http.StatusOK
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(azureStackMetadata))
+		}))
+		defer srv.Close()
+
+		cacheDir := t.TempDir()
+		validate := func() Options {
+			o := defaultOptions()
+			o.AuthRecordCacheDir = cacheDir
+			o.EnvironmentMetadataURL = srv.URL + "/metadata/endpoints"
+			require.NoError(t, o.Validate())
+			assert.Equal(t, "https://adfs.local.azurestack.external/adfs/", o.GetCloudConfiguration().ActiveDirectoryAuthorityHost)
+			return o
+		}
+
+		o := validate()
+		validate()
+		assert.Equal(t, 1, requests, "the cached metadata is used")
+
+		// expired metadata is fetched again, or used as is when it can't be fetched
+		expired := time.Now().Add(-cloudMetadataCacheTTL - time.Minute)
+		require.NoError(t, os.Chtimes(o.getCloudMetadataCachePath(), expired, expired))
+		status = http.StatusServiceUnavailable
+		validate()
+		assert.Equal(t, 2, requests)
+
+		status = http.StatusOK
+		validate()
+		validate()
+		assert.Equal(t, 3, requests)
+	})
+
+	t.Run("file and URL", func(t *testing.T) {
+		o := defaultOptions()
+		o.EnvironmentFile = "cloud.json"
+		o.EnvironmentMetadataURL = "https://management.local.azurestack.external/metadata/endpoints"
+		assert.ErrorContains(t, o.Validate(), "cannot be used together")
+	})
+}
@@ -0,0 +1,55 @@
+package token
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
+)
+
+const (
+	interactiveTokenCacheFileName    = "interactive_tokens.cache"
+	interactiveCAETokenCacheFileName = "interactive_tokens_cae.cache"
+)
+
+// CustomBrowserCredential is interactive login launching the browser with the browser
+// command, or falling back to device code login when no browser can be launched, which
+// azidentity's InteractiveBrowserCredential does not support
+type CustomBrowserCredential struct {
+	publicClientCredential
+	browser *browserSignIn
+}
+
+var _ CredentialProvider = (*CustomBrowserCredential)(nil)
+
+func newCustomBrowserCredential(opts *Options, record azidentity.AuthenticationRecord) (CredentialProvider, error) {
+	if opts.ClientID == "" {
+		return nil, fmt.Errorf("client ID cannot be empty")
+	}
+	if opts.TenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+
+	client, err := newUserPublicClient(opts, interactiveTokenCacheFileName, interactiveCAETokenCacheFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create interactive browser credential: %w", err)
+	}
+	browser := newBrowserSignIn(opts)
+	return &CustomBrowserCredential{
+		publicClientCredential: publicClientCredential{
+			client:         client,
+			record:         record,
+			tenantID:       opts.TenantID,
+			nonInteractive: opts.isNonInteractive,
+			signIn: func(ctx context.Context, scopes []string, tenantID, claims string) (public.AuthResult, error) {
+				return browser.acquireToken(ctx, client, scopes, tenantID, claims)
+			},
+		},
+		browser: browser,
+	}, nil
+}
+
+func (c *CustomBrowserCredential) Name() string {
+	return "CustomBrowserCredential"
+}
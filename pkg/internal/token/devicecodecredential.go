@@ -3,7 +3,6 @@ package token
 import (
 	"context"
 	"fmt"
-	"os"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
@@ -29,12 +28,13 @@ func newDeviceCodeCredential(opts *Options, record azidentity.AuthenticationReco
 		err error
 	)
 	if opts.UsePersistentCache {
-		c, err = newPersistentCache()
+		c, err = newAccountPersistentCache(opts)
 		if err != nil {
 			klog.V(5).Infof("failed to create cache: %v", err)
 		}
 	}
 
+	prompt := newDeviceCodePrompt(opts)
 	azOpts := &azidentity.DeviceCodeCredentialOptions{
 		ClientOptions:            azcore.ClientOptions{Cloud: opts.GetCloudConfiguration()},
 		AuthenticationRecord:     record,
@@ -42,9 +42,10 @@ func newDeviceCodeCredential(opts *Options, record azidentity.AuthenticationReco
 		ClientID:                 opts.ClientID,
 		TenantID:                 opts.TenantID,
 		DisableInstanceDiscovery: opts.DisableInstanceDiscovery,
+		// fail instead of prompting when kubectl reports a non-interactive session
+		DisableAutomaticAuthentication: opts.isNonInteractive,
 		UserPrompt: func(ctx context.Context, dcm azidentity.DeviceCodeMessage) error {
-			_, err := fmt.Fprintln(os.Stderr, dcm.Message)
-			return err
+			return prompt.show(deviceCodeEvent{VerificationURI: dcm.VerificationURL, UserCode: dcm.UserCode, Message: dcm.Message})
 		},
 	}
 
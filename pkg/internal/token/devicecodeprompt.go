@@ -0,0 +1,169 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+	"k8s.io/klog/v2"
+
+	"github.com/Azure/kubelogin/pkg/internal/qrcode"
+)
+
+const deviceCodeEventType = "devicecode"
+
+// deviceCodeEvent is the JSON event of a device code, for editors and tools wrapping
+// kubectl to show their own sign-in UI
+type deviceCodeEvent struct {
+	Type            string `json:"type"`
+	VerificationURI string `json:"verification_uri"`
+	UserCode        string `json:"user_code"`
+	// ExpiresOn is unknown with the device code login of azidentity
+	ExpiresOn *time.Time `json:"expires_on,omitempty"`
+	Message   string     `json:"message"`
+}
+
+// deviceCodePrompt shows the device code of device code login. The prompt goes to stderr,
+// and also to the terminal when stderr is captured, e.g. by an IDE running kubectl. The
+// device code is written as an event to the events fd and file.
+type deviceCodePrompt struct {
+	qrCode     bool
+	eventsFD   int
+	eventsFile string
+	// out and outIsTerminal replace stderr, and tty replaces the controlling terminal, in tests
+	out           io.Writer
+	outIsTerminal bool
+	tty           io.Writer
+}
+
+func newDeviceCodePrompt(opts *Options) *deviceCodePrompt {
+	return &deviceCodePrompt{
+		qrCode:     opts.DeviceCodeQR,
+		eventsFD:   opts.EventsFD,
+		eventsFile: opts.EventsFile,
+	}
+}
+
+// show prompts the user to sign in with the device code
+func (p *deviceCodePrompt) show(e deviceCodeEvent) error {
+	e.Type = deviceCodeEventType
+	p.emit(e)
+
+	out, isTerminal := p.stderr()
+	if !isTerminal {
+		// stderr may be shown only after kubectl exits, or not at all
+		if tty, closeTTY := p.terminal(); tty != nil {
+			defer closeTTY()
+			if err := p.print(tty, e, true); err != nil {
+				klog.V(5).Infof("failed to write the device code message to the terminal: %s", err)
+			}
+		}
+	}
+	return p.print(out, e, isTerminal)
+}
+
+// print writes the message, after the QR code when enabled and out is a terminal
+func (p *deviceCodePrompt) print(out io.Writer, e deviceCodeEvent, isTerminal bool) error {
+	if p.qrCode && isTerminal {
+		if code, err := qrcode.Encode(e.VerificationURI); err != nil {
+			klog.V(5).Infof("failed to encode the verification URI as a QR code: %s", err)
+		} else {
+			fmt.Fprint(out, code.Terminal())
+		}
+	}
+	if _, err := fmt.Fprintln(out, e.Message); err != nil {
+		return fmt.Errorf("prompting the device code message: %w", err)
+	}
+	return nil
+}
+
+// stderr returns stderr and whether it is a terminal
+func (p *deviceCodePrompt) stderr() (io.Writer, bool) {
+	if p.out != nil {
+		return p.out, p.outIsTerminal
+	}
+	return os.Stderr, term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// terminal opens the controlling terminal, or returns nil when there is none
+func (p *deviceCodePrompt) terminal() (io.Writer, func()) {
+	if p.out != nil {
+		if p.tty == nil {
+			return nil, func() {}
+		}
+		return p.tty, func() {}
+	}
+	tty, err := os.OpenFile(ttyPath(), os.O_WRONLY, 0)
+	if err != nil {
+		klog.V(5).Infof("stderr is not a terminal and no terminal could be opened: %s", err)
+		return nil, func() {}
+	}
+	return tty, func() { tty.Close() }
+}
+
+// emit writes the event to the events fd and file. A failure does not stop the login.
+func (p *deviceCodePrompt) emit(e deviceCodeEvent) {
+	if p.eventsFD == 0 && p.eventsFile == "" {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		klog.Warningf("failed to encode the %s event: %s", e.Type, err)
+		return
+	}
+	b = append(b, '\n')
+
+	if p.eventsFD > 0 {
+		if _, err := eventsFDFile(p.eventsFD).Write(b); err != nil {
+			klog.Warningf("failed to write the %s event to fd %d: %s", e.Type, p.eventsFD, err)
+		}
+	}
+	if p.eventsFile != "" {
+		if err := appendToFile(p.eventsFile, b); err != nil {
+			klog.Warningf("failed to write the %s event to %s: %s", e.Type, p.eventsFile, err)
+		}
+	}
+}
+
+// eventsFDFiles keep the files of the events fds, which the finalizer of a collected
+// file would close while the parent process still reads them
+var (
+	eventsFDFilesMu sync.Mutex
+	eventsFDFiles   = map[int]*os.File{}
+)
+
+func eventsFDFile(fd int) *os.File {
+	eventsFDFilesMu.Lock()
+	defer eventsFDFilesMu.Unlock()
+	f, ok := eventsFDFiles[fd]
+	if !ok {
+		f = os.NewFile(uintptr(fd), fmt.Sprintf("events-fd-%d", fd))
+		eventsFDFiles[fd] = f
+	}
+	return f
+}
+
+func appendToFile(name string, b []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ttyPath is the controlling terminal of the process
+func ttyPath() string {
+	if runtime.GOOS == "windows" {
+		return "CONOUT$"
+	}
+	return "/dev/tty"
+}
@@ -0,0 +1,126 @@
+package token
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceCodePromptShow(t *testing.T) {
+	expiresOn := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := deviceCodeEvent{
+		VerificationURI: "https://microsoft.com/devicelogin",
+		UserCode:        "USERCODE",
+		ExpiresOn:       &expiresOn,
+		Message:         "To sign in, enter the code USERCODE",
+	}
+
+	t.Run("message", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		p := &deviceCodePrompt{qrCode: true, out: out}
+		require.NoError(t, p.show(event))
+		assert.Equal(t, "To sign in, enter the code USERCODE\n", out.String(), "no QR code outside a terminal")
+	})
+
+	t.Run("QR code in a terminal", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		p := &deviceCodePrompt{qrCode: true, out: out, outIsTerminal: true}
+		require.NoError(t, p.show(event))
+		assert.Contains(t, out.String(), "▀")
+		assert.True(t, strings.HasSuffix(out.String(), "\x1b[0m\nTo sign in, enter the code USERCODE\n"))
+	})
+
+	t.Run("no QR code unless enabled", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		p := &deviceCodePrompt{out: out, outIsTerminal: true}
+		require.NoError(t, p.show(event))
+		assert.Equal(t, "To sign in, enter the code USERCODE\n", out.String())
+	})
+
+	t.Run("terminal in addition to captured stderr", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		tty := &bytes.Buffer{}
+		p := &deviceCodePrompt{qrCode: true, out: out, tty: tty}
+		require.NoError(t, p.show(event))
+		assert.Equal(t, "To sign in, enter the code USERCODE\n", out.String())
+		assert.Contains(t, tty.String(), "▀")
+		assert.True(t, strings.HasSuffix(tty.String(), "\x1b[0m\nTo sign in, enter the code USERCODE\n"))
+	})
+
+	t.Run("no terminal when stderr is one", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		tty := &bytes.Buffer{}
+		p := &deviceCodePrompt{out: out, outIsTerminal: true, tty: tty}
+		require.NoError(t, p.show(event))
+		assert.Equal(t, "To sign in, enter the code USERCODE\n", out.String())
+		assert.Empty(t, tty.String())
+	})
+
+	t.Run("events file", func(t *testing.T) {
+		eventsFile := filepath.Join(t.TempDir(), "events.jsonl")
+		p := &deviceCodePrompt{eventsFile: eventsFile, out: &bytes.Buffer{}}
+		require.NoError(t, p.show(event))
+		require.NoError(t, p.show(deviceCodeEvent{VerificationURI: "https://microsoft.com/devicelogin", UserCode: "OTHERCODE"}))
+
+		b, err := os.ReadFile(eventsFile)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+		require.Len(t, lines, 2)
+		assert.JSONEq(t, `{"type":"devicecode","verification_uri":"https://microsoft.com/devicelogin","user_code":"USERCODE","expires_on":"2026-01-02T03:04:05Z","message":"To sign in, enter the code USERCODE"}`, lines[0])
+		assert.JSONEq(t, `{"type":"devicecode","verification_uri":"https://microsoft.com/devicelogin","user_code":"OTHERCODE","message":""}`, lines[1])
+	})
+
+	t.Run("events fd", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		defer r.Close()
+		defer w.Close()
+
+		p := &deviceCodePrompt{eventsFD: int(w.Fd()), out: &bytes.Buffer{}}
+		require.NoError(t, p.show(event))
+		line, err := bufio.NewReader(r).ReadString('\n')
+		require.NoError(t, err)
+		var got deviceCodeEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &got))
+		assert.Equal(t, deviceCodeEventType, got.Type)
+		assert.Equal(t, "USERCODE", got.UserCode)
+		assert.True(t, expiresOn.Equal(*got.ExpiresOn))
+	})
+
+	t.Run("a failing events file does not stop the login", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		p := &deviceCodePrompt{eventsFile: filepath.Join(t.TempDir(), "missing", "events.jsonl"), out: out}
+		require.NoError(t, p.show(event))
+		assert.Contains(t, out.String(), "USERCODE")
+	})
+}
+
+func TestNewADALDeviceCodeEvent(t *testing.T) {
+	userCode, verificationURL, message := "USERCODE", "https://microsoft.com/devicelogin", "enter the code"
+	expiresIn := int64(900)
+
+	e := newADALDeviceCodeEvent(&adal.DeviceCode{
+		UserCode:        &userCode,
+		VerificationURL: &verificationURL,
+		Message:         &message,
+		ExpiresIn:       &expiresIn,
+	})
+	assert.Equal(t, "USERCODE", e.UserCode)
+	assert.Equal(t, verificationURL, e.VerificationURI)
+	assert.Equal(t, message, e.Message)
+	require.NotNil(t, e.ExpiresOn)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), *e.ExpiresOn, time.Minute)
+
+	e = newADALDeviceCodeEvent(&adal.DeviceCode{})
+	assert.Empty(t, e.UserCode)
+	assert.Nil(t, e.ExpiresOn)
+}
@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	klog "k8s.io/klog/v2"
@@ -24,45 +26,108 @@ type execCredentialPlugin struct {
 	o                    *Options
 	cachedRecord         CachedRecordProvider
 	execCredentialWriter ExecCredentialWriter
+	execCredentialCache  ExecCredentialCache
 	newCredentialFunc    func(record azidentity.AuthenticationRecord, o *Options) (CredentialProvider, error)
+	acquireLockFunc      func(ctx context.Context, path string) (func(), error)
 }
 
 var errAuthenticateNotSupported = errors.New("authenticate is not supported")
 
 func New(o *Options) (ExecCredentialPlugin, error) {
+	return newExecCredentialPlugin(o)
+}
+
+// GetAccessToken acquires a token the same way as get-token, including the token
+// cache, without writing an ExecCredential.
+func GetAccessToken(ctx context.Context, o *Options) (azcore.AccessToken, error) {
+	plugin, err := newExecCredentialPlugin(o)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	return plugin.getToken(ctx)
+}
+
+func newExecCredentialPlugin(o *Options) (*execCredentialPlugin, error) {
 	klog.V(10).Info(o.ToString())
 	// Initialize PoP token cache in Options if enabled
 	if o.IsPoPTokenEnabled && o.popTokenCache == nil {
 		// Create PoP token cache using the official MSAL & MSAL extension libraries.
 		popTokenCache, err := popcache.NewCache(o.AuthRecordCacheDir)
+		if err != nil && o.hasPoPCacheEncryption() {
+			// Fallback: encrypt the PoP token cache and PoP key in files with the key the user opted in with
+			klog.V(5).Infof("encrypting the PoP token cache in files due to secure storage failure: %v", err)
+			key, keyErr := o.getPoPCacheEncryptionKey()
+			if keyErr != nil {
+				return nil, keyErr
+			}
+			popTokenCache, err = popcache.NewEncryptedFileCache(o.AuthRecordCacheDir, key)
+		}
 		if err != nil {
 			// Fallback: Log warning and continue without PoP token caching when cache creation fails
 			// Leave popTokenCache unset (nil field) so GetPoPTokenCache() returns an untyped nil interface.
-			klog.Warningf("PoP token caching disabled due to secure storage failure (likely container environment): %v", err)
+			klog.Warningf("PoP token caching disabled due to secure storage failure (likely container environment), set --pop-cache-key or --pop-cache-passphrase to cache PoP tokens in encrypted files: %v", err)
 		} else {
 			o.setPoPTokenCache(popTokenCache)
 		}
 	}
 
-	return &execCredentialPlugin{
+	plugin := &execCredentialPlugin{
 		o:                    o,
 		execCredentialWriter: &execCredentialWriter{},
 		// cachedRecord stores authentication record (account info) to avoid re-prompting user
-		cachedRecord: &defaultCachedRecordProvider{
-			file: o.authRecordCacheFile,
-		},
+		cachedRecord:      newCachedRecordProvider(o),
 		newCredentialFunc: NewAzIdentityCredential,
-	}, nil
+		acquireLockFunc:   acquireProcessLockWithContext,
+	}
+
+	// PoP tokens are not cached here: their signature covers a timestamp and nonce, so a cached
+	// one goes stale long before it expires. The PoP token cache re-signs the access token instead.
+	if !o.DisableTokenCache && !o.IsPoPTokenEnabled {
+		// execCredentialCache stores issued tokens to skip credential construction on later invocations
+		execCredentialCache, err := newExecCredentialCache(o)
+		if err != nil {
+			klog.V(5).Infof("token caching disabled: %v", err)
+		} else {
+			plugin.execCredentialCache = execCredentialCache
+		}
+	}
+
+	return plugin, nil
 }
 
 func (p *execCredentialPlugin) Do(ctx context.Context) error {
+	token, err := p.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	return p.execCredentialWriter.Write(token, os.Stdout)
+}
+
+// getToken returns a cached token or acquires a new one with the configured credential.
+func (p *execCredentialPlugin) getToken(ctx context.Context) (azcore.AccessToken, error) {
 	if p.o.ServerID == "" {
-		return errors.New("server-id is required")
+		return azcore.AccessToken{}, errors.New("server-id is required")
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, p.o.Timeout)
 	defer cancel()
 
+	if token := p.retrieveCachedToken(ctx); token.Token != "" {
+		return token, nil
+	}
+
+	// Serialize token acquisition across concurrent kubelogin processes so that only
+	// one of them prompts the user. The others wait and then reuse its result.
+	unlock, err := p.acquireLock(ctx)
+	if err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to wait for another kubelogin process to acquire a token: %w", err)
+	}
+	defer unlock()
+
+	if token := p.retrieveCachedToken(ctx); token.Token != "" {
+		return token, nil
+	}
+
 	record, err := p.cachedRecord.Retrieve()
 	if err != nil {
 		klog.V(5).Infof("failed to retrieve cached record: %s", err)
@@ -70,36 +135,92 @@ func (p *execCredentialPlugin) Do(ctx context.Context) error {
 
 	cred, err := p.newCredentialFunc(record, p.o)
 	if err != nil {
-		return fmt.Errorf("failed to create azidentity credential: %w", err)
+		return azcore.AccessToken{}, fmt.Errorf("failed to create azidentity credential: %w", err)
 	}
 
 	klog.V(5).Infof("using credential: %s", cred.Name())
 	scopes := []string{GetScope(p.o.ServerID)}
 	tokenRequestOptions := policy.TokenRequestOptions{
-		TenantID: p.o.TenantID,
-		Scopes:   scopes,
+		TenantID:  p.o.TenantID,
+		Scopes:    scopes,
+		Claims:    p.o.Claims,
+		EnableCAE: p.o.EnableCAE,
 	}
 
 	if cred.NeedAuthenticate() && record == (azidentity.AuthenticationRecord{}) {
 		// No stored record; call Authenticate to acquire one.
 		// This will prompt the user to authenticate interactively.
 		klog.V(5).Info("no stored record; calling Authenticate")
-		record, err = cred.Authenticate(ctx, &tokenRequestOptions)
-		if err != nil {
-			return fmt.Errorf("failed to authenticate: %w", err)
-		}
-		err = p.cachedRecord.Store(record)
-		if err != nil {
-			return fmt.Errorf("failed to store record: %w", err)
+		if err := p.authenticate(ctx, cred, &tokenRequestOptions); err != nil {
+			return azcore.AccessToken{}, err
 		}
 	}
 	klog.V(5).Infof("getting token with scopes: %v", scopes)
 	token, err := cred.GetToken(ctx, tokenRequestOptions)
+	if err != nil && cred.NeedAuthenticate() && !p.o.isNonInteractive && isInteractionRequired(err) {
+		// The stored record cannot satisfy the request silently, e.g. because of a
+		// claims challenge, so the user signs in again with the claims.
+		klog.V(5).Infof("interaction required; calling Authenticate: %s", err)
+		if err := p.authenticate(ctx, cred, &tokenRequestOptions); err != nil {
+			return azcore.AccessToken{}, err
+		}
+		token, err = cred.GetToken(ctx, tokenRequestOptions)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get token: %w", err)
+		return azcore.AccessToken{}, fmt.Errorf("failed to get token: %w", err)
 	}
 
-	return p.execCredentialWriter.Write(token, os.Stdout)
+	if p.execCredentialCache != nil {
+		if err := p.execCredentialCache.Store(ctx, token); err != nil {
+			klog.V(5).Infof("failed to cache token: %s", err)
+		}
+	}
+
+	return token, nil
+}
+
+// authenticate prompts the user to sign in with the credential and stores the resulting record.
+func (p *execCredentialPlugin) authenticate(ctx context.Context, cred CredentialProvider, options *policy.TokenRequestOptions) error {
+	if p.o.isNonInteractive && isInteractiveLogin(p.o.LoginMethod) {
+		return fmt.Errorf("failed to authenticate with %s login: %w", p.o.LoginMethod, errNonInteractiveSession)
+	}
+	record, err := cred.Authenticate(ctx, options)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+	if err := p.cachedRecord.Store(record); err != nil {
+		return fmt.Errorf("failed to store record: %w", err)
+	}
+	return nil
+}
+
+// retrieveCachedToken returns the token cached by a previous invocation, or an
+// empty token when the cache is disabled or holds no usable token. A claims
+// challenge means the cached token was rejected, so it is not reused either.
+func (p *execCredentialPlugin) retrieveCachedToken(ctx context.Context) azcore.AccessToken {
+	if p.execCredentialCache == nil || p.o.Claims != "" {
+		return azcore.AccessToken{}
+	}
+	token, err := p.execCredentialCache.Retrieve(ctx)
+	if err != nil {
+		klog.V(5).Infof("failed to retrieve cached token: %s", err)
+		return azcore.AccessToken{}
+	}
+	if token.Token != "" {
+		klog.V(5).Infof("using cached token which expires on %s", token.ExpiresOn)
+	}
+	return token
+}
+
+// acquireLock takes the cross-process lock guarding token acquisition for the
+// options, waiting until the context is done while another process holds it.
+func (p *execCredentialPlugin) acquireLock(ctx context.Context) (func(), error) {
+	if p.acquireLockFunc == nil {
+		return func() {}, nil
+	}
+	lockPath := filepath.Join(lockFileDir(), fmt.Sprintf("get-token-%s.lock", getExecCredentialCacheKey(p.o)))
+	klog.V(5).Infof("acquiring lock %s", lockPath)
+	return p.acquireLockFunc(ctx, lockPath)
 }
 
 func GetScope(serverID string) string {
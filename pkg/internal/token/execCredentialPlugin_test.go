@@ -1,10 +1,19 @@
 package token
 
 import (
+	"context"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestKUBERNETES_EXEC_INFOIsEmpty(t *testing.T) {
@@ -131,3 +140,325 @@ func TestNew_PoPCacheFallbackResilience(t *testing.T) {
 		}
 	})
 }
+
+type fakeCredential struct {
+	token            azcore.AccessToken
+	getTokenCalled   int
+	needAuthenticate bool
+	record           azidentity.AuthenticationRecord
+	// getTokenErrs are returned by the first GetToken calls, one per call
+	getTokenErrs       []error
+	authenticateCalled int
+	requests           []policy.TokenRequestOptions
+}
+
+func (c *fakeCredential) GetToken(_ context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.getTokenCalled++
+	c.requests = append(c.requests, opts)
+	if len(c.getTokenErrs) > 0 {
+		err := c.getTokenErrs[0]
+		c.getTokenErrs = c.getTokenErrs[1:]
+		return azcore.AccessToken{}, err
+	}
+	return c.token, nil
+}
+
+func (c *fakeCredential) Authenticate(_ context.Context, opts *policy.TokenRequestOptions) (azidentity.AuthenticationRecord, error) {
+	if !c.needAuthenticate {
+		return azidentity.AuthenticationRecord{}, errAuthenticateNotSupported
+	}
+	c.authenticateCalled++
+	c.requests = append(c.requests, *opts)
+	return c.record, nil
+}
+
+func (c *fakeCredential) NeedAuthenticate() bool { return c.needAuthenticate }
+
+func (c *fakeCredential) Name() string { return "fakeCredential" }
+
+type fakeExecCredentialWriter struct {
+	written []azcore.AccessToken
+}
+
+func (w *fakeExecCredentialWriter) Write(token azcore.AccessToken, _ io.Writer) error {
+	w.written = append(w.written, token)
+	return nil
+}
+
+func TestExecCredentialPluginDoWithTokenCache(t *testing.T) {
+	now := time.Now()
+
+	newPlugin := func(t *testing.T, cred *fakeCredential, writer *fakeExecCredentialWriter) *execCredentialPlugin {
+		t.Helper()
+		return &execCredentialPlugin{
+			o: &Options{
+				ServerID: "server-id",
+				Timeout:  time.Minute,
+			},
+			cachedRecord:         &defaultCachedRecordProvider{file: filepath.Join(t.TempDir(), "auth.json")},
+			execCredentialWriter: writer,
+			execCredentialCache:  newTestExecCredentialCache(t, 5*time.Minute, now),
+			newCredentialFunc: func(azidentity.AuthenticationRecord, *Options) (CredentialProvider, error) {
+				return cred, nil
+			},
+		}
+	}
+
+	t.Run("cache miss acquires and stores token", func(t *testing.T) {
+		cred := &fakeCredential{token: azcore.AccessToken{Token: "fresh", ExpiresOn: now.Add(time.Hour)}}
+		writer := &fakeExecCredentialWriter{}
+		p := newPlugin(t, cred, writer)
+
+		require.NoError(t, p.Do(context.Background()))
+		assert.Equal(t, 1, cred.getTokenCalled)
+		require.Len(t, writer.written, 1)
+		assert.Equal(t, "fresh", writer.written[0].Token)
+
+		cached, err := p.execCredentialCache.Retrieve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", cached.Token)
+	})
+
+	t.Run("cache hit skips credential construction", func(t *testing.T) {
+		writer := &fakeExecCredentialWriter{}
+		p := newPlugin(t, nil, writer)
+		p.newCredentialFunc = func(azidentity.AuthenticationRecord, *Options) (CredentialProvider, error) {
+			t.Fatal("credential should not be constructed on cache hit")
+			return nil, nil
+		}
+		require.NoError(t, p.execCredentialCache.Store(context.Background(), azcore.AccessToken{Token: "cached", ExpiresOn: now.Add(time.Hour)}))
+
+		require.NoError(t, p.Do(context.Background()))
+		require.Len(t, writer.written, 1)
+		assert.Equal(t, "cached", writer.written[0].Token)
+	})
+
+	t.Run("stale cached token is refreshed", func(t *testing.T) {
+		cred := &fakeCredential{token: azcore.AccessToken{Token: "fresh", ExpiresOn: now.Add(time.Hour)}}
+		writer := &fakeExecCredentialWriter{}
+		p := newPlugin(t, cred, writer)
+		require.NoError(t, p.execCredentialCache.Store(context.Background(), azcore.AccessToken{Token: "stale", ExpiresOn: now.Add(time.Minute)}))
+
+		require.NoError(t, p.Do(context.Background()))
+		assert.Equal(t, 1, cred.getTokenCalled)
+		require.Len(t, writer.written, 1)
+		assert.Equal(t, "fresh", writer.written[0].Token)
+	})
+}
+
+func TestExecCredentialPluginDoWaitsForConcurrentAcquisition(t *testing.T) {
+	now := time.Now()
+	lockPath := filepath.Join(t.TempDir(), "get-token.lock")
+	cache := newTestExecCredentialCache(t, 5*time.Minute, now)
+	writer := &fakeExecCredentialWriter{}
+	p := &execCredentialPlugin{
+		o: &Options{
+			ServerID: "server-id",
+			Timeout:  time.Minute,
+		},
+		cachedRecord:         &defaultCachedRecordProvider{file: filepath.Join(t.TempDir(), "auth.json")},
+		execCredentialWriter: writer,
+		execCredentialCache:  cache,
+		newCredentialFunc: func(azidentity.AuthenticationRecord, *Options) (CredentialProvider, error) {
+			t.Error("credential should not be constructed when another process acquired the token")
+			return nil, errors.New("unexpected credential construction")
+		},
+		acquireLockFunc: func(ctx context.Context, _ string) (func(), error) {
+			return acquireProcessLockWithContext(ctx, lockPath)
+		},
+	}
+
+	// simulate another process acquiring a token while holding the lock
+	unlock, err := acquireProcessLockWithContext(context.Background(), lockPath)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- p.Do(context.Background()) }()
+
+	time.Sleep(3 * processLockPollInterval)
+	require.NoError(t, cache.Store(context.Background(), azcore.AccessToken{Token: "from-other-process", ExpiresOn: now.Add(time.Hour)}))
+	unlock()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do did not return after the lock was released")
+	}
+	require.Len(t, writer.written, 1)
+	assert.Equal(t, "from-other-process", writer.written[0].Token)
+}
+
+func TestExecCredentialPluginDoLockTimeout(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "get-token.lock")
+	unlock, err := acquireProcessLockWithContext(context.Background(), lockPath)
+	require.NoError(t, err)
+	defer unlock()
+
+	p := &execCredentialPlugin{
+		o: &Options{
+			ServerID: "server-id",
+			Timeout:  3 * processLockPollInterval,
+		},
+		execCredentialWriter: &fakeExecCredentialWriter{},
+		acquireLockFunc: func(ctx context.Context, _ string) (func(), error) {
+			return acquireProcessLockWithContext(ctx, lockPath)
+		},
+	}
+
+	err = p.Do(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestExecCredentialPluginDoNonInteractiveSession(t *testing.T) {
+	testCases := []struct {
+		name        string
+		loginMethod string
+		expectErr   bool
+	}{
+		{name: "devicecode fails fast", loginMethod: DeviceCodeLogin, expectErr: true},
+		{name: "interactive fails fast", loginMethod: InteractiveLogin, expectErr: true},
+		{name: "ropc is not affected", loginMethod: ROPCLogin},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cred := &fakeCredential{
+				token:            azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)},
+				needAuthenticate: true,
+				record:           azidentity.AuthenticationRecord{Username: "user"},
+			}
+			writer := &fakeExecCredentialWriter{}
+			p := &execCredentialPlugin{
+				o: &Options{
+					LoginMethod:      tc.loginMethod,
+					ServerID:         "server-id",
+					Timeout:          time.Minute,
+					isNonInteractive: true,
+				},
+				cachedRecord:         &defaultCachedRecordProvider{file: filepath.Join(t.TempDir(), "auth.json")},
+				execCredentialWriter: writer,
+				newCredentialFunc: func(azidentity.AuthenticationRecord, *Options) (CredentialProvider, error) {
+					return cred, nil
+				},
+			}
+
+			err := p.Do(context.Background())
+			if tc.expectErr {
+				assert.ErrorIs(t, err, errNonInteractiveSession)
+				assert.Equal(t, 0, cred.getTokenCalled)
+				assert.Empty(t, writer.written)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, cred.getTokenCalled)
+		})
+	}
+}
+
+func TestNew_TokenCache(t *testing.T) {
+	t.Run("token cache enabled by default", func(t *testing.T) {
+		plugin, err := New(&Options{ServerID: "server-id", AuthRecordCacheDir: t.TempDir()})
+		require.NoError(t, err)
+		assert.NotNil(t, plugin.(*execCredentialPlugin).execCredentialCache)
+	})
+
+	t.Run("token cache is not used for PoP tokens", func(t *testing.T) {
+		plugin, err := New(&Options{ServerID: "server-id", AuthRecordCacheDir: t.TempDir(), IsPoPTokenEnabled: true, PoPTokenClaims: "u=host"})
+		require.NoError(t, err)
+		assert.Nil(t, plugin.(*execCredentialPlugin).execCredentialCache)
+	})
+
+	t.Run("token cache can be disabled", func(t *testing.T) {
+		plugin, err := New(&Options{ServerID: "server-id", AuthRecordCacheDir: t.TempDir(), DisableTokenCache: true})
+		require.NoError(t, err)
+		assert.Nil(t, plugin.(*execCredentialPlugin).execCredentialCache)
+	})
+}
+
+func TestExecCredentialPluginDoWithClaims(t *testing.T) {
+	now := time.Now()
+	const claims = `{"access_token":{"acrs":{"essential":true,"value":"c1"}}}`
+	interactionRequired := errors.New("AADSTS50076: interaction_required")
+
+	newPlugin := func(t *testing.T, o *Options, cred *fakeCredential) *execCredentialPlugin {
+		t.Helper()
+		o.ServerID = "server-id"
+		o.Timeout = time.Minute
+		return &execCredentialPlugin{
+			o:                    o,
+			cachedRecord:         &defaultCachedRecordProvider{file: filepath.Join(t.TempDir(), "auth.json")},
+			execCredentialWriter: &fakeExecCredentialWriter{},
+			execCredentialCache:  newTestExecCredentialCache(t, 5*time.Minute, now),
+			newCredentialFunc: func(azidentity.AuthenticationRecord, *Options) (CredentialProvider, error) {
+				return cred, nil
+			},
+		}
+	}
+
+	t.Run("claims and CAE are forwarded and the cached token is not reused", func(t *testing.T) {
+		cred := &fakeCredential{token: azcore.AccessToken{Token: "stepped-up", ExpiresOn: now.Add(time.Hour)}}
+		p := newPlugin(t, &Options{Claims: claims, EnableCAE: true}, cred)
+		require.NoError(t, p.execCredentialCache.Store(context.Background(), azcore.AccessToken{Token: "cached", ExpiresOn: now.Add(time.Hour)}))
+
+		token, err := p.getToken(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "stepped-up", token.Token)
+		require.Len(t, cred.requests, 1)
+		assert.Equal(t, claims, cred.requests[0].Claims)
+		assert.True(t, cred.requests[0].EnableCAE)
+
+		// the new token replaces the rejected one for later invocations without claims
+		p.o.Claims = ""
+		cached := p.retrieveCachedToken(context.Background())
+		assert.Equal(t, "stepped-up", cached.Token)
+	})
+
+	t.Run("interaction required falls back to Authenticate with the claims", func(t *testing.T) {
+		cred := &fakeCredential{
+			token:            azcore.AccessToken{Token: "stepped-up", ExpiresOn: now.Add(time.Hour)},
+			needAuthenticate: true,
+			record:           azidentity.AuthenticationRecord{Username: "user"},
+			getTokenErrs:     []error{interactionRequired},
+		}
+		p := newPlugin(t, &Options{LoginMethod: DeviceCodeLogin, Claims: claims}, cred)
+		require.NoError(t, p.cachedRecord.Store(azidentity.AuthenticationRecord{Username: "user"}))
+
+		token, err := p.getToken(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "stepped-up", token.Token)
+		assert.Equal(t, 1, cred.authenticateCalled)
+		assert.Equal(t, 2, cred.getTokenCalled)
+		for _, r := range cred.requests {
+			assert.Equal(t, claims, r.Claims)
+		}
+	})
+
+	t.Run("interaction required fails in a non-interactive session", func(t *testing.T) {
+		cred := &fakeCredential{
+			needAuthenticate: true,
+			record:           azidentity.AuthenticationRecord{Username: "user"},
+			getTokenErrs:     []error{interactionRequired},
+		}
+		p := newPlugin(t, &Options{LoginMethod: DeviceCodeLogin, Claims: claims, isNonInteractive: true}, cred)
+		require.NoError(t, p.cachedRecord.Store(azidentity.AuthenticationRecord{Username: "user"}))
+
+		_, err := p.getToken(context.Background())
+		assert.ErrorIs(t, err, interactionRequired)
+		assert.Equal(t, 0, cred.authenticateCalled)
+	})
+
+	t.Run("other errors are returned without prompting", func(t *testing.T) {
+		cred := &fakeCredential{
+			needAuthenticate: true,
+			record:           azidentity.AuthenticationRecord{Username: "user"},
+			getTokenErrs:     []error{errors.New("network unreachable")},
+		}
+		p := newPlugin(t, &Options{LoginMethod: DeviceCodeLogin}, cred)
+		require.NoError(t, p.cachedRecord.Store(azidentity.AuthenticationRecord{Username: "user"}))
+
+		_, err := p.getToken(context.Background())
+		assert.ErrorContains(t, err, "network unreachable")
+		assert.Equal(t, 0, cred.authenticateCalled)
+	})
+}
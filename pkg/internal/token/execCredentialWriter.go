@@ -6,11 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/pkg/apis/clientauthentication"
 	v1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
 	"k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
 )
@@ -69,20 +67,19 @@ func (*execCredentialWriter) Write(accessToken azcore.AccessToken, writer io.Wri
 }
 
 func getAPIVersionFromExecInfoEnv() (string, error) {
-	env := os.Getenv(execInfoEnv)
-	if env == "" {
-		return apiV1beta1, nil
+	info, err := getExecInfoFromEnv()
+	if err != nil {
+		return "", err
 	}
-	var execCredential clientauthentication.ExecCredential
-	if err := json.Unmarshal([]byte(env), &execCredential); err != nil {
-		return "", fmt.Errorf("cannot unmarshal %q to ExecCredential: %w", env, err)
+	if info == nil {
+		return apiV1beta1, nil
 	}
-	switch execCredential.APIVersion {
+	switch info.apiVersion {
 	case "":
 		return apiV1beta1, nil
 	case apiV1, apiV1beta1:
-		return execCredential.APIVersion, nil
+		return info.apiVersion, nil
 	default:
-		return "", fmt.Errorf("api version: %s is not supported", execCredential.APIVersion)
+		return "", fmt.Errorf("api version: %s is not supported", info.apiVersion)
 	}
 }
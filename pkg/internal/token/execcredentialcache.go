@@ -0,0 +1,143 @@
+package token
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor/file"
+	klog "k8s.io/klog/v2"
+
+	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
+)
+
+// ExecCredentialCacheDirName is the directory of the cache directory holding the tokens cached
+// across get-token invocations
+const ExecCredentialCacheDirName = "tokens"
+
+// ExecCredentialCache stores access tokens issued by get-token so that later
+// invocations can return them without constructing a credential.
+type ExecCredentialCache interface {
+	// Retrieve returns the cached token. It returns an empty token when nothing is
+	// cached or the cached token expires within the refresh margin.
+	Retrieve(ctx context.Context) (azcore.AccessToken, error)
+	// Store saves the token for later invocations.
+	Store(ctx context.Context, token azcore.AccessToken) error
+}
+
+// CachedAccessToken is an access token cached across get-token invocations
+type CachedAccessToken struct {
+	Token     string    `json:"token"`
+	ExpiresOn time.Time `json:"expiresOn"`
+}
+
+type defaultExecCredentialCache struct {
+	accessor      accessor.Accessor
+	refreshMargin time.Duration
+	now           func() time.Time
+}
+
+// secureStorageError reports why platform-specific secure storage can't be used.
+// It is a variable to allow overriding in tests.
+var secureStorageError = popcache.StorageError
+
+// newExecCredentialCache creates a cache entry for the token identified by the
+// options. The entry is encrypted with platform-specific secure storage when it
+// is available and falls back to a file encrypted with the key of --pop-cache-key
+// or --pop-cache-passphrase, or else only readable by the current user.
+func newExecCredentialCache(o *Options) (ExecCredentialCache, error) {
+	return newTokenCache(o, getExecCredentialCacheFileName(o))
+}
+
+// newTokenCache creates a cache entry at path, encrypted the same way as the
+// entries of the exec credential cache
+func newTokenCache(o *Options, path string) (*defaultExecCredentialCache, error) {
+	var (
+		acc accessor.Accessor
+		err error
+	)
+	if storageErr := secureStorageError(); storageErr == nil {
+		acc, err = popcache.NewSecureAccessor(path)
+	} else if o.hasPoPCacheEncryption() {
+		klog.V(5).Infof("secure storage is unavailable, caching the token in %s encrypted with the pop cache key: %v", path, storageErr)
+		acc, err = o.newEncryptedFileAccessor(path)
+	} else {
+		klog.Warningf("secure storage is unavailable, caching the token unencrypted in %s, readable only by the current user. Use --pop-cache-key or --pop-cache-passphrase to encrypt it, or --disable-token-cache to not cache it: %v", path, storageErr)
+		acc, err = file.New(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token cache storage: %w", err)
+	}
+
+	return &defaultExecCredentialCache{
+		accessor:      acc,
+		refreshMargin: o.TokenCacheRefreshMargin,
+		now:           time.Now,
+	}, nil
+}
+
+func (c *defaultExecCredentialCache) Retrieve(ctx context.Context) (azcore.AccessToken, error) {
+	b, err := c.accessor.Read(ctx)
+	if err != nil || len(b) == 0 {
+		return azcore.AccessToken{}, err
+	}
+	var cached CachedAccessToken
+	if err := json.Unmarshal(b, &cached); err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("failed to parse cached token: %w", err)
+	}
+	if cached.Token == "" || !c.now().Add(c.refreshMargin).Before(cached.ExpiresOn) {
+		return azcore.AccessToken{}, nil
+	}
+	return azcore.AccessToken{Token: cached.Token, ExpiresOn: cached.ExpiresOn}, nil
+}
+
+func (c *defaultExecCredentialCache) Store(ctx context.Context, token azcore.AccessToken) error {
+	if token.Token == "" {
+		return nil
+	}
+	b, err := json.Marshal(CachedAccessToken{Token: token.Token, ExpiresOn: token.ExpiresOn})
+	if err != nil {
+		return err
+	}
+	return c.accessor.Write(ctx, b)
+}
+
+// getExecCredentialCacheFileName returns the cache file for the token requested
+// by the options.
+func getExecCredentialCacheFileName(o *Options) string {
+	return filepath.Join(o.AuthRecordCacheDir, ExecCredentialCacheDirName, getExecCredentialCacheKey(o)+".cache")
+}
+
+// getExecCredentialCacheKey identifies the token requested by the options.
+// Every option that changes the issued token is part of the key.
+func getExecCredentialCacheKey(o *Options) string {
+	key := strings.Join([]string{
+		o.LoginMethod,
+		strings.Join(o.LoginChain, ","),
+		o.ServerID,
+		o.TenantID,
+		o.ClientID,
+		o.PoPTokenClaims,
+		strconv.FormatBool(o.IsLegacy),
+		strconv.FormatBool(o.EnableCAE),
+		o.IdentityClientID,
+		o.IdentityObjectID,
+		o.IdentityResourceID,
+		o.IdentityEndpoint,
+		o.Username,
+		o.LoginHint,
+		o.SubscriptionID,
+		o.Environment,
+		o.EnvironmentFile,
+		o.EnvironmentMetadataURL,
+		o.AuthorityHost,
+	}, "\x00")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
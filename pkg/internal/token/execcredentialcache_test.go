@@ -0,0 +1,154 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecCredentialCache(t *testing.T, refreshMargin time.Duration, now time.Time) *defaultExecCredentialCache {
+	t.Helper()
+	acc, err := file.New(filepath.Join(t.TempDir(), "token.cache"))
+	require.NoError(t, err)
+	return &defaultExecCredentialCache{
+		accessor:      acc,
+		refreshMargin: refreshMargin,
+		now:           func() time.Time { return now },
+	}
+}
+
+func TestDefaultExecCredentialCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("empty cache returns empty token", func(t *testing.T) {
+		c := newTestExecCredentialCache(t, 5*time.Minute, now)
+		token, err := c.Retrieve(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, token.Token)
+	})
+
+	t.Run("valid token is returned", func(t *testing.T) {
+		c := newTestExecCredentialCache(t, 5*time.Minute, now)
+		expected := azcore.AccessToken{Token: "token", ExpiresOn: now.Add(time.Hour)}
+		require.NoError(t, c.Store(ctx, expected))
+
+		token, err := c.Retrieve(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.Token, token.Token)
+		assert.True(t, expected.ExpiresOn.Equal(token.ExpiresOn))
+	})
+
+	t.Run("token expiring within the refresh margin is not returned", func(t *testing.T) {
+		c := newTestExecCredentialCache(t, 5*time.Minute, now)
+		require.NoError(t, c.Store(ctx, azcore.AccessToken{Token: "token", ExpiresOn: now.Add(4 * time.Minute)}))
+
+		token, err := c.Retrieve(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, token.Token)
+	})
+
+	t.Run("empty token is not stored", func(t *testing.T) {
+		c := newTestExecCredentialCache(t, 0, now)
+		require.NoError(t, c.Store(ctx, azcore.AccessToken{ExpiresOn: now.Add(time.Hour)}))
+
+		b, err := c.accessor.Read(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, b)
+	})
+
+	t.Run("corrupted cache returns error", func(t *testing.T) {
+		c := newTestExecCredentialCache(t, 0, now)
+		require.NoError(t, c.accessor.Write(ctx, []byte("not json")))
+
+		_, err := c.Retrieve(ctx)
+		assert.ErrorContains(t, err, "failed to parse cached token")
+	})
+}
+
+func TestGetExecCredentialCacheFileName(t *testing.T) {
+	base := Options{
+		LoginMethod:        DeviceCodeLogin,
+		ServerID:           "server-id",
+		TenantID:           "tenant-id",
+		ClientID:           "client-id",
+		AuthRecordCacheDir: "/tmp/cache",
+	}
+	baseFile := getExecCredentialCacheFileName(&base)
+	assert.Equal(t, filepath.Join("/tmp/cache", ExecCredentialCacheDirName), filepath.Dir(baseFile))
+	assert.Equal(t, baseFile, getExecCredentialCacheFileName(&base), "file name should be stable")
+
+	testCases := []struct {
+		name   string
+		modify func(o *Options)
+	}{
+		{"login method", func(o *Options) { o.LoginMethod = AzureCLILogin }},
+		{"server id", func(o *Options) { o.ServerID = "other-server-id" }},
+		{"tenant id", func(o *Options) { o.TenantID = "other-tenant-id" }},
+		{"client id", func(o *Options) { o.ClientID = "other-client-id" }},
+		{"pop claims", func(o *Options) { o.PoPTokenClaims = "u=host" }},
+		{"legacy", func(o *Options) { o.IsLegacy = true }},
+		{"login hint", func(o *Options) { o.LoginHint = "alice@contoso.com" }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := base
+			tc.modify(&o)
+			assert.NotEqual(t, baseFile, getExecCredentialCacheFileName(&o))
+		})
+	}
+}
+
+func TestGetExecCredentialCacheKeyLoginHint(t *testing.T) {
+	alice := Options{LoginMethod: InteractiveLogin, ServerID: "server-id", LoginHint: "alice@contoso.com"}
+	bob := alice
+	bob.LoginHint = "bob@contoso.com"
+	assert.NotEqual(t, getExecCredentialCacheKey(&alice), getExecCredentialCacheKey(&bob),
+		"accounts picked by different login hints must not share the cached token and lock")
+}
+
+func TestNewTokenCacheWithoutSecureStorage(t *testing.T) {
+	original := secureStorageError
+	defer func() { secureStorageError = original }()
+	secureStorageError = func() error { return errors.New("no keyring") }
+
+	ctx := context.Background()
+	token := azcore.AccessToken{Token: "secret-token", ExpiresOn: time.Now().Add(time.Hour)}
+
+	t.Run("token is encrypted with the pop cache key", func(t *testing.T) {
+		o := &Options{
+			AuthRecordCacheDir: t.TempDir(),
+			PoPCacheKey:        "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+		}
+		c, err := newExecCredentialCache(o)
+		require.NoError(t, err)
+		require.NoError(t, c.Store(ctx, token))
+
+		b, err := os.ReadFile(getExecCredentialCacheFileName(o))
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), token.Token)
+
+		got, err := c.Retrieve(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, token.Token, got.Token)
+	})
+
+	t.Run("token is stored unencrypted without a pop cache key", func(t *testing.T) {
+		o := &Options{AuthRecordCacheDir: t.TempDir()}
+		c, err := newExecCredentialCache(o)
+		require.NoError(t, err)
+		require.NoError(t, c.Store(ctx, token))
+
+		b, err := os.ReadFile(getExecCredentialCacheFileName(o))
+		require.NoError(t, err)
+		assert.Contains(t, string(b), token.Token)
+	})
+}
@@ -0,0 +1,87 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	v1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ExecClusterExtensionName is the cluster extension kubectl passes to exec plugins
+// in KUBERNETES_EXEC_INFO when provideClusterInfo is set
+const ExecClusterExtensionName = "client.authentication.k8s.io/exec"
+
+// errNonInteractiveSession is returned when a login method needs to prompt the
+// user but kubectl reported that the session is non-interactive.
+var errNonInteractiveSession = errors.New("user interaction is required but kubectl reported a non-interactive session. Run the command in an interactive terminal or use a non-interactive login method")
+
+// ExecClusterConfig is the per-cluster configuration get-token reads from the
+// cluster's exec extension when the exec plugin sets provideClusterInfo.
+type ExecClusterConfig struct {
+	ServerID       string `json:"server-id,omitempty"`
+	TenantID       string `json:"tenant-id,omitempty"`
+	PoPTokenClaims string `json:"pop-claims,omitempty"`
+}
+
+// GetExecClusterConfig returns the kubelogin settings stored in the cluster's exec
+// extension, or nil when the cluster has none.
+func GetExecClusterConfig(cluster *api.Cluster) (*ExecClusterConfig, error) {
+	if cluster == nil {
+		return nil, nil
+	}
+	ext, ok := cluster.Extensions[ExecClusterExtensionName]
+	if !ok || ext == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(ext)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s cluster extension: %w", ExecClusterExtensionName, err)
+	}
+	var clusterConfig ExecClusterConfig
+	if err := json.Unmarshal(b, &clusterConfig); err != nil {
+		return nil, fmt.Errorf("unable to read %s cluster extension: %w", ExecClusterExtensionName, err)
+	}
+	return &clusterConfig, nil
+}
+
+// execInfo holds the fields of KUBERNETES_EXEC_INFO used by get-token
+type execInfo struct {
+	apiVersion    string
+	interactive   bool
+	clusterConfig *ExecClusterConfig
+}
+
+// getExecInfoFromEnv parses KUBERNETES_EXEC_INFO. It returns nil when kubelogin
+// is not invoked by kubectl.
+func getExecInfoFromEnv() (*execInfo, error) {
+	env := os.Getenv(execInfoEnv)
+	if env == "" {
+		return nil, nil
+	}
+	// v1 and v1beta1 share the same shape so either can be decoded as v1
+	var execCredential v1.ExecCredential
+	if err := json.Unmarshal([]byte(env), &execCredential); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal %q to ExecCredential: %w", env, err)
+	}
+
+	info := &execInfo{
+		apiVersion:  execCredential.APIVersion,
+		interactive: execCredential.Spec.Interactive,
+	}
+	if cluster := execCredential.Spec.Cluster; cluster != nil && len(cluster.Config.Raw) > 0 {
+		var config ExecClusterConfig
+		if err := json.Unmarshal(cluster.Config.Raw, &config); err != nil {
+			return nil, fmt.Errorf("cannot unmarshal cluster config %q: %w", string(cluster.Config.Raw), err)
+		}
+		info.clusterConfig = &config
+	}
+	return info, nil
+}
+
+// isInteractiveLogin reports whether the login method may prompt the user.
+func isInteractiveLogin(loginMethod string) bool {
+	return loginMethod == DeviceCodeLogin || loginMethod == InteractiveLogin || loginMethod == AuthCodeLogin
+}
@@ -0,0 +1,127 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetExecInfoFromEnv(t *testing.T) {
+	testCases := []struct {
+		name          string
+		execInfoEnv   string
+		expected      *execInfo
+		expectedError string
+	}{
+		{
+			name:        "KUBERNETES_EXEC_INFO is empty",
+			execInfoEnv: "",
+		},
+		{
+			name:        "interactive session",
+			execInfoEnv: `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true}}`,
+			expected:    &execInfo{apiVersion: apiV1, interactive: true},
+		},
+		{
+			name:        "non-interactive session",
+			execInfoEnv: `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1beta1","spec":{"interactive":false}}`,
+			expected:    &execInfo{apiVersion: apiV1beta1},
+		},
+		{
+			name:        "cluster without config",
+			execInfoEnv: `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true,"cluster":{"server":"https://example.com"}}}`,
+			expected:    &execInfo{apiVersion: apiV1, interactive: true},
+		},
+		{
+			name:        "cluster with config",
+			execInfoEnv: `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true,"cluster":{"server":"https://example.com","config":{"server-id":"server","tenant-id":"tenant","pop-claims":"u=/arm/id"}}}}`,
+			expected: &execInfo{
+				apiVersion:  apiV1,
+				interactive: true,
+				clusterConfig: &ExecClusterConfig{
+					ServerID:       "server",
+					TenantID:       "tenant",
+					PoPTokenClaims: "u=/arm/id",
+				},
+			},
+		},
+		{
+			name:          "invalid json",
+			execInfoEnv:   `{`,
+			expectedError: `cannot unmarshal "{" to ExecCredential`,
+		},
+		{
+			name:          "invalid cluster config",
+			execInfoEnv:   `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1","spec":{"cluster":{"config":{"server-id":1}}}}`,
+			expectedError: "cannot unmarshal cluster config",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(execInfoEnv, tc.execInfoEnv)
+			info, err := getExecInfoFromEnv()
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, info)
+		})
+	}
+}
+
+func TestOptionsUpdateFromExecInfo(t *testing.T) {
+	testCases := []struct {
+		name        string
+		execInfoEnv string
+		options     Options
+		expected    Options
+	}{
+		{
+			name:     "KUBERNETES_EXEC_INFO is empty",
+			options:  Options{ServerID: "server"},
+			expected: Options{ServerID: "server"},
+		},
+		{
+			name:        "non-interactive session",
+			execInfoEnv: `{"apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":false}}`,
+			options:     Options{ServerID: "server"},
+			expected:    Options{ServerID: "server", isNonInteractive: true},
+		},
+		{
+			name:        "cluster config overrides options",
+			execInfoEnv: `{"apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true,"cluster":{"config":{"server-id":"cluster-server","tenant-id":"cluster-tenant"}}}}`,
+			options:     Options{ServerID: "server", TenantID: "tenant", ClientID: "client"},
+			expected:    Options{ServerID: "cluster-server", TenantID: "cluster-tenant", ClientID: "client"},
+		},
+		{
+			name:        "partial cluster config keeps options",
+			execInfoEnv: `{"apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true,"cluster":{"config":{"tenant-id":"cluster-tenant"}}}}`,
+			options:     Options{ServerID: "server", TenantID: "tenant"},
+			expected:    Options{ServerID: "server", TenantID: "cluster-tenant"},
+		},
+		{
+			name:        "pop claims enable pop",
+			execInfoEnv: `{"apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true,"cluster":{"config":{"pop-claims":"u=/arm/id"}}}}`,
+			options:     Options{ServerID: "server"},
+			expected:    Options{ServerID: "server", IsPoPTokenEnabled: true, PoPTokenClaims: "u=/arm/id"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(execInfoEnv, tc.execInfoEnv)
+			o := tc.options
+			require.NoError(t, o.UpdateFromExecInfo())
+			assert.Equal(t, tc.expected, o)
+		})
+	}
+
+	t.Run("invalid KUBERNETES_EXEC_INFO", func(t *testing.T) {
+		t.Setenv(execInfoEnv, "{")
+		o := Options{}
+		assert.Error(t, o.UpdateFromExecInfo())
+	})
+}
@@ -0,0 +1,230 @@
+package token
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+const (
+	sourceDefault  = "default"
+	sourceFlag     = "flag"
+	sourceExecInfo = "cluster info (KUBERNETES_EXEC_INFO)"
+	redactedSecret = "[redacted]"
+)
+
+// ConfigValue is the resolved value of an option with the source it comes from
+type ConfigValue struct {
+	Flag   string
+	Value  string
+	Source string
+}
+
+// Explain resolves the options from the profile, environment variables and KUBERNETES_EXEC_INFO
+// the same way get-token does and returns every option with the source of its value. Secrets are redacted.
+func (o *Options) Explain() ([]ConfigValue, error) {
+	sources := map[string]string{}
+	for _, flag := range o.changedFlags {
+		if flag == "token-cache-dir" {
+			flag = "cache-dir"
+		}
+		sources[flag] = sourceFlag
+	}
+	if v := os.Getenv("KUBECACHEDIR"); v != "" && sources["cache-dir"] == "" && o.AuthRecordCacheDir == v {
+		sources["cache-dir"] = envSource("KUBECACHEDIR")
+	}
+
+	before := o.configValues()
+	profile, err := o.updateFromProfile()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range o.configValues() {
+		if v.Value != before[i].Value {
+			sources[v.Flag] = "profile " + profile
+		}
+	}
+
+	for _, e := range o.updateFromEnv(os.LookupEnv) {
+		sources[e.flag] = envSource(e.name)
+	}
+
+	before = o.configValues()
+	if err := o.UpdateFromExecInfo(); err != nil {
+		return nil, err
+	}
+	values := o.configValues()
+	for i, v := range values {
+		if v.Value != before[i].Value {
+			sources[v.Flag] = sourceExecInfo
+		}
+		values[i].Source = sources[v.Flag]
+		if values[i].Source == "" {
+			values[i].Source = sourceDefault
+		}
+	}
+	return values, nil
+}
+
+// PrintConfig writes the options resolved by Explain and the credential get-token would use
+func PrintConfig(w io.Writer, o *Options) error {
+	values, err := o.Explain()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FLAG\tVALUE\tSOURCE")
+	for _, v := range values {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Flag, v.Value, v.Source)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	var credential string
+	if cred, err := NewAzIdentityCredential(azidentity.AuthenticationRecord{}, o); err != nil {
+		credential = fmt.Sprintf("none (%s)", err)
+	} else {
+		credential = cred.Name()
+	}
+	_, err = fmt.Fprintf(w, "\nCredential: %s\nReason: %s\n", credential, credentialReason(o))
+	return err
+}
+
+// configValues returns the value of every option keyed by its flag name
+func (o *Options) configValues() []ConfigValue {
+	return []ConfigValue{
+		{Flag: "login", Value: o.LoginMethod},
+		{Flag: "login-chain", Value: strings.Join(o.LoginChain, ",")},
+		{Flag: "server-id", Value: o.ServerID},
+		{Flag: "tenant-id", Value: o.TenantID},
+		{Flag: "client-id", Value: o.ClientID},
+		{Flag: "client-secret", Value: redactSecret(o.ClientSecret)},
+		{Flag: "client-certificate", Value: o.ClientCert},
+		{Flag: "client-certificate-password", Value: redactSecret(o.ClientCertPassword)},
+		{Flag: "client-certificate-expiry-days", Value: strconv.Itoa(o.ClientCertExpiryDays)},
+		{Flag: "client-certificate-expiry-strict", Value: strconv.FormatBool(o.ClientCertExpiryStrict)},
+		{Flag: "username", Value: o.Username},
+		{Flag: "password", Value: redactSecret(o.Password)},
+		{Flag: "identity-client-id", Value: o.IdentityClientID},
+		{Flag: "identity-object-id", Value: o.IdentityObjectID},
+		{Flag: "identity-resource-id", Value: o.IdentityResourceID},
+		{Flag: "identity-endpoint", Value: o.IdentityEndpoint},
+		{Flag: "federated-token-file", Value: o.FederatedTokenFile},
+		{Flag: "authority-host", Value: o.AuthorityHost},
+		{Flag: "azure-pipelines-service-connection-id", Value: o.AzurePipelinesServiceConnectionID},
+		{Flag: "client-assertion-command", Value: o.ClientAssertionCommand},
+		{Flag: "client-assertion-file", Value: o.ClientAssertionFile},
+		{Flag: "client-assertion-audience", Value: o.ClientAssertionAudience},
+		{Flag: "subscription", Value: o.SubscriptionID},
+		{Flag: "environment", Value: o.Environment},
+		{Flag: "environment-file", Value: o.EnvironmentFile},
+		{Flag: "environment-metadata-url", Value: o.EnvironmentMetadataURL},
+		{Flag: "legacy", Value: strconv.FormatBool(o.IsLegacy)},
+		{Flag: "pop-enabled", Value: strconv.FormatBool(o.IsPoPTokenEnabled)},
+		{Flag: "pop-claims", Value: o.PoPTokenClaims},
+		{Flag: "pop-cache-key", Value: redactSecret(o.PoPCacheKey)},
+		{Flag: "pop-cache-passphrase", Value: redactSecret(o.PoPCachePassphrase)},
+		{Flag: "redirect-url", Value: o.RedirectURL},
+		{Flag: "login-hint", Value: o.LoginHint},
+		{Flag: "browser-command", Value: o.BrowserCommand},
+		{Flag: "interactive-fallback", Value: o.InteractiveFallback},
+		{Flag: "cache-dir", Value: o.AuthRecordCacheDir},
+		{Flag: "timeout", Value: o.Timeout.String()},
+		{Flag: "use-azurerm-env-vars", Value: strconv.FormatBool(o.UseAzureRMTerraformEnv)},
+		{Flag: "disable-environment-override", Value: strconv.FormatBool(o.DisableEnvironmentOverride)},
+		{Flag: "flags-override-environment", Value: strconv.FormatBool(o.FlagsOverrideEnvironment)},
+		{Flag: "disable-instance-discovery", Value: strconv.FormatBool(o.DisableInstanceDiscovery)},
+		{Flag: "disable-token-cache", Value: strconv.FormatBool(o.DisableTokenCache)},
+		{Flag: "token-cache-refresh-margin", Value: o.TokenCacheRefreshMargin.String()},
+		{Flag: "profile", Value: o.Profile},
+		{Flag: "claims", Value: o.Claims},
+		{Flag: "enable-cae", Value: strconv.FormatBool(o.EnableCAE)},
+		{Flag: "device-code-qr", Value: strconv.FormatBool(o.DeviceCodeQR)},
+		{Flag: "events-fd", Value: strconv.Itoa(o.EventsFD)},
+		{Flag: "events-file", Value: o.EventsFile},
+	}
+}
+
+// envSource describes an environment variable source, telling apart the Terraform Azure Provider ones
+func envSource(name string) string {
+	if strings.HasPrefix(name, "ARM_") {
+		return "terraform env " + name
+	}
+	return "env " + name
+}
+
+// redactSecret hides a literal secret. Secret references are shown as they do not hold the secret.
+func redactSecret(secret string) string {
+	if secret == "" || IsSecretRef(secret) {
+		return secret
+	}
+	return redactedSecret
+}
+
+// credentialReason explains why NewAzIdentityCredential picks its credential for the options
+func credentialReason(o *Options) string {
+	switch o.LoginMethod {
+	case DeviceCodeLogin:
+		if o.IsLegacy {
+			return "devicecode login with --legacy"
+		}
+	case InteractiveLogin:
+		switch {
+		case o.IsPoPTokenEnabled:
+			return "interactive login with --pop-enabled"
+		case o.BrowserCommand != "":
+			return "interactive login with --browser-command"
+		case o.InteractiveFallback != "":
+			return "interactive login with --interactive-fallback"
+		}
+	case AuthCodeLogin, ROPCLogin:
+		if o.IsPoPTokenEnabled {
+			return o.LoginMethod + " login with --pop-enabled"
+		}
+	case ServicePrincipalLogin:
+		switch {
+		case o.IsLegacy && o.ClientCert != "":
+			return "spn login with --legacy and a client certificate"
+		case o.IsLegacy:
+			return "spn login with --legacy and a client secret"
+		case o.ClientCert != "" && o.IsPoPTokenEnabled:
+			return "spn login with a client certificate and --pop-enabled"
+		case o.ClientCert != "":
+			return "spn login with a client certificate"
+		case o.IsPoPTokenEnabled:
+			return "spn login with a client secret and --pop-enabled"
+		default:
+			return "spn login with a client secret"
+		}
+	case AutoLogin:
+		if len(o.LoginChain) > 0 {
+			return fmt.Sprintf("auto login trying %s in order", strings.Join(o.LoginChain, ", "))
+		}
+		return fmt.Sprintf("auto login trying %s in order, detected from the environment", strings.Join(detectLoginChain(o), ", "))
+	case WorkloadIdentityLogin:
+		if p := detectCIProvider(o); p != nil {
+			return fmt.Sprintf("workloadidentity login in %s (%s)", p.name, p.detectedBy())
+		}
+		return "workloadidentity login with a federated token file"
+	case ClientAssertionLogin:
+		if o.ClientAssertionFile != "" {
+			return "clientassertion login with --client-assertion-file"
+		}
+		return "clientassertion login with --client-assertion-command"
+	case MSILogin:
+		return "msi login with " + describeManagedIdentityEndpoint(o)
+	case MSIFederatedLogin:
+		if o.IdentityClientID != "" || o.IdentityObjectID != "" || o.IdentityResourceID != "" {
+			return "msifederated login with a user-assigned managed identity"
+		}
+		return "msifederated login with the system-assigned managed identity"
+	}
+	return o.LoginMethod + " login"
+}
@@ -0,0 +1,130 @@
+package token
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+func newOptionsFromFlags(t *testing.T, args ...string) Options {
+	t.Helper()
+	o := NewOptions(false)
+	fs := pflag.NewFlagSet("get-token", pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	o.AddFlags(fs)
+	require.NoError(t, fs.Parse(args))
+	o.SetChangedFlags(fs)
+	return o
+}
+
+func sourcesOf(values []ConfigValue) map[string]string {
+	sources := map[string]string{}
+	for _, v := range values {
+		sources[v.Flag] = v.Source
+	}
+	return sources
+}
+
+func valuesOf(values []ConfigValue) map[string]string {
+	m := map[string]string{}
+	for _, v := range values {
+		m[v.Flag] = v.Value
+	}
+	return m
+}
+
+func TestExplain(t *testing.T) {
+	t.Run("sources", func(t *testing.T) {
+		t.Setenv(env.AzureClientID, "client-id from env")
+		t.Setenv(execInfoEnv, `{"apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true,"cluster":{"config":{"tenant-id":"cluster-tenant"}}}}`)
+		o := newOptionsFromFlags(t,
+			"--login", "spn",
+			"--server-id", "server-id",
+			"--client-id", "client-id from flag",
+			"--tenant-id", "tenant-id",
+			"--token-cache-dir", "/tmp/cache",
+		)
+
+		values, err := o.Explain()
+		require.NoError(t, err)
+		sources := sourcesOf(values)
+		assert.Equal(t, sourceFlag, sources["login"])
+		assert.Equal(t, sourceFlag, sources["server-id"])
+		assert.Equal(t, sourceFlag, sources["cache-dir"])
+		assert.Equal(t, "env "+env.AzureClientID, sources["client-id"])
+		assert.Equal(t, sourceExecInfo, sources["tenant-id"])
+		assert.Equal(t, sourceDefault, sources["environment"])
+		assert.Equal(t, "client-id from env", valuesOf(values)["client-id"])
+		assert.Equal(t, "cluster-tenant", valuesOf(values)["tenant-id"])
+	})
+
+	t.Run("terraform env", func(t *testing.T) {
+		t.Setenv(execInfoEnv, "")
+		t.Setenv(env.TerraformClientID, "client-id from env")
+		o := newOptionsFromFlags(t, "--use-azurerm-env-vars")
+
+		values, err := o.Explain()
+		require.NoError(t, err)
+		assert.Equal(t, "terraform env "+env.TerraformClientID, sourcesOf(values)["client-id"])
+	})
+
+	t.Run("flags override environment", func(t *testing.T) {
+		t.Setenv(execInfoEnv, "")
+		t.Setenv(env.AzureClientID, "client-id from env")
+		t.Setenv(env.AzureTenantID, "tenant-id from env")
+		o := newOptionsFromFlags(t, "--client-id", "client-id from flag", "--flags-override-environment")
+
+		values, err := o.Explain()
+		require.NoError(t, err)
+		assert.Equal(t, sourceFlag, sourcesOf(values)["client-id"])
+		assert.Equal(t, "client-id from flag", valuesOf(values)["client-id"])
+		assert.Equal(t, "env "+env.AzureTenantID, sourcesOf(values)["tenant-id"])
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		t.Setenv(execInfoEnv, "")
+		writeTestKubeloginConfig(t, testKubeloginConfig)
+		o := newOptionsFromFlags(t, "--profile", "prod", "--client-id", "client-id from flag", "--disable-environment-override")
+
+		values, err := o.Explain()
+		require.NoError(t, err)
+		assert.Equal(t, "profile prod", sourcesOf(values)["tenant-id"])
+		assert.Equal(t, sourceFlag, sourcesOf(values)["client-id"])
+	})
+
+	t.Run("secrets are redacted", func(t *testing.T) {
+		t.Setenv(execInfoEnv, "")
+		o := newOptionsFromFlags(t, "--client-secret", "secret", "--password", "env:PASSWORD", "--disable-environment-override")
+
+		values, err := o.Explain()
+		require.NoError(t, err)
+		assert.Equal(t, redactedSecret, valuesOf(values)["client-secret"])
+		assert.Equal(t, "env:PASSWORD", valuesOf(values)["password"])
+		assert.Equal(t, "", valuesOf(values)["client-certificate-password"])
+	})
+}
+
+func TestPrintConfig(t *testing.T) {
+	t.Setenv(execInfoEnv, "")
+	o := newOptionsFromFlags(t,
+		"--login", "spn",
+		"--server-id", "server-id",
+		"--client-id", "client-id",
+		"--tenant-id", "tenant-id",
+		"--client-secret", "s3cr3t-value",
+		"--disable-environment-override",
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, PrintConfig(&buf, &o))
+	assert.Contains(t, buf.String(), "FLAG")
+	assert.Contains(t, buf.String(), redactedSecret)
+	assert.NotContains(t, buf.String(), "s3cr3t-value")
+	assert.Contains(t, buf.String(), "Credential: ClientSecretCredential\nReason: spn login with a client secret\n")
+}
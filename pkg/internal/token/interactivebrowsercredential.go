@@ -28,7 +28,7 @@ func newInteractiveBrowserCredential(opts *Options, record azidentity.Authentica
 		err error
 	)
 	if opts.UsePersistentCache {
-		c, err = newPersistentCache()
+		c, err = newAccountPersistentCache(opts)
 		if err != nil {
 			klog.V(5).Infof("failed to create cache: %v", err)
 		}
@@ -41,8 +41,10 @@ func newInteractiveBrowserCredential(opts *Options, record azidentity.Authentica
 		ClientID:                 opts.ClientID,
 		TenantID:                 opts.TenantID,
 		DisableInstanceDiscovery: opts.DisableInstanceDiscovery,
-		RedirectURL:              opts.RedirectURL,
-		LoginHint:                opts.LoginHint,
+		// fail instead of prompting when kubectl reports a non-interactive session
+		DisableAutomaticAuthentication: opts.isNonInteractive,
+		RedirectURL:                    opts.RedirectURL,
+		LoginHint:                      opts.LoginHint,
 	}
 
 	if opts.httpClient != nil {
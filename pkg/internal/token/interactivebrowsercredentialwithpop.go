@@ -14,10 +14,12 @@ import (
 )
 
 type InteractiveBrowserCredentialWithPoP struct {
-	popClaims   map[string]string
-	client      public.Client
-	options     *pop.MsalClientOptions
-	keyProvider PoPKeyProvider
+	popClaims      map[string]string
+	client         public.Client
+	options        *pop.MsalClientOptions
+	keyProvider    PoPKeyProvider
+	browser        *browserSignIn
+	nonInteractive bool
 }
 
 var _ CredentialProvider = (*InteractiveBrowserCredentialWithPoP)(nil)
@@ -65,10 +67,12 @@ func newInteractiveBrowserCredentialWithPoP(opts *Options) (CredentialProvider,
 	}
 
 	return &InteractiveBrowserCredentialWithPoP{
-		options:     msalOpts,
-		client:      client,
-		popClaims:   popClaimsMap,
-		keyProvider: opts.GetPoPKeyProvider(),
+		options:        msalOpts,
+		client:         client,
+		popClaims:      popClaimsMap,
+		keyProvider:    opts.GetPoPKeyProvider(),
+		browser:        newBrowserSignIn(opts),
+		nonInteractive: opts.isNonInteractive,
 	}, nil
 }
 
@@ -87,14 +91,30 @@ func (c *InteractiveBrowserCredentialWithPoP) GetToken(ctx context.Context, opts
 		return azcore.AccessToken{}, err
 	}
 
-	token, expirationTimeUnix, err := pop.AcquirePoPTokenInteractive(
-		ctx,
-		c.popClaims,
-		opts.Scopes,
-		c.client,
-		c.options,
-		popKey,
+	if c.nonInteractive {
+		// only cached accounts can be used when kubectl cannot prompt the user
+		token, expirationTimeUnix, err := pop.AcquirePoPTokenSilent(ctx, c.popClaims, opts.Scopes, c.client, c.options, popKey)
+		if err != nil {
+			return azcore.AccessToken{}, fmt.Errorf("%w: %s", errNonInteractiveSession, err)
+		}
+		return azcore.AccessToken{Token: token, ExpiresOn: time.Unix(expirationTimeUnix, 0)}, nil
+	}
+
+	deviceCode := func(ctx context.Context) (public.AuthResult, error) {
+		return c.browser.acquireTokenByDeviceCode(ctx, c.client, opts.Scopes, c.options.TenantID, "")
+	}
+	var (
+		token              string
+		expirationTimeUnix int64
 	)
+	if c.browser.useDeviceCode() {
+		token, expirationTimeUnix, err = pop.AcquirePoPTokenBySignIn(ctx, c.popClaims, opts.Scopes, c.client, c.options, popKey, deviceCode)
+	} else {
+		token, expirationTimeUnix, err = pop.AcquirePoPTokenInteractive(ctx, c.popClaims, opts.Scopes, c.client, c.options, popKey, c.browser.interactiveOptions()...)
+		if err != nil && c.browser.fallBackToDeviceCode() {
+			token, expirationTimeUnix, err = pop.AcquirePoPTokenBySignIn(ctx, c.popClaims, opts.Scopes, c.client, c.options, popKey, deviceCode)
+		}
+	}
 	if err != nil {
 		return azcore.AccessToken{}, fmt.Errorf("failed to create PoP token using interactive login: %w", err)
 	}
@@ -0,0 +1,166 @@
+package token
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/managedidentity"
+	klog "k8s.io/klog/v2"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+const (
+	imdsTokenEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	// ManagedIdentityCacheDirName is the directory of the cache directory holding the managed
+	// identity tokens of msifederated login
+	ManagedIdentityCacheDirName = "msi"
+)
+
+// getManagedIdentityID returns the ID of the user-assigned identity of the options, or nil
+// for the system-assigned identity
+func getManagedIdentityID(opts *Options, clientID string) azidentity.ManagedIDKind {
+	switch {
+	case clientID != "":
+		return azidentity.ClientID(clientID)
+	case opts.IdentityObjectID != "":
+		return azidentity.ObjectID(opts.IdentityObjectID)
+	case opts.IdentityResourceID != "":
+		return azidentity.ResourceID(opts.IdentityResourceID)
+	}
+	return nil
+}
+
+// describeManagedIdentityEndpoint describes the endpoint the tokens of the managed identity
+// are requested from. App Service, Cloud Shell and Arc configure it in environment variables.
+func describeManagedIdentityEndpoint(opts *Options) string {
+	source, _ := managedidentity.GetSource()
+	switch source {
+	case managedidentity.AppService:
+		return fmt.Sprintf("the App Service endpoint (%s and %s are set)", env.IdentityEndpoint, env.IdentityHeader)
+	case managedidentity.ServiceFabric:
+		return fmt.Sprintf("the Service Fabric endpoint (%s, %s and IDENTITY_SERVER_THUMBPRINT are set)", env.IdentityEndpoint, env.IdentityHeader)
+	case managedidentity.CloudShell:
+		return fmt.Sprintf("the Cloud Shell endpoint (%s is set)", env.MSIEndpoint)
+	case managedidentity.AzureML:
+		return fmt.Sprintf("the Azure Machine Learning endpoint (%s and MSI_SECRET are set)", env.MSIEndpoint)
+	case managedidentity.AzureArc:
+		return "the Azure Arc endpoint"
+	}
+	if opts.IdentityEndpoint != "" {
+		return "the endpoint " + opts.IdentityEndpoint
+	}
+	return "IMDS"
+}
+
+// imdsEndpointTransport sends the token requests of IMDS to another endpoint
+type imdsEndpointTransport struct {
+	endpoint *url.URL
+	next     policy.Transporter
+}
+
+func newIMDSEndpointTransport(endpoint string, next policy.Transporter) (*imdsEndpointTransport, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("identity endpoint %q is not valid: %w", endpoint, err)
+	}
+	if next == nil {
+		next = http.DefaultClient
+	}
+	return &imdsEndpointTransport{endpoint: u, next: next}, nil
+}
+
+func (t *imdsEndpointTransport) Do(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme+"://"+req.URL.Host+req.URL.Path != imdsTokenEndpoint {
+		return t.next.Do(req)
+	}
+	u := *t.endpoint
+	q := u.Query()
+	for k, v := range req.URL.Query() {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	req = req.Clone(req.Context())
+	req.URL = &u
+	req.Host = u.Host
+	return t.next.Do(req)
+}
+
+// cachedManagedIdentityCredential caches the managed identity tokens msifederated login uses
+// as client assertions across get-token invocations. The exec credential cache only holds the
+// token of the application they are exchanged for.
+type cachedManagedIdentityCredential struct {
+	cred azcore.TokenCredential
+	// dir is the cache directory and key identifies the managed identity and its endpoint
+	dir string
+	key string
+	// newCache creates the cache entry at path
+	newCache func(path string) (ExecCredentialCache, error)
+}
+
+// newCachedManagedIdentityCredential caches the tokens of cred, the credential of the managed
+// identity with the client ID or the identity object ID or resource ID of the options
+func newCachedManagedIdentityCredential(opts *Options, clientID string, cred azcore.TokenCredential) *cachedManagedIdentityCredential {
+	return &cachedManagedIdentityCredential{
+		cred: cred,
+		dir:  opts.AuthRecordCacheDir,
+		key:  getManagedIdentityCacheKey(opts, getManagedIdentityID(opts, clientID)),
+		newCache: func(path string) (ExecCredentialCache, error) {
+			return newTokenCache(opts, path)
+		},
+	}
+}
+
+func (c *cachedManagedIdentityCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if opts.Claims != "" {
+		// a claims challenge means the cached token was rejected
+		return c.cred.GetToken(ctx, opts)
+	}
+	path := filepath.Join(c.dir, ManagedIdentityCacheDirName,
+		fmt.Sprintf("%x.cache", sha256.Sum256([]byte(c.key+"\x00"+strings.Join(opts.Scopes, " ")))))
+	cache, err := c.newCache(path)
+	if err != nil {
+		klog.V(5).Infof("managed identity token caching disabled: %v", err)
+		return c.cred.GetToken(ctx, opts)
+	}
+	if token, err := cache.Retrieve(ctx); err != nil {
+		klog.V(5).Infof("failed to retrieve cached managed identity token: %v", err)
+	} else if token.Token != "" {
+		klog.V(5).Info("using the cached managed identity token")
+		return token, nil
+	}
+
+	token, err := c.cred.GetToken(ctx, opts)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	if err := cache.Store(ctx, token); err != nil {
+		klog.V(5).Infof("failed to cache managed identity token: %v", err)
+	}
+	return token, nil
+}
+
+// getManagedIdentityCacheKey identifies the managed identity and the endpoint its tokens
+// are requested from
+func getManagedIdentityCacheKey(opts *Options, id azidentity.ManagedIDKind) string {
+	source, _ := managedidentity.GetSource()
+	return strings.Join([]string{
+		string(source),
+		os.Getenv(env.IdentityEndpoint),
+		os.Getenv(env.MSIEndpoint),
+		opts.IdentityEndpoint,
+		fmt.Sprintf("%T", id),
+		fmt.Sprint(id),
+		strconv.FormatBool(opts.EnableCAE),
+	}, "\x00")
+}
@@ -0,0 +1,256 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+// fakeManagedIdentityEndpoint serves the token endpoints of IMDS, App Service and Cloud Shell
+type fakeManagedIdentityEndpoint struct {
+	server   *httptest.Server
+	requests []*http.Request
+}
+
+func newFakeManagedIdentityEndpoint(t *testing.T) *fakeManagedIdentityEndpoint {
+	t.Helper()
+	f := &fakeManagedIdentityEndpoint{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		f.requests = append(f.requests, r)
+		resource := r.Form.Get("resource")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "msi-token-" + strconv.Itoa(len(f.requests)),
+			"expires_in":   "3600",
+			"expires_on":   strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10),
+			"resource":     resource,
+			"token_type":   "Bearer",
+		})
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// clearManagedIdentityEnvs unsets the environment variables of the managed identity
+// endpoints of the host the tests run on
+func clearManagedIdentityEnvs(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{env.IdentityEndpoint, env.IdentityHeader, "IDENTITY_SERVER_THUMBPRINT", env.IMDSEndpoint, env.MSIEndpoint, "MSI_SECRET"} {
+		t.Setenv(name, "")
+	}
+}
+
+var managedIdentityTestIDs atomic.Int64
+
+// newManagedIdentityTestID returns a value of its own to each call. The tests use it in the
+// identities or the server IDs of their tokens, as MSAL caches the tokens of managed
+// identities in memory for the lifetime of the process.
+func newManagedIdentityTestID(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, managedIdentityTestIDs.Add(1))
+}
+
+func TestGetManagedIdentityID(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     *Options
+		clientID string
+		want     azidentity.ManagedIDKind
+	}{
+		{
+			name: "system-assigned identity",
+			opts: &Options{},
+		},
+		{
+			name:     "client ID",
+			opts:     &Options{IdentityObjectID: "object-id"},
+			clientID: "client-id",
+			want:     azidentity.ClientID("client-id"),
+		},
+		{
+			name: "object ID",
+			opts: &Options{IdentityObjectID: "object-id", IdentityResourceID: "resource-id"},
+			want: azidentity.ObjectID("object-id"),
+		},
+		{
+			name: "resource ID",
+			opts: &Options{IdentityResourceID: "resource-id"},
+			want: azidentity.ResourceID("resource-id"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, getManagedIdentityID(tc.opts, tc.clientID))
+		})
+	}
+}
+
+func TestManagedIdentityEndpoints(t *testing.T) {
+	t.Run("identity endpoint replaces IMDS", func(t *testing.T) {
+		clearManagedIdentityEnvs(t)
+		f := newFakeManagedIdentityEndpoint(t)
+		serverID := newManagedIdentityTestID("server-id")
+		opts := &Options{IdentityObjectID: "object-id", IdentityEndpoint: f.server.URL + "/metadata/identity/oauth2/token"}
+		assert.Equal(t, "the endpoint "+opts.IdentityEndpoint, describeManagedIdentityEndpoint(opts))
+
+		cred, err := newManagedIdentityCredential(opts)
+		require.NoError(t, err)
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{serverID + "/.default"}})
+		require.NoError(t, err)
+		assert.Equal(t, "msi-token-1", token.Token)
+
+		require.Len(t, f.requests, 1)
+		req := f.requests[0]
+		assert.Equal(t, "/metadata/identity/oauth2/token", req.URL.Path)
+		assert.Equal(t, "true", req.Header.Get("Metadata"))
+		assert.Equal(t, "object-id", req.URL.Query().Get("object_id"))
+		assert.Equal(t, serverID, req.URL.Query().Get("resource"))
+	})
+
+	t.Run("App Service endpoint", func(t *testing.T) {
+		clearManagedIdentityEnvs(t)
+		f := newFakeManagedIdentityEndpoint(t)
+		t.Setenv(env.IdentityEndpoint, f.server.URL+"/msi/token")
+		t.Setenv(env.IdentityHeader, "identity-header")
+		serverID := newManagedIdentityTestID("server-id")
+		opts := &Options{ClientID: "client-id"}
+		assert.Equal(t, "the App Service endpoint (IDENTITY_ENDPOINT and IDENTITY_HEADER are set)", describeManagedIdentityEndpoint(opts))
+
+		cred, err := newManagedIdentityCredential(opts)
+		require.NoError(t, err)
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{serverID + "/.default"}})
+		require.NoError(t, err)
+		assert.Equal(t, "msi-token-1", token.Token)
+
+		require.Len(t, f.requests, 1)
+		req := f.requests[0]
+		assert.Equal(t, "/msi/token", req.URL.Path)
+		assert.Equal(t, "identity-header", req.Header.Get("X-IDENTITY-HEADER"))
+		assert.Equal(t, "client-id", req.URL.Query().Get("client_id"))
+	})
+
+	t.Run("Cloud Shell endpoint", func(t *testing.T) {
+		clearManagedIdentityEnvs(t)
+		f := newFakeManagedIdentityEndpoint(t)
+		t.Setenv(env.MSIEndpoint, f.server.URL+"/oauth2/token")
+		serverID := newManagedIdentityTestID("server-id")
+		opts := &Options{}
+		assert.Equal(t, "the Cloud Shell endpoint (MSI_ENDPOINT is set)", describeManagedIdentityEndpoint(opts))
+
+		cred, err := newManagedIdentityCredential(opts)
+		require.NoError(t, err)
+		token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{serverID + "/.default"}})
+		require.NoError(t, err)
+		assert.Equal(t, "msi-token-1", token.Token)
+
+		require.Len(t, f.requests, 1)
+		assert.Equal(t, http.MethodPost, f.requests[0].Method)
+		assert.Equal(t, serverID, f.requests[0].PostForm.Get("resource"))
+	})
+}
+
+func TestCachedManagedIdentityCredential(t *testing.T) {
+	clearManagedIdentityEnvs(t)
+	ctx := context.Background()
+
+	newCredential := func(t *testing.T, opts *Options) *cachedManagedIdentityCredential {
+		t.Helper()
+		cred, err := newAzManagedIdentityCredential(opts, opts.IdentityClientID)
+		require.NoError(t, err)
+		cached := newCachedManagedIdentityCredential(opts, opts.IdentityClientID, cred)
+		cached.newCache = func(path string) (ExecCredentialCache, error) {
+			acc, err := file.New(path)
+			if err != nil {
+				return nil, err
+			}
+			return &defaultExecCredentialCache{accessor: acc, refreshMargin: opts.TokenCacheRefreshMargin, now: time.Now}, nil
+		}
+		return cached
+	}
+
+	t.Run("tokens are cached across invocations", func(t *testing.T) {
+		f := newFakeManagedIdentityEndpoint(t)
+		scopes := []string{newManagedIdentityTestID("server-id") + "/.default"}
+		opts := &Options{
+			UsePersistentCache:      true,
+			AuthRecordCacheDir:      t.TempDir(),
+			IdentityEndpoint:        f.server.URL + "/metadata/identity/oauth2/token",
+			TokenCacheRefreshMargin: defaultTokenCacheRefreshMargin,
+		}
+		for range 2 {
+			token, err := newCredential(t, opts).GetToken(ctx, policy.TokenRequestOptions{Scopes: scopes})
+			require.NoError(t, err)
+			assert.Equal(t, "msi-token-1", token.Token)
+		}
+		assert.Len(t, f.requests, 1)
+
+		// another identity has its own tokens
+		opts.IdentityResourceID = "resource-id"
+		token, err := newCredential(t, opts).GetToken(ctx, policy.TokenRequestOptions{Scopes: scopes})
+		require.NoError(t, err)
+		assert.Equal(t, "msi-token-2", token.Token)
+
+		// a claims challenge is not answered with a cached token
+		token, err = newCredential(t, opts).GetToken(ctx, policy.TokenRequestOptions{Scopes: scopes, Claims: `{"access_token":{}}`})
+		require.NoError(t, err)
+		assert.Equal(t, "msi-token-3", token.Token)
+	})
+
+	t.Run("tokens of msi login are left to the exec credential cache", func(t *testing.T) {
+		f := newFakeManagedIdentityEndpoint(t)
+		opts := &Options{
+			UsePersistentCache: true,
+			AuthRecordCacheDir: t.TempDir(),
+			IdentityEndpoint:   f.server.URL + "/metadata/identity/oauth2/token",
+		}
+		cred, err := newManagedIdentityCredential(opts)
+		require.NoError(t, err)
+		assert.IsType(t, &azidentity.ManagedIdentityCredential{}, cred.(*ManagedIdentityCredential).cred)
+		_, err = cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{newManagedIdentityTestID("server-id") + "/.default"}})
+		require.NoError(t, err)
+		assert.NoDirExists(t, filepath.Join(opts.AuthRecordCacheDir, ManagedIdentityCacheDirName))
+	})
+}
+
+func TestIMDSEndpointTransport(t *testing.T) {
+	var got *url.URL
+	transport, err := newIMDSEndpointTransport("http://localhost:40342/token?api=1", transporterFunc(func(req *http.Request) (*http.Response, error) {
+		got = req.URL
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, imdsTokenEndpoint+"?resource=server-id", nil)
+	require.NoError(t, err)
+	_, err = transport.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:40342/token?api=1&resource=server-id", got.String())
+	assert.Equal(t, imdsTokenEndpoint+"?resource=server-id", req.URL.String(), "the request is not modified")
+
+	req, err = http.NewRequest(http.MethodGet, "https://login.microsoftonline.com/tenant/oauth2/v2.0/token", nil)
+	require.NoError(t, err)
+	_, err = transport.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "https://login.microsoftonline.com/tenant/oauth2/v2.0/token", got.String())
+}
+
+type transporterFunc func(*http.Request) (*http.Response, error)
+
+func (f transporterFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -7,22 +7,29 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/managedidentity"
+	klog "k8s.io/klog/v2"
 )
 
 type ManagedIdentityCredential struct {
-	cred *azidentity.ManagedIdentityCredential
+	cred azcore.TokenCredential
 }
 
 var _ CredentialProvider = (*ManagedIdentityCredential)(nil)
 
 func newManagedIdentityCredential(opts *Options) (CredentialProvider, error) {
-	var id azidentity.ManagedIDKind
-	if opts.ClientID != "" {
-		id = azidentity.ClientID(opts.ClientID)
-	} else if opts.IdentityResourceID != "" {
-		id = azidentity.ResourceID(opts.IdentityResourceID)
+	cred, err := newAzManagedIdentityCredential(opts, opts.ClientID)
+	if err != nil {
+		return nil, err
 	}
+	return &ManagedIdentityCredential{cred: cred}, nil
+}
 
+// newAzManagedIdentityCredential creates the credential of the managed identity with the
+// client ID, or the identity object ID or resource ID of the options. Without any of them,
+// the system-assigned identity is used.
+func newAzManagedIdentityCredential(opts *Options, clientID string) (azcore.TokenCredential, error) {
+	id := getManagedIdentityID(opts, clientID)
 	azOpts := &azidentity.ManagedIdentityCredentialOptions{
 		ClientOptions: azcore.ClientOptions{Cloud: opts.GetCloudConfiguration()},
 		ID:            id,
@@ -32,11 +39,22 @@ func newManagedIdentityCredential(opts *Options) (CredentialProvider, error) {
 		azOpts.Transport = opts.httpClient
 	}
 
+	if opts.IdentityEndpoint != "" {
+		if source, _ := managedidentity.GetSource(); source != managedidentity.DefaultToIMDS {
+			klog.Warningf("--identity-endpoint is ignored as %s", describeManagedIdentityEndpoint(opts))
+		}
+		transport, err := newIMDSEndpointTransport(opts.IdentityEndpoint, azOpts.Transport)
+		if err != nil {
+			return nil, err
+		}
+		azOpts.Transport = transport
+	}
+
 	cred, err := azidentity.NewManagedIdentityCredential(azOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create managed identity credential: %w", err)
 	}
-	return &ManagedIdentityCredential{cred: cred}, nil
+	return cred, nil
 }
 
 func (c *ManagedIdentityCredential) Name() string {
@@ -0,0 +1,83 @@
+package token
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/confidential"
+)
+
+// MSIFederatedCredential authenticates an application with a token of a managed identity,
+// used as the client assertion of a federated identity credential of the application. As the
+// application may be registered in another tenant, the token is requested in --tenant-id.
+type MSIFederatedCredential struct {
+	client confidential.Client
+}
+
+var _ CredentialProvider = (*MSIFederatedCredential)(nil)
+
+func newMSIFederatedCredential(opts *Options) (CredentialProvider, error) {
+	if opts.ClientID == "" {
+		return nil, fmt.Errorf("client ID cannot be empty")
+	}
+	if opts.TenantID == "" {
+		return nil, fmt.Errorf("tenant ID cannot be empty")
+	}
+	msi, err := newAzManagedIdentityCredential(opts, opts.IdentityClientID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.UsePersistentCache && !opts.DisableTokenCache {
+		msi = newCachedManagedIdentityCredential(opts, opts.IdentityClientID, msi)
+	}
+	audience := opts.ClientAssertionAudience
+	if audience == "" {
+		audience = azureADAudience
+	}
+	cred := confidential.NewCredFromAssertionCallback(func(ctx context.Context, _ confidential.AssertionRequestOptions) (string, error) {
+		token, err := msi.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{audience + "/.default"}})
+		if err != nil {
+			return "", fmt.Errorf("failed to get managed identity token for %s: %w", audience, err)
+		}
+		return token.Token, nil
+	})
+
+	o := []confidential.Option{
+		confidential.WithInstanceDiscovery(!opts.DisableInstanceDiscovery),
+	}
+	if opts.httpClient != nil {
+		o = append(o, confidential.WithHTTPClient(opts.httpClient))
+	}
+	client, err := confidential.New(
+		fmt.Sprintf("%s%s/", opts.GetCloudConfiguration().ActiveDirectoryAuthorityHost, opts.TenantID),
+		opts.ClientID, cred, o...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create managed identity federated credential: %w", err)
+	}
+
+	return &MSIFederatedCredential{client: client}, nil
+}
+
+func (c *MSIFederatedCredential) Name() string {
+	return "MSIFederatedCredential"
+}
+
+func (c *MSIFederatedCredential) Authenticate(ctx context.Context, opts *policy.TokenRequestOptions) (azidentity.AuthenticationRecord, error) {
+	return azidentity.AuthenticationRecord{}, errAuthenticateNotSupported
+}
+
+func (c *MSIFederatedCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	result, err := c.client.AcquireTokenByCredential(ctx, opts.Scopes)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	return azcore.AccessToken{Token: result.AccessToken, ExpiresOn: result.ExpiresOn}, nil
+}
+
+func (c *MSIFederatedCredential) NeedAuthenticate() bool {
+	return false
+}
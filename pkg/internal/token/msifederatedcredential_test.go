@@ -0,0 +1,150 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMSIFederatedCredential(t *testing.T) {
+	testCases := []struct {
+		name    string
+		opts    *Options
+		wantErr string
+	}{
+		{
+			name: "system-assigned identity",
+			opts: &Options{ClientID: "client-id", TenantID: "tenant"},
+		},
+		{
+			name: "user-assigned identity",
+			opts: &Options{ClientID: "client-id", TenantID: "tenant", IdentityClientID: "msi-client-id"},
+		},
+		{
+			name:    "missing client ID",
+			opts:    &Options{TenantID: "tenant", IdentityClientID: "msi-client-id"},
+			wantErr: "client ID cannot be empty",
+		},
+		{
+			name:    "missing tenant ID",
+			opts:    &Options{ClientID: "client-id", IdentityClientID: "msi-client-id"},
+			wantErr: "tenant ID cannot be empty",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cred, err := newMSIFederatedCredential(tc.opts)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				assert.Nil(t, cred)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "MSIFederatedCredential", cred.Name())
+		})
+	}
+}
+
+func TestMSIFederatedCredentialGetToken(t *testing.T) {
+	clearManagedIdentityEnvs(t)
+	msiClientID := newManagedIdentityTestID("msi-client-id")
+	msiResourceID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/" + newManagedIdentityTestID("id")
+
+	testCases := []struct {
+		name         string
+		opts         Options
+		wantResource string
+		wantQuery    url.Values
+	}{
+		{
+			name:         "user-assigned identity by client ID",
+			opts:         Options{IdentityClientID: msiClientID},
+			wantResource: azureADAudience,
+			wantQuery:    url.Values{"client_id": {msiClientID}},
+		},
+		{
+			name:         "user-assigned identity by resource ID",
+			opts:         Options{IdentityResourceID: msiResourceID},
+			wantResource: azureADAudience,
+			wantQuery:    url.Values{"msi_res_id": {msiResourceID}},
+		},
+		{
+			name:         "audience of a sovereign cloud",
+			opts:         Options{IdentityObjectID: newManagedIdentityTestID("msi-object-id"), ClientAssertionAudience: "api://AzureADTokenExchangeUSGov"},
+			wantResource: "api://AzureADTokenExchangeUSGov",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sts := newFakeSTS(t)
+			msi := newFakeManagedIdentityEndpoint(t)
+			opts := tc.opts
+			opts.ClientID = "client-id"
+			opts.TenantID = "tenant"
+			opts.AuthorityHost = sts.server.URL + "/"
+			opts.DisableInstanceDiscovery = true
+			opts.IdentityEndpoint = msi.server.URL + "/metadata/identity/oauth2/token"
+			opts.httpClient = sts.server.Client()
+
+			cred, err := newMSIFederatedCredential(&opts)
+			require.NoError(t, err)
+
+			token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"server-id/.default"}})
+			require.NoError(t, err)
+			assert.Equal(t, "access-token-1", token.Token)
+
+			require.Len(t, msi.requests, 1)
+			query := msi.requests[0].URL.Query()
+			assert.Equal(t, tc.wantResource, query.Get("resource"))
+			for k := range tc.wantQuery {
+				assert.Equal(t, tc.wantQuery.Get(k), query.Get(k))
+			}
+
+			require.Len(t, sts.tokenRequests, 1)
+			req := sts.tokenRequests[0]
+			assert.Equal(t, "client_credentials", req.Get("grant_type"))
+			assert.Equal(t, "client-id", req.Get("client_id"))
+			assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", req.Get("client_assertion_type"))
+			assert.Equal(t, "msi-token-1", req.Get("client_assertion"))
+		})
+	}
+}
+
+func TestMSIFederatedCredentialAssertionCache(t *testing.T) {
+	clearManagedIdentityEnvs(t)
+	original := secureStorageError
+	defer func() { secureStorageError = original }()
+	secureStorageError = func() error { return errors.New("no keyring") }
+
+	sts := newFakeSTS(t)
+	msi := newFakeManagedIdentityEndpoint(t)
+	opts := &Options{
+		ClientID:                 "client-id",
+		TenantID:                 "tenant",
+		AuthorityHost:            sts.server.URL + "/",
+		DisableInstanceDiscovery: true,
+		IdentityEndpoint:         msi.server.URL + "/metadata/identity/oauth2/token",
+		UsePersistentCache:       true,
+		AuthRecordCacheDir:       t.TempDir(),
+		TokenCacheRefreshMargin:  defaultTokenCacheRefreshMargin,
+		httpClient:               sts.server.Client(),
+	}
+
+	// each invocation exchanges the managed identity token cached by the first one
+	for range 2 {
+		cred, err := newMSIFederatedCredential(opts)
+		require.NoError(t, err)
+		_, err = cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"server-id/.default"}})
+		require.NoError(t, err)
+	}
+	assert.Len(t, msi.requests, 1)
+	require.Len(t, sts.tokenRequests, 2)
+	assert.Equal(t, "msi-token-1", sts.tokenRequests[1].Get("client_assertion"))
+	assert.DirExists(t, filepath.Join(opts.AuthRecordCacheDir, ManagedIdentityCacheDirName))
+}
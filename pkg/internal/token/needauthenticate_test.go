@@ -24,13 +24,19 @@ func TestNeedAuthenticate(t *testing.T) {
 		{"ADALDeviceCodeCredential", &ADALDeviceCodeCredential{}, false},
 		{"AzureCLICredential", &AzureCLICredential{}, false},
 		{"AzureDeveloperCLICredential", &AzureDeveloperCLICredential{}, false},
+		{"AuthCodeCredential", &AuthCodeCredential{}, true},
+		{"AuthCodeCredentialWithPoP", &AuthCodeCredentialWithPoP{}, false},
 		{"AzurePipelinesCredential", &AzurePipelinesCredential{}, false},
+		{"ChainCredential", &ChainCredential{}, false},
+		{"CIProviderCredential", &CIProviderCredential{}, false},
+		{"ClientAssertionCredential", &ClientAssertionCredential{}, false},
+		{"MSIFederatedCredential", &MSIFederatedCredential{}, false},
 		{"ClientCertificateCredential", &ClientCertificateCredential{}, false},
 		{"ClientCertificateCredentialWithPoP", &ClientCertificateCredentialWithPoP{}, false},
 		{"ClientSecretCredential", &ClientSecretCredential{}, false},
 		{"ClientSecretCredentialWithPoP", &ClientSecretCredentialWithPoP{}, false},
+		{"CustomBrowserCredential", &CustomBrowserCredential{}, true},
 		{"DeviceCodeCredential", &DeviceCodeCredential{}, true},
-		{"GithubActionsCredential", &GithubActionsCredential{}, false},
 		{"InteractiveBrowserCredential", &InteractiveBrowserCredential{}, true},
 		{"InteractiveBrowserCredentialWithPoP", &InteractiveBrowserCredentialWithPoP{}, false},
 		{"ManagedIdentityCredential", &ManagedIdentityCredential{}, false},
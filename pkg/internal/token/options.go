@@ -2,10 +2,11 @@ package token
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/Azure/kubelogin/pkg/internal/env"
 	"github.com/Azure/kubelogin/pkg/internal/pop"
 	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
 	msalcache "github.com/AzureAD/microsoft-authentication-library-for-go/apps/cache"
 )
 
@@ -27,42 +29,76 @@ type PoPKeyProvider interface {
 
 type Options struct {
 	LoginMethod                       string
+	LoginChain                        []string
 	ClientID                          string
 	ClientSecret                      string
 	ClientCert                        string
 	ClientCertPassword                string
+	ClientCertExpiryDays              int
+	ClientCertExpiryStrict            bool
 	Username                          string
 	Password                          string
 	ServerID                          string
 	TenantID                          string
 	SubscriptionID                    string
 	Environment                       string
+	EnvironmentFile                   string
+	EnvironmentMetadataURL            string
 	IsLegacy                          bool
 	Timeout                           time.Duration
 	AuthRecordCacheDir                string
-	authRecordCacheFile               string
+	IdentityClientID                  string
+	IdentityObjectID                  string
 	IdentityResourceID                string
+	IdentityEndpoint                  string
 	FederatedTokenFile                string
 	AuthorityHost                     string
 	UseAzureRMTerraformEnv            bool
 	IsPoPTokenEnabled                 bool
 	PoPTokenClaims                    string
+	PoPCacheKey                       string
+	PoPCachePassphrase                string
 	DisableEnvironmentOverride        bool
+	FlagsOverrideEnvironment          bool
 	UsePersistentCache                bool
 	DisableInstanceDiscovery          bool
 	httpClient                        *http.Client
 	RedirectURL                       string
 	LoginHint                         string
+	BrowserCommand                    string
+	InteractiveFallback               string
+	DeviceCodeQR                      bool
+	EventsFD                          int
+	EventsFile                        string
 	AzurePipelinesServiceConnectionID string
+	ClientAssertionCommand            string
+	ClientAssertionFile               string
+	ClientAssertionAudience           string
+	DisableTokenCache                 bool
+	TokenCacheRefreshMargin           time.Duration
+	Profile                           string
+	Claims                            string
+	EnableCAE                         bool
+	// changedFlags are the names of the flags explicitly set on the command line
+	changedFlags []string
+	// customCloud is the cloud loaded from EnvironmentFile or EnvironmentMetadataURL by Validate
+	customCloud *cloud.Configuration
+	// isNonInteractive is set when kubectl reports the session cannot prompt the user
+	isNonInteractive bool
 	// Private field to store the PoP token cache, set during initialization. Stores MSAL tokens for token caching
 	popTokenCache *popcache.Cache
+	// popCacheEncryptionKey encrypts the token caches and PoP key in files when secure storage is unavailable
+	popCacheEncryptionKey []byte
 }
 
 const (
-	defaultEnvironmentName = "AzurePublicCloud"
+	defaultEnvironmentName         = "AzurePublicCloud"
+	defaultTokenCacheRefreshMargin = 5 * time.Minute
+	defaultClientCertExpiryDays    = 30
 
 	DeviceCodeLogin        = "devicecode"
 	InteractiveLogin       = "interactive"
+	AuthCodeLogin          = "authcode"
 	ServicePrincipalLogin  = "spn"
 	ROPCLogin              = "ropc"
 	MSILogin               = "msi"
@@ -70,6 +106,9 @@ const (
 	AzureDeveloperCLILogin = "azd"
 	WorkloadIdentityLogin  = "workloadidentity"
 	AzurePipelinesLogin    = "azurepipelines"
+	ClientAssertionLogin   = "clientassertion"
+	MSIFederatedLogin      = "msifederated"
+	AutoLogin              = "auto"
 )
 
 var (
@@ -78,7 +117,7 @@ var (
 )
 
 func init() {
-	supportedLogin = []string{DeviceCodeLogin, InteractiveLogin, ServicePrincipalLogin, ROPCLogin, MSILogin, AzureCLILogin, AzureDeveloperCLILogin, WorkloadIdentityLogin, AzurePipelinesLogin}
+	supportedLogin = []string{DeviceCodeLogin, InteractiveLogin, AuthCodeLogin, ServicePrincipalLogin, ROPCLogin, MSILogin, AzureCLILogin, AzureDeveloperCLILogin, WorkloadIdentityLogin, AzurePipelinesLogin, ClientAssertionLogin, MSIFederatedLogin, AutoLogin}
 }
 
 func GetSupportedLogins() string {
@@ -86,36 +125,50 @@ func GetSupportedLogins() string {
 }
 
 func NewOptions(usePersistentCache bool) Options {
-	envAuthRecordCacheDir := os.Getenv("KUBECACHEDIR")
 	return Options{
-		LoginMethod: DeviceCodeLogin,
-		Environment: defaultEnvironmentName,
-		AuthRecordCacheDir: func() string {
-			if envAuthRecordCacheDir != "" {
-				return envAuthRecordCacheDir
-			}
-			return DefaultAuthRecordCacheDir
-		}(),
+		LoginMethod:        DeviceCodeLogin,
+		Environment:        defaultEnvironmentName,
+		AuthRecordCacheDir: GetDefaultCacheDir(),
 		UsePersistentCache: usePersistentCache,
 	}
 }
 
+// GetDefaultCacheDir returns the cache directory used without --cache-dir, which is
+// KUBECACHEDIR when it is set
+func GetDefaultCacheDir() string {
+	if dir := os.Getenv("KUBECACHEDIR"); dir != "" {
+		return dir
+	}
+	return DefaultAuthRecordCacheDir
+}
+
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVarP(&o.LoginMethod, "login", "l", o.LoginMethod,
 		fmt.Sprintf("Login method. Supported methods: %s. It may be specified in %s environment variable", GetSupportedLogins(), env.LoginMethod))
+	fs.StringSliceVar(&o.LoginChain, "login-chain", o.LoginChain,
+		fmt.Sprintf("Comma-separated login methods tried in order by %s login, e.g. workloadidentity,msi,azurecli. Defaults to the login methods detected from the environment", AutoLogin))
 	fs.StringVar(&o.ClientID, "client-id", o.ClientID,
 		fmt.Sprintf("AAD client application ID. It may be specified in %s or %s environment variable. For Azure Pipelines login, it may be specified in %s environment variable", env.KubeloginClientID, env.AzureClientID, env.AzureSubscriptionClientID))
 	fs.StringVar(&o.ClientSecret, "client-secret", o.ClientSecret,
-		fmt.Sprintf("AAD client application secret. Used in spn login. It may be specified in %s or %s environment variable", env.KubeloginClientSecret, env.AzureClientSecret))
+		fmt.Sprintf("AAD client application secret. Used in spn login. It may be specified in %s or %s environment variable. It may be a reference: env:NAME, file:/path or keyring:name", env.KubeloginClientSecret, env.AzureClientSecret))
 	fs.StringVar(&o.ClientCert, "client-certificate", o.ClientCert,
-		fmt.Sprintf("AAD client cert in pfx or PEM. Used in spn login. It may be specified in %s or %s environment variable", env.KubeloginClientCertificatePath, env.AzureClientCertificatePath))
+		fmt.Sprintf("AAD client cert in pfx or PEM, detected from its content. Used in spn login. It may be specified in %s or %s environment variable, or as base64 content in %s environment variable. Use - to read it from stdin, or env:NAME to read its base64 content from an environment variable", env.KubeloginClientCertificatePath, env.AzureClientCertificatePath, env.AzureClientCertificate))
 	fs.StringVar(&o.ClientCertPassword, "client-certificate-password", o.ClientCertPassword,
-		fmt.Sprintf("Password for AAD client cert. Used in spn login. It may be specified in %s or %s environment variable. Only used for PFX encoded certs.", env.KubeloginClientCertificatePassword, env.AzureClientCertificatePassword))
+		fmt.Sprintf("Password for AAD client cert. Used in spn login. It may be specified in %s or %s environment variable. Only used for PFX encoded certs and PEM files with an encrypted PKCS#8 private key. It may be a reference: env:NAME, file:/path or keyring:name", env.KubeloginClientCertificatePassword, env.AzureClientCertificatePassword))
+	fs.IntVar(&o.ClientCertExpiryDays, "client-certificate-expiry-days", defaultClientCertExpiryDays,
+		"Log a warning when the client certificate expires within this number of days. 0 disables the warning")
+	fs.BoolVar(&o.ClientCertExpiryStrict, "client-certificate-expiry-strict", o.ClientCertExpiryStrict,
+		fmt.Sprintf("set to true to fail with exit status %d instead of logging a warning when the client certificate expires within --client-certificate-expiry-days. Default false", ExitCodeCertificateExpiry))
 	fs.StringVar(&o.Username, "username", o.Username,
 		fmt.Sprintf("user name for ropc login flow. It may be specified in %s or %s environment variable", env.KubeloginROPCUsername, env.AzureUsername))
 	fs.StringVar(&o.Password, "password", o.Password,
-		fmt.Sprintf("password for ropc login flow. It may be specified in %s or %s environment variable", env.KubeloginROPCPassword, env.AzurePassword))
+		fmt.Sprintf("password for ropc login flow. It may be specified in %s or %s environment variable. It may be a reference: env:NAME, file:/path or keyring:name", env.KubeloginROPCPassword, env.AzurePassword))
 	fs.StringVar(&o.IdentityResourceID, "identity-resource-id", o.IdentityResourceID, "Managed Identity resource id.")
+	fs.StringVar(&o.IdentityClientID, "identity-client-id", o.IdentityClientID,
+		fmt.Sprintf("Managed Identity client id used by %s login, as --client-id is the application the managed identity token is exchanged for. Defaults to the system-assigned identity", MSIFederatedLogin))
+	fs.StringVar(&o.IdentityObjectID, "identity-object-id", o.IdentityObjectID, "Managed Identity object id.")
+	fs.StringVar(&o.IdentityEndpoint, "identity-endpoint", o.IdentityEndpoint,
+		fmt.Sprintf("Managed Identity token endpoint used by %s and %s login instead of IMDS, e.g. a local proxy. App Service, Cloud Shell and Arc endpoints are read from %s, %s and %s environment variables. It may be specified in %s environment variable", MSILogin, MSIFederatedLogin, env.IdentityEndpoint, env.MSIEndpoint, env.IMDSEndpoint, env.KubeloginIdentityEndpoint))
 	fs.StringVar(&o.ServerID, "server-id", o.ServerID, "AAD server application ID")
 	fs.StringVar(&o.FederatedTokenFile, "federated-token-file", o.FederatedTokenFile,
 		fmt.Sprintf("Workload Identity federated token file. It may be specified in %s environment variable", env.AzureFederatedTokenFile))
@@ -123,12 +176,23 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 		fmt.Sprintf("Workload Identity authority host. It may be specified in %s environment variable", env.AzureAuthorityHost))
 	fs.StringVar(&o.AzurePipelinesServiceConnectionID, "azure-pipelines-service-connection-id", o.AzurePipelinesServiceConnectionID,
 		fmt.Sprintf("Service connection (resource) ID used by azurepipelines login method. It may be specified in %s environment variable", env.AzureSubscriptionServiceConnectionID))
+	fs.StringVar(&o.ClientAssertionCommand, "client-assertion-command", o.ClientAssertionCommand,
+		fmt.Sprintf("Command printing the client assertion used by %s login, e.g. a JWT issued by a secret store. The audience is passed in %s environment variable. Its assertion is cached until it expires. It may be specified in %s environment variable", ClientAssertionLogin, env.KubeloginClientAssertionAudience, env.KubeloginClientAssertionCommand))
+	fs.StringVar(&o.ClientAssertionFile, "client-assertion-file", o.ClientAssertionFile,
+		fmt.Sprintf("File holding the client assertion used by %s login, read each time a token is requested. It may be specified in %s environment variable", ClientAssertionLogin, env.KubeloginClientAssertionFile))
+	fs.StringVar(&o.ClientAssertionAudience, "client-assertion-audience", o.ClientAssertionAudience,
+		fmt.Sprintf("Audience the client assertion of %s login must be issued for, also requested for the OIDC token of GitHub Actions and Buildkite and the JWT-SVID of the SPIFFE Workload API by %s login, and for the managed identity token by %s login. Defaults to %s. It may be specified in %s environment variable", ClientAssertionLogin, WorkloadIdentityLogin, MSIFederatedLogin, azureADAudience, env.KubeloginClientAssertionAudience))
 	fs.StringVar(&o.AuthRecordCacheDir, "token-cache-dir", o.AuthRecordCacheDir, "directory to cache authentication record")
 	_ = fs.MarkDeprecated("token-cache-dir", "use --cache-dir instead")
 	fs.StringVar(&o.AuthRecordCacheDir, "cache-dir", o.AuthRecordCacheDir, "directory to cache authentication record")
 	fs.StringVarP(&o.TenantID, "tenant-id", "t", o.TenantID, fmt.Sprintf("AAD tenant ID. It may be specified in %s environment variable. For Azure Pipelines login, it may be specified in %s environment variable", env.AzureTenantID, env.AzureSubscriptionTenantID))
 	fs.StringVarP(&o.SubscriptionID, "subscription", "s", o.SubscriptionID, "Azure subscription ID or name. Used in azurecli login method")
-	fs.StringVarP(&o.Environment, "environment", "e", o.Environment, "Azure environment name")
+	fs.StringVarP(&o.Environment, "environment", "e", o.Environment,
+		"Azure environment name: AzurePublicCloud, AzureUSGovernmentCloud or AzureChinaCloud. Any name is accepted with --environment-file or --environment-metadata-url, and selects the cloud when the metadata lists several")
+	fs.StringVar(&o.EnvironmentFile, "environment-file", o.EnvironmentFile,
+		fmt.Sprintf("Path to a JSON file with the ARM metadata of a custom cloud such as Azure Stack Hub. It may be specified in %s environment variable", env.AzureEnvironmentFilepath))
+	fs.StringVar(&o.EnvironmentMetadataURL, "environment-metadata-url", o.EnvironmentMetadataURL,
+		"ARM metadata endpoint of a custom cloud, e.g. https://management.local.azurestack.external/metadata/endpoints?api-version=2015-01-01")
 	fs.BoolVar(&o.IsLegacy, "legacy", o.IsLegacy, "set to true to get token with 'spn:' prefix in audience claim")
 	fs.BoolVar(&o.UseAzureRMTerraformEnv, "use-azurerm-env-vars", o.UseAzureRMTerraformEnv,
 		"Use environment variable names of Terraform Azure Provider (ARM_CLIENT_ID, ARM_CLIENT_SECRET, ARM_CLIENT_CERTIFICATE_PATH, ARM_CLIENT_CERTIFICATE_PASSWORD, ARM_TENANT_ID)")
@@ -136,10 +200,31 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.DurationVar(&o.Timeout, "timeout", 60*time.Second,
 		fmt.Sprintf("Timeout duration for Azure CLI token requests. It may be specified in %s environment variable", "AZURE_CLI_TIMEOUT"))
 	fs.StringVar(&o.PoPTokenClaims, "pop-claims", o.PoPTokenClaims, "contains a comma-separated list of claims to attach to the pop token in the format `key=val,key2=val2`. At minimum, specify the ARM ID of the cluster as `u=ARM_ID`")
+	fs.StringVar(&o.PoPCacheKey, "pop-cache-key", o.PoPCacheKey,
+		fmt.Sprintf("Base64-encoded 32-byte key, e.g. generated with 'openssl rand -base64 32', encrypting the token caches and PoP key in files of the cache directory when secure storage is unavailable, e.g. in containers. It may be a reference: env:NAME or file:/path. It may be specified in %s environment variable", env.KubeloginPoPCacheKey))
+	fs.StringVar(&o.PoPCachePassphrase, "pop-cache-passphrase", o.PoPCachePassphrase,
+		fmt.Sprintf("Passphrase the key encrypting the token caches and PoP key is derived from, instead of --pop-cache-key. Deriving the key takes a noticeable time on every invocation, so prefer --pop-cache-key for scripted use. It may be a reference: env:NAME or file:/path. It may be specified in %s environment variable", env.KubeloginPoPCachePassphrase))
 	fs.BoolVar(&o.DisableEnvironmentOverride, "disable-environment-override", o.DisableEnvironmentOverride, "Enable or disable the use of env-variables. Default false")
+	fs.BoolVar(&o.FlagsOverrideEnvironment, "flags-override-environment", o.FlagsOverrideEnvironment, "set to true to keep the value of a flag set on the command line when an environment variable for the same option is set. Default false")
 	fs.BoolVar(&o.DisableInstanceDiscovery, "disable-instance-discovery", o.DisableInstanceDiscovery, "set to true to disable instance discovery in environments with their own simple Identity Provider (not AAD) that do not have instance metadata discovery endpoint. Default false")
-	fs.StringVar(&o.RedirectURL, "redirect-url", o.RedirectURL, "The URL Microsoft Entra ID will redirect to with the access token. This is only used for interactive login. This is an optional parameter.")
-	fs.StringVar(&o.LoginHint, "login-hint", o.LoginHint, "The login hint to pre-fill the username in the interactive login flow.")
+	fs.StringVar(&o.RedirectURL, "redirect-url", o.RedirectURL, "The URL Microsoft Entra ID will redirect to with the access token. This is only used for interactive and authcode login. This is an optional parameter.")
+	fs.StringVar(&o.LoginHint, "login-hint", o.LoginHint, "The login hint to pre-fill the username in the interactive login flow and to pick the account among the cached authentication records.")
+	fs.StringVar(&o.BrowserCommand, "browser-command", o.BrowserCommand,
+		"Command that opens the sign-in URL of interactive login instead of the system browser, e.g. wslview. Its arguments are split like a shell, without running one, so paths with spaces must be quoted. The URL is appended to its arguments")
+	fs.StringVar(&o.InteractiveFallback, "interactive-fallback", o.InteractiveFallback,
+		fmt.Sprintf("Login method used by interactive login when no browser can be launched. Supported value: %s", DeviceCodeLogin))
+	fs.BoolVar(&o.DeviceCodeQR, "device-code-qr", o.DeviceCodeQR, "set to true to also show the verification URL of device code login as a QR code in the terminal. Default false")
+	fs.IntVar(&o.EventsFD, "events-fd", o.EventsFD,
+		"File descriptor, inherited from the parent process, to which JSON events such as the device code of device code login are written, one per line")
+	fs.StringVar(&o.EventsFile, "events-file", o.EventsFile,
+		fmt.Sprintf("File to which JSON events such as the device code of device code login are appended, one per line. It may be specified in %s environment variable", env.KubeloginEventsFile))
+	fs.BoolVar(&o.DisableTokenCache, "disable-token-cache", o.DisableTokenCache, "set to true to always acquire a new token instead of reusing the token cached by a previous get-token invocation. Default false")
+	fs.DurationVar(&o.TokenCacheRefreshMargin, "token-cache-refresh-margin", defaultTokenCacheRefreshMargin, "A cached token is not reused once it expires within this duration")
+	fs.StringVar(&o.Claims, "claims", o.Claims,
+		fmt.Sprintf("Claims challenge returned by Conditional Access or Continuous Access Evaluation, as JSON or base64. The token is requested with the claims instead of reusing a cached one. It may be specified in %s environment variable", env.KubeloginClaims))
+	fs.BoolVar(&o.EnableCAE, "enable-cae", o.EnableCAE, "set to true to declare the cp1 client capability so that Microsoft Entra ID issues Continuous Access Evaluation tokens. Default false")
+	fs.StringVar(&o.Profile, "profile", o.Profile,
+		fmt.Sprintf("Name of the profile in the kubelogin config file to use. Without it, the profile whose server-id matches the server-id of the cluster (provideClusterInfo) or --server-id is used. The config file is ~/.kube/kubelogin/config.yaml unless specified in %s environment variable", env.KubeloginConfig))
 }
 
 func (o *Options) Validate() error {
@@ -154,6 +239,26 @@ func (o *Options) Validate() error {
 		return fmt.Errorf("'%s' is not a supported login method. Supported method is one of %s", o.LoginMethod, GetSupportedLogins())
 	}
 
+	if len(o.LoginChain) > 0 {
+		if o.LoginMethod != AutoLogin {
+			return fmt.Errorf("login chain requires %s login", AutoLogin)
+		}
+		for _, login := range o.LoginChain {
+			if login == AutoLogin || !slices.Contains(supportedLogin, login) {
+				return fmt.Errorf("'%s' is not a supported login method in the login chain", login)
+			}
+		}
+	}
+
+	if o.EnvironmentFile == "" && o.EnvironmentMetadataURL == "" && o.Environment != "" {
+		if _, ok := knownClouds[strings.ToUpper(o.Environment)]; !ok {
+			return fmt.Errorf("'%s' is not a supported environment. Supported environments are AzurePublicCloud, AzureUSGovernmentCloud and AzureChinaCloud. Use --environment-file or --environment-metadata-url for a custom cloud", o.Environment)
+		}
+	}
+	if err := o.loadCustomCloud(); err != nil {
+		return err
+	}
+
 	if o.AuthorityHost != "" {
 		u, err := url.ParseRequestURI(o.AuthorityHost)
 		if err != nil {
@@ -176,117 +281,316 @@ func (o *Options) Validate() error {
 		return fmt.Errorf("pop-enabled flag is required to use the PoP token feature. Please provide both pop-enabled and pop-claims flags")
 	}
 
+	if o.PoPCacheKey != "" && o.PoPCachePassphrase != "" {
+		return fmt.Errorf("pop cache key and passphrase cannot be used together")
+	}
+
+	if o.Claims != "" {
+		claims, err := parseClaims(o.Claims)
+		if err != nil {
+			return err
+		}
+		o.Claims = claims
+	}
+
+	if (o.Claims != "" || o.EnableCAE) && (o.IsPoPTokenEnabled || o.IsLegacy) {
+		return fmt.Errorf("claims and enable-cae are not supported with PoP tokens or legacy mode")
+	}
+
+	if o.InteractiveFallback != "" && o.InteractiveFallback != DeviceCodeLogin {
+		return fmt.Errorf("'%s' is not a supported interactive fallback. Supported value is %s", o.InteractiveFallback, DeviceCodeLogin)
+	}
+
+	if o.ClientAssertionCommand != "" && o.ClientAssertionFile != "" {
+		return fmt.Errorf("client assertion command and file cannot be used together")
+	}
+
+	identityIDs := 0
+	for _, id := range []string{o.IdentityClientID, o.IdentityObjectID, o.IdentityResourceID} {
+		if id != "" {
+			identityIDs++
+		}
+	}
+	if identityIDs > 1 {
+		return fmt.Errorf("identity client ID, object ID and resource ID cannot be used together")
+	}
+
+	if o.IdentityEndpoint != "" {
+		u, err := url.ParseRequestURI(o.IdentityEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("identity endpoint %q is not valid", o.IdentityEndpoint)
+		}
+	}
+
+	if o.EventsFD < 0 {
+		return fmt.Errorf("events fd must not be negative")
+	}
+
+	if o.EventsFD == 1 {
+		return fmt.Errorf("events cannot be written to stdout, which carries the exec credential")
+	}
+
 	if o.Timeout <= 0 {
 		return fmt.Errorf("timeout must be greater than 0")
 	}
 
+	if o.ClientCertExpiryDays < 0 {
+		return fmt.Errorf("client certificate expiry days must not be negative")
+	}
+
+	if o.TokenCacheRefreshMargin < 0 {
+		return fmt.Errorf("token cache refresh margin must not be negative")
+	}
+
 	return nil
 }
 
 func (o *Options) UpdateFromEnv() {
-	o.authRecordCacheFile = getAuthenticationRecordFileName(o)
+	o.updateFromEnv(os.LookupEnv)
+}
+
+// EnvOverrides returns the names of the environment variables UpdateFromEnv would
+// apply to the options when looking them up with lookupEnv. The options are not modified.
+func (o *Options) EnvOverrides(lookupEnv func(string) (string, bool)) []string {
+	c := *o
+	var names []string
+	for _, e := range c.updateFromEnv(lookupEnv) {
+		if !slices.Contains(names, e.name) {
+			names = append(names, e.name)
+		}
+	}
+	return names
+}
 
+// envOverride is an environment variable applied to the option of a flag
+type envOverride struct {
+	flag string
+	name string
+}
+
+// updateFromEnv applies the environment variables found by lookupEnv and returns them in the order applied
+func (o *Options) updateFromEnv(lookupEnv func(string) (string, bool)) []envOverride {
 	if o.DisableEnvironmentOverride {
-		return
+		return nil
+	}
+
+	var applied []envOverride
+	lookup := func(flag, name string) (string, bool) {
+		if o.FlagsOverrideEnvironment && slices.Contains(o.changedFlags, flag) {
+			return "", false
+		}
+		v, ok := lookupEnv(name)
+		if ok {
+			applied = append(applied, envOverride{flag: flag, name: name})
+		}
+		return v, ok
 	}
 
 	if o.UseAzureRMTerraformEnv {
-		if v, ok := os.LookupEnv(env.TerraformClientID); ok {
+		if v, ok := lookup("client-id", env.TerraformClientID); ok {
 			o.ClientID = v
 		}
-		if v, ok := os.LookupEnv(env.TerraformClientSecret); ok {
+		if v, ok := lookup("client-secret", env.TerraformClientSecret); ok {
 			o.ClientSecret = v
 		}
-		if v, ok := os.LookupEnv(env.TerraformClientCertificatePath); ok {
+		if v, ok := lookup("client-certificate", env.TerraformClientCertificatePath); ok {
 			o.ClientCert = v
 		}
-		if v, ok := os.LookupEnv(env.TerraformClientCertificatePassword); ok {
+		if v, ok := lookup("client-certificate-password", env.TerraformClientCertificatePassword); ok {
 			o.ClientCertPassword = v
 		}
-		if v, ok := os.LookupEnv(env.TerraformTenantID); ok {
+		if v, ok := lookup("tenant-id", env.TerraformTenantID); ok {
 			o.TenantID = v
 		}
 	} else {
-		if v, ok := os.LookupEnv(env.KubeloginClientID); ok {
+		if v, ok := lookup("client-id", env.KubeloginClientID); ok {
 			o.ClientID = v
 		}
-		if v, ok := os.LookupEnv(env.AzureClientID); ok {
+		if v, ok := lookup("client-id", env.AzureClientID); ok {
 			o.ClientID = v
 		}
-		if v, ok := os.LookupEnv(env.KubeloginClientSecret); ok {
+		if v, ok := lookup("client-secret", env.KubeloginClientSecret); ok {
 			o.ClientSecret = v
 		}
-		if v, ok := os.LookupEnv(env.AzureClientSecret); ok {
+		if v, ok := lookup("client-secret", env.AzureClientSecret); ok {
 			o.ClientSecret = v
 		}
-		if v, ok := os.LookupEnv(env.KubeloginClientCertificatePath); ok {
+		if _, ok := lookup("client-certificate", env.AzureClientCertificate); ok {
+			o.ClientCert = SecretRefEnvPrefix + env.AzureClientCertificate
+		}
+		if v, ok := lookup("client-certificate", env.KubeloginClientCertificatePath); ok {
 			o.ClientCert = v
 		}
-		if v, ok := os.LookupEnv(env.AzureClientCertificatePath); ok {
+		if v, ok := lookup("client-certificate", env.AzureClientCertificatePath); ok {
 			o.ClientCert = v
 		}
-		if v, ok := os.LookupEnv(env.KubeloginClientCertificatePassword); ok {
+		if v, ok := lookup("client-certificate-password", env.KubeloginClientCertificatePassword); ok {
 			o.ClientCertPassword = v
 		}
-		if v, ok := os.LookupEnv(env.AzureClientCertificatePassword); ok {
+		if v, ok := lookup("client-certificate-password", env.AzureClientCertificatePassword); ok {
 			o.ClientCertPassword = v
 		}
-		if v, ok := os.LookupEnv(env.AzureTenantID); ok {
+		if v, ok := lookup("tenant-id", env.AzureTenantID); ok {
 			o.TenantID = v
 		}
 	}
 
-	if v, ok := os.LookupEnv(env.KubeloginROPCUsername); ok {
+	if v, ok := lookup("username", env.KubeloginROPCUsername); ok {
 		o.Username = v
 	}
-	if v, ok := os.LookupEnv(env.AzureUsername); ok {
+	if v, ok := lookup("username", env.AzureUsername); ok {
 		o.Username = v
 	}
-	if v, ok := os.LookupEnv(env.KubeloginROPCPassword); ok {
+	if v, ok := lookup("password", env.KubeloginROPCPassword); ok {
 		o.Password = v
 	}
-	if v, ok := os.LookupEnv(env.AzurePassword); ok {
+	if v, ok := lookup("password", env.AzurePassword); ok {
 		o.Password = v
 	}
-	if v, ok := os.LookupEnv(env.LoginMethod); ok {
+	if v, ok := lookup("login", env.LoginMethod); ok {
 		o.LoginMethod = v
 	}
 
 	if o.LoginMethod == WorkloadIdentityLogin {
-		if v, ok := os.LookupEnv(env.AzureClientID); ok {
+		if v, ok := lookup("client-id", env.AzureClientID); ok {
 			o.ClientID = v
 		}
-		if v, ok := os.LookupEnv(env.AzureFederatedTokenFile); ok {
+		if v, ok := lookup("federated-token-file", env.AzureFederatedTokenFile); ok {
 			o.FederatedTokenFile = v
 		}
-		if v, ok := os.LookupEnv(env.AzureAuthorityHost); ok {
+		if v, ok := lookup("authority-host", env.AzureAuthorityHost); ok {
 			o.AuthorityHost = v
 		}
 	}
 
 	if o.LoginMethod == AzurePipelinesLogin {
 		if o.ClientID == "" {
-			if v, ok := os.LookupEnv(env.AzureSubscriptionClientID); ok {
+			if v, ok := lookup("client-id", env.AzureSubscriptionClientID); ok {
 				o.ClientID = v
 			}
 		}
 		if o.TenantID == "" {
-			if v, ok := os.LookupEnv(env.AzureSubscriptionTenantID); ok {
+			if v, ok := lookup("tenant-id", env.AzureSubscriptionTenantID); ok {
 				o.TenantID = v
 			}
 		}
 		if o.AzurePipelinesServiceConnectionID == "" {
-			if v, ok := os.LookupEnv(env.AzureSubscriptionServiceConnectionID); ok {
+			if v, ok := lookup("azure-pipelines-service-connection-id", env.AzureSubscriptionServiceConnectionID); ok {
 				o.AzurePipelinesServiceConnectionID = v
 			}
 		}
 	}
 
-	if v, ok := os.LookupEnv("AZURE_CLI_TIMEOUT"); ok {
+	if o.LoginMethod == ClientAssertionLogin {
+		if v, ok := lookup("client-assertion-command", env.KubeloginClientAssertionCommand); ok {
+			o.ClientAssertionCommand = v
+		}
+		if v, ok := lookup("client-assertion-file", env.KubeloginClientAssertionFile); ok {
+			o.ClientAssertionFile = v
+		}
+	}
+
+	if o.LoginMethod == MSILogin || o.LoginMethod == MSIFederatedLogin {
+		if v, ok := lookup("identity-endpoint", env.KubeloginIdentityEndpoint); ok {
+			o.IdentityEndpoint = v
+		}
+	}
+
+	if o.LoginMethod == ClientAssertionLogin || o.LoginMethod == WorkloadIdentityLogin || o.LoginMethod == MSIFederatedLogin {
+		if v, ok := lookup("client-assertion-audience", env.KubeloginClientAssertionAudience); ok {
+			o.ClientAssertionAudience = v
+		}
+	}
+
+	// the key and passphrase are referred to, so that they are not shown with the options
+	if _, ok := lookup("pop-cache-key", env.KubeloginPoPCacheKey); ok {
+		o.PoPCacheKey = SecretRefEnvPrefix + env.KubeloginPoPCacheKey
+	}
+	if _, ok := lookup("pop-cache-passphrase", env.KubeloginPoPCachePassphrase); ok {
+		o.PoPCachePassphrase = SecretRefEnvPrefix + env.KubeloginPoPCachePassphrase
+	}
+
+	if v, ok := lookup("claims", env.KubeloginClaims); ok {
+		o.Claims = v
+	}
+
+	if v, ok := lookup("events-file", env.KubeloginEventsFile); ok {
+		o.EventsFile = v
+	}
+
+	if v, ok := lookup("environment-file", env.AzureEnvironmentFilepath); ok {
+		o.EnvironmentFile = v
+	}
+
+	if v, ok := lookup("timeout", "AZURE_CLI_TIMEOUT"); ok {
 		if timeout, err := time.ParseDuration(v); err == nil {
 			o.Timeout = timeout
 		}
 	}
+
+	return applied
+}
+
+// NewOptionsFromExecArgs parses the get-token args of a kubeconfig exec plugin.
+// Flags unknown to this version of kubelogin are ignored.
+func NewOptionsFromExecArgs(args []string) (Options, error) {
+	if len(args) > 0 && args[0] == "get-token" {
+		args = args[1:]
+	}
+	o := NewOptions(true)
+	fs := pflag.NewFlagSet("get-token", pflag.ContinueOnError)
+	fs.ParseErrorsWhitelist.UnknownFlags = true
+	fs.SetOutput(io.Discard)
+	o.AddFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return o, err
+	}
+	o.SetChangedFlags(fs)
+	return o, nil
+}
+
+// SetChangedFlags records the flags explicitly set in fs. With FlagsOverrideEnvironment,
+// environment variables are not applied to the options of these flags.
+func (o *Options) SetChangedFlags(fs *pflag.FlagSet) {
+	o.changedFlags = nil
+	fs.Visit(func(f *pflag.Flag) {
+		o.changedFlags = append(o.changedFlags, f.Name)
+	})
+}
+
+// UpdateFromExecInfo applies the session and cluster information kubectl passes in
+// KUBERNETES_EXEC_INFO. Values from the cluster's exec extension take precedence
+// over flags so that a single kubeconfig user can serve many clusters.
+func (o *Options) UpdateFromExecInfo() error {
+	info, err := getExecInfoFromEnv()
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return nil
+	}
+
+	o.isNonInteractive = !info.interactive
+	o.UpdateFromExecClusterConfig(info.clusterConfig)
+	return nil
+}
+
+// UpdateFromExecClusterConfig applies the settings of the cluster's exec extension.
+// Values that are set take precedence over flags.
+func (o *Options) UpdateFromExecClusterConfig(c *ExecClusterConfig) {
+	if c == nil {
+		return
+	}
+	if c.ServerID != "" {
+		o.ServerID = c.ServerID
+	}
+	if c.TenantID != "" {
+		o.TenantID = c.TenantID
+	}
+	if c.PoPTokenClaims != "" {
+		o.IsPoPTokenEnabled = true
+		o.PoPTokenClaims = c.PoPTokenClaims
+	}
 }
 
 func (o *Options) GetCloudConfiguration() cloud.Configuration {
@@ -295,20 +599,11 @@ func (o *Options) GetCloudConfiguration() cloud.Configuration {
 			ActiveDirectoryAuthorityHost: o.AuthorityHost,
 		}
 	}
-
-	switch strings.ToUpper(o.Environment) {
-	case "AZURECLOUD":
-		fallthrough
-	case "AZUREPUBLIC":
-		fallthrough
-	case "AZUREPUBLICCLOUD":
-		return cloud.AzurePublic
-	case "AZUREUSGOVERNMENT":
-		fallthrough
-	case "AZUREUSGOVERNMENTCLOUD":
-		return cloud.AzureGovernment
-	case "AZURECHINACLOUD":
-		return cloud.AzureChina
+	if o.customCloud != nil {
+		return *o.customCloud
+	}
+	if c, ok := knownClouds[strings.ToUpper(o.Environment)]; ok {
+		return c
 	}
 	return cloud.AzurePublic
 }
@@ -318,28 +613,47 @@ func (o *Options) ToString() string {
 
 	parts := []string{
 		fmt.Sprintf("Login Method: %s", o.LoginMethod),
+		fmt.Sprintf("Login Chain: %s", strings.Join(o.LoginChain, ",")),
 		fmt.Sprintf("Environment: %s", o.Environment),
+		fmt.Sprintf("EnvironmentFile: %s", o.EnvironmentFile),
+		fmt.Sprintf("EnvironmentMetadataURL: %s", o.EnvironmentMetadataURL),
 		fmt.Sprintf("TenantID: %s", o.TenantID),
 		fmt.Sprintf("SubscriptionID: %s", o.SubscriptionID),
 		fmt.Sprintf("ServerID: %s", o.ServerID),
 		fmt.Sprintf("ClientID: %s", o.ClientID),
+		fmt.Sprintf("ClientCertExpiryDays: %d", o.ClientCertExpiryDays),
+		fmt.Sprintf("ClientCertExpiryStrict: %t", o.ClientCertExpiryStrict),
+		fmt.Sprintf("ClientAssertionCommand: %s", o.ClientAssertionCommand),
+		fmt.Sprintf("ClientAssertionFile: %s", o.ClientAssertionFile),
+		fmt.Sprintf("ClientAssertionAudience: %s", o.ClientAssertionAudience),
 		fmt.Sprintf("IsLegacy: %t", o.IsLegacy),
+		fmt.Sprintf("msiClientID: %s", o.IdentityClientID),
+		fmt.Sprintf("msiObjectID: %s", o.IdentityObjectID),
 		fmt.Sprintf("msiResourceID: %s", o.IdentityResourceID),
+		fmt.Sprintf("msiEndpoint: %s", o.IdentityEndpoint),
 		fmt.Sprintf("Timeout: %v", o.Timeout),
 		fmt.Sprintf("authRecordCacheDir: %s", o.AuthRecordCacheDir),
-		fmt.Sprintf("tokenauthRecordFile: %s", o.authRecordCacheFile),
+		fmt.Sprintf("tokenauthRecordFile: %s", getAuthenticationRecordFileName(o)),
 		fmt.Sprintf("AZURE_CONFIG_DIR: %s", azureConfigDir),
 		fmt.Sprintf("RedirectURL: %s", o.RedirectURL),
 		fmt.Sprintf("LoginHint: %s", o.LoginHint),
+		fmt.Sprintf("BrowserCommand: %s", o.BrowserCommand),
+		fmt.Sprintf("InteractiveFallback: %s", o.InteractiveFallback),
+		fmt.Sprintf("DeviceCodeQR: %t", o.DeviceCodeQR),
+		fmt.Sprintf("EventsFD: %d", o.EventsFD),
+		fmt.Sprintf("EventsFile: %s", o.EventsFile),
+		fmt.Sprintf("DisableTokenCache: %t", o.DisableTokenCache),
+		fmt.Sprintf("TokenCacheRefreshMargin: %v", o.TokenCacheRefreshMargin),
+		fmt.Sprintf("FlagsOverrideEnvironment: %t", o.FlagsOverrideEnvironment),
+		fmt.Sprintf("Profile: %s", o.Profile),
+		fmt.Sprintf("Claims: %s", o.Claims),
+		fmt.Sprintf("EnableCAE: %t", o.EnableCAE),
+		fmt.Sprintf("isNonInteractive: %t", o.isNonInteractive),
 	}
 
 	return strings.Join(parts, ", ")
 }
 
-func getAuthenticationRecordFileName(o *Options) string {
-	return filepath.Join(o.AuthRecordCacheDir, "auth.json")
-}
-
 // parsePoPClaims parses the pop token claims. Pop token claims are passed in as a
 // comma-separated string in the format "key1=val1,key2=val2"
 func parsePoPClaims(popClaims string) (map[string]string, error) {
@@ -402,8 +716,48 @@ func (o *Options) setPoPTokenCache(cache *popcache.Cache) {
 // This centralizes the key provider logic.
 func (o *Options) GetPoPKeyProvider() PoPKeyProvider {
 	return &defaultPoPKeyProvider{
-		cacheDir: o.getCacheDir(),
+		cacheDir:      o.getCacheDir(),
+		encryptionKey: o.popCacheEncryptionKey,
+	}
+}
+
+// hasPoPCacheEncryption reports whether the user opted in to encrypting the token caches and
+// PoP key in files when secure storage is unavailable
+func (o *Options) hasPoPCacheEncryption() bool {
+	return o.PoPCacheKey != "" || o.PoPCachePassphrase != ""
+}
+
+// getPoPCacheEncryptionKey returns the key of --pop-cache-key, or the key derived from
+// --pop-cache-passphrase. Their secret references are resolved by ResolveSecrets.
+// The key is kept in the options, and popcache derives the key of a passphrase once per process.
+func (o *Options) getPoPCacheEncryptionKey() ([]byte, error) {
+	if o.popCacheEncryptionKey != nil {
+		return o.popCacheEncryptionKey, nil
+	}
+	if o.PoPCacheKey != "" {
+		key, err := popcache.ParseEncryptionKey(o.PoPCacheKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pop cache key: %w", err)
+		}
+		o.popCacheEncryptionKey = key
+		return key, nil
+	}
+	key, err := popcache.DeriveEncryptionKey(o.AuthRecordCacheDir, o.PoPCachePassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive the pop cache key from the passphrase: %w", err)
+	}
+	o.popCacheEncryptionKey = key
+	return key, nil
+}
+
+// newEncryptedFileAccessor creates the accessor of the file at path encrypted with the key of
+// --pop-cache-key or --pop-cache-passphrase, for when secure storage is unavailable
+func (o *Options) newEncryptedFileAccessor(path string) (accessor.Accessor, error) {
+	key, err := o.getPoPCacheEncryptionKey()
+	if err != nil {
+		return nil, err
 	}
+	return popcache.NewEncryptedFileAccessor(path, key)
 }
 
 // getCacheDir returns the cache directory path if caching is enabled, empty string otherwise
@@ -416,10 +770,11 @@ func (o *Options) getCacheDir() string {
 
 // defaultPoPKeyProvider is the default implementation of PoPKeyProvider
 type defaultPoPKeyProvider struct {
-	cacheDir string
+	cacheDir      string
+	encryptionKey []byte
 }
 
 // GetPoPKey implements PoPKeyProvider interface
 func (p *defaultPoPKeyProvider) GetPoPKey() (*pop.SwKey, error) {
-	return pop.GetPoPKeyByPolicy(p.cacheDir)
+	return pop.GetPoPKeyByPolicy(p.cacheDir, p.encryptionKey)
 }
@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/Azure/kubelogin/pkg/internal/env"
+	"github.com/Azure/kubelogin/pkg/internal/pop"
+	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
 	"github.com/Azure/kubelogin/pkg/internal/testutils"
 	"github.com/google/go-cmp/cmp"
 	"github.com/spf13/pflag"
@@ -23,9 +25,9 @@ func TestOptions(t *testing.T) {
 			t.Fatalf("option validation failed: %s", err)
 		}
 
-		dir, _ := filepath.Split(o.authRecordCacheFile)
-		if dir != DefaultAuthRecordCacheDir {
-			t.Fatalf("token cache directory is expected to be %s, got %s", DefaultAuthRecordCacheDir, dir)
+		dir, _ := filepath.Split(getAuthenticationRecordFileName(&o))
+		if want := filepath.Join(DefaultAuthRecordCacheDir, AuthRecordDirName) + string(filepath.Separator); dir != want {
+			t.Fatalf("token cache directory is expected to be %s, got %s", want, dir)
 		}
 	})
 
@@ -37,9 +39,9 @@ func TestOptions(t *testing.T) {
 		if err := o.Validate(); err != nil {
 			t.Fatalf("option validation failed: %s", err)
 		}
-		dir, _ := filepath.Split(o.authRecordCacheFile)
-		if dir != o.AuthRecordCacheDir {
-			t.Fatalf("token cache directory is expected to be %s, got %s", o.AuthRecordCacheDir, dir)
+		dir, _ := filepath.Split(getAuthenticationRecordFileName(&o))
+		if want := filepath.Join(o.AuthRecordCacheDir, AuthRecordDirName) + string(filepath.Separator); dir != want {
+			t.Fatalf("token cache directory is expected to be %s, got %s", want, dir)
 		}
 	})
 
@@ -51,6 +53,193 @@ func TestOptions(t *testing.T) {
 		}
 	})
 
+	t.Run("unsupported interactive fallback should return error", func(t *testing.T) {
+		o := defaultOptions()
+		o.InteractiveFallback = AuthCodeLogin
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "is not a supported interactive fallback") {
+			t.Fatalf("unsupported interactive fallback should return error. got: %s", err)
+		}
+		o.InteractiveFallback = DeviceCodeLogin
+		if err := o.Validate(); err != nil {
+			t.Fatalf("devicecode interactive fallback should be valid. got: %s", err)
+		}
+	})
+
+	t.Run("events fd should not be stdout", func(t *testing.T) {
+		o := defaultOptions()
+		o.EventsFD = 1
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "events cannot be written to stdout") {
+			t.Fatalf("events fd 1 should return error. got: %s", err)
+		}
+		o.EventsFD = -1
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "events fd must not be negative") {
+			t.Fatalf("negative events fd should return error. got: %s", err)
+		}
+		o.EventsFD = 3
+		if err := o.Validate(); err != nil {
+			t.Fatalf("events fd 3 should be valid. got: %s", err)
+		}
+	})
+
+	t.Run("login chain should require auto login", func(t *testing.T) {
+		o := defaultOptions()
+		o.LoginChain = []string{MSILogin}
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "login chain requires auto login") {
+			t.Fatalf("login chain without auto login should return error. got: %s", err)
+		}
+	})
+
+	t.Run("login chain should only contain supported login methods", func(t *testing.T) {
+		for _, login := range []string{"unsupported", AutoLogin} {
+			o := defaultOptions()
+			o.LoginMethod = AutoLogin
+			o.LoginChain = []string{MSILogin, login}
+			if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "is not a supported login method in the login chain") {
+				t.Fatalf("login chain with %s should return unsupported error. got: %s", login, err)
+			}
+		}
+	})
+
+	t.Run("base64 claims should be decoded", func(t *testing.T) {
+		o := defaultOptions()
+		o.Claims = "eyJhY2Nlc3NfdG9rZW4iOnsiYWNycyI6eyJlc3NlbnRpYWwiOnRydWUsInZhbHVlIjoiYzEifX19"
+		if err := o.Validate(); err != nil {
+			t.Fatalf("option validation failed: %s", err)
+		}
+		if want := `{"access_token":{"acrs":{"essential":true,"value":"c1"}}}`; o.Claims != want {
+			t.Fatalf("claims are expected to be %s, got %s", want, o.Claims)
+		}
+	})
+
+	t.Run("claims should be read from env", func(t *testing.T) {
+		t.Setenv(env.KubeloginClaims, `{"access_token":{}}`)
+		o := defaultOptions()
+		o.UpdateFromEnv()
+		if o.Claims != `{"access_token":{}}` {
+			t.Fatalf("claims are expected to be read from %s, got %q", env.KubeloginClaims, o.Claims)
+		}
+	})
+
+	t.Run("client certificate content should be read from env", func(t *testing.T) {
+		t.Setenv(env.AzureClientCertificate, "Y2VydA==")
+		o := defaultOptions()
+		o.UpdateFromEnv()
+		if want := "env:" + env.AzureClientCertificate; o.ClientCert != want {
+			t.Fatalf("client certificate is expected to be %s, got %q", want, o.ClientCert)
+		}
+
+		t.Setenv(env.AzureClientCertificatePath, "/path/to/cert.pem")
+		o = defaultOptions()
+		o.UpdateFromEnv()
+		if o.ClientCert != "/path/to/cert.pem" {
+			t.Fatalf("client certificate path is expected to take precedence over the content, got %q", o.ClientCert)
+		}
+	})
+
+	t.Run("negative client certificate expiry days should fail", func(t *testing.T) {
+		o := defaultOptions()
+		o.ClientCertExpiryDays = -1
+		if err := o.Validate(); err == nil || err.Error() != "client certificate expiry days must not be negative" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("events file should be read from env", func(t *testing.T) {
+		t.Setenv(env.KubeloginEventsFile, "/tmp/events.jsonl")
+		o := defaultOptions()
+		o.UpdateFromEnv()
+		if o.EventsFile != "/tmp/events.jsonl" {
+			t.Fatalf("events file is expected to be read from %s, got %q", env.KubeloginEventsFile, o.EventsFile)
+		}
+	})
+
+	t.Run("client assertion command and file should not be used together", func(t *testing.T) {
+		o := defaultOptions()
+		o.LoginMethod = ClientAssertionLogin
+		o.ClientAssertionCommand = "vault-jwt"
+		o.ClientAssertionFile = "/tmp/assertion.jwt"
+		if err := o.Validate(); err == nil || err.Error() != "client assertion command and file cannot be used together" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("client assertion options should be read from env for clientassertion login", func(t *testing.T) {
+		t.Setenv(env.KubeloginClientAssertionCommand, "vault-jwt --role kubelogin")
+		t.Setenv(env.KubeloginClientAssertionAudience, "api://kubelogin")
+		o := defaultOptions()
+		o.UpdateFromEnv()
+		if o.ClientAssertionCommand != "" {
+			t.Fatalf("client assertion command is expected to be ignored for %s login, got %q", o.LoginMethod, o.ClientAssertionCommand)
+		}
+		o.LoginMethod = ClientAssertionLogin
+		o.UpdateFromEnv()
+		if o.ClientAssertionCommand != "vault-jwt --role kubelogin" || o.ClientAssertionAudience != "api://kubelogin" {
+			t.Fatalf("client assertion options are expected to be read from env, got command %q and audience %q", o.ClientAssertionCommand, o.ClientAssertionAudience)
+		}
+	})
+
+	t.Run("identity client ID, object ID and resource ID should not be used together", func(t *testing.T) {
+		o := defaultOptions()
+		o.LoginMethod = MSIFederatedLogin
+		o.IdentityClientID = "msi-client-id"
+		o.IdentityResourceID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/id"
+		if err := o.Validate(); err == nil || err.Error() != "identity client ID, object ID and resource ID cannot be used together" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		o.IdentityClientID = ""
+		o.IdentityObjectID = "msi-object-id"
+		if err := o.Validate(); err == nil || err.Error() != "identity client ID, object ID and resource ID cannot be used together" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("identity endpoint should be an http URL", func(t *testing.T) {
+		o := defaultOptions()
+		o.LoginMethod = MSILogin
+		o.IdentityEndpoint = "localhost:40342/metadata/identity/oauth2/token"
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "identity endpoint") {
+			t.Fatalf("invalid identity endpoint should return error. got: %v", err)
+		}
+		o.IdentityEndpoint = "http://localhost:40342/metadata/identity/oauth2/token"
+		if err := o.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("identity endpoint should be read from env for msi login", func(t *testing.T) {
+		t.Setenv(env.KubeloginIdentityEndpoint, "http://localhost:40342/metadata/identity/oauth2/token")
+		o := defaultOptions()
+		o.UpdateFromEnv()
+		if o.IdentityEndpoint != "" {
+			t.Fatalf("identity endpoint is expected to be ignored for %s login, got %q", o.LoginMethod, o.IdentityEndpoint)
+		}
+		o.LoginMethod = MSILogin
+		o.UpdateFromEnv()
+		if o.IdentityEndpoint != "http://localhost:40342/metadata/identity/oauth2/token" {
+			t.Fatalf("identity endpoint is expected to be read from env, got %q", o.IdentityEndpoint)
+		}
+	})
+
+	t.Run("client assertion audience should be read from env for msifederated login", func(t *testing.T) {
+		t.Setenv(env.KubeloginClientAssertionAudience, "api://AzureADTokenExchangeUSGov")
+		o := defaultOptions()
+		o.LoginMethod = MSIFederatedLogin
+		o.UpdateFromEnv()
+		if o.ClientAssertionAudience != "api://AzureADTokenExchangeUSGov" {
+			t.Fatalf("client assertion audience is expected to be read from env, got %q", o.ClientAssertionAudience)
+		}
+	})
+
+	t.Run("claims should not be supported with pop tokens", func(t *testing.T) {
+		o := defaultOptions()
+		o.IsPoPTokenEnabled = true
+		o.PoPTokenClaims = "u=testhost"
+		o.EnableCAE = true
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "not supported with PoP tokens") {
+			t.Fatalf("enable-cae with pop tokens should return error. got: %s", err)
+		}
+	})
+
 	t.Run("pop-enabled flag should return error if pop-claims are not provided", func(t *testing.T) {
 		o := defaultOptions()
 		o.IsPoPTokenEnabled = true
@@ -291,16 +480,17 @@ func TestOptionsWithEnvVars(t *testing.T) {
 				env.LoginMethod:                        DeviceCodeLogin,
 			},
 			expected: Options{
-				ClientID:            clientID,
-				ClientSecret:        clientSecret,
-				ClientCert:          certPath,
-				ClientCertPassword:  certPassword,
-				Username:            username,
-				Password:            password,
-				TenantID:            tenantID,
-				LoginMethod:         DeviceCodeLogin,
-				authRecordCacheFile: "auth.json",
-				Timeout:             60 * time.Second,
+				ClientID:                clientID,
+				ClientSecret:            clientSecret,
+				ClientCert:              certPath,
+				ClientCertPassword:      certPassword,
+				Username:                username,
+				Password:                password,
+				TenantID:                tenantID,
+				LoginMethod:             DeviceCodeLogin,
+				Timeout:                 60 * time.Second,
+				TokenCacheRefreshMargin: defaultTokenCacheRefreshMargin,
+				ClientCertExpiryDays:    defaultClientCertExpiryDays,
 			},
 		},
 		{
@@ -315,15 +505,16 @@ func TestOptionsWithEnvVars(t *testing.T) {
 				env.LoginMethod:                        DeviceCodeLogin,
 			},
 			expected: Options{
-				UseAzureRMTerraformEnv: true,
-				ClientID:               clientID,
-				ClientSecret:           clientSecret,
-				ClientCert:             certPath,
-				ClientCertPassword:     certPassword,
-				TenantID:               tenantID,
-				LoginMethod:            DeviceCodeLogin,
-				authRecordCacheFile:    "auth.json",
-				Timeout:                60 * time.Second,
+				UseAzureRMTerraformEnv:  true,
+				ClientID:                clientID,
+				ClientSecret:            clientSecret,
+				ClientCert:              certPath,
+				ClientCertPassword:      certPassword,
+				TenantID:                tenantID,
+				LoginMethod:             DeviceCodeLogin,
+				Timeout:                 60 * time.Second,
+				TokenCacheRefreshMargin: defaultTokenCacheRefreshMargin,
+				ClientCertExpiryDays:    defaultClientCertExpiryDays,
 			},
 		},
 		{
@@ -341,18 +532,19 @@ func TestOptionsWithEnvVars(t *testing.T) {
 				env.AzureAuthorityHost:             authorityHost,
 			},
 			expected: Options{
-				ClientID:            clientID,
-				ClientSecret:        clientSecret,
-				ClientCert:          certPath,
-				ClientCertPassword:  certPassword,
-				Username:            username,
-				Password:            password,
-				TenantID:            tenantID,
-				LoginMethod:         WorkloadIdentityLogin,
-				AuthorityHost:       authorityHost,
-				FederatedTokenFile:  tokenFile,
-				authRecordCacheFile: "auth.json",
-				Timeout:             60 * time.Second,
+				ClientID:                clientID,
+				ClientSecret:            clientSecret,
+				ClientCert:              certPath,
+				ClientCertPassword:      certPassword,
+				Username:                username,
+				Password:                password,
+				TenantID:                tenantID,
+				LoginMethod:             WorkloadIdentityLogin,
+				AuthorityHost:           authorityHost,
+				FederatedTokenFile:      tokenFile,
+				Timeout:                 60 * time.Second,
+				TokenCacheRefreshMargin: defaultTokenCacheRefreshMargin,
+				ClientCertExpiryDays:    defaultClientCertExpiryDays,
 			},
 		},
 	}
@@ -470,6 +662,60 @@ func TestDisableEnvironmentOverride(t *testing.T) {
 	})
 }
 
+func TestEnvOverrides(t *testing.T) {
+	lookupEnv := func(vars map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		}
+	}
+
+	t.Run("returns applied env names without modifying options", func(t *testing.T) {
+		o := Options{ClientID: "client-id from options"}
+		overrides := o.EnvOverrides(lookupEnv(map[string]string{
+			env.KubeloginClientID: "client-id from env",
+			env.AzureClientID:     "client-id from azure env",
+			env.AzureTenantID:     "tenant-id from env",
+		}))
+		expected := []string{env.KubeloginClientID, env.AzureClientID, env.AzureTenantID}
+		if !cmp.Equal(expected, overrides) {
+			t.Fatalf("unexpected env overrides: %s", cmp.Diff(expected, overrides))
+		}
+		if o.ClientID != "client-id from options" {
+			t.Fatalf("expected client-id to be 'client-id from options', got %s", o.ClientID)
+		}
+	})
+
+	t.Run("returns nothing when environment override is disabled", func(t *testing.T) {
+		o := Options{DisableEnvironmentOverride: true}
+		if overrides := o.EnvOverrides(lookupEnv(map[string]string{env.AzureClientID: "client-id"})); len(overrides) != 0 {
+			t.Fatalf("expected no env overrides, got %v", overrides)
+		}
+	})
+}
+
+func TestNewOptionsFromExecArgs(t *testing.T) {
+	o, err := NewOptionsFromExecArgs([]string{
+		"get-token",
+		"--login", "spn",
+		"--server-id", "server-id",
+		"--token-cache-dir", "/tmp/cache",
+		"--some-future-flag", "value",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if o.LoginMethod != ServicePrincipalLogin {
+		t.Fatalf("expected login to be %q, got %q", ServicePrincipalLogin, o.LoginMethod)
+	}
+	if o.ServerID != "server-id" {
+		t.Fatalf("expected server-id to be 'server-id', got %q", o.ServerID)
+	}
+	if o.AuthRecordCacheDir != "/tmp/cache" {
+		t.Fatalf("expected cache dir to be '/tmp/cache', got %q", o.AuthRecordCacheDir)
+	}
+}
+
 func TestAzurePipelinesEnvironmentVariables(t *testing.T) {
 	const (
 		testClientID            = "test-client-id"
@@ -747,3 +993,122 @@ func TestGetPoPTokenCache_NilReturnsUntypedNil(t *testing.T) {
 		}
 	})
 }
+
+func TestPoPCacheEncryptionKey(t *testing.T) {
+	const key = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // base64 of 32 bytes
+
+	t.Run("key and passphrase should not be used together", func(t *testing.T) {
+		o := defaultOptions()
+		o.PoPCacheKey = key
+		o.PoPCachePassphrase = "passphrase"
+		if err := o.Validate(); err == nil || !strings.Contains(err.Error(), "cannot be used together") {
+			t.Fatalf("key and passphrase together should return error. got: %s", err)
+		}
+	})
+
+	t.Run("key and passphrase should be referred to from env", func(t *testing.T) {
+		t.Setenv(env.KubeloginPoPCacheKey, key)
+		t.Setenv(env.KubeloginPoPCachePassphrase, "passphrase")
+		o := defaultOptions()
+		o.UpdateFromEnv()
+		if want := "env:" + env.KubeloginPoPCacheKey; o.PoPCacheKey != want {
+			t.Fatalf("key is expected to be %s, got %q", want, o.PoPCacheKey)
+		}
+		if want := "env:" + env.KubeloginPoPCachePassphrase; o.PoPCachePassphrase != want {
+			t.Fatalf("passphrase is expected to be %s, got %q", want, o.PoPCachePassphrase)
+		}
+	})
+
+	t.Run("key should be decoded", func(t *testing.T) {
+		o := defaultOptions()
+		o.PoPCacheKey = key
+		got, err := o.getPoPCacheEncryptionKey()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(got) != "0123456789abcdef0123456789abcdef" {
+			t.Fatalf("unexpected key %q", got)
+		}
+
+		o = defaultOptions()
+		o.PoPCacheKey = "c2hvcnQ="
+		if _, err := o.getPoPCacheEncryptionKey(); err == nil || !strings.Contains(err.Error(), "invalid pop cache key") {
+			t.Fatalf("short key should return error. got: %s", err)
+		}
+	})
+
+	t.Run("key should be derived from the passphrase", func(t *testing.T) {
+		o := defaultOptions()
+		o.AuthRecordCacheDir = t.TempDir()
+		o.PoPCachePassphrase = "passphrase"
+		key1, err := o.getPoPCacheEncryptionKey()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		key2, err := o.getPoPCacheEncryptionKey()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(key1) != string(key2) || len(key1) != 32 {
+			t.Fatalf("the passphrase should derive the same 32-byte key, got %x and %x", key1, key2)
+		}
+	})
+
+	t.Run("PoP key provider should keep the PoP key in an encrypted file", func(t *testing.T) {
+		o := defaultOptions()
+		o.AuthRecordCacheDir = t.TempDir()
+		o.popTokenCache = &popcache.Cache{}
+		o.popCacheEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+		key1, err := o.GetPoPKeyProvider().GetPoPKey()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		key2, err := pop.GetSwPoPKeyEncryptedFile(o.AuthRecordCacheDir, o.popCacheEncryptionKey)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if key1.KeyID() != key2.KeyID() {
+			t.Fatalf("the PoP key is expected to be persisted in the encrypted file, got %s and %s", key1.KeyID(), key2.KeyID())
+		}
+	})
+}
+
+func TestFlagsOverrideEnvironment(t *testing.T) {
+	t.Setenv(env.AzureClientID, "client-id from env")
+	t.Setenv(env.AzureTenantID, "tenant-id from env")
+
+	for _, tc := range []struct {
+		name             string
+		args             []string
+		expectedClientID string
+	}{
+		{
+			name:             "env overrides flags by default",
+			args:             []string{"--client-id", "client-id from flag"},
+			expectedClientID: "client-id from env",
+		},
+		{
+			name:             "flags override env",
+			args:             []string{"--client-id", "client-id from flag", "--flags-override-environment"},
+			expectedClientID: "client-id from flag",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := NewOptions(false)
+			fs := pflag.NewFlagSet("get-token", pflag.ContinueOnError)
+			o.AddFlags(fs)
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			o.SetChangedFlags(fs)
+			o.UpdateFromEnv()
+			if o.ClientID != tc.expectedClientID {
+				t.Fatalf("expected client-id to be %q, got %q", tc.expectedClientID, o.ClientID)
+			}
+			// env still applies to options whose flags are not set
+			if o.TenantID != "tenant-id from env" {
+				t.Fatalf("expected tenant-id to be 'tenant-id from env', got %q", o.TenantID)
+			}
+		})
+	}
+}
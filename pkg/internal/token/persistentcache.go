@@ -7,6 +7,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity/cache"
+	klog "k8s.io/klog/v2"
 )
 
 // cacheNewFunc is the function used to create a new persistent cache.
@@ -25,12 +26,30 @@ var cacheNewFunc = cache.New
 // (best-effort) to avoid breaking existing behavior.
 //
 // See https://github.com/Azure/kubelogin/issues/740
-func newPersistentCache() (azidentity.Cache, error) {
+func newPersistentCache(opts *cache.Options) (azidentity.Cache, error) {
 	lockDir := lockFileDir()
 	lockPath := filepath.Join(lockDir, "cache-test.lock")
 	unlock := acquireProcessLock(lockPath)
 	defer unlock()
-	return cacheNewFunc(nil)
+	return cacheNewFunc(opts)
+}
+
+// newAccountPersistentCache creates the persistent token cache of the user accounts of the
+// authority, tenant and client of the options, apart from the caches of other contexts. An
+// account whose record was migrated from auth.json keeps the default cache of earlier versions,
+// which holds its tokens.
+func newAccountPersistentCache(o *Options) (azidentity.Cache, error) {
+	if usesLegacyPersistentCache(getAuthenticationRecordFileName(o)) {
+		klog.V(5).Info("using the persistent token cache of the account migrated from auth.json")
+		return newPersistentCache(nil)
+	}
+	return newPersistentCache(&cache.Options{Name: getPersistentCacheName(o)})
+}
+
+// getPersistentCacheName names the persistent token cache of the user accounts of the
+// authority, tenant and client of the options like their authentication records
+func getPersistentCacheName(o *Options) string {
+	return "kubelogin_" + getAuthenticationRecordKey(o, "") + ".cache"
 }
 
 // lockFileDir returns a user-scoped directory for the lock file.
@@ -23,12 +23,64 @@ func TestNewPersistentCache_Success(t *testing.T) {
 		return azidentity.Cache{}, nil
 	}
 
-	c, err := newPersistentCache()
+	c, err := newPersistentCache(nil)
 	assert.NoError(t, err)
 	assert.Equal(t, azidentity.Cache{}, c)
 	assert.True(t, called)
 }
 
+func TestNewAccountPersistentCache(t *testing.T) {
+	original := cacheNewFunc
+	defer func() { cacheNewFunc = original }()
+
+	var names []string
+	cacheNewFunc = func(opts *cache.Options) (azidentity.Cache, error) {
+		require.NotNil(t, opts)
+		names = append(names, opts.Name)
+		return azidentity.Cache{}, nil
+	}
+
+	for _, o := range []*Options{
+		{TenantID: "tenant", ClientID: "client-id"},
+		{TenantID: "tenant", ClientID: "client-id", LoginHint: "user@contoso.com"},
+		{TenantID: "other-tenant", ClientID: "client-id"},
+	} {
+		_, err := newAccountPersistentCache(o)
+		require.NoError(t, err)
+	}
+	require.Len(t, names, 3)
+	assert.Regexp(t, `^kubelogin_[0-9a-f]{64}\.cache$`, names[0])
+	assert.Equal(t, names[0], names[1], "the accounts of a tenant and client share a cache")
+	assert.NotEqual(t, names[0], names[2])
+}
+
+func TestNewAccountPersistentCache_MigratedAccount(t *testing.T) {
+	original := cacheNewFunc
+	defer func() { cacheNewFunc = original }()
+
+	var got *cache.Options
+	cacheNewFunc = func(opts *cache.Options) (azidentity.Cache, error) {
+		got = opts
+		return azidentity.Cache{}, nil
+	}
+
+	o := &Options{AuthRecordCacheDir: t.TempDir(), TenantID: "tenant", ClientID: "client-id"}
+	record := azidentity.AuthenticationRecord{ClientID: "client-id", Authority: "https://login.microsoftonline.com", Version: "1.0"}
+	require.NoError(t, (&defaultCachedRecordProvider{file: filepath.Join(o.AuthRecordCacheDir, LegacyAuthRecordFileName)}).Store(record))
+
+	_, err := newAccountPersistentCache(o)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, getPersistentCacheName(o), got.Name, "an account signed in after upgrading uses its own cache")
+
+	// the record of auth.json is migrated, and its account keeps the default cache of earlier versions
+	_, err = newCachedRecordProvider(o).Retrieve()
+	require.NoError(t, err)
+	_, err = newAccountPersistentCache(o)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
 func TestNewPersistentCache_Error(t *testing.T) {
 	original := cacheNewFunc
 	defer func() { cacheNewFunc = original }()
@@ -38,7 +90,7 @@ func TestNewPersistentCache_Error(t *testing.T) {
 		return azidentity.Cache{}, expectedErr
 	}
 
-	c, err := newPersistentCache()
+	c, err := newPersistentCache(nil)
 	assert.ErrorIs(t, err, expectedErr)
 	assert.Equal(t, azidentity.Cache{}, c)
 }
@@ -62,7 +114,7 @@ func TestNewPersistentCache_ConcurrentAccess(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_, err := newPersistentCache()
+			_, err := newPersistentCache(nil)
 			assert.NoError(t, err)
 		}()
 	}
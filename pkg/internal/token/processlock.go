@@ -0,0 +1,52 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// processLockPollInterval is how often a waiting process retries a held lock.
+const processLockPollInterval = 100 * time.Millisecond
+
+// acquireProcessLockWithContext acquires an exclusive file lock at the given path,
+// waiting while another process holds it. Unlike acquireProcessLock, it fails when
+// the context is done before the lock is acquired. Like acquireProcessLock, it
+// continues without the lock when the lock file can't be opened or locked, e.g. in
+// a read-only directory, as the lock only avoids prompting the user twice.
+func acquireProcessLockWithContext(ctx context.Context, path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		klog.V(5).Infof("failed to open lock file %s, continuing without the lock: %v", path, err)
+		return func() {}, nil
+	}
+
+	ticker := time.NewTicker(processLockPollInterval)
+	defer ticker.Stop()
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			klog.V(5).Infof("failed to acquire lock on %s, continuing without the lock: %v", path, err)
+			f.Close()
+			return func() {}, nil
+		}
+		if locked {
+			return func() {
+				if err := unlockFile(f); err != nil {
+					klog.V(5).Infof("failed to release lock on %s: %v", path, err)
+				}
+				f.Close()
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("timed out waiting for lock on %s: %w", path, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package token
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireProcessLockWithContext(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "test.lock")
+
+	unlock, err := acquireProcessLockWithContext(context.Background(), lockPath)
+	require.NoError(t, err)
+
+	t.Run("held lock times out", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*processLockPollInterval)
+		defer cancel()
+		_, err := acquireProcessLockWithContext(ctx, lockPath)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("waiter acquires lock once released", func(t *testing.T) {
+		acquired := make(chan error, 1)
+		go func() {
+			unlockWaiter, err := acquireProcessLockWithContext(context.Background(), lockPath)
+			if err == nil {
+				unlockWaiter()
+			}
+			acquired <- err
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("lock should not be acquired while held")
+		case <-time.After(3 * processLockPollInterval):
+		}
+
+		unlock()
+		select {
+		case err := <-acquired:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("lock was not acquired after release")
+		}
+	})
+}
+
+func TestAcquireProcessLockWithContext_InvalidPath(t *testing.T) {
+	// the lock is best-effort, so a lock file that can't be opened doesn't fail get-token
+	lockPath := filepath.Join(t.TempDir(), "nonexistent", "test.lock")
+	unlock, err := acquireProcessLockWithContext(context.Background(), lockPath)
+	require.NoError(t, err)
+	unlock()
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package token
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// acquireProcessLock is a no-op on Windows because the macOS keychain
+// race condition (issue #740) does not apply. Returns a no-op unlock function.
+func acquireProcessLock(_ string) func() {
+	return func() {}
+}
+
+// tryLockFile attempts to take an exclusive lock on f without blocking.
+// It reports false when another process holds the lock.
+func tryLockFile(f *os.File) (bool, error) {
+	err := windows.LockFileEx(
+		windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, new(windows.Overlapped))
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// unlockFile releases a lock taken by tryLockFile.
+func unlockFile(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, new(windows.Overlapped))
+}
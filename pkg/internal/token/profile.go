@@ -0,0 +1,211 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+// DefaultConfigFile is the kubelogin config file used unless KUBELOGIN_CONFIG is set
+var DefaultConfigFile = filepath.Join(homedir.HomeDir(), ".kube", "kubelogin", "config.yaml")
+
+// Config is the kubelogin config file holding named profiles
+type Config struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Profile holds get-token settings shared by many kubeconfigs. Keys are the flag names.
+type Profile struct {
+	LoginMethod                       string   `json:"login,omitempty"`
+	LoginChain                        []string `json:"login-chain,omitempty"`
+	ServerID                          string   `json:"server-id,omitempty"`
+	TenantID                          string   `json:"tenant-id,omitempty"`
+	ClientID                          string   `json:"client-id,omitempty"`
+	ClientCert                        string   `json:"client-certificate,omitempty"`
+	ClientCertExpiryDays              *int     `json:"client-certificate-expiry-days,omitempty"`
+	Username                          string   `json:"username,omitempty"`
+	IdentityClientID                  string   `json:"identity-client-id,omitempty"`
+	IdentityObjectID                  string   `json:"identity-object-id,omitempty"`
+	IdentityResourceID                string   `json:"identity-resource-id,omitempty"`
+	IdentityEndpoint                  string   `json:"identity-endpoint,omitempty"`
+	FederatedTokenFile                string   `json:"federated-token-file,omitempty"`
+	AuthorityHost                     string   `json:"authority-host,omitempty"`
+	AzurePipelinesServiceConnectionID string   `json:"azure-pipelines-service-connection-id,omitempty"`
+	ClientAssertionCommand            string   `json:"client-assertion-command,omitempty"`
+	ClientAssertionFile               string   `json:"client-assertion-file,omitempty"`
+	ClientAssertionAudience           string   `json:"client-assertion-audience,omitempty"`
+	SubscriptionID                    string   `json:"subscription,omitempty"`
+	Environment                       string   `json:"environment,omitempty"`
+	EnvironmentFile                   string   `json:"environment-file,omitempty"`
+	EnvironmentMetadataURL            string   `json:"environment-metadata-url,omitempty"`
+	CacheDir                          string   `json:"cache-dir,omitempty"`
+	PoPTokenClaims                    string   `json:"pop-claims,omitempty"`
+	RedirectURL                       string   `json:"redirect-url,omitempty"`
+	LoginHint                         string   `json:"login-hint,omitempty"`
+	BrowserCommand                    string   `json:"browser-command,omitempty"`
+	InteractiveFallback               string   `json:"interactive-fallback,omitempty"`
+	EventsFile                        string   `json:"events-file,omitempty"`
+	IsLegacy                          bool     `json:"legacy,omitempty"`
+	UseAzureRMTerraformEnv            bool     `json:"use-azurerm-env-vars,omitempty"`
+	DisableInstanceDiscovery          bool     `json:"disable-instance-discovery,omitempty"`
+	DisableEnvironmentOverride        bool     `json:"disable-environment-override,omitempty"`
+	FlagsOverrideEnvironment          bool     `json:"flags-override-environment,omitempty"`
+	EnableCAE                         bool     `json:"enable-cae,omitempty"`
+	DeviceCodeQR                      bool     `json:"device-code-qr,omitempty"`
+	ClientCertExpiryStrict            bool     `json:"client-certificate-expiry-strict,omitempty"`
+}
+
+// ConfigFile returns the path of the kubelogin config file
+func ConfigFile() string {
+	if v := os.Getenv(env.KubeloginConfig); v != "" {
+		return v
+	}
+	return DefaultConfigFile
+}
+
+// LoadConfig reads the kubelogin config file. A missing file is an empty config.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubelogin config %s: %w", path, err)
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse kubelogin config %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// LoadProfile returns the named profile of the kubelogin config file
+func LoadProfile(name string) (*Profile, error) {
+	path := ConfigFile()
+	c, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found in kubelogin config %s", name, path)
+	}
+	return &p, nil
+}
+
+// UpdateFromProfile applies the profile named by --profile or, without it, the first profile
+// by name whose server-id matches the server-id of the cluster's exec extension or else
+// --server-id. Flags set on the command line take precedence over the profile, and
+// environment variables applied by UpdateFromEnv afterwards override it.
+func (o *Options) UpdateFromProfile() error {
+	_, err := o.updateFromProfile()
+	return err
+}
+
+// profileServerID returns the server-id profiles are matched by. The server-id of the
+// cluster's exec extension is used when it is set, as UpdateFromExecInfo applies it over
+// --server-id afterwards. An invalid KUBERNETES_EXEC_INFO is reported by UpdateFromExecInfo.
+func (o *Options) profileServerID() string {
+	if info, err := getExecInfoFromEnv(); err == nil && info != nil && info.clusterConfig != nil && info.clusterConfig.ServerID != "" {
+		return info.clusterConfig.ServerID
+	}
+	return o.ServerID
+}
+
+// updateFromProfile applies the profile and returns its name, or an empty name when none applies
+func (o *Options) updateFromProfile() (string, error) {
+	serverID := o.profileServerID()
+	if o.Profile == "" && serverID == "" {
+		return "", nil
+	}
+	path := ConfigFile()
+	c, err := LoadConfig(path)
+	if err != nil {
+		return "", err
+	}
+
+	name := o.Profile
+	if name == "" {
+		for _, n := range slices.Sorted(maps.Keys(c.Profiles)) {
+			if c.Profiles[n].ServerID == serverID {
+				name = n
+				break
+			}
+		}
+		if name == "" {
+			return "", nil
+		}
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return "", fmt.Errorf("profile %q not found in kubelogin config %s", name, path)
+	}
+
+	setString := func(flag string, dst *string, v string) {
+		if v != "" && !slices.Contains(o.changedFlags, flag) {
+			*dst = v
+		}
+	}
+	setBool := func(flag string, dst *bool, v bool) {
+		if v && !slices.Contains(o.changedFlags, flag) {
+			*dst = v
+		}
+	}
+
+	setString("login", &o.LoginMethod, p.LoginMethod)
+	if len(p.LoginChain) > 0 && !slices.Contains(o.changedFlags, "login-chain") {
+		o.LoginChain = p.LoginChain
+	}
+	setString("server-id", &o.ServerID, p.ServerID)
+	setString("tenant-id", &o.TenantID, p.TenantID)
+	setString("client-id", &o.ClientID, p.ClientID)
+	setString("client-certificate", &o.ClientCert, p.ClientCert)
+	if p.ClientCertExpiryDays != nil && !slices.Contains(o.changedFlags, "client-certificate-expiry-days") {
+		o.ClientCertExpiryDays = *p.ClientCertExpiryDays
+	}
+	setString("username", &o.Username, p.Username)
+	setString("identity-client-id", &o.IdentityClientID, p.IdentityClientID)
+	setString("identity-object-id", &o.IdentityObjectID, p.IdentityObjectID)
+	setString("identity-resource-id", &o.IdentityResourceID, p.IdentityResourceID)
+	setString("identity-endpoint", &o.IdentityEndpoint, p.IdentityEndpoint)
+	setString("federated-token-file", &o.FederatedTokenFile, p.FederatedTokenFile)
+	setString("authority-host", &o.AuthorityHost, p.AuthorityHost)
+	setString("azure-pipelines-service-connection-id", &o.AzurePipelinesServiceConnectionID, p.AzurePipelinesServiceConnectionID)
+	setString("client-assertion-command", &o.ClientAssertionCommand, p.ClientAssertionCommand)
+	setString("client-assertion-file", &o.ClientAssertionFile, p.ClientAssertionFile)
+	setString("client-assertion-audience", &o.ClientAssertionAudience, p.ClientAssertionAudience)
+	setString("subscription", &o.SubscriptionID, p.SubscriptionID)
+	setString("environment", &o.Environment, p.Environment)
+	setString("environment-file", &o.EnvironmentFile, p.EnvironmentFile)
+	setString("environment-metadata-url", &o.EnvironmentMetadataURL, p.EnvironmentMetadataURL)
+	setString("redirect-url", &o.RedirectURL, p.RedirectURL)
+	setString("login-hint", &o.LoginHint, p.LoginHint)
+	setString("browser-command", &o.BrowserCommand, p.BrowserCommand)
+	setString("interactive-fallback", &o.InteractiveFallback, p.InteractiveFallback)
+	setString("events-file", &o.EventsFile, p.EventsFile)
+	if !slices.Contains(o.changedFlags, "token-cache-dir") && os.Getenv("KUBECACHEDIR") == "" {
+		setString("cache-dir", &o.AuthRecordCacheDir, p.CacheDir)
+	}
+	if p.PoPTokenClaims != "" && !slices.Contains(o.changedFlags, "pop-claims") {
+		o.PoPTokenClaims = p.PoPTokenClaims
+		o.IsPoPTokenEnabled = true
+	}
+	setBool("legacy", &o.IsLegacy, p.IsLegacy)
+	setBool("use-azurerm-env-vars", &o.UseAzureRMTerraformEnv, p.UseAzureRMTerraformEnv)
+	setBool("disable-instance-discovery", &o.DisableInstanceDiscovery, p.DisableInstanceDiscovery)
+	setBool("disable-environment-override", &o.DisableEnvironmentOverride, p.DisableEnvironmentOverride)
+	setBool("flags-override-environment", &o.FlagsOverrideEnvironment, p.FlagsOverrideEnvironment)
+	setBool("enable-cae", &o.EnableCAE, p.EnableCAE)
+	setBool("device-code-qr", &o.DeviceCodeQR, p.DeviceCodeQR)
+	setBool("client-certificate-expiry-strict", &o.ClientCertExpiryStrict, p.ClientCertExpiryStrict)
+	return name, nil
+}
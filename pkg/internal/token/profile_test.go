@@ -0,0 +1,125 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Azure/kubelogin/pkg/internal/env"
+)
+
+const testKubeloginConfig = `profiles:
+  prod:
+    login: spn
+    tenant-id: prod-tenant
+    client-id: prod-client
+    environment: AzureUSGovernmentCloud
+    cache-dir: /tmp/prod-cache
+    pop-claims: u=/arm/id
+  by-server-id:
+    login: azurecli
+    server-id: shared-server
+`
+
+func writeTestKubeloginConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	t.Setenv(env.KubeloginConfig, path)
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		c, err := LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+		require.NoError(t, err)
+		assert.Empty(t, c.Profiles)
+	})
+
+	t.Run("profiles", func(t *testing.T) {
+		path := writeTestKubeloginConfig(t, testKubeloginConfig)
+		c, err := LoadConfig(path)
+		require.NoError(t, err)
+		assert.Equal(t, Profile{LoginMethod: AzureCLILogin, ServerID: "shared-server"}, c.Profiles["by-server-id"])
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		path := writeTestKubeloginConfig(t, "profiles:\n  prod:\n    tenant: prod-tenant\n")
+		_, err := LoadConfig(path)
+		assert.ErrorContains(t, err, "failed to parse kubelogin config")
+	})
+}
+
+func TestUpdateFromProfile(t *testing.T) {
+	t.Setenv("KUBECACHEDIR", "")
+	writeTestKubeloginConfig(t, testKubeloginConfig)
+
+	t.Run("profile by name", func(t *testing.T) {
+		o := newOptionsFromFlags(t, "--profile", "prod", "--server-id", "server")
+		require.NoError(t, o.UpdateFromProfile())
+		assert.Equal(t, ServicePrincipalLogin, o.LoginMethod)
+		assert.Equal(t, "server", o.ServerID)
+		assert.Equal(t, "prod-tenant", o.TenantID)
+		assert.Equal(t, "prod-client", o.ClientID)
+		assert.Equal(t, "AzureUSGovernmentCloud", o.Environment)
+		assert.Equal(t, "/tmp/prod-cache", o.AuthRecordCacheDir)
+		assert.True(t, o.IsPoPTokenEnabled)
+		assert.Equal(t, "u=/arm/id", o.PoPTokenClaims)
+	})
+
+	t.Run("flags take precedence", func(t *testing.T) {
+		o := newOptionsFromFlags(t, "--profile", "prod", "--tenant-id", "flag-tenant", "--cache-dir", "/tmp/flag-cache")
+		require.NoError(t, o.UpdateFromProfile())
+		assert.Equal(t, "flag-tenant", o.TenantID)
+		assert.Equal(t, "/tmp/flag-cache", o.AuthRecordCacheDir)
+		assert.Equal(t, "prod-client", o.ClientID)
+	})
+
+	t.Run("profile by server id", func(t *testing.T) {
+		o := newOptionsFromFlags(t, "--server-id", "shared-server")
+		require.NoError(t, o.UpdateFromProfile())
+		assert.Equal(t, AzureCLILogin, o.LoginMethod)
+	})
+
+	t.Run("profile by server id of the exec cluster config", func(t *testing.T) {
+		t.Setenv(execInfoEnv, `{"apiVersion":"client.authentication.k8s.io/v1","spec":{"interactive":true,"cluster":{"config":{"server-id":"shared-server"}}}}`)
+		o := newOptionsFromFlags(t, "--server-id", "other-server")
+		require.NoError(t, o.UpdateFromProfile())
+		assert.Equal(t, AzureCLILogin, o.LoginMethod)
+		require.NoError(t, o.UpdateFromExecInfo())
+		assert.Equal(t, "shared-server", o.ServerID)
+	})
+
+	t.Run("no matching profile", func(t *testing.T) {
+		o := newOptionsFromFlags(t, "--server-id", "other-server")
+		require.NoError(t, o.UpdateFromProfile())
+		assert.Equal(t, DeviceCodeLogin, o.LoginMethod)
+	})
+
+	t.Run("profile not found", func(t *testing.T) {
+		o := newOptionsFromFlags(t, "--profile", "missing")
+		assert.ErrorContains(t, o.UpdateFromProfile(), `profile "missing" not found`)
+	})
+
+	t.Run("env overrides profile", func(t *testing.T) {
+		t.Setenv(env.AzureTenantID, "env-tenant")
+		o := newOptionsFromFlags(t, "--profile", "prod")
+		require.NoError(t, o.UpdateFromProfile())
+		o.UpdateFromEnv()
+		assert.Equal(t, "env-tenant", o.TenantID)
+	})
+}
+
+func TestLoadProfile(t *testing.T) {
+	writeTestKubeloginConfig(t, testKubeloginConfig)
+
+	p, err := LoadProfile("by-server-id")
+	require.NoError(t, err)
+	assert.Equal(t, "shared-server", p.ServerID)
+
+	_, err = LoadProfile("missing")
+	assert.ErrorContains(t, err, `profile "missing" not found`)
+}
@@ -5,7 +5,6 @@ package token
 import (
 	"context"
 	"errors"
-	"os"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
@@ -42,13 +41,26 @@ func NewAzIdentityCredential(record azidentity.AuthenticationRecord, o *Options)
 		switch {
 		case o.IsPoPTokenEnabled:
 			return newInteractiveBrowserCredentialWithPoP(o)
+		case o.BrowserCommand != "" || o.InteractiveFallback != "":
+			return newCustomBrowserCredential(o, record)
 		default:
 			return newInteractiveBrowserCredential(o, record)
 		}
 
+	case AuthCodeLogin:
+		switch {
+		case o.IsPoPTokenEnabled:
+			return newAuthCodeCredentialWithPoP(o)
+		default:
+			return newAuthCodeCredential(o, record)
+		}
+
 	case MSILogin:
 		return newManagedIdentityCredential(o)
 
+	case MSIFederatedLogin:
+		return newMSIFederatedCredential(o)
+
 	case ROPCLogin:
 		switch {
 		case o.IsPoPTokenEnabled:
@@ -74,15 +86,19 @@ func NewAzIdentityCredential(record azidentity.AuthenticationRecord, o *Options)
 		}
 
 	case WorkloadIdentityLogin:
-		switch {
-		case os.Getenv(actionsIDTokenRequestToken) != "" && os.Getenv(actionsIDTokenRequestURL) != "":
-			return newGithubActionsCredential(o)
-		default:
-			return newWorkloadIdentityCredential(o)
+		if p := detectCIProvider(o); p != nil {
+			return newCIProviderCredential(o, p)
 		}
+		return newWorkloadIdentityCredential(o)
 
 	case AzurePipelinesLogin:
 		return newAzurePipelinesCredential(o)
+
+	case ClientAssertionLogin:
+		return newClientAssertionCredential(o)
+
+	case AutoLogin:
+		return newChainCredential(o, record)
 	}
 
 	return nil, errors.New("unsupported token provider")
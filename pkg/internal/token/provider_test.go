@@ -68,6 +68,17 @@ func TestNewAzIdentityCredential(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Interactive login with browser command",
+			options: &Options{
+				LoginMethod:    InteractiveLogin,
+				ServerID:       "server-id",
+				TenantID:       "tenant-id",
+				ClientID:       "client-id",
+				BrowserCommand: "wslview",
+			},
+			wantErr: false,
+		},
 		{
 			name: "MSI login",
 			options: &Options{
@@ -0,0 +1,139 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
+	"k8s.io/klog/v2"
+
+	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
+)
+
+// publicClientCredential acquires tokens for the user of its authentication record with an
+// MSAL public client, for the user logins azidentity credentials cannot be customized for.
+// signIn signs the user in when no cached token can be used.
+type publicClientCredential struct {
+	client         public.Client
+	record         azidentity.AuthenticationRecord
+	tenantID       string
+	nonInteractive bool
+	signIn         func(ctx context.Context, scopes []string, tenantID, claims string) (public.AuthResult, error)
+}
+
+// newUserPublicClient returns the MSAL public client of a user login. Its tokens are
+// persisted in cacheFileName, or caeCacheFileName when CAE is enabled.
+func newUserPublicClient(opts *Options, cacheFileName, caeCacheFileName string) (public.Client, error) {
+	authorityURL, err := url.JoinPath(opts.GetCloudConfiguration().ActiveDirectoryAuthorityHost, opts.TenantID)
+	if err != nil {
+		return public.Client{}, fmt.Errorf("unable to construct authority URL: %w", err)
+	}
+	clientOpts := []public.Option{
+		public.WithAuthority(authorityURL),
+		public.WithInstanceDiscovery(!opts.DisableInstanceDiscovery),
+	}
+	if opts.httpClient != nil {
+		clientOpts = append(clientOpts, public.WithHTTPClient(opts.httpClient))
+	}
+	if opts.EnableCAE {
+		clientOpts = append(clientOpts, public.WithClientCapabilities([]string{"cp1"}))
+		// CAE tokens are cached apart so that a token lacking the capability is never returned
+		cacheFileName = caeCacheFileName
+	}
+	if opts.UsePersistentCache {
+		c, err := popcache.NewNamedCache(opts.AuthRecordCacheDir, cacheFileName)
+		if err != nil {
+			klog.V(5).Infof("failed to create cache: %v", err)
+		} else {
+			clientOpts = append(clientOpts, public.WithCache(c))
+		}
+	}
+	return public.New(opts.ClientID, clientOpts...)
+}
+
+func (c *publicClientCredential) Authenticate(ctx context.Context, opts *policy.TokenRequestOptions) (azidentity.AuthenticationRecord, error) {
+	result, err := c.signIn(ctx, opts.Scopes, c.tenant(opts.TenantID), opts.Claims)
+	if err != nil {
+		return azidentity.AuthenticationRecord{}, err
+	}
+	record, err := newAuthenticationRecord(result)
+	if err != nil {
+		return azidentity.AuthenticationRecord{}, err
+	}
+	c.record = record
+	return record, nil
+}
+
+func (c *publicClientCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	result, err := c.acquireTokenSilent(ctx, opts)
+	if err != nil {
+		if c.nonInteractive {
+			return azcore.AccessToken{}, fmt.Errorf("%w: %s", errNonInteractiveSession, err)
+		}
+		klog.V(5).Infof("silent token acquisition failed, signing in: %s", err)
+		result, err = c.signIn(ctx, opts.Scopes, c.tenant(opts.TenantID), opts.Claims)
+		if err != nil {
+			return azcore.AccessToken{}, err
+		}
+	}
+	return azcore.AccessToken{Token: result.AccessToken, ExpiresOn: result.ExpiresOn}, nil
+}
+
+func (c *publicClientCredential) NeedAuthenticate() bool {
+	return true
+}
+
+// acquireTokenSilent acquires a token for the account of the authentication record from the cache
+func (c *publicClientCredential) acquireTokenSilent(ctx context.Context, opts policy.TokenRequestOptions) (public.AuthResult, error) {
+	if c.record.HomeAccountID == "" {
+		return public.AuthResult{}, fmt.Errorf("no authentication record")
+	}
+	accounts, err := c.client.Accounts(ctx)
+	if err != nil {
+		return public.AuthResult{}, fmt.Errorf("failed to list cached accounts: %w", err)
+	}
+	for _, account := range accounts {
+		if account.HomeAccountID == c.record.HomeAccountID {
+			return c.client.AcquireTokenSilent(ctx, opts.Scopes,
+				public.WithSilentAccount(account), public.WithTenantID(c.tenant(opts.TenantID)), public.WithClaims(opts.Claims))
+		}
+	}
+	return public.AuthResult{}, fmt.Errorf("no cached account found for %s", c.record.Username)
+}
+
+func (c *publicClientCredential) tenant(tenantID string) string {
+	if tenantID != "" {
+		return tenantID
+	}
+	return c.tenantID
+}
+
+// newAuthenticationRecord returns the authentication record of a token acquired with MSAL,
+// in the format of the records azidentity credentials read from the same file
+func newAuthenticationRecord(result public.AuthResult) (azidentity.AuthenticationRecord, error) {
+	u, err := url.Parse(result.IDToken.Issuer)
+	if err != nil || u.Host == "" {
+		return azidentity.AuthenticationRecord{}, fmt.Errorf("expected a URL issuer but got %q", result.IDToken.Issuer)
+	}
+	tenantID := result.IDToken.TenantID
+	if tenantID == "" {
+		tenantID = strings.Trim(u.Path, "/")
+	}
+	username := result.IDToken.PreferredUsername
+	if username == "" {
+		username = result.IDToken.UPN
+	}
+	return azidentity.AuthenticationRecord{
+		Authority:     fmt.Sprintf("%s://%s", u.Scheme, u.Host),
+		ClientID:      result.IDToken.Audience,
+		HomeAccountID: result.Account.HomeAccountID,
+		TenantID:      tenantID,
+		Username:      username,
+		Version:       "1.0",
+	}, nil
+}
@@ -0,0 +1,161 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/AzureAD/microsoft-authentication-extensions-for-go/cache/accessor"
+
+	popcache "github.com/Azure/kubelogin/pkg/internal/pop/cache"
+)
+
+const (
+	// SecretRefEnvPrefix refers to a secret stored in an environment variable, e.g. env:MY_SECRET
+	SecretRefEnvPrefix = "env:"
+	// SecretRefFilePrefix refers to a secret stored in a file, e.g. file:/path/to/secret
+	SecretRefFilePrefix = "file:"
+	// SecretRefKeyringPrefix refers to a secret stored in the OS keyring by kubelogin, e.g. keyring:my-secret
+	SecretRefKeyringPrefix = "keyring:"
+
+	secretsDirName = "secrets"
+)
+
+var (
+	keyringSecretNameRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	envNameRegexp           = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// IsSecretRef reports whether the value is a secret reference rather than a literal secret
+func IsSecretRef(value string) bool {
+	_, _, ok := parseSecretRef(value)
+	return ok
+}
+
+// parseSecretRef splits a secret reference into its prefix and the environment variable name,
+// absolute file path or keyring secret name it refers to. A value starting with a prefix but not
+// followed by one of them is a literal secret, e.g. "env:p@ss" or "file:secret".
+func parseSecretRef(value string) (prefix, target string, ok bool) {
+	for _, ref := range []struct {
+		prefix string
+		valid  func(string) bool
+	}{
+		{prefix: SecretRefEnvPrefix, valid: envNameRegexp.MatchString},
+		{prefix: SecretRefFilePrefix, valid: filepath.IsAbs},
+		{prefix: SecretRefKeyringPrefix, valid: keyringSecretNameRegexp.MatchString},
+	} {
+		if target, found := strings.CutPrefix(value, ref.prefix); found && ref.valid(target) {
+			return ref.prefix, target, true
+		}
+	}
+	return "", "", false
+}
+
+// ResolveSecrets replaces secret references in client secret, client certificate password,
+// password and the PoP cache key and passphrase with the secrets they refer to.
+func (o *Options) ResolveSecrets() error {
+	for _, s := range []struct {
+		name  string
+		value *string
+	}{
+		{name: "client secret", value: &o.ClientSecret},
+		{name: "client certificate password", value: &o.ClientCertPassword},
+		{name: "password", value: &o.Password},
+		{name: "pop cache key", value: &o.PoPCacheKey},
+		{name: "pop cache passphrase", value: &o.PoPCachePassphrase},
+	} {
+		v, err := resolveSecret(*s.value, o.AuthRecordCacheDir)
+		if err != nil {
+			return fmt.Errorf("unable to resolve %s: %w", s.name, err)
+		}
+		*s.value = v
+	}
+	return nil
+}
+
+// resolveSecret returns the secret the value refers to, or the value itself when it is not a reference
+func resolveSecret(value, cacheDir string) (string, error) {
+	prefix, target, ok := parseSecretRef(value)
+	if !ok {
+		return value, nil
+	}
+	switch prefix {
+	case SecretRefEnvPrefix:
+		v, ok := os.LookupEnv(target)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", target)
+		}
+		return v, nil
+	case SecretRefFilePrefix:
+		b, err := os.ReadFile(target)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	default:
+		return GetKeyringSecret(cacheDir, target)
+	}
+}
+
+// GetKeyringSecret reads a secret stored by SetKeyringSecret
+func GetKeyringSecret(cacheDir, name string) (string, error) {
+	acc, err := newKeyringSecretAccessor(cacheDir, name)
+	if err != nil {
+		return "", err
+	}
+	b, err := acc.Read(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %q from keyring: %w", name, err)
+	}
+	if len(b) == 0 {
+		return "", fmt.Errorf("secret %q not found in keyring", name)
+	}
+	return string(b), nil
+}
+
+// SetKeyringSecret stores the secret in platform-specific secure storage under the name and
+// returns the reference to use in place of the secret.
+func SetKeyringSecret(cacheDir, name, secret string) (string, error) {
+	acc, err := newKeyringSecretAccessor(cacheDir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := acc.Write(context.Background(), []byte(secret)); err != nil {
+		return "", fmt.Errorf("failed to write secret %q to keyring: %w", name, err)
+	}
+	return SecretRefKeyringPrefix + name, nil
+}
+
+// KeyringSecretsPersist reports whether secrets stored by SetKeyringSecret survive a reboot.
+// They don't on Linux, where the keyring is the kernel keyring.
+func KeyringSecretsPersist() bool {
+	return popcache.PersistentStorage()
+}
+
+// KeyringSecretName returns a valid keyring secret name built from the parts
+func KeyringSecretName(parts ...string) string {
+	name := strings.Join(parts, ".")
+	return strings.Map(func(r rune) rune {
+		if keyringSecretNameRegexp.MatchString(string(r)) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func newKeyringSecretAccessor(cacheDir, name string) (accessor.Accessor, error) {
+	if !keyringSecretNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid keyring secret name %q. Only letters, digits, '.', '_' and '-' are allowed", name)
+	}
+	if err := popcache.StorageError(); err != nil {
+		return nil, fmt.Errorf("keyring is not available: %w", err)
+	}
+	acc, err := popcache.NewSecureAccessor(filepath.Join(cacheDir, secretsDirName, name+".secret"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to access keyring: %w", err)
+	}
+	return acc, nil
+}
@@ -0,0 +1,90 @@
+package token
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSecret(t *testing.T) {
+	cacheDir := t.TempDir()
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("file-secret\n"), 0600))
+	t.Setenv("KUBELOGIN_TEST_SECRET", "env-secret")
+	ref, err := SetKeyringSecret(cacheDir, "test-secret", "keyring-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "keyring:test-secret", ref)
+
+	testCases := []struct {
+		name          string
+		value         string
+		expected      string
+		expectedError string
+	}{
+		{name: "empty", value: "", expected: ""},
+		{name: "literal", value: "literal-secret", expected: "literal-secret"},
+		{name: "env", value: "env:KUBELOGIN_TEST_SECRET", expected: "env-secret"},
+		{name: "missing env", value: "env:KUBELOGIN_TEST_MISSING", expectedError: `environment variable "KUBELOGIN_TEST_MISSING" is not set`},
+		{name: "file", value: "file:" + secretFile, expected: "file-secret"},
+		{name: "missing file", value: "file:" + filepath.Join(cacheDir, "missing"), expectedError: "failed to read secret file"},
+		{name: "keyring", value: ref, expected: "keyring-secret"},
+		{name: "missing keyring secret", value: "keyring:missing", expectedError: `secret "missing" not found in keyring`},
+		{name: "invalid keyring secret name is a literal", value: "keyring:../secret", expected: "keyring:../secret"},
+		{name: "invalid env name is a literal", value: "env:p@ss", expected: "env:p@ss"},
+		{name: "relative file path is a literal", value: "file:secret", expected: "file:secret"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := resolveSecret(tc.value, cacheDir)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, v)
+		})
+	}
+}
+
+func TestOptionsResolveSecrets(t *testing.T) {
+	t.Setenv("KUBELOGIN_TEST_CLIENT_SECRET", "client-secret")
+	t.Setenv("KUBELOGIN_TEST_PASSWORD", "password")
+
+	o := Options{
+		AuthRecordCacheDir: t.TempDir(),
+		ClientSecret:       "env:KUBELOGIN_TEST_CLIENT_SECRET",
+		ClientCertPassword: "cert-password",
+		Password:           "env:KUBELOGIN_TEST_PASSWORD",
+	}
+	require.NoError(t, o.ResolveSecrets())
+	assert.Equal(t, "client-secret", o.ClientSecret)
+	assert.Equal(t, "cert-password", o.ClientCertPassword)
+	assert.Equal(t, "password", o.Password)
+
+	o.ClientSecret = "env:KUBELOGIN_TEST_MISSING"
+	assert.EqualError(t, o.ResolveSecrets(), `unable to resolve client secret: environment variable "KUBELOGIN_TEST_MISSING" is not set`)
+}
+
+func TestKeyringSecretName(t *testing.T) {
+	assert.Equal(t, "tenant.client.client-secret", KeyringSecretName("tenant", "client", "client-secret"))
+	assert.Equal(t, "tenant.user_contoso.com.password", KeyringSecretName("tenant", "user@contoso.com", "password"))
+	assert.Equal(t, ".._.secret", KeyringSecretName("../", "secret"))
+}
+
+func TestIsSecretRef(t *testing.T) {
+	assert.True(t, IsSecretRef("env:NAME"))
+	assert.True(t, IsSecretRef("file:"+filepath.Join(t.TempDir(), "secret")))
+	assert.True(t, IsSecretRef("keyring:name"))
+	assert.False(t, IsSecretRef("secret"))
+	assert.False(t, IsSecretRef(""))
+	// literal secrets starting with a prefix but not followed by a name or absolute path
+	assert.False(t, IsSecretRef("env:"))
+	assert.False(t, IsSecretRef("env:1NAME"))
+	assert.False(t, IsSecretRef("env:p@ss~word"))
+	assert.False(t, IsSecretRef("file:secret"))
+	assert.False(t, IsSecretRef("keyring:my secret"))
+}
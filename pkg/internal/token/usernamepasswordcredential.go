@@ -34,7 +34,7 @@ func newUsernamePasswordCredential(opts *Options, record azidentity.Authenticati
 		err error
 	)
 	if opts.UsePersistentCache {
-		c, err = newPersistentCache()
+		c, err = newAccountPersistentCache(opts)
 		if err != nil {
 			klog.V(5).Infof("failed to create cache: %v", err)
 		}
@@ -38,7 +38,7 @@ func newWorkloadIdentityCredential(opts *Options) (CredentialProvider, error) {
 		err error
 	)
 	if opts.UsePersistentCache {
-		c, err = newPersistentCache()
+		c, err = newPersistentCache(nil)
 		if err != nil {
 			klog.V(5).Infof("failed to create cache: %v", err)
 		}
@@ -0,0 +1,103 @@
+package whoami
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	tokenTypeBearer = "Bearer"
+	tokenTypePoP    = "PoP"
+)
+
+// Identity holds the claims of an access token that identify the caller to the cluster
+type Identity struct {
+	TokenType         string    `json:"tokenType"`
+	ObjectID          string    `json:"oid,omitempty"`
+	UserPrincipalName string    `json:"upn,omitempty"`
+	AppID             string    `json:"appid,omitempty"`
+	TenantID          string    `json:"tid,omitempty"`
+	Audience          []string  `json:"aud,omitempty"`
+	Groups            []string  `json:"groups,omitempty"`
+	GroupsOverage     bool      `json:"groupsOverage,omitempty"`
+	Roles             []string  `json:"roles,omitempty"`
+	AuthMethods       []string  `json:"amr,omitempty"`
+	ExpiresOn         time.Time `json:"expiresOn"`
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	ObjectID          string            `json:"oid"`
+	UPN               string            `json:"upn"`
+	PreferredUsername string            `json:"preferred_username"`
+	UniqueName        string            `json:"unique_name"`
+	AppID             string            `json:"appid"`
+	AuthorizedParty   string            `json:"azp"`
+	TenantID          string            `json:"tid"`
+	Groups            []string          `json:"groups"`
+	HasGroups         bool              `json:"hasgroups"`
+	ClaimNames        map[string]string `json:"_claim_names"`
+	Roles             []string          `json:"roles"`
+	AMR               []string          `json:"amr"`
+	// AccessToken and Confirmation are set in the outer token of a PoP token
+	AccessToken  string          `json:"at"`
+	Confirmation json.RawMessage `json:"cnf"`
+}
+
+// ParseIdentity decodes the access token without verifying its signature. PoP tokens
+// are unwrapped to the access token in their "at" claim.
+func ParseIdentity(accessToken string) (*Identity, error) {
+	claims, err := parseClaims(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenType := tokenTypeBearer
+	if claims.AccessToken != "" && len(claims.Confirmation) > 0 {
+		tokenType = tokenTypePoP
+		if claims, err = parseClaims(claims.AccessToken); err != nil {
+			return nil, fmt.Errorf("unable to parse the access token of the PoP token: %w", err)
+		}
+	}
+
+	identity := &Identity{
+		TokenType:         tokenType,
+		ObjectID:          claims.ObjectID,
+		UserPrincipalName: firstNonEmpty(claims.UPN, claims.PreferredUsername, claims.UniqueName),
+		AppID:             firstNonEmpty(claims.AppID, claims.AuthorizedParty),
+		TenantID:          claims.TenantID,
+		Audience:          claims.Audience,
+		Groups:            claims.Groups,
+		Roles:             claims.Roles,
+		AuthMethods:       claims.AMR,
+	}
+	// when a user is a member of too many groups, Azure AD omits the groups claim
+	// and points to the Microsoft Graph endpoint listing them instead
+	if _, ok := claims.ClaimNames["groups"]; ok || claims.HasGroups {
+		identity.GroupsOverage = true
+	}
+	if claims.ExpiresAt != nil {
+		identity.ExpiresOn = claims.ExpiresAt.Time
+	}
+	return identity, nil
+}
+
+func parseClaims(accessToken string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, claims); err != nil {
+		return nil, fmt.Errorf("unable to parse token: %w", err)
+	}
+	return claims, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
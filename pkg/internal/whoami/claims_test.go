@@ -0,0 +1,137 @@
+package whoami
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-key"))
+	require.NoError(t, err)
+	return s
+}
+
+func TestParseIdentity(t *testing.T) {
+	expiresOn := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	userToken := newTestToken(t, jwt.MapClaims{
+		"oid":    "object-id",
+		"upn":    "user@contoso.com",
+		"appid":  "app-id",
+		"tid":    "tenant-id",
+		"aud":    "6dae42f8-4368-4678-94ff-3960e28e3630",
+		"groups": []string{"group-1", "group-2"},
+		"amr":    []string{"pwd", "mfa"},
+		"exp":    expiresOn.Unix(),
+	})
+
+	testCases := []struct {
+		name          string
+		token         string
+		expected      *Identity
+		expectedError string
+	}{
+		{
+			name:  "user token",
+			token: userToken,
+			expected: &Identity{
+				TokenType:         tokenTypeBearer,
+				ObjectID:          "object-id",
+				UserPrincipalName: "user@contoso.com",
+				AppID:             "app-id",
+				TenantID:          "tenant-id",
+				Audience:          []string{"6dae42f8-4368-4678-94ff-3960e28e3630"},
+				Groups:            []string{"group-1", "group-2"},
+				AuthMethods:       []string{"pwd", "mfa"},
+				ExpiresOn:         expiresOn,
+			},
+		},
+		{
+			name: "v2 service principal token with group overage",
+			token: newTestToken(t, jwt.MapClaims{
+				"oid":          "object-id",
+				"azp":          "app-id",
+				"tid":          "tenant-id",
+				"aud":          []string{"aud-1", "aud-2"},
+				"roles":        []string{"role-1"},
+				"_claim_names": map[string]string{"groups": "src1"},
+				"exp":          expiresOn.Unix(),
+			}),
+			expected: &Identity{
+				TokenType:     tokenTypeBearer,
+				ObjectID:      "object-id",
+				AppID:         "app-id",
+				TenantID:      "tenant-id",
+				Audience:      []string{"aud-1", "aud-2"},
+				Roles:         []string{"role-1"},
+				GroupsOverage: true,
+				ExpiresOn:     expiresOn,
+			},
+		},
+		{
+			name: "preferred_username and hasgroups",
+			token: newTestToken(t, jwt.MapClaims{
+				"preferred_username": "user@contoso.com",
+				"hasgroups":          true,
+			}),
+			expected: &Identity{
+				TokenType:         tokenTypeBearer,
+				UserPrincipalName: "user@contoso.com",
+				GroupsOverage:     true,
+			},
+		},
+		{
+			name: "PoP token",
+			token: newTestToken(t, jwt.MapClaims{
+				"at":    userToken,
+				"ts":    time.Now().Unix(),
+				"u":     "cluster.example.com",
+				"cnf":   map[string]interface{}{"jwk": map[string]string{"kty": "RSA"}},
+				"nonce": "nonce",
+			}),
+			expected: &Identity{
+				TokenType:         tokenTypePoP,
+				ObjectID:          "object-id",
+				UserPrincipalName: "user@contoso.com",
+				AppID:             "app-id",
+				TenantID:          "tenant-id",
+				Audience:          []string{"6dae42f8-4368-4678-94ff-3960e28e3630"},
+				Groups:            []string{"group-1", "group-2"},
+				AuthMethods:       []string{"pwd", "mfa"},
+				ExpiresOn:         expiresOn,
+			},
+		},
+		{
+			name:          "invalid token",
+			token:         "not-a-jwt",
+			expectedError: "unable to parse token",
+		},
+		{
+			name: "PoP token with invalid access token",
+			token: newTestToken(t, jwt.MapClaims{
+				"at":  "not-a-jwt",
+				"cnf": map[string]interface{}{"jwk": map[string]string{"kty": "RSA"}},
+			}),
+			expectedError: "unable to parse the access token of the PoP token",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			identity, err := ParseIdentity(tc.token)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tc.expected.ExpiresOn.Equal(identity.ExpiresOn), "expected expiry %s, got %s", tc.expected.ExpiresOn, identity.ExpiresOn)
+			tc.expected.ExpiresOn = identity.ExpiresOn
+			assert.Equal(t, tc.expected, identity)
+		})
+	}
+}
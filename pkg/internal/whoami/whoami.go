@@ -0,0 +1,170 @@
+package whoami
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	klog "k8s.io/klog/v2"
+
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+const (
+	flagContext = "context"
+	flagOutput  = "output"
+
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+type Options struct {
+	configFlags genericclioptions.RESTClientGetter
+	// context is the kubeconfig context name
+	context string
+	output  string
+}
+
+func stringptr(str string) *string { return &str }
+
+func New() Options {
+	configFlags := &genericclioptions.ConfigFlags{
+		KubeConfig: stringptr(""),
+	}
+	return Options{configFlags: configFlags, output: outputTable}
+}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	if cf, ok := o.configFlags.(*genericclioptions.ConfigFlags); ok {
+		cf.AddFlags(fs)
+	}
+	fs.StringVar(&o.context, flagContext, "", "The name of the kubeconfig context to use. Defaults to the current context")
+	fs.StringVarP(&o.output, flagOutput, "o", o.output, fmt.Sprintf("Output format. One of: %s, %s", outputTable, outputJSON))
+}
+
+func (o *Options) Validate() error {
+	if o.output != outputTable && o.output != outputJSON {
+		return fmt.Errorf("unsupported output format: %q. Supported formats: %s, %s", o.output, outputTable, outputJSON)
+	}
+	return nil
+}
+
+// Run acquires a token with the kubelogin exec plugin of the kubeconfig context and
+// writes the identity it carries.
+func Run(ctx context.Context, o Options, w io.Writer) error {
+	tokenOptions, err := o.getTokenOptions()
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := token.GetAccessToken(ctx, tokenOptions)
+	if err != nil {
+		return err
+	}
+
+	identity, err := ParseIdentity(accessToken.Token)
+	if err != nil {
+		return err
+	}
+
+	if o.output == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(identity)
+	}
+	return writeTable(w, identity)
+}
+
+// getTokenOptions builds the get-token options from the exec plugin of the kubeconfig context
+func (o *Options) getTokenOptions() (*token.Options, error) {
+	config, err := o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load kubeconfig: %s", err)
+	}
+
+	contextName := o.context
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	kubeContext := config.Contexts[contextName]
+	if kubeContext == nil {
+		return nil, fmt.Errorf("no context exists with the name: %q", contextName)
+	}
+	authInfo := config.AuthInfos[kubeContext.AuthInfo]
+	if authInfo == nil || authInfo.Exec == nil || !strings.Contains(strings.ToLower(authInfo.Exec.Command), "kubelogin") {
+		return nil, fmt.Errorf("user %q of context %q does not use the kubelogin exec plugin", kubeContext.AuthInfo, contextName)
+	}
+	klog.V(5).Infof("using user %q of context %q", kubeContext.AuthInfo, contextName)
+
+	tokenOptions, err := token.NewOptionsFromExecArgs(authInfo.Exec.Args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse exec args of user %q: %w", kubeContext.AuthInfo, err)
+	}
+
+	// kubectl sets the exec env for the plugin process, this process is short-lived so do the same
+	for _, e := range authInfo.Exec.Env {
+		if err := os.Setenv(e.Name, e.Value); err != nil {
+			return nil, fmt.Errorf("unable to set exec env %s: %w", e.Name, err)
+		}
+	}
+	if err := tokenOptions.UpdateFromProfile(); err != nil {
+		return nil, err
+	}
+	tokenOptions.UpdateFromEnv()
+
+	if authInfo.Exec.ProvideClusterInfo {
+		clusterConfig, err := token.GetExecClusterConfig(config.Clusters[kubeContext.Cluster])
+		if err != nil {
+			return nil, err
+		}
+		tokenOptions.UpdateFromExecClusterConfig(clusterConfig)
+	}
+
+	if err := tokenOptions.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+	if err := tokenOptions.Validate(); err != nil {
+		return nil, err
+	}
+	return &tokenOptions, nil
+}
+
+func writeTable(w io.Writer, identity *Identity) error {
+	groups := strings.Join(identity.Groups, ", ")
+	if identity.GroupsOverage {
+		groups = "(overage: too many groups to include in the token, query Microsoft Graph instead)"
+	}
+	expiresOn := ""
+	if !identity.ExpiresOn.IsZero() {
+		expiresOn = fmt.Sprintf("%s (in %s)", identity.ExpiresOn.Local().Format(time.RFC3339), time.Until(identity.ExpiresOn).Round(time.Second))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range [][2]string{
+		{"Token type", identity.TokenType},
+		{"Object ID (oid)", identity.ObjectID},
+		{"User (upn)", identity.UserPrincipalName},
+		{"App ID (appid)", identity.AppID},
+		{"Tenant ID (tid)", identity.TenantID},
+		{"Audience (aud)", strings.Join(identity.Audience, ", ")},
+		{"Groups", groups},
+		{"Roles", strings.Join(identity.Roles, ", ")},
+		{"Auth methods (amr)", strings.Join(identity.AuthMethods, ", ")},
+		{"Expires on", expiresOn},
+	} {
+		if row[1] == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(tw, "%s:\t%s\n", row[0], row[1]); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,122 @@
+package whoami
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/Azure/kubelogin/pkg/internal/token"
+)
+
+func newTestOptions(config *clientcmdapi.Config, context string) Options {
+	return Options{
+		configFlags: genericclioptions.NewTestConfigFlags().
+			WithClientConfig(clientcmd.NewNonInteractiveClientConfig(*config, config.CurrentContext, &clientcmd.ConfigOverrides{}, nil)),
+		context: context,
+		output:  outputTable,
+	}
+}
+
+func newTestConfig() *clientcmdapi.Config {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["aks"] = &clientcmdapi.Cluster{Server: "https://aks.example.com"}
+	config.AuthInfos["spn"] = &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			Command: "kubelogin",
+			Args: []string{
+				"get-token",
+				"--login", "spn",
+				"--server-id", "server-id",
+				"--client-id", "client-id",
+				"--tenant-id", "tenant-id",
+				"--client-secret", "env:KUBELOGIN_TEST_WHOAMI_SECRET",
+				"--some-future-flag", "value",
+			},
+			Env: []clientcmdapi.ExecEnvVar{{Name: "KUBELOGIN_TEST_WHOAMI_SECRET", Value: "secret"}},
+		},
+	}
+	config.AuthInfos["token"] = &clientcmdapi.AuthInfo{Token: "token"}
+	config.Contexts["aks-spn"] = &clientcmdapi.Context{Cluster: "aks", AuthInfo: "spn"}
+	config.Contexts["aks-token"] = &clientcmdapi.Context{Cluster: "aks", AuthInfo: "token"}
+	config.CurrentContext = "aks-spn"
+	return config
+}
+
+func TestGetTokenOptions(t *testing.T) {
+	// getTokenOptions sets the exec env in the process, restore it after the test
+	t.Setenv("KUBELOGIN_TEST_WHOAMI_SECRET", "")
+
+	t.Run("current context", func(t *testing.T) {
+		o := newTestOptions(newTestConfig(), "")
+		tokenOptions, err := o.getTokenOptions()
+		require.NoError(t, err)
+		assert.Equal(t, token.ServicePrincipalLogin, tokenOptions.LoginMethod)
+		assert.Equal(t, "server-id", tokenOptions.ServerID)
+		assert.Equal(t, "client-id", tokenOptions.ClientID)
+		assert.Equal(t, "tenant-id", tokenOptions.TenantID)
+		assert.Equal(t, "secret", tokenOptions.ClientSecret)
+	})
+
+	t.Run("cluster info", func(t *testing.T) {
+		config := newTestConfig()
+		config.AuthInfos["spn"].Exec.ProvideClusterInfo = true
+		config.Clusters["aks"].Extensions = map[string]runtime.Object{
+			token.ExecClusterExtensionName: &runtime.Unknown{Raw: []byte(`{"server-id":"cluster-server-id"}`)},
+		}
+		o := newTestOptions(config, "aks-spn")
+		tokenOptions, err := o.getTokenOptions()
+		require.NoError(t, err)
+		assert.Equal(t, "cluster-server-id", tokenOptions.ServerID)
+	})
+
+	t.Run("unknown context", func(t *testing.T) {
+		o := newTestOptions(newTestConfig(), "missing")
+		_, err := o.getTokenOptions()
+		assert.EqualError(t, err, `no context exists with the name: "missing"`)
+	})
+
+	t.Run("context without kubelogin", func(t *testing.T) {
+		o := newTestOptions(newTestConfig(), "aks-token")
+		_, err := o.getTokenOptions()
+		assert.EqualError(t, err, `user "token" of context "aks-token" does not use the kubelogin exec plugin`)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	o := New()
+	assert.NoError(t, o.Validate())
+	o.output = outputJSON
+	assert.NoError(t, o.Validate())
+	o.output = "yaml"
+	assert.EqualError(t, o.Validate(), `unsupported output format: "yaml". Supported formats: table, json`)
+}
+
+func TestWriteTable(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeTable(&buf, &Identity{
+		TokenType:         tokenTypePoP,
+		ObjectID:          "object-id",
+		UserPrincipalName: "user@contoso.com",
+		TenantID:          "tenant-id",
+		Audience:          []string{"aud"},
+		Groups:            []string{"group-1", "group-2"},
+		GroupsOverage:     true,
+		ExpiresOn:         time.Now().Add(time.Hour),
+	}))
+
+	out := buf.String()
+	assert.Contains(t, out, "Token type:")
+	assert.Contains(t, out, "PoP")
+	assert.Contains(t, out, "user@contoso.com")
+	assert.Contains(t, out, "overage")
+	assert.NotContains(t, out, "group-1")
+	assert.NotContains(t, out, "App ID")
+	assert.Contains(t, out, "Expires on:")
+}